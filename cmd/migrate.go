@@ -6,10 +6,11 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"alielgamal.com/myservice/internal/config"
 	internalDB "alielgamal.com/myservice/internal/db"
 )
 
-func migrateCmd(db *internalDB.SQLDB) *cobra.Command {
+func migrateCmd(db *internalDB.SQLDB, dbConfig config.DBConfig) *cobra.Command {
 	result := &cobra.Command{
 		Use:   "migrate [version]",
 		Short: "Run migrations on the database",
@@ -31,7 +32,7 @@ func migrateCmd(db *internalDB.SQLDB) *cobra.Command {
 			switch len(args) {
 			case 0:
 				log.Println("Running all pending DB migrations...")
-				version, err = internalDB.UpgradeDB(db.DB)
+				version, err = internalDB.UpgradeDB(db, internalDB.WithBackfillTenant(dbConfig.BackfillTenant()))
 			default:
 				var targetVersion int
 				targetVersion, err = strconv.Atoi(args[0])
@@ -39,10 +40,10 @@ func migrateCmd(db *internalDB.SQLDB) *cobra.Command {
 					if force {
 						log.Printf("Migrating DB to version %v...\n", targetVersion)
 						version = uint(targetVersion)
-						err = internalDB.Force(db.DB, targetVersion)
+						err = internalDB.Force(db, targetVersion)
 					} else {
 						log.Printf("Migrating DB to version %v...\n", targetVersion)
-						version, err = internalDB.MigrateDBTo(db.DB, uint(targetVersion))
+						version, err = internalDB.MigrateDBTo(db, uint(targetVersion), internalDB.WithBackfillTenant(dbConfig.BackfillTenant()))
 					}
 				}
 			}
@@ -30,7 +30,17 @@ func ExecuteCommand(ctx context.Context, appConfig config.Config, db *internalDB
 		logger.Error(err, "Error while setting logger")
 	}
 
-	if db == nil {
+	if db == nil && appConfig.DBConfig.Driver() == internalDB.SQLiteDriver {
+		logger.Info("Opening SQLite db...", "URL", appConfig.DBConfig.GetURL())
+		sqlDB, err := otelsql.Open(internalDB.SQLiteDriver, appConfig.DBConfig.DataSourceName(), otelsql.WithAttributes(
+			semconv.DBSystemSqlite))
+		if err != nil {
+			logger.Error(err, "Error while opening DB")
+			return err
+		}
+		db = &internalDB.SQLDB{DB: sqlDB, Driver: internalDB.SQLiteDriver}
+		defer db.DB.Close()
+	} else if db == nil {
 		// Get a database driver.Connector for a fixed configuration.
 		logger.Info("Connecting to db...", "URL", appConfig.DBConfig.GetURL())
 		var connector driver.Connector
@@ -47,6 +57,7 @@ func ExecuteCommand(ctx context.Context, appConfig config.Config, db *internalDB
 		db = &internalDB.SQLDB{
 			DB: otelsql.OpenDB(connector, otelsql.WithAttributes(
 				semconv.DBSystemPostgreSQL)),
+			Driver: internalDB.PostgresDriver,
 		}
 		defer db.DB.Close()
 	}
@@ -58,8 +69,9 @@ func ExecuteCommand(ctx context.Context, appConfig config.Config, db *internalDB
 	}
 
 	rootCmd.AddCommand(startCmd(logger, db, appConfig))
-	rootCmd.AddCommand(migrateCmd(db))
+	rootCmd.AddCommand(migrateCmd(db, appConfig.DBConfig))
 	rootCmd.AddCommand(versionCmd(db))
+	rootCmd.AddCommand(storedCmd())
 
 	if len(args) > 0 {
 		rootCmd.SetArgs(args)
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 
+	"alielgamal.com/myservice/internal"
 	"alielgamal.com/myservice/internal/app"
 	"alielgamal.com/myservice/internal/auth"
 	"alielgamal.com/myservice/internal/aws"
@@ -20,33 +22,65 @@ import (
 	internalDB "alielgamal.com/myservice/internal/db"
 	"alielgamal.com/myservice/internal/google"
 	"alielgamal.com/myservice/internal/health"
+	"alielgamal.com/myservice/internal/outbox"
+	"alielgamal.com/myservice/internal/resource"
+	"alielgamal.com/myservice/internal/stored"
 	"alielgamal.com/myservice/internal/telemetry"
 )
 
+// inMemoryFlag the flag of the start command that keeps the data in memory instead of the DB
+const inMemoryFlag = "in-memory"
+
+// noDB the DB of the health routes when the service runs without a DB
+type noDB struct{}
+
+func (noDB) PingContext(context.Context) error {
+	return nil
+}
+
 func startCmd(logger logr.Logger, db *internalDB.SQLDB, appConfig config.Config) *cobra.Command {
 
-	return &cobra.Command{
+	result := &cobra.Command{
 		Use:     "start",
 		Aliases: []string{"up"},
 		Short:   "Start the service",
 		Run: func(cmd *cobra.Command, _ []string) {
-			logger.Info("Running any pending DB migrations...")
-			dbVersion, err := internalDB.UpgradeDB(db.DB)
+			inMemory, err := cmd.Flags().GetBool(inMemoryFlag)
 			if err != nil {
-				logger.Error(err, "Error while upgrading DB")
+				logger.Error(err, "Invalid in-memory flag")
 				panic(err)
 			}
-			logger.Info("Migrations done", "DBVersion", dbVersion)
+
+			var healthDB health.Pinger = db
+			var dbVersion uint
+			if inMemory {
+				logger.Info("Keeping data in memory, the DB is not used")
+				healthDB = noDB{}
+			} else {
+				logger.Info("Running any pending DB migrations...")
+				dbVersion, err = internalDB.UpgradeDB(db, internalDB.WithBackfillTenant(appConfig.DBConfig.BackfillTenant()))
+				if err != nil {
+					logger.Error(err, "Error while upgrading DB")
+					panic(err)
+				}
+				logger.Info("Migrations done", "DBVersion", dbVersion)
+			}
 
 			logger.Info("Initializing service...")
 			telemetryShutdownFunc, err := telemetry.SetupMonitoring(cmd.Context(), appConfig.TelemetryConfig)
 			if err != nil {
 				logger.Error(err, "failed to set up OpenTelemetry monitoring")
 			}
-			if _, err = otelsql.RegisterDBStatsMetrics(db.DB, otelsql.WithAttributes(
-				semconv.DBSystemPostgreSQL,
-			)); err != nil {
-				logger.Error(err, "failed to register otelsql metrics")
+			if !inMemory {
+				dbSystem := semconv.DBSystemPostgreSQL
+				if internalDB.DriverOf(db) == internalDB.SQLiteDriver {
+					dbSystem = semconv.DBSystemSqlite
+				}
+				if _, err = otelsql.RegisterDBStatsMetrics(db.DB, otelsql.WithAttributes(
+					dbSystem,
+				)); err != nil {
+					logger.Error(err, "failed to register otelsql metrics")
+				}
 			}
 
 			router := gin.New()
@@ -55,9 +89,11 @@ func startCmd(logger logr.Logger, db *internalDB.SQLDB, appConfig config.Config)
 				corsConfig := cors.DefaultConfig()
 				corsConfig.AllowOrigins = origins
 				corsConfig.AllowCredentials = true
+				corsConfig.AddAllowHeaders(resource.IfMatchHeader)
+				corsConfig.AddExposeHeaders(resource.ETagHeader)
 				router.Use(cors.New(corsConfig))
 			}
-			health.SetupRoutes(router, db, dbVersion)
+			health.SetupRoutes(router, healthDB, dbVersion)
 
 			internalRouter := router.Group("/internal")
 			var authProvider auth.Provider
@@ -68,13 +104,60 @@ func startCmd(logger logr.Logger, db *internalDB.SQLDB, appConfig config.Config)
 			}
 			if authProvider != nil {
 				internalRouter.Use(authProvider.Middleware(logger))
+			} else {
+				// Without authentication there are no users to tell apart, so all requests share the local tenant
+				logger.Info("No authentication is configured, so all internal requests belong to the local tenant")
+				internalRouter.Use(func(c *gin.Context) {
+					c.Set(internal.TenantContextKey, internal.LocalTenant)
+					c.Next()
+				})
+			}
+			health.SetupRoutes(internalRouter, healthDB, dbVersion)
+			// registry the stores whose tables are checked below and whose expired items are reaped
+			registry := stored.NewRegistry()
+			if inMemory {
+				app.SetupMemoryRoutes(internalRouter, logger)
+			} else {
+				bypasses, err := internalDB.BypassesRowSecurity(cmd.Context(), db)
+				if err != nil {
+					logger.Error(err, "Error while checking the row-level security of the DB role")
+					panic(err)
+				}
+				if bypasses && authProvider != nil {
+					err = errors.New("the DB role bypasses row-level security, connect as a role that is neither a superuser nor has BYPASSRLS")
+					logger.Error(err, "Tenants can't be isolated")
+					panic(err)
+				} else if bypasses {
+					// All requests belong to the local tenant, so there are no tenants to isolate
+					logger.Info("The DB role bypasses row-level security, which is only safe without authentication")
+				}
+				app.SetupRoutes(cmd.Context(), internalRouter, logger, db, listenerFor(db, appConfig.DBConfig.GetURL()), appConfig.CacheConfig, registry)
+				if err := registry.Check(cmd.Context()); err != nil {
+					logger.Error(err, "The tables of the stores don't match their options")
+					panic(err)
+				}
 			}
-			health.SetupRoutes(internalRouter, db, dbVersion)
-			app.SetupRoutes(internalRouter, logger, db)
 			internalRouter.Static("portal", appConfig.ServerConfig.PortalPath())
 
+			if appConfig.OutboxConfig.RelayEnabled() && inMemory {
+				logger.Info("Outbox relay is not started since there is no outbox table in memory")
+			} else if appConfig.OutboxConfig.RelayEnabled() {
+				var sink outbox.Sink = outbox.LogSink{Logger: logger.WithName("outbox.sink")}
+				if url := appConfig.OutboxConfig.WebhookURL(); url != "" {
+					sink = outbox.WebhookSink{URL: url}
+				}
+				relay := outbox.NewRelay(db, logger, time.Duration(appConfig.OutboxConfig.PollIntervalSeconds())*time.Second,
+					appConfig.OutboxConfig.MaxAttempts(), sink)
+				go relay.Run(cmd.Context())
+			}
+
+			if appConfig.ReaperConfig.Enabled() {
+				reaper := stored.NewReaper(logger, registry, time.Duration(appConfig.ReaperConfig.IntervalSeconds())*time.Second, appConfig.ReaperConfig.BatchSize())
+				go reaper.Run(cmd.Context())
+			}
+
 			externalRouter := router.Group("/external")
-			health.SetupRoutes(externalRouter, db, dbVersion)
+			health.SetupRoutes(externalRouter, healthDB, dbVersion)
 
 			server := &http.Server{
 				Addr:    appConfig.ServerConfig.GetHTTPAddress(),
@@ -101,4 +184,18 @@ func startCmd(logger logr.Logger, db *internalDB.SQLDB, appConfig config.Config)
 			logger.Info("Shutting down completed!")
 		},
 	}
+
+	result.Flags().Bool(inMemoryFlag, false, "Keep the data in memory instead of the DB, which loses it on shutdown")
+	return result
+}
+
+// listenerFor returns the function that creates the listeners of the stores of the DB, which is nil for DBs that can't
+// notify listeners (see stored.WithListener)
+func listenerFor(db *internalDB.SQLDB, url string) func() internalDB.Listener {
+	if internalDB.DriverOf(db) == internalDB.SQLiteDriver {
+		return nil
+	}
+	return func() internalDB.Listener {
+		return internalDB.NewPQListener(url)
+	}
 }
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	internalDB "alielgamal.com/myservice/internal/db"
+)
+
+func TestListenerFor(t *testing.T) {
+	url := "postgres://localhost/test"
+
+	t.Run("Listens to Postgres DBs", func(t *testing.T) {
+		assert.NotNil(t, listenerFor(&internalDB.SQLDB{}, url), "DBs without a driver are Postgres DBs")
+		assert.NotNil(t, listenerFor(&internalDB.SQLDB{Driver: internalDB.PostgresDriver}, url))
+	})
+
+	t.Run("Doesn't listen to SQLite DBs", func(t *testing.T) {
+		assert.Nil(t, listenerFor(&internalDB.SQLDB{Driver: internalDB.SQLiteDriver}, url))
+	})
+}
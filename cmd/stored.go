@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"alielgamal.com/myservice/internal/stored"
+)
+
+// migrationsDir the directory of the Postgres migrations, relative to the root of the repository. The SQLite
+// migrations are in its sqlite directory.
+const migrationsDir = "internal/db/migrations"
+
+// migrationFilePattern the names of migration files, which start with their version
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_.*\.(up|down)\.sql$`)
+
+func storedCmd() *cobra.Command {
+	result := &cobra.Command{
+		Use:   "stored",
+		Short: "Manage the tables of stored entities",
+	}
+	result.AddCommand(scaffoldCmd())
+	return result
+}
+
+func scaffoldCmd() *cobra.Command {
+	result := &cobra.Command{
+		Use:   "scaffold <name>",
+		Short: "Generate the migrations that create the table of a new stored entity",
+		Long: "Generate the next numbered Postgres and SQLite migrations that create the table of a new stored entity, " +
+			"with the columns, indexes and triggers required by the options of its store",
+		Args: cobra.ExactArgs(1),
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			flags := cmd.Flags()
+			dir, _ := flags.GetString("dir")
+			schema := stored.TableSchema{}
+			schema.SoftDelete, _ = flags.GetBool("soft-delete")
+			schema.History, _ = flags.GetBool("history")
+			schema.Watch, _ = flags.GetBool("watch")
+			schema.Tenancy, _ = flags.GetBool("tenancy")
+			schema.Expiry, _ = flags.GetBool("expiry")
+			schema.SearchAttributes, _ = flags.GetStringSlice("search")
+
+			files, err := scaffoldMigrations(dir, args[0], schema)
+			if err != nil {
+				return err
+			}
+			for _, f := range files {
+				fmt.Fprintf(cmd.OutOrStdout(), "Created %v\n", f)
+			}
+			return nil
+		},
+	}
+
+	result.Flags().String("dir", migrationsDir, "The directory of the Postgres migrations")
+	result.Flags().Bool("soft-delete", false, "Add the columns of stores in soft-delete mode")
+	result.Flags().Bool("history", false, "Add the history table")
+	result.Flags().Bool("watch", false, "Add the trigger that notifies the listeners of the table")
+	result.Flags().Bool("tenancy", false, "Add the tenant column and the row-level security policies")
+	result.Flags().Bool("expiry", false, "Add the expiry column and, with --tenancy, the reap policy")
+	result.Flags().StringSlice("search", nil, "The top-level attributes of the content that are searchable")
+	return result
+}
+
+// scaffoldMigrations writes the migrations that create the table in the directory of the Postgres migrations and its
+// sqlite directory, numbered after the latest migration of both. It returns the names of the written files, and writes
+// none if it fails.
+func scaffoldMigrations(dir string, table string, schema stored.TableSchema) ([]string, error) {
+	postgres, sqlite, err := stored.Scaffold(table, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	sqliteDir := filepath.Join(dir, "sqlite")
+	version := uint64(0)
+	for _, d := range []string{dir, sqliteDir} {
+		latest, err := latestMigration(d)
+		if err != nil {
+			return nil, err
+		}
+		version = max(version, latest)
+	}
+
+	name := fmt.Sprintf("%06d_create_%v_table", version+1, table)
+	return writeNewFiles([]newFile{
+		{filepath.Join(dir, name+".up.sql"), postgres.Up},
+		{filepath.Join(dir, name+".down.sql"), postgres.Down},
+		{filepath.Join(sqliteDir, name+".up.sql"), sqlite.Up},
+		{filepath.Join(sqliteDir, name+".down.sql"), sqlite.Down},
+	})
+}
+
+// latestMigration returns the version of the latest migration in the directory, which is 0 if there is none
+func latestMigration(dir string) (uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	latest := uint64(0)
+	for _, e := range entries {
+		m := migrationFilePattern.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		latest = max(latest, version)
+	}
+	return latest, nil
+}
+
+// newFile a file written by writeNewFiles
+type newFile struct {
+	name    string
+	content string
+}
+
+// writeNewFiles writes files that must not exist, and returns their names. If writing any of them fails, the files
+// written before are removed so that a partial set of migrations is never left behind.
+func writeNewFiles(files []newFile) ([]string, error) {
+	written := make([]string, 0, len(files))
+	for _, f := range files {
+		if err := writeNewFile(f.name, f.content); err != nil {
+			for _, name := range written {
+				err = errors.Join(err, os.Remove(name))
+			}
+			return nil, err
+		}
+		written = append(written, f.name)
+	}
+	return written, nil
+}
+
+// writeNewFile writes the content to a file that must not exist, removing the file if the content can't be written
+func writeNewFile(name string, content string) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(content)
+	err = errors.Join(err, f.Close())
+	if err != nil {
+		return errors.Join(err, os.Remove(name))
+	}
+	return nil
+}
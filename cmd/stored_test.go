@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScaffoldCmd(t *testing.T) {
+	prepareDir := func(t *testing.T) string {
+		dir := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "sqlite"), 0o755))
+		for _, f := range []string{"000001_a.up.sql", "000001_a.down.sql", "000007_b.up.sql", "000007_b.down.sql", "README.md"} {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, f), nil, 0o644))
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "sqlite", "000008_c.up.sql"), nil, 0o644))
+		return dir
+	}
+
+	t.Run("Writes the next numbered migrations", func(t *testing.T) {
+		dir := prepareDir(t)
+		cmd := scaffoldCmd()
+		var buffer bytes.Buffer
+		cmd.SetOutput(&buffer)
+		cmd.SetArgs([]string{"widget", "--dir", dir, "--soft-delete", "--search", "name,note"})
+		require.NoError(t, cmd.ExecuteContext(context.Background()))
+
+		for _, f := range []string{"000009_create_widget_table.up.sql", "000009_create_widget_table.down.sql",
+			"sqlite/000009_create_widget_table.up.sql", "sqlite/000009_create_widget_table.down.sql"} {
+			assert.FileExists(t, filepath.Join(dir, f))
+			assert.Contains(t, buffer.String(), filepath.Join(dir, f))
+		}
+		up, err := os.ReadFile(filepath.Join(dir, "000009_create_widget_table.up.sql"))
+		require.NoError(t, err)
+		assert.Contains(t, string(up), "CREATE TABLE widget (")
+		assert.Contains(t, string(up), "deleted_at TIMESTAMP NULL")
+		assert.Contains(t, string(up), "content->>'note'")
+		assert.Contains(t, string(up), "EXECUTE PROCEDURE update_modified_at()")
+		assert.NotContains(t, string(up), "widget_history")
+	})
+
+	t.Run("Removes the written migrations when writing one fails", func(t *testing.T) {
+		dir := t.TempDir()
+		existing := filepath.Join(dir, "c.sql")
+		require.NoError(t, os.WriteFile(existing, []byte("kept"), 0o644))
+
+		written, err := writeNewFiles([]newFile{
+			{filepath.Join(dir, "a.sql"), "a"},
+			{filepath.Join(dir, "b.sql"), "b"},
+			{existing, "c"},
+		})
+		assert.ErrorIs(t, err, os.ErrExist)
+		assert.Empty(t, written)
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "c.sql", entries[0].Name())
+		content, err := os.ReadFile(existing)
+		require.NoError(t, err)
+		assert.Equal(t, "kept", string(content), "the existing file is not overwritten")
+	})
+
+	t.Run("Fails when", func(t *testing.T) {
+		tests := []struct {
+			name string
+			args []string
+		}{
+			{"the name is invalid", []string{"Widget"}},
+			{"the name is missing", []string{}},
+			{"the directory doesn't exist", []string{"widget", "--dir", "missing"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				dir := prepareDir(t)
+				cmd := scaffoldCmd()
+				cmd.SetOutput(&bytes.Buffer{})
+				cmd.SetArgs(append([]string{"--dir", dir}, tt.args...))
+				assert.Error(t, cmd.ExecuteContext(context.Background()))
+
+				entries, err := os.ReadDir(dir)
+				require.NoError(t, err)
+				assert.Len(t, entries, 6, "no migration is written")
+			})
+		}
+	})
+}
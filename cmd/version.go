@@ -15,7 +15,7 @@ func versionCmd(db *internalDB.SQLDB) *cobra.Command {
 		Short: "Print the version of the service",
 		Run: func(cmd *cobra.Command, _ []string) {
 			out := cmd.OutOrStdout()
-			dbVersion, dirty, err := internalDB.Version(db.DB)
+			dbVersion, dirty, err := internalDB.Version(db)
 			fmt.Fprintf(out, "DB Version: %v\n", dbVersion)
 			fmt.Fprintf(out, "DB Dirty: %v\n", dirty)
 			fmt.Fprintf(out, "DB Error: %v\n", err)
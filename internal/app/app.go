@@ -13,9 +13,15 @@ const disabledJSONKey = "disabled"
 
 // App represents an application entity
 type App struct {
-	// APIKey The API key for the app
-	APIKey string `json:"apiKey"`
+	// APIKey The API key for the app. It can only be changed by resetting it, and it is left out of outbox events.
+	APIKey string `json:"apiKey" stored:"readonly,secret"`
 
 	// Disabled Whether the app is disabled
 	Disabled bool `json:"disabled"`
+
+	// Name The display name of the app. It is searchable.
+	Name string `json:"name,omitempty"`
+
+	// Description What the app is used for. It is searchable.
+	Description string `json:"description,omitempty"`
 }
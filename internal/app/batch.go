@@ -0,0 +1,98 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"alielgamal.com/myservice/internal"
+	"alielgamal.com/myservice/internal/resource"
+	"alielgamal.com/myservice/internal/response"
+	"alielgamal.com/myservice/internal/stored"
+)
+
+// methodParamName the param that captures custom methods like apps:batch. Gin doesn't support static routes that
+// contain a colon, so custom methods are routed using a wildcard that captures the colon and the method name.
+const methodParamName = "method"
+
+const batchMethod = ":batch"
+
+// maxBatchSize the maximum number of apps that can be added or patched by a single batch request
+const maxBatchSize = 1000
+
+// batchRequest the body of a batch request. Exactly one of Add and Patch must be set.
+type batchRequest struct {
+	// Atomic whether nothing should be written if any item fails. Otherwise, each item reports its own error.
+	Atomic bool `json:"atomic"`
+
+	// Add the apps to add. Missing ids are generated.
+	Add []stored.Stored[App] `json:"add"`
+
+	// Patch the patches to apply to existing apps
+	Patch []stored.ItemPatch `json:"patch" binding:"dive"`
+}
+
+// batchResult the result of a single item of a batch request
+type batchResult struct {
+	Item  *stored.Stored[App]   `json:"item,omitempty"`
+	Error *response.ErrorDetail `json:"error,omitempty"`
+}
+
+func (h *handler) customMethod(c *gin.Context) {
+	switch c.Param(methodParamName) {
+	case batchMethod:
+		h.batchApps(c)
+	default:
+		resource.WriteError(c, http.StatusNotFound, fmt.Errorf("unknown method: %v", c.Param(methodParamName)))
+	}
+}
+
+func (h *handler) batchApps(c *gin.Context) {
+	ctx, span := tracer.Start(resource.Context(c), "handler.batchApps")
+	defer span.End()
+
+	req := batchRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		h.resource.Fail(c, fmt.Errorf("%w: %w", resource.ErrInvalidRequest, err), "")
+		return
+	}
+	if (len(req.Add) == 0) == (len(req.Patch) == 0) || len(req.Add) > maxBatchSize || len(req.Patch) > maxBatchSize {
+		resource.WriteError(c, http.StatusBadRequest, fmt.Errorf("a batch must either add or patch between 1 and %v apps", maxBatchSize))
+		return
+	}
+
+	mode := stored.PerItem
+	if req.Atomic {
+		mode = stored.AllOrNothing
+	}
+
+	var results []stored.BatchResult[App]
+	var err error
+	if len(req.Add) > 0 {
+		for i := range req.Add {
+			if req.Add[i].ID == "" {
+				req.Add[i].ID = uuid.NewString()
+			}
+			resourceConfig.Defaults(c, &req.Add[i])
+		}
+		results, err = h.db.AddMany(ctx, internal.UserFromGinContext(c), req.Add, mode)
+	} else {
+		results, err = h.db.PatchMany(ctx, internal.UserFromGinContext(c), req.Patch, mode)
+	}
+	if err != nil {
+		h.resource.Fail(c, err, "")
+		return
+	}
+
+	body := make([]batchResult, 0, len(results))
+	for _, r := range results {
+		if r.Err != nil {
+			body = append(body, batchResult{Error: &response.ErrorDetail{Code: resource.Status(r.Err), Msg: r.Err.Error()}})
+			continue
+		}
+		body = append(body, batchResult{Item: r.Item})
+	}
+	c.JSON(http.StatusOK, body)
+}
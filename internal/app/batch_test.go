@@ -0,0 +1,125 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"alielgamal.com/myservice/internal/stored"
+	storedTest "alielgamal.com/myservice/internal/stored/test"
+)
+
+func TestBatchApps(t *testing.T) {
+	post := func(r *gin.Engine, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/"+RouteRelativePath+batchMethod, bytes.NewBufferString(body))
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Adds apps atomically with generated keys", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		added := []stored.BatchResult[App]{
+			{Item: &stored.Stored[App]{ID: "a", Content: App{APIKey: "key-a"}}},
+			{Item: &stored.Stored[App]{ID: "b", Content: App{APIKey: "key-b"}}},
+		}
+		mockStore.On("AddMany", mock.Anything, mock.Anything, mock.MatchedBy(func(items []stored.Stored[App]) bool {
+			return len(items) == 2 && items[0].ID == "a" && items[1].ID == "b" &&
+				items[0].Content.APIKey != "" && !items[1].Content.Disabled
+		}), stored.AllOrNothing).Return(added, nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := post(r, `{"atomic":true,"add":[{"id":"a"},{"id":"b","content":{"disabled":true}}]}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var body []batchResult
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Len(t, body, 2)
+		assert.Equal(t, "a", body[0].Item.ID)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("Reports the result of each patch", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		patches := []stored.ItemPatch{
+			{ID: "a", Attributes: map[string]any{disabledJSONKey: true}},
+			{ID: "missing", Attributes: map[string]any{disabledJSONKey: true}},
+		}
+		results := []stored.BatchResult[App]{
+			{Item: &stored.Stored[App]{ID: "a", Version: 2, Content: App{Disabled: true}}},
+			{Err: stored.ErrNotFound},
+		}
+		mockStore.On("PatchMany", mock.Anything, mock.Anything, patches, stored.PerItem).Return(results, nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := post(r, `{"patch":[{"id":"a","attributes":{"disabled":true}},{"id":"missing","attributes":{"disabled":true}}]}`)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var body []batchResult
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Len(t, body, 2)
+		assert.Equal(t, int64(2), body[0].Item.Version)
+		assert.Nil(t, body[0].Error)
+		assert.Nil(t, body[1].Item)
+		assert.Equal(t, http.StatusNotFound, body[1].Error.Code)
+	})
+
+	t.Run("Fails the whole atomic batch", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("AddMany", mock.Anything, mock.Anything, mock.Anything, stored.AllOrNothing).
+			Return([]stored.BatchResult[App](nil), fmt.Errorf("%w: duplicate id", stored.ErrAlreadyExists))
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := post(r, `{"atomic":true,"add":[{"id":"a"},{"id":"a"}]}`)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Rejects batches that both add and patch", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := post(r, `{"add":[{"id":"a"}],"patch":[{"id":"b","attributes":{}}]}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Rejects empty batches", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := post(r, `{"atomic":true}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Returns 404 for unknown methods", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/"+RouteRelativePath+":unknown", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -1,207 +1,151 @@
 package app
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-logr/logr"
 	"github.com/google/uuid"
-	"github.com/lib/pq"
 
 	"alielgamal.com/myservice/internal"
+	"alielgamal.com/myservice/internal/config"
 	"alielgamal.com/myservice/internal/db"
-	"alielgamal.com/myservice/internal/response"
+	"alielgamal.com/myservice/internal/outbox"
+	"alielgamal.com/myservice/internal/resource"
 	"alielgamal.com/myservice/internal/stored"
 )
 
 // RouteRelativePath the relative path that handlers will be registered under
 const RouteRelativePath = "apps"
 
-const idParamName = "id"
-
-// SetupRoutes adds app routes handling
-func SetupRoutes(routes gin.IRoutes, logger logr.Logger, db db.DB) {
-	setupRoutes(routes, logger, stored.NewStore[App](db, appTableName))
+// apiKeyResetEventType the type of the outbox event published when the API key of an app is reset
+const apiKeyResetEventType = "app.api_key_reset"
+
+// resourceConfig the configuration of the routes that create, get, patch, list and delete apps. New apps get a
+// generated API key and start enabled, and apps can be listed by whether they are disabled.
+var resourceConfig = resource.Config[App]{
+	Name: appTableName,
+	Defaults: func(_ *gin.Context, item *stored.Stored[App]) {
+		item.Content.APIKey = uuid.NewString()
+		item.Content.Disabled = false
+	},
+	Filters: []string{disabledJSONKey},
+	Sorts: map[string]stored.Sort{
+		"id":            {Column: stored.IDColumn},
+		"createdAt":     {Column: stored.CreatedAtColumn},
+		"modifiedAt":    {Column: stored.ModifiedAtColumn},
+		disabledJSONKey: {Attribute: disabledJSONKey},
+	},
 }
 
-func setupRoutes(routes gin.IRoutes, logger logr.Logger, db stored.Store[App]) {
-	h := handler{
-		logger: logger.WithName("app.handler"),
-		db:     db,
+// SetupRoutes adds app routes handling. Apps are read through a cache if it is enabled, which drops the apps written by
+// other replicas by watching the app table using listeners created by newListener until ctx is done. The store of apps is
+// added to the registry to have its table checked at startup (see stored.Registry).
+func SetupRoutes(ctx context.Context, routes gin.IRoutes, logger logr.Logger, db db.DB, newListener func() db.Listener, cacheConfig config.CacheConfig, registry *stored.Registry) {
+	var store stored.Store[App] = stored.NewStore[App](db, appTableName, append(storeOptions(), stored.WithListener(newListener))...)
+	stored.Register(registry, appTableName, store)
+	if cacheConfig.Enabled() {
+		store = stored.NewCachedStore(ctx, appTableName, store,
+			stored.WithCacheSize(cacheConfig.Size()),
+			stored.WithCacheTTL(time.Duration(cacheConfig.TTLSeconds())*time.Second))
 	}
-
-	routes.POST(RouteRelativePath, h.addApp)
-	routes.GET(RouteRelativePath+"/:"+idParamName, h.getApp)
-	routes.PATCH(RouteRelativePath+"/:"+idParamName, h.patchApp)
-	routes.GET(RouteRelativePath, h.listApps)
-	routes.POST(RouteRelativePath+"/:"+idParamName+"/api-key", h.resetAPIKey)
+	setupRoutes(routes, logger, store)
 }
 
-type handler struct {
-	logger logr.Logger
-	db     stored.Store[App]
+// SetupMemoryRoutes adds app routes handling backed by a store that keeps the apps in memory
+func SetupMemoryRoutes(routes gin.IRoutes, logger logr.Logger) {
+	setupRoutes(routes, logger, stored.NewMemoryStore[App](appTableName, storeOptions()...))
 }
 
-func (h *handler) addApp(c *gin.Context) {
-	ctx, span := tracer.Start(c.Request.Context(), "handler.addApp")
-	defer span.End()
-
-	p := stored.Stored[App]{}
-	if err := c.BindJSON(&p); err != nil {
-		h.logger.Error(err, "failed to read request JSON")
-		c.JSON(http.StatusBadRequest, response.ErrorResponse{
-			Err: response.ErrorDetail{
-				Code: http.StatusBadRequest,
-				Msg:  err.Error(),
-			}})
-		return
-	}
+// storeOptions the options of the store of apps
+func storeOptions() []stored.Option {
+	return []stored.Option{stored.WithSoftDelete(), stored.WithHistory(), stored.WithOutbox(outbox.Table), stored.WithSearch(), stored.WithTenancy()}
+}
 
-	if p.ID == "" {
-		p.ID = uuid.NewString()
+// setupRoutes adds the routes of the app resource, and the routes that only apps have
+func setupRoutes(routes gin.IRoutes, logger logr.Logger, db stored.Store[App]) {
+	h := handler{
+		logger:   logger.WithName("app.handler"),
+		resource: resource.Register(routes, RouteRelativePath, logger, db, resourceConfig),
+		db:       db,
 	}
 
-	p.Content.APIKey = uuid.NewString()
-	p.Content.Disabled = false
-
-	result, err := h.db.Add(ctx, internal.UserFromGinContext(c), p.ID, p.Content)
-	if err != nil {
-		h.logger.Error(err, "failed to add app to store", "id", p.ID)
-		code := http.StatusInternalServerError
-		pgErr, ok := err.(*pq.Error)
-		if ok && pgErr.Code.Name() == "unique_violation" {
-			h.logger.Error(pgErr, "PG Error while adding app", "code", pgErr.Code, "name", pgErr.Code.Name(), "column", pgErr.Column, "constraint", pgErr.Constraint, "table", pgErr.Table)
-			code = http.StatusConflict
-			err = fmt.Errorf("an app with the id '%v' already exists", p.ID)
-		}
-		c.JSON(code, response.ErrorResponse{
-			Err: response.ErrorDetail{
-				Code: code,
-				Msg:  err.Error(),
-			}})
-		return
-	}
+	routes.POST(RouteRelativePath+":"+methodParamName, h.customMethod)
+	routes.GET(RouteRelativePath+"/stats", h.getAppStats)
+	routes.PUT(RouteRelativePath+"/:"+resource.IDParam, h.putApp)
+	routes.GET(RouteRelativePath+"/:"+resource.IDParam+"/history", h.getAppHistory)
+	routes.POST(RouteRelativePath+"/:"+resource.IDParam+"/api-key", h.resetAPIKey)
+}
 
-	c.JSON(http.StatusOK, result)
+type handler struct {
+	logger   logr.Logger
+	resource *resource.Handler[App]
+	db       stored.Store[App]
 }
 
-func (h *handler) getApp(c *gin.Context) {
-	ctx, span := tracer.Start(c.Request.Context(), "handler.getApp")
+func (h *handler) putApp(c *gin.Context) {
+	ctx, span := tracer.Start(resource.Context(c), "handler.putApp")
 	defer span.End()
 
-	p := stored.Stored[App]{}
-	if err := c.BindUri(&p); err != nil {
-		h.logger.Error(err, "attempting to get app with invalid id", "id", p.ID)
-		c.JSON(http.StatusBadRequest, response.ErrorResponse{
-			Err: response.ErrorDetail{
-				Code: http.StatusBadRequest,
-				Msg:  err.Error(),
-			}})
+	id := c.Param(resource.IDParam)
+	content := App{}
+	if err := c.BindJSON(&content); err != nil {
+		h.resource.Fail(c, fmt.Errorf("%w: %w", resource.ErrInvalidRequest, err), id)
 		return
 	}
 
-	result, err := h.db.Get(ctx, p.ID)
-
-	if err == sql.ErrNoRows {
-		h.logger.Error(err, "cannot find app by id", "id", p.ID)
-		c.JSON(http.StatusNotFound, response.ErrorResponse{
-			Err: response.ErrorDetail{
-				Code: http.StatusNotFound,
-				Msg:  fmt.Sprintf("cannot find app with id: %v", p.ID),
-			}})
+	versions, hasIfMatch := resource.IfMatch(c)
+	if hasIfMatch && len(versions) == 0 {
+		h.resource.Fail(c, fmt.Errorf("%w: no entity tag of the %v header can match: %v", resource.ErrPreconditionFailed, resource.IfMatchHeader, c.GetHeader(resource.IfMatchHeader)), id)
 		return
 	}
 
+	// The API key can only be changed by resetting it, so it is carried over from the stored app. The put is applied
+	// to the version that the API key was read from to not revert a concurrent reset.
+	current, err := h.db.Get(stored.SkipCache(ctx), id)
 	if err != nil {
-		h.logger.Error(err, "failed to get app from store", "id", p.ID)
-		c.JSON(http.StatusInternalServerError, response.ErrorResponse{
-			Err: response.ErrorDetail{
-				Code: http.StatusInternalServerError,
-				Msg:  err.Error(),
-			}})
+		h.resource.Fail(c, err, id)
 		return
 	}
-
-	c.JSON(http.StatusOK, result)
-}
-
-func (h *handler) patchApp(c *gin.Context) {
-	ctx, span := tracer.Start(c.Request.Context(), "handler.patchApp")
-	defer span.End()
-
-	p := stored.Stored[any]{}
-	if err := c.BindUri(&p); err != nil {
-		h.logger.Error(err, "attempting to patch app with invalid id", "id", p.ID)
-		c.JSON(http.StatusBadRequest, response.ErrorResponse{
-			Err: response.ErrorDetail{
-				Code: http.StatusBadRequest,
-				Msg:  err.Error(),
-			}})
-		return
-	}
-
-	delta := map[string]any{}
-	if err := c.BindJSON(&delta); err != nil {
-		h.logger.Error(err, "unable to parse patch content", "id", p.ID)
-		c.JSON(http.StatusBadRequest, response.ErrorResponse{
-			Err: response.ErrorDetail{
-				Code: http.StatusBadRequest,
-				Msg:  err.Error(),
-			}})
-		return
+	if hasIfMatch {
+		if err := resource.MatchVersion(id, versions, current.Version); err != nil {
+			h.resource.Fail(c, err, id)
+			return
+		}
 	}
 
-	_, err := h.db.Patch(ctx, internal.UserFromGinContext(c), p.ID, delta)
-	if err == sql.ErrNoRows {
-		h.logger.Error(err, "attempt to patch a non-existing app", "id", p.ID)
-		c.JSON(http.StatusNotFound, response.ErrorResponse{
-			Err: response.ErrorDetail{
-				Code: http.StatusNotFound,
-				Msg:  err.Error(),
-			}})
+	content.APIKey = current.Content.APIKey
+	result, err := h.db.PutVersion(ctx, internal.UserFromGinContext(c), id, current.Version, content)
+	if errors.Is(err, stored.ErrConflict) && !hasIfMatch {
+		// The client didn't ask for a version, so the app was modified concurrently since it was read by the put
+		h.logger.Error(err, "attempt to put an app that has been modified", "id", id)
+		resource.WriteError(c, http.StatusConflict, err)
 		return
 	} else if err != nil {
-		h.logger.Error(err, "failed to patch app in db", "id", p.ID)
-		c.JSON(http.StatusInternalServerError, response.ErrorResponse{
-			Err: response.ErrorDetail{
-				Code: http.StatusInternalServerError,
-				Msg:  err.Error(),
-			}})
+		h.resource.Fail(c, err, id)
 		return
 	}
 
-	c.AbortWithStatus(http.StatusOK)
+	c.Header(resource.ETagHeader, resource.ETag(result.Version))
+	c.JSON(http.StatusOK, result)
 }
 
-func (h *handler) listApps(c *gin.Context) {
-	ctx, span := tracer.Start(c.Request.Context(), "handler.listApps")
+func (h *handler) getAppHistory(c *gin.Context) {
+	ctx, span := tracer.Start(resource.Context(c), "handler.getAppHistory")
 	defer span.End()
 
-	listCondition := []stored.Condition{}
-	if v, hasDisabled := c.GetQuery(disabledJSONKey); hasDisabled {
-		disabled, err := strconv.ParseBool(v)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, response.ErrorResponse{
-				Err: response.ErrorDetail{
-					Code: http.StatusBadRequest,
-					Msg:  fmt.Sprintf("invalid value for disabled: %v", v),
-				}})
-			return
-		}
-		listCondition = append(listCondition, stored.Condition{Attribute: disabledJSONKey, Op: stored.EqualOperator, Value: disabled})
-	}
-
-	result, err := h.db.List(ctx, listCondition...)
+	id := c.Param(resource.IDParam)
+	result, err := h.db.History(ctx, id)
 	if err != nil {
-		h.logger.Error(err, "failed to list apps from store")
-		c.JSON(http.StatusInternalServerError, response.ErrorResponse{
-			Err: response.ErrorDetail{
-				Code: http.StatusInternalServerError,
-				Msg:  err.Error(),
-			}})
+		h.resource.Fail(c, err, id)
+		return
+	}
+	if len(result) == 0 {
+		resource.WriteError(c, http.StatusNotFound, fmt.Errorf("cannot find history of app with id: %v", id))
 		return
 	}
 
@@ -209,28 +153,15 @@ func (h *handler) listApps(c *gin.Context) {
 }
 
 func (h *handler) resetAPIKey(c *gin.Context) {
-	ctx, span := tracer.Start(c.Request.Context(), "handler.resetAPIKey")
+	ctx, span := tracer.Start(resource.Context(c), "handler.resetAPIKey")
 	defer span.End()
 
-	id := c.Param(idParamName)
+	id := c.Param(resource.IDParam)
 
 	newKey := uuid.NewString()
-	_, err := h.db.Patch(ctx, internal.UserFromGinContext(c), id, map[string]any{"apiKey": newKey})
-	if err == sql.ErrNoRows {
-		h.logger.Error(err, "attempt to reset API key for a non-existing app", "id", id)
-		c.JSON(http.StatusNotFound, response.ErrorResponse{
-			Err: response.ErrorDetail{
-				Code: http.StatusNotFound,
-				Msg:  fmt.Sprintf("cannot find app with id: %v", id),
-			}})
-		return
-	} else if err != nil {
-		h.logger.Error(err, "failed to reset API key", "id", id)
-		c.JSON(http.StatusInternalServerError, response.ErrorResponse{
-			Err: response.ErrorDetail{
-				Code: http.StatusInternalServerError,
-				Msg:  err.Error(),
-			}})
+	_, err := h.db.Patch(ctx, internal.UserFromGinContext(c), id, map[string]any{"apiKey": newKey}, stored.AllowReadOnly(), stored.PublishAs(apiKeyResetEventType))
+	if err != nil {
+		h.resource.Fail(c, err, id)
 		return
 	}
 
@@ -2,11 +2,13 @@ package app
 
 import (
 	"bytes"
-	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"iter"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -14,7 +16,10 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
+	"alielgamal.com/myservice/internal"
+	"alielgamal.com/myservice/internal/resource"
 	"alielgamal.com/myservice/internal/response"
 	"alielgamal.com/myservice/internal/stored"
 	storedTest "alielgamal.com/myservice/internal/stored/test"
@@ -58,6 +63,23 @@ func TestAddApp(t *testing.T) {
 
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
 	})
+
+	t.Run("Returns 409 when the app already exists", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		exists := fmt.Errorf("%w: %w", stored.ErrAlreadyExists, &stored.ConstraintViolationError{Constraint: "app_pkey", Err: errors.New("duplicate key")})
+		mockStore.On("Add", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return((*stored.Stored[App])(nil), exists)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		body, _ := json.Marshal(stored.Stored[App]{ID: "test-id", Content: App{}})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/"+RouteRelativePath, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
 }
 
 func TestAddAppAutoGeneratesAPIKey(t *testing.T) {
@@ -95,9 +117,57 @@ func TestGetApp(t *testing.T) {
 		assert.Equal(t, http.StatusOK, w.Code)
 	})
 
+	t.Run("Returns the version as an ETag", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		result := &stored.Stored[App]{ID: "test-id", Version: 3, Content: App{APIKey: "some-key"}}
+		mockStore.On("Get", mock.Anything, "test-id").Return(result, nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"/test-id", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	})
+
+	t.Run("Returns only the selected fields", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		result := &stored.Stored[App]{ID: "test-id", Version: 3, Content: App{Disabled: true}}
+		mockStore.On("Get", mock.Anything, "test-id", stored.Fields("disabled")).Return(result, nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"/test-id?fields=disabled", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		body := stored.Stored[map[string]any]{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, map[string]any{"disabled": true}, body.Content)
+	})
+
+	t.Run("Returns 400 when a field is unknown", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("Get", mock.Anything, "test-id", stored.Fields("z")).Return((*stored.Stored[App])(nil), fmt.Errorf("%w: unknown attribute 'z'", stored.ErrInvalidAttribute))
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"/test-id?fields=z", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
 	t.Run("Returns 404 when app not found", func(t *testing.T) {
 		mockStore := &storedTest.Store[App]{}
-		mockStore.On("Get", mock.Anything, "missing").Return((*stored.Stored[App])(nil), sql.ErrNoRows)
+		mockStore.On("Get", mock.Anything, "missing").Return((*stored.Stored[App])(nil), stored.ErrNotFound)
 
 		r := gin.Default()
 		setupRoutes(r, newLogger(), mockStore)
@@ -146,9 +216,97 @@ func TestPatchApp(t *testing.T) {
 		assert.Equal(t, http.StatusOK, w.Code)
 	})
 
+	t.Run("Patches the version in the If-Match header", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		result := &stored.Stored[App]{ID: "test-id", Version: 4, Content: App{APIKey: "key", Disabled: true}}
+		mockStore.On("PatchVersion", mock.Anything, mock.Anything, "test-id", int64(3), mock.Anything).Return(result, nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		body, _ := json.Marshal(map[string]any{"disabled": true})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPatch, "/"+RouteRelativePath+"/test-id", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", `"3"`)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+	})
+
+	t.Run("Returns 412 when the app has been modified", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		conflict := &stored.ConflictError{ID: "test-id", ExpectedVersion: 3, ActualVersion: 4}
+		mockStore.On("PatchVersion", mock.Anything, mock.Anything, "test-id", int64(3), mock.Anything).Return((*stored.Stored[App])(nil), conflict)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		body, _ := json.Marshal(map[string]any{"disabled": true})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPatch, "/"+RouteRelativePath+"/test-id", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", `"3"`)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	})
+
+	t.Run("Returns 412 when If-Match can never match", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		body, _ := json.Marshal(map[string]any{"disabled": true})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPatch, "/"+RouteRelativePath+"/test-id", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", `W/"3"`)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		mockStore.AssertNotCalled(t, "PatchVersion", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Returns 400 when the patch doesn't fit an app", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		invalid := &stored.InvalidContentError{Attribute: "disabled", Err: errors.New("not a bool")}
+		mockStore.On("Patch", mock.Anything, mock.Anything, "test-id", mock.Anything).Return((*stored.Stored[App])(nil), invalid)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		body, _ := json.Marshal(map[string]any{"disabled": "yes"})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPatch, "/"+RouteRelativePath+"/test-id", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Returns 400 when patching the API key", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		readOnly := fmt.Errorf("%w: 'apiKey'", stored.ErrReadOnlyAttribute)
+		mockStore.On("Patch", mock.Anything, mock.Anything, "test-id", mock.Anything).Return((*stored.Stored[App])(nil), readOnly)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		body, _ := json.Marshal(map[string]any{"apiKey": "my-key"})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPatch, "/"+RouteRelativePath+"/test-id", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
 	t.Run("Returns 404 when app not found", func(t *testing.T) {
 		mockStore := &storedTest.Store[App]{}
-		mockStore.On("Patch", mock.Anything, mock.Anything, "missing", mock.Anything).Return((*stored.Stored[App])(nil), sql.ErrNoRows)
+		mockStore.On("Patch", mock.Anything, mock.Anything, "missing", mock.Anything).Return((*stored.Stored[App])(nil), stored.ErrNotFound)
 
 		r := gin.Default()
 		setupRoutes(r, newLogger(), mockStore)
@@ -179,6 +337,173 @@ func TestPatchApp(t *testing.T) {
 	})
 }
 
+func TestPutApp(t *testing.T) {
+	put := func(r *gin.Engine, ifMatch string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(App{APIKey: "client-key", Disabled: true})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPut, "/"+RouteRelativePath+"/test-id", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	current := &stored.Stored[App]{ID: "test-id", Version: 3, Content: App{APIKey: "key"}}
+
+	t.Run("Replaces the app keeping its API key", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		result := &stored.Stored[App]{ID: "test-id", Version: 4, Content: App{APIKey: "key", Disabled: true}}
+		mockStore.On("Get", mock.Anything, "test-id").Return(current, nil)
+		mockStore.On("PutVersion", mock.Anything, mock.Anything, "test-id", int64(3), App{APIKey: "key", Disabled: true}).Return(result, nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := put(r, "")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("Returns 412 when the If-Match header doesn't match", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("Get", mock.Anything, "test-id").Return(current, nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := put(r, `"2"`)
+
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		mockStore.AssertNotCalled(t, "PutVersion", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Returns 409 when the app is modified concurrently", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		conflict := &stored.ConflictError{ID: "test-id", ExpectedVersion: 3, ActualVersion: 4}
+		mockStore.On("Get", mock.Anything, "test-id").Return(current, nil)
+		mockStore.On("PutVersion", mock.Anything, mock.Anything, "test-id", int64(3), mock.Anything).Return((*stored.Stored[App])(nil), conflict)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := put(r, "")
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Returns 404 when app not found", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("Get", mock.Anything, "test-id").Return((*stored.Stored[App])(nil), stored.ErrNotFound)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := put(r, "")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestDeleteApp(t *testing.T) {
+	t.Run("Successfully deletes an app", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("Delete", mock.Anything, mock.Anything, "test-id").Return(nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodDelete, "/"+RouteRelativePath+"/test-id", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("Returns 404 when app not found", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("Delete", mock.Anything, mock.Anything, "missing").Return(stored.ErrNotFound)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodDelete, "/"+RouteRelativePath+"/missing", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Returns 500 on internal error", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("Delete", mock.Anything, mock.Anything, "err-id").Return(errors.New("db error"))
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodDelete, "/"+RouteRelativePath+"/err-id", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func TestGetAppHistory(t *testing.T) {
+	t.Run("Successfully returns the app revisions", func(t *testing.T) {
+		revisions := []stored.Revision[App]{
+			{ID: "test-id", Version: 1, Operation: stored.AddOperation, Content: App{Disabled: false}, Actor: "admin"},
+			{ID: "test-id", Version: 2, Operation: stored.PatchOperation, Content: App{Disabled: true}, Actor: "admin",
+				Diff: map[string]any{disabledJSONKey: true}},
+		}
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("History", mock.Anything, "test-id").Return(revisions, nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"/test-id/history", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var result []stored.Revision[App]
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		assert.Equal(t, revisions, result)
+	})
+
+	t.Run("Returns 404 when app has no history", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("History", mock.Anything, "missing").Return([]stored.Revision[App]{}, nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"/missing/history", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Returns 500 on internal error", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("History", mock.Anything, "err-id").Return([]stored.Revision[App](nil), errors.New("db error"))
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"/err-id/history", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
 func TestListApps(t *testing.T) {
 	t.Run("Successfully lists apps", func(t *testing.T) {
 		mockStore := &storedTest.Store[App]{}
@@ -186,7 +511,7 @@ func TestListApps(t *testing.T) {
 			{ID: "1", Content: App{APIKey: "key-1"}},
 			{ID: "2", Content: App{APIKey: "key-2"}},
 		}
-		mockStore.On("List", mock.Anything).Return(apps, nil)
+		mockStore.On("ListPage", mock.Anything, stored.ListOptions{}).Return(&stored.Page[App]{Items: apps}, nil)
 
 		r := gin.Default()
 		setupRoutes(r, newLogger(), mockStore)
@@ -203,7 +528,7 @@ func TestListApps(t *testing.T) {
 		apps := []stored.Stored[App]{
 			{ID: "1", Content: App{APIKey: "key-1", Disabled: true}},
 		}
-		mockStore.On("List", mock.Anything, stored.Condition{Attribute: disabledJSONKey, Op: stored.EqualOperator, Value: true}).Return(apps, nil)
+		mockStore.On("ListPage", mock.Anything, stored.ListOptions{}, stored.Condition{Attribute: disabledJSONKey, Op: stored.EqualOperator, Value: true}).Return(&stored.Page[App]{Items: apps}, nil)
 
 		r := gin.Default()
 		setupRoutes(r, newLogger(), mockStore)
@@ -214,11 +539,332 @@ func TestListApps(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 	})
+
+	t.Run("Returns only the selected fields", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		apps := []stored.Stored[App]{
+			{ID: "1", Content: App{Disabled: true}},
+			{ID: "2"},
+		}
+		mockStore.On("ListPage", mock.Anything, stored.ListOptions{}, stored.Fields("disabled")).Return(&stored.Page[App]{Items: apps}, nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"?fields=disabled", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		body := stored.Page[map[string]any]{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		require.Len(t, body.Items, 2)
+		assert.Equal(t, map[string]any{"disabled": true}, body.Items[0].Content)
+		assert.Equal(t, map[string]any{"disabled": false}, body.Items[1].Content)
+	})
+}
+
+func TestListAppsFilter(t *testing.T) {
+	t.Run("Passes the filter as a condition", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		filter := stored.Or(
+			stored.Condition{Attribute: disabledJSONKey, Op: stored.EqualOperator, Value: true},
+			stored.Condition{Column: stored.CreatedByColumn, Op: stored.EqualOperator, Value: "me@example.com"},
+		)
+		mockStore.On("ListPage", mock.Anything, stored.ListOptions{}, filter).Return(&stored.Page[App]{Items: []stored.Stored[App]{}}, nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		query := url.Values{"filter": {`{"or": [{"attribute": "disabled", "op": "=", "value": true}, {"column": "created_by", "op": "=", "value": "me@example.com"}]}`}}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"?"+query.Encode(), nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("Returns 400 on invalid filter", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			filter string
+		}{
+			{"malformed JSON", `{"or": `},
+			{"unknown operator", `{"attribute": "disabled", "op": "~", "value": true}`},
+			{"empty or", `{"or": []}`},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				mockStore := &storedTest.Store[App]{}
+
+				r := gin.Default()
+				setupRoutes(r, newLogger(), mockStore)
+
+				query := url.Values{"filter": {tt.filter}}
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"?"+query.Encode(), nil)
+				r.ServeHTTP(w, req)
+
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+			})
+		}
+	})
+}
+
+func TestListAppsPagination(t *testing.T) {
+	t.Run("Passes the page options and returns the next cursor", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		apps := []stored.Stored[App]{
+			{ID: "1", Content: App{APIKey: "key-1"}},
+		}
+		opts := stored.ListOptions{Limit: 1, Sort: stored.Sort{Column: stored.CreatedAtColumn, Descending: true}, Cursor: "abc"}
+		mockStore.On("ListPage", mock.Anything, opts).Return(&stored.Page[App]{Items: apps, NextCursor: "def"}, nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"?limit=1&sort=-createdAt&cursor=abc", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		result := stored.Page[App]{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		assert.Equal(t, stored.Page[App]{Items: apps, NextCursor: "def"}, result)
+	})
+
+	t.Run("Returns 400 on invalid options", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			query string
+		}{
+			{"non-numeric limit", "limit=abc"},
+			{"zero limit", "limit=0"},
+			{"limit above maximum", fmt.Sprintf("limit=%v", stored.MaxPageLimit+1)},
+			{"unknown sort", "sort=apiKey"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				mockStore := &storedTest.Store[App]{}
+
+				r := gin.Default()
+				setupRoutes(r, newLogger(), mockStore)
+
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"?"+tt.query, nil)
+				r.ServeHTTP(w, req)
+
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+			})
+		}
+	})
+
+	t.Run("Returns 400 on invalid cursor", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("ListPage", mock.Anything, stored.ListOptions{Cursor: "bad"}).Return((*stored.Page[App])(nil), stored.ErrInvalidCursor)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"?cursor=bad", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestListAppsSearch(t *testing.T) {
+	t.Run("Searches the apps that fill the conditions", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		apps := []stored.Stored[App]{
+			{ID: "1", Content: App{Name: "Payments"}},
+			{ID: "2", Content: App{Name: "Payroll"}},
+		}
+		mockStore.On("Search", mock.Anything, "pay", stored.DefaultPageLimit, stored.Condition{Attribute: disabledJSONKey, Op: stored.EqualOperator, Value: false}).Return(apps, nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"?q=pay&disabled=false", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		result := stored.Page[App]{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		assert.Equal(t, apps, result.Items)
+		mockStore.AssertNotCalled(t, "ListPage", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Searches the most relevant apps up to the limit", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		apps := []stored.Stored[App]{
+			{ID: "1", Content: App{Name: "Payments"}},
+			{ID: "2", Content: App{Name: "Payroll"}},
+		}
+		mockStore.On("Search", mock.Anything, "pay", 1).Return(apps[:1], nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"?q=pay&limit=1", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		result := stored.Page[App]{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		assert.Equal(t, apps[:1], result.Items)
+	})
+
+	t.Run("Returns 400 when sorting or paging search results", func(t *testing.T) {
+		for _, query := range []string{"q=pay&sort=createdAt", "q=pay&cursor=abc"} {
+			t.Run(query, func(t *testing.T) {
+				mockStore := &storedTest.Store[App]{}
+
+				r := gin.Default()
+				setupRoutes(r, newLogger(), mockStore)
+
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"?"+query, nil)
+				r.ServeHTTP(w, req)
+
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+			})
+		}
+	})
+
+	t.Run("Returns 500 on store error", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("Search", mock.Anything, "pay", stored.DefaultPageLimit).Return([]stored.Stored[App](nil), errors.New("db error"))
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"?q=pay", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func TestListAppsStream(t *testing.T) {
+	apps := []stored.Stored[App]{
+		{ID: "1", Content: App{Name: "Payments"}},
+		{ID: "2", Content: App{Name: "Payroll", Disabled: true}},
+	}
+	// streamOf returns a sequence of the apps followed by the error if it isn't nil
+	streamOf := func(apps []stored.Stored[App], err error) iter.Seq2[stored.Stored[App], error] {
+		return func(yield func(stored.Stored[App], error) bool) {
+			for _, a := range apps {
+				if !yield(a, nil) {
+					return
+				}
+			}
+			if err != nil {
+				yield(stored.Stored[App]{}, err)
+			}
+		}
+	}
+	stream := func(mockStore *storedTest.Store[App], query string) *httptest.ResponseRecorder {
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+query, nil)
+		req.Header.Set("Accept", resource.NDJSONContentType)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	lines := func(t *testing.T, body *bytes.Buffer) []map[string]any {
+		result := []map[string]any{}
+		decoder := json.NewDecoder(body)
+		for decoder.More() {
+			line := map[string]any{}
+			require.NoError(t, decoder.Decode(&line))
+			result = append(result, line)
+		}
+		return result
+	}
+
+	t.Run("Streams the apps that fill the conditions", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("Iter", mock.Anything, stored.Condition{Attribute: disabledJSONKey, Op: stored.EqualOperator, Value: false}).Return(streamOf(apps, nil))
+
+		w := stream(mockStore, "?disabled=false")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, resource.NDJSONContentType, w.Header().Get("Content-Type"))
+		assert.Equal(t, 2, bytes.Count(w.Body.Bytes(), []byte("\n")))
+		result := lines(t, w.Body)
+		require.Len(t, result, 2)
+		assert.Equal(t, "1", result[0]["id"])
+		assert.Equal(t, "2", result[1]["id"])
+		mockStore.AssertNotCalled(t, "ListPage", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Streams the selected fields", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("Iter", mock.Anything).Return(streamOf(apps, nil))
+
+		w := stream(mockStore, "?fields=name")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		result := lines(t, w.Body)
+		require.Len(t, result, 2)
+		assert.Equal(t, map[string]any{"name": "Payments"}, result[0]["content"])
+	})
+
+	t.Run("Streams nothing when no app fills the conditions", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("Iter", mock.Anything).Return(streamOf(nil, nil))
+
+		w := stream(mockStore, "")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, resource.NDJSONContentType, w.Header().Get("Content-Type"))
+		assert.Empty(t, w.Body.String())
+	})
+
+	t.Run("Returns 400 when sorting, paging or searching", func(t *testing.T) {
+		for _, query := range []string{"?sort=createdAt", "?cursor=abc", "?limit=10", "?q=pay"} {
+			t.Run(query, func(t *testing.T) {
+				w := stream(&storedTest.Store[App]{}, query)
+
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+			})
+		}
+	})
+
+	t.Run("Returns 500 when the store fails before any app", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("Iter", mock.Anything).Return(streamOf(nil, errors.New("db error")))
+
+		w := stream(mockStore, "")
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+
+	t.Run("Ends the stream with an error line when the store fails", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("Iter", mock.Anything).Return(streamOf(apps[:1], errors.New("db error")))
+
+		w := stream(mockStore, "")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		result := lines(t, w.Body)
+		require.Len(t, result, 2)
+		assert.Equal(t, "1", result[0]["id"])
+		assert.Equal(t, map[string]any{"code": float64(http.StatusInternalServerError), "message": "db error"}, result[1]["error"])
+	})
 }
 
 func TestListAppsError(t *testing.T) {
 	mockStore := &storedTest.Store[App]{}
-	mockStore.On("List", mock.Anything).Return([]stored.Stored[App](nil), errors.New("db error"))
+	mockStore.On("ListPage", mock.Anything, stored.ListOptions{}).Return((*stored.Page[App])(nil), errors.New("db error"))
 
 	r := gin.Default()
 	setupRoutes(r, newLogger(), mockStore)
@@ -247,7 +893,7 @@ func TestResetAPIKey(t *testing.T) {
 	t.Run("Successfully resets API key", func(t *testing.T) {
 		mockStore := &storedTest.Store[App]{}
 		result := &stored.Stored[App]{ID: "test-id", Content: App{APIKey: "new-key"}}
-		mockStore.On("Patch", mock.Anything, mock.Anything, "test-id", mock.Anything).Return(result, nil)
+		mockStore.On("Patch", mock.Anything, mock.Anything, "test-id", mock.Anything, mock.Anything, mock.Anything).Return(result, nil)
 
 		r := gin.Default()
 		setupRoutes(r, newLogger(), mockStore)
@@ -262,7 +908,7 @@ func TestResetAPIKey(t *testing.T) {
 
 	t.Run("Returns 404 when app not found", func(t *testing.T) {
 		mockStore := &storedTest.Store[App]{}
-		mockStore.On("Patch", mock.Anything, mock.Anything, "missing", mock.Anything).Return((*stored.Stored[App])(nil), sql.ErrNoRows)
+		mockStore.On("Patch", mock.Anything, mock.Anything, "missing", mock.Anything, mock.Anything, mock.Anything).Return((*stored.Stored[App])(nil), stored.ErrNotFound)
 
 		r := gin.Default()
 		setupRoutes(r, newLogger(), mockStore)
@@ -276,7 +922,7 @@ func TestResetAPIKey(t *testing.T) {
 
 	t.Run("Returns 500 on internal error", func(t *testing.T) {
 		mockStore := &storedTest.Store[App]{}
-		mockStore.On("Patch", mock.Anything, mock.Anything, "err-id", mock.Anything).Return((*stored.Stored[App])(nil), errors.New("db error"))
+		mockStore.On("Patch", mock.Anything, mock.Anything, "err-id", mock.Anything, mock.Anything, mock.Anything).Return((*stored.Stored[App])(nil), errors.New("db error"))
 
 		r := gin.Default()
 		setupRoutes(r, newLogger(), mockStore)
@@ -288,3 +934,82 @@ func TestResetAPIKey(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
 	})
 }
+
+func TestAppsInMemory(t *testing.T) {
+	r := gin.Default()
+	r.Use(func(c *gin.Context) {
+		if tenant := c.GetHeader("X-Tenant"); tenant != "" {
+			c.Set(internal.TenantContextKey, tenant)
+		}
+	})
+	SetupMemoryRoutes(r, newLogger())
+
+	serve := func(method string, path string, body any, headers map[string]string) *httptest.ResponseRecorder {
+		reader := bytes.NewReader(nil)
+		if body != nil {
+			bodyJSON, _ := json.Marshal(body)
+			reader = bytes.NewReader(bodyJSON)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/"+RouteRelativePath+path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "10.0.0.1:50000"
+		req.Header.Set("X-Tenant", "example")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodPost, "", stored.Stored[App]{ID: "payments", Content: App{Name: "Payments"}}, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	added := stored.Stored[App]{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &added))
+	assert.NotEmpty(t, added.Content.APIKey)
+	assert.Equal(t, int64(1), added.Version)
+
+	w = serve(http.MethodPost, "", stored.Stored[App]{ID: "payments", Content: App{Name: "Other"}}, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = serve(http.MethodPost, "", stored.Stored[App]{ID: "payroll", Content: App{Name: "Payroll"}}, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = serve(http.MethodPatch, "/payments", map[string]any{"disabled": true}, map[string]string{resource.IfMatchHeader: `"1"`})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get(resource.ETagHeader))
+
+	w = serve(http.MethodPatch, "/payments", map[string]any{"disabled": false}, map[string]string{resource.IfMatchHeader: `"1"`})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = serve(http.MethodGet, "/payments", nil, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	fetched := stored.Stored[App]{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fetched))
+	assert.Equal(t, App{APIKey: added.Content.APIKey, Disabled: true, Name: "Payments"}, fetched.Content)
+
+	w = serve(http.MethodGet, "?disabled=false", nil, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	listed := stored.Page[App]{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed.Items, 1)
+	assert.Equal(t, "payroll", listed.Items[0].ID)
+
+	w = serve(http.MethodGet, "?q=pay", nil, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	listed = stored.Page[App]{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	assert.Len(t, listed.Items, 2)
+
+	w = serve(http.MethodDelete, "/payments", nil, nil)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	w = serve(http.MethodGet, "/payments", nil, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve(http.MethodGet, "/payroll", nil, map[string]string{"X-Tenant": "other"})
+	assert.Equal(t, http.StatusNotFound, w.Code, "the apps of other tenants are hidden")
+
+	w = serve(http.MethodGet, "/payroll", nil, map[string]string{"X-Tenant": ""})
+	assert.Equal(t, http.StatusForbidden, w.Code, "users without a tenant are rejected")
+}
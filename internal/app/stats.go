@@ -0,0 +1,102 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"alielgamal.com/myservice/internal/resource"
+	"alielgamal.com/myservice/internal/stored"
+)
+
+const groupByQueryParam = "groupBy"
+const functionQueryParam = "function"
+const ofQueryParam = "of"
+
+// statsFields the fields that app stats can be grouped by and that min and max can be computed on. Time fields can be
+// bucketed by suffixing them with ':' and a bucket, like createdAt:week.
+var statsFields = map[string]stored.GroupBy{
+	"createdBy":     {Column: stored.CreatedByColumn},
+	"createdAt":     {Column: stored.CreatedAtColumn},
+	"modifiedBy":    {Column: stored.ModifiedByColumn},
+	"modifiedAt":    {Column: stored.ModifiedAtColumn},
+	disabledJSONKey: {Attribute: disabledJSONKey},
+}
+
+// statsGroup the stats of a single group of apps
+type statsGroup struct {
+	// Keys the values that the apps of the group share by groupBy field
+	Keys map[string]any `json:"keys"`
+
+	// Value the result of the function
+	Value any `json:"value"`
+}
+
+func (h *handler) getAppStats(c *gin.Context) {
+	ctx, span := tracer.Start(resource.Context(c), "handler.getAppStats")
+	defer span.End()
+
+	conds, err := h.resource.Conditions(c)
+	if err != nil {
+		h.resource.Fail(c, err, "")
+		return
+	}
+
+	agg, fields, err := statsAggregation(c)
+	if err != nil {
+		h.resource.Fail(c, err, "")
+		return
+	}
+
+	opts := make([]stored.ReadOption, 0, len(conds))
+	for _, cond := range conds {
+		opts = append(opts, cond)
+	}
+	groups, err := h.db.Aggregate(ctx, agg, opts...)
+	if err != nil {
+		h.resource.Fail(c, err, "")
+		return
+	}
+
+	body := make([]statsGroup, 0, len(groups))
+	for _, g := range groups {
+		keys := make(map[string]any, len(fields))
+		for i, f := range fields {
+			keys[f] = g.Keys[i]
+		}
+		body = append(body, statsGroup{Keys: keys, Value: g.Value})
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// statsAggregation returns the aggregation that the query params of a stats request ask for and the groupBy fields in
+// the order of the group keys
+func statsAggregation(c *gin.Context) (stored.Aggregation, []string, error) {
+	agg := stored.Aggregation{Function: stored.AggregateFunction(c.DefaultQuery(functionQueryParam, string(stored.CountFunction)))}
+
+	fields := []string{}
+	if v := c.Query(groupByQueryParam); v != "" {
+		for _, f := range strings.Split(v, ",") {
+			name, bucket, _ := strings.Cut(f, ":")
+			groupBy, ok := statsFields[name]
+			if !ok {
+				return agg, nil, fmt.Errorf("%w: invalid value for groupBy: %v", resource.ErrInvalidRequest, f)
+			}
+			groupBy.Bucket = stored.TimeBucket(bucket)
+			agg.GroupBy = append(agg.GroupBy, groupBy)
+			fields = append(fields, f)
+		}
+	}
+
+	if v, hasOf := c.GetQuery(ofQueryParam); hasOf {
+		// Only columns can be aggregated since the attributes of apps are not numeric
+		of, ok := statsFields[v]
+		if !ok || of.Column == "" {
+			return agg, nil, fmt.Errorf("%w: invalid value for of: %v", resource.ErrInvalidRequest, v)
+		}
+		agg.Column = of.Column
+	}
+	return agg, fields, nil
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"alielgamal.com/myservice/internal/stored"
+	storedTest "alielgamal.com/myservice/internal/stored/test"
+)
+
+func TestGetAppStats(t *testing.T) {
+	get := func(r *gin.Engine, query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/"+RouteRelativePath+"/stats"+query, nil)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Counts the enabled apps", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("Aggregate", mock.Anything, stored.Aggregation{Function: stored.CountFunction},
+			stored.Condition{Attribute: disabledJSONKey, Op: stored.EqualOperator, Value: false}).
+			Return([]stored.Group{{Keys: []any{}, Value: int64(3)}}, nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := get(r, "?disabled=false")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `[{"keys":{},"value":3}]`, w.Body.String())
+	})
+
+	t.Run("Counts the apps created per user per week", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		agg := stored.Aggregation{
+			Function: stored.CountFunction,
+			GroupBy: []stored.GroupBy{
+				{Column: stored.CreatedByColumn},
+				{Column: stored.CreatedAtColumn, Bucket: stored.WeekBucket},
+			},
+		}
+		mockStore.On("Aggregate", mock.Anything, agg).
+			Return([]stored.Group{{Keys: []any{"admin", "2026-10-12T00:00:00Z"}, Value: int64(2)}}, nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := get(r, "?groupBy=createdBy,createdAt:week")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var body []statsGroup
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, []statsGroup{{Keys: map[string]any{"createdBy": "admin", "createdAt:week": "2026-10-12T00:00:00Z"}, Value: float64(2)}}, body)
+	})
+
+	t.Run("Computes the latest modification of disabled apps", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		agg := stored.Aggregation{Function: stored.MaxFunction, Column: stored.ModifiedAtColumn, GroupBy: []stored.GroupBy{{Attribute: disabledJSONKey}}}
+		mockStore.On("Aggregate", mock.Anything, agg).Return([]stored.Group{}, nil)
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		w := get(r, "?function=max&of=modifiedAt&groupBy=disabled")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockStore.AssertExpectations(t)
+	})
+
+	t.Run("Returns 400 when", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			query string
+		}{
+			{"groupBy is unknown", "?groupBy=apiKey"},
+			{"of is an attribute", "?function=min&of=disabled"},
+			{"disabled is invalid", "?disabled=maybe"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				r := gin.Default()
+				setupRoutes(r, newLogger(), &storedTest.Store[App]{})
+
+				assert.Equal(t, http.StatusBadRequest, get(r, tt.query).Code)
+			})
+		}
+	})
+
+	t.Run("Returns 400 when the store rejects the aggregation", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("Aggregate", mock.Anything, mock.Anything).
+			Return([]stored.Group(nil), fmt.Errorf("%w: unknown bucket 'decade'", stored.ErrInvalidAggregation))
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		assert.Equal(t, http.StatusBadRequest, get(r, "?groupBy=createdAt:decade").Code)
+	})
+
+	t.Run("Returns 500 on internal error", func(t *testing.T) {
+		mockStore := &storedTest.Store[App]{}
+		mockStore.On("Aggregate", mock.Anything, mock.Anything).Return([]stored.Group(nil), errors.New("db error"))
+
+		r := gin.Default()
+		setupRoutes(r, newLogger(), mockStore)
+
+		assert.Equal(t, http.StatusInternalServerError, get(r, "").Code)
+	})
+}
@@ -43,6 +43,25 @@ func TestIntegration(t *testing.T) {
 		assert.False(t, result.Content.Disabled)
 	})
 
+	t.Run("Delete App", func(t *testing.T) {
+		body, err := json.Marshal(stored.Stored[app.App]{ID: "deleted-app"})
+		require.NoError(t, err)
+
+		resp, err := http.Post(baseURL+"/internal/apps", "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		req, err := http.NewRequest(http.MethodDelete, baseURL+"/internal/apps/deleted-app", nil)
+		require.NoError(t, err)
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		resp, err = http.Get(baseURL + "/internal/apps/deleted-app")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
 	t.Run("List Apps", func(t *testing.T) {
 		resp, err := http.Get(baseURL + "/internal/apps")
 		require.NoError(t, err)
@@ -184,6 +184,10 @@ func albAuthMiddleware(logger logr.Logger, region string, fetcher keyFetcher) gi
 			logger.Info("Cannot parse email claim from ALB JWT", "claims", claims)
 		}
 
+		if tenant, ok := claims["custom:tenant"].(string); ok {
+			c.Set(internal.TenantContextKey, tenant)
+		}
+
 		c.Next()
 	}
 }
@@ -122,7 +122,7 @@ func TestALBAuthMiddleware(t *testing.T) {
 		r := gin.Default()
 		r.Use(albAuthMiddleware(logger, "us-east-1", fetcher))
 
-		var capturedUserID, capturedEmail string
+		var capturedUserID, capturedEmail, capturedTenant string
 		r.GET("/test", func(c *gin.Context) {
 			if v, ok := c.Get(internal.UserIDContextKey); ok {
 				capturedUserID = v.(string)
@@ -130,13 +130,17 @@ func TestALBAuthMiddleware(t *testing.T) {
 			if v, ok := c.Get(internal.UserEmailContextKey); ok {
 				capturedEmail = v.(string)
 			}
+			if v, ok := c.Get(internal.TenantContextKey); ok {
+				capturedTenant = v.(string)
+			}
 			c.Status(http.StatusOK)
 		})
 
 		token := signedALBToken(t, privateKey, "test-kid", jwt.MapClaims{
-			"sub":   "user123",
-			"email": "test@example.com",
-			"exp":   time.Now().Add(time.Hour).Unix(),
+			"sub":           "user123",
+			"email":         "test@example.com",
+			"custom:tenant": "example",
+			"exp":           time.Now().Add(time.Hour).Unix(),
 		})
 
 		w := httptest.NewRecorder()
@@ -147,6 +151,7 @@ func TestALBAuthMiddleware(t *testing.T) {
 		assert.Equal(t, http.StatusOK, w.Code)
 		assert.Equal(t, "user123", capturedUserID)
 		assert.Equal(t, "test@example.com", capturedEmail)
+		assert.Equal(t, "example", capturedTenant)
 	})
 
 	t.Run("Returns 401 with wrong signing key", func(t *testing.T) {
@@ -0,0 +1,35 @@
+package config
+
+import "github.com/spf13/viper"
+
+const cacheEnabled = "CACHE.ENABLED"
+const cacheSize = "CACHE.SIZE"
+const cacheTTLSeconds = "CACHE.TTL_SECONDS"
+
+// CacheConfig contains the configuration of the caches of the stores
+type CacheConfig struct {
+	v *viper.Viper
+}
+
+// Enabled reports whether stores should be read through a cache
+func (c CacheConfig) Enabled() bool {
+	return c.v.GetBool(cacheEnabled)
+}
+
+// Size returns the maximum number of items that a cache keeps (default 1000)
+func (c CacheConfig) Size() int {
+	size := c.v.GetInt(cacheSize)
+	if size <= 0 {
+		return 1000
+	}
+	return size
+}
+
+// TTLSeconds returns how long in seconds cached items are kept (default 60)
+func (c CacheConfig) TTLSeconds() int {
+	ttl := c.v.GetInt(cacheTTLSeconds)
+	if ttl <= 0 {
+		return 60
+	}
+	return ttl
+}
@@ -39,6 +39,9 @@ type Config struct {
 	TelemetryConfig TelemetryConfig
 	GCPConfig       GCPConfig
 	AWSConfig       AWSConfig
+	OutboxConfig    OutboxConfig
+	CacheConfig     CacheConfig
+	ReaperConfig    ReaperConfig
 }
 
 // NewConfigFromViper Creates a new Config struct from a Viper object
@@ -49,5 +52,8 @@ func NewConfigFromViper(v *viper.Viper) Config {
 		TelemetryConfig: TelemetryConfig{v},
 		GCPConfig:       GCPConfig{v},
 		AWSConfig:       AWSConfig{v},
+		OutboxConfig:    OutboxConfig{v},
+		CacheConfig:     CacheConfig{v},
+		ReaperConfig:    ReaperConfig{v},
 	}
 }
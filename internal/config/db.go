@@ -2,8 +2,11 @@ package config
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/viper"
+
+	internalDB "alielgamal.com/myservice/internal/db"
 )
 
 // DBConfig contains the DB related configuration
@@ -14,6 +17,10 @@ type DBConfig struct {
 const dbConfigURL = "DB.URL"
 const dbConfigURLTemplate = "DB.URL_TEMPLATE"
 const dbConfigName = "DB.NAME"
+const dbConfigBackfillTenant = "DB.BACKFILL_TENANT"
+
+// sqliteScheme the scheme of the URLs of SQLite DBs, like sqlite://data/myservice.db?_txlock=immediate
+const sqliteScheme = "sqlite://"
 
 // GetURL the actual DB connection URL that should be used. It automatically replaces the %v in the URL_Template with the Name.
 func (c DBConfig) GetURL() string {
@@ -27,3 +34,24 @@ func (c DBConfig) GetURL() string {
 func (c DBConfig) GetURLTemplate() string {
 	return c.v.GetString(dbConfigURLTemplate)
 }
+
+// Driver the driver of the DB, which is chosen by the scheme of its URL. URLs starting with sqlite:// are SQLite DBs,
+// all other URLs are Postgres DBs.
+func (c DBConfig) Driver() string {
+	if strings.HasPrefix(c.GetURL(), sqliteScheme) {
+		return internalDB.SQLiteDriver
+	}
+	return internalDB.PostgresDriver
+}
+
+// BackfillTenant the tenant that migrations move the rows written before their table became multi-tenant to. It is
+// only needed to migrate DBs that have such rows (see internalDB.WithBackfillTenant).
+func (c DBConfig) BackfillTenant() string {
+	return c.v.GetString(dbConfigBackfillTenant)
+}
+
+// DataSourceName the name that the driver of the DB connects to. It is the file name and the parameters of SQLite DBs
+// and the URL of Postgres DBs.
+func (c DBConfig) DataSourceName() string {
+	return strings.TrimPrefix(c.GetURL(), sqliteScheme)
+}
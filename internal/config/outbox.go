@@ -0,0 +1,41 @@
+package config
+
+import "github.com/spf13/viper"
+
+const outboxRelayEnabled = "OUTBOX.RELAY_ENABLED"
+const outboxPollIntervalSeconds = "OUTBOX.POLL_INTERVAL_SECONDS"
+const outboxWebhookURL = "OUTBOX.WEBHOOK_URL"
+const outboxMaxAttempts = "OUTBOX.MAX_ATTEMPTS"
+
+// OutboxConfig contains the configuration of the outbox relay
+type OutboxConfig struct {
+	v *viper.Viper
+}
+
+// RelayEnabled reports whether the service should relay outbox events to the sinks
+func (c OutboxConfig) RelayEnabled() bool {
+	return c.v.GetBool(outboxRelayEnabled)
+}
+
+// PollIntervalSeconds returns the interval in seconds between checks for pending outbox events (default 5)
+func (c OutboxConfig) PollIntervalSeconds() int {
+	interval := c.v.GetInt(outboxPollIntervalSeconds)
+	if interval <= 0 {
+		return 5
+	}
+	return interval
+}
+
+// WebhookURL returns the URL to which outbox events are posted. Events are only logged when it is not set
+func (c OutboxConfig) WebhookURL() string {
+	return c.v.GetString(outboxWebhookURL)
+}
+
+// MaxAttempts returns the number of failed deliveries after which an outbox event is dead-lettered (default 10)
+func (c OutboxConfig) MaxAttempts() int {
+	attempts := c.v.GetInt(outboxMaxAttempts)
+	if attempts <= 0 {
+		return 10
+	}
+	return attempts
+}
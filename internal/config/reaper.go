@@ -0,0 +1,35 @@
+package config
+
+import "github.com/spf13/viper"
+
+const reaperEnabled = "REAPER.ENABLED"
+const reaperIntervalSeconds = "REAPER.INTERVAL_SECONDS"
+const reaperBatchSize = "REAPER.BATCH_SIZE"
+
+// ReaperConfig contains the configuration of the reaper of expired stored items
+type ReaperConfig struct {
+	v *viper.Viper
+}
+
+// Enabled reports whether the service should delete the expired items of the stores
+func (c ReaperConfig) Enabled() bool {
+	return c.v.GetBool(reaperEnabled)
+}
+
+// IntervalSeconds returns the interval in seconds between reaps of expired items (default 60)
+func (c ReaperConfig) IntervalSeconds() int {
+	interval := c.v.GetInt(reaperIntervalSeconds)
+	if interval <= 0 {
+		return 60
+	}
+	return interval
+}
+
+// BatchSize returns the maximum number of expired items deleted from a table at a time (default 100)
+func (c ReaperConfig) BatchSize() int {
+	size := c.v.GetInt(reaperBatchSize)
+	if size <= 0 {
+		return 100
+	}
+	return size
+}
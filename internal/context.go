@@ -8,6 +8,12 @@ const UserIDContextKey = "x-user-id"
 // UserEmailContextKey The key that is set in Gin's context that contains the authenticated user emailF
 const UserEmailContextKey = "x-user-email"
 
+// TenantContextKey The key that is set in Gin's context that contains the tenant of the authenticated user
+const TenantContextKey = "x-tenant"
+
+// LocalTenant The tenant of all requests when no authentication is configured, which is only meant for local development
+const LocalTenant = "local"
+
 // UserFromGinContext Fetches the user from the context
 func UserFromGinContext(c *gin.Context) string {
 	email, ok := c.Get(UserEmailContextKey)
@@ -20,3 +26,10 @@ func UserFromGinContext(c *gin.Context) string {
 	}
 	return c.RemoteIP()
 }
+
+// TenantFromGinContext Fetches the tenant of the user from the context. ok is false if the authentication of the user
+// doesn't carry a tenant, in which case the user can't use multi-tenant data.
+func TenantFromGinContext(c *gin.Context) (tenant string, ok bool) {
+	tenant = c.GetString(TenantContextKey)
+	return tenant, tenant != ""
+}
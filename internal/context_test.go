@@ -49,3 +49,29 @@ func TestUserFromGinContext(t *testing.T) {
 		})
 	}
 }
+
+func TestTenantFromGinContext(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Tenant   interface{}
+		Expected string
+		OK       bool
+	}{
+		{Name: "Tenant when set", Tenant: "example", Expected: "example", OK: true},
+		{Name: "No tenant when empty", Tenant: "", Expected: "", OK: false},
+		{Name: "No tenant when not set", Tenant: nil, Expected: "", OK: false},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if tt.Tenant != nil {
+				c.Set(TenantContextKey, tt.Tenant)
+			}
+
+			tenant, ok := TenantFromGinContext(c)
+			assert.Equal(t, tt.Expected, tenant)
+			assert.Equal(t, tt.OK, ok)
+		})
+	}
+}
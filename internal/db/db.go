@@ -4,9 +4,11 @@ package db
 import (
 	"context"
 	"database/sql"
+	"time"
 )
 
-type querable interface {
+// Querier is implemented by both DB and Tx to run statements
+type Querier interface {
 	// QueryRowContext mirrors sql.DB#QueryRowContext
 	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 
@@ -19,7 +21,7 @@ type querable interface {
 
 // DB interface to enable replacing the implementation of sql.DB instances. Helpful for testing
 type DB interface {
-	querable
+	Querier
 
 	//PingContext mirrors sql.DB#PingContext
 	PingContext(ctx context.Context) error
@@ -30,7 +32,7 @@ type DB interface {
 
 // Tx interface to enable replacing implementation of sql.Tx instances. Helpful for testing
 type Tx interface {
-	querable
+	Querier
 
 	// Commit mirrors sql.Tx#Commit
 	Commit() error
@@ -39,9 +41,44 @@ type Tx interface {
 	Rollback() error
 }
 
+// The drivers of the DBs that SQLDB supports
+const (
+	// PostgresDriver the driver of Postgres DBs
+	PostgresDriver = "postgres"
+
+	// SQLiteDriver the driver of SQLite DBs
+	SQLiteDriver = "sqlite3"
+)
+
 // SQLDB Wraps sql.DB and implements internal DB interface
 type SQLDB struct {
 	DB *sql.DB
+
+	// Driver the driver of the DB. Defaults to PostgresDriver. Statements are written for Postgres, so they are
+	// translated for SQLite DBs (see SQLiteDriver).
+	Driver string
+}
+
+// DriverOf returns the driver of a DB. DBs that are not SQLDBs are assumed to be Postgres DBs.
+func DriverOf(db DB) string {
+	if s, ok := db.(*SQLDB); ok && s.Driver != "" {
+		return s.Driver
+	}
+	return PostgresDriver
+}
+
+// bypassesRowSecurityStmt selects whether the role of the connection bypasses row-level security
+const bypassesRowSecurityStmt = "SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user"
+
+// BypassesRowSecurity reports whether the role that the DB connects as bypasses the row-level security of Postgres
+// tables, like superusers and roles with BYPASSRLS do. SQLite DBs have no row-level security to bypass.
+func BypassesRowSecurity(ctx context.Context, db DB) (bool, error) {
+	if DriverOf(db) == SQLiteDriver {
+		return false, nil
+	}
+	var bypasses bool
+	err := db.QueryRowContext(ctx, bypassesRowSecurityStmt).Scan(&bypasses)
+	return bypasses, err
 }
 
 // PingContext mirrors sql.DB#PingContext
@@ -51,20 +88,33 @@ func (s *SQLDB) PingContext(ctx context.Context) error {
 
 // BeginTx mirrors sql.DB#BeginTx
 func (s *SQLDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
-	return s.DB.BeginTx(ctx, opts)
+	tx, err := s.DB.BeginTx(ctx, opts)
+	if err != nil || s.Driver != SQLiteDriver {
+		return tx, err
+	}
+	return &sqliteTx{tx: tx, now: time.Now()}, nil
 }
 
 // QueryRowContext mirrors sql.DB#QueryRowContext
 func (s *SQLDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if s.Driver == SQLiteDriver {
+		query, args = sqliteStatement(query, args, time.Now())
+	}
 	return s.DB.QueryRowContext(ctx, query, args...)
 }
 
 // ExecContext mirrors sql.DB#QueryContext
 func (s *SQLDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if s.Driver == SQLiteDriver {
+		query, args = sqliteStatement(query, args, time.Now())
+	}
 	return s.DB.ExecContext(ctx, query, args...)
 }
 
 // QueryContext mirrors sql.DB#QueryContext
 func (s *SQLDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if s.Driver == SQLiteDriver {
+		query, args = sqliteStatement(query, args, time.Now())
+	}
 	return s.DB.QueryContext(ctx, query, args...)
 }
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	listenerMinReconnectInterval = time.Second
+	listenerMaxReconnectInterval = time.Minute
+)
+
+// Notification a message sent on a channel using Postgres NOTIFY
+type Notification struct {
+	// Channel the channel on which the notification was sent
+	Channel string
+
+	// Payload the payload of the notification
+	Payload string
+}
+
+// Listener interface to receive notifications sent using Postgres NOTIFY over a dedicated connection.
+// Implementations re-establish the connection when it is lost. Since notifications sent meanwhile are lost, a nil
+// notification is delivered once the connection is re-established.
+type Listener interface {
+	// Listen starts receiving the notifications sent on a channel
+	Listen(channel string) error
+
+	// Notifications returns the channel on which notifications are delivered. It is closed when the Listener is closed.
+	Notifications() <-chan *Notification
+
+	// Ping checks that the connection is still alive, which triggers reconnecting if it is not
+	Ping() error
+
+	// Close closes the connection
+	Close() error
+}
+
+// PQListener Wraps pq.Listener and implements internal Listener interface
+type PQListener struct {
+	l             *pq.Listener
+	notifications chan *Notification
+	closed        chan struct{}
+	closeOnce     sync.Once
+}
+
+// NewPQListener creates a Listener that uses its own connection to the DB at the passed URL
+func NewPQListener(url string) *PQListener {
+	l := &PQListener{
+		l:             pq.NewListener(url, listenerMinReconnectInterval, listenerMaxReconnectInterval, nil),
+		notifications: make(chan *Notification),
+		closed:        make(chan struct{}),
+	}
+
+	go func() {
+		defer close(l.notifications)
+		for n := range l.l.Notify {
+			var notification *Notification
+			if n != nil {
+				notification = &Notification{Channel: n.Channel, Payload: n.Extra}
+			}
+			select {
+			case l.notifications <- notification:
+			case <-l.closed:
+				// Nobody is receiving anymore, but pq.Listener notifications are drained until it closes them
+			}
+		}
+	}()
+
+	return l
+}
+
+// Listen mirrors pq.Listener#Listen
+func (l *PQListener) Listen(channel string) error {
+	return l.l.Listen(channel)
+}
+
+// Notifications mirrors pq.Listener#NotificationChannel
+func (l *PQListener) Notifications() <-chan *Notification {
+	return l.notifications
+}
+
+// Ping mirrors pq.Listener#Ping
+func (l *PQListener) Ping() error {
+	return l.l.Ping()
+}
+
+// Close mirrors pq.Listener#Close
+func (l *PQListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return l.l.Close()
+}
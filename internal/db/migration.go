@@ -1,41 +1,138 @@
 package db
 
 import (
-	"database/sql"
+	"context"
 	"embed"
 
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 )
 
-//go:embed migrations/*.sql
+// The migrations of SQLite DBs mirror the migrations of Postgres DBs, with the same versions
+//
+//go:embed migrations/*.sql migrations/sqlite/*.sql
 var fs embed.FS
 
-func setupMigrations(db *sql.DB) (*migrate.Migrate, error) {
-	d, err := iofs.New(fs, "migrations")
+const (
+	// backfillTenantStmt sets the backfill tenant (see WithBackfillTenant) in a setting of the Postgres migration
+	// connection, which migrations read using current_setting('stored.backfill_tenant', true)
+	backfillTenantStmt = "SELECT set_config('stored.backfill_tenant', $1, false)"
+
+	// SQLite has no settings, so the migrations of SQLite DBs read the backfill tenant from a temporary table of the
+	// migration connection using (SELECT value FROM temp.migration_setting WHERE name = 'backfill_tenant')
+	createSettingsStmt = "CREATE TEMP TABLE IF NOT EXISTS migration_setting (name TEXT PRIMARY KEY, value TEXT NOT NULL)"
+	setSettingStmt     = "INSERT OR REPLACE INTO temp.migration_setting (name, value) VALUES ('backfill_tenant', ?)"
+	dropSettingsStmt   = "DROP TABLE IF EXISTS temp.migration_setting"
+)
+
+// MigrationOption configures how a DB is migrated by UpgradeDB and MigrateDBTo
+type MigrationOption func(*migrationOptions)
+
+type migrationOptions struct {
+	backfillTenant string
+}
+
+// WithBackfillTenant sets the tenant of the rows that were written before their table became multi-tenant. Migrating
+// a table that has such rows to a multi-tenant table fails without it, since their tenant is unknown.
+func WithBackfillTenant(tenant string) MigrationOption {
+	return func(o *migrationOptions) {
+		o.backfillTenant = tenant
+	}
+}
+
+// setupMigrations returns the migrations of the DB and a function that releases the connection they run on, which
+// must be called once they are done
+func setupMigrations(db *SQLDB, opts ...MigrationOption) (*migrate.Migrate, func(), error) {
+	o := migrationOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	dir := "migrations"
+	if db.Driver == SQLiteDriver {
+		dir = "migrations/sqlite"
+	}
+	d, err := iofs.New(fs, dir)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	var driver database.Driver
+	var release func()
+	if db.Driver == SQLiteDriver {
+		driver, release, err = sqliteMigrationDriver(db, o)
+	} else {
+		driver, release, err = postgresMigrationDriver(db, o)
+	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	m, err := migrate.NewWithInstance("iofs", d, "db", driver)
 	if err != nil {
-		return nil, err
+		release()
+		return nil, nil, err
+	}
+	return m, release, nil
+}
+
+// postgresMigrationDriver returns a driver that runs the migrations on a connection that has the settings of the
+// migration options
+func postgresMigrationDriver(db *SQLDB, o migrationOptions) (database.Driver, func(), error) {
+	ctx := context.Background()
+	conn, err := db.DB.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := conn.ExecContext(ctx, backfillTenantStmt, o.backfillTenant); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return driver, func() { conn.Close() }, nil
+}
+
+// sqliteMigrationDriver returns a driver that runs the migrations on a connection that has the settings of the
+// migration options. The SQLite driver runs on the DB itself, so the DB is limited to a single connection until the
+// migrations are done.
+func sqliteMigrationDriver(db *SQLDB, o migrationOptions) (database.Driver, func(), error) {
+	db.DB.SetMaxOpenConns(1)
+	release := func() {
+		db.DB.Exec(dropSettingsStmt)
+		db.DB.SetMaxOpenConns(0)
+	}
+	if _, err := db.DB.Exec(createSettingsStmt); err != nil {
+		release()
+		return nil, nil, err
+	}
+	if o.backfillTenant != "" {
+		if _, err := db.DB.Exec(setSettingStmt, o.backfillTenant); err != nil {
+			release()
+			return nil, nil, err
+		}
+	}
+	driver, err := sqlite3.WithInstance(db.DB, &sqlite3.Config{})
+	if err != nil {
+		release()
+		return nil, nil, err
 	}
-	return m, nil
+	return driver, release, nil
 }
 
 // UpgradeDB runs migrations all the way to the latest possible version
-func UpgradeDB(db *sql.DB) (uint, error) {
-	m, err := setupMigrations(db)
+func UpgradeDB(db *SQLDB, opts ...MigrationOption) (uint, error) {
+	m, release, err := setupMigrations(db, opts...)
 	if err != nil {
 		return 0, err
 	}
+	defer release()
 	err = m.Up()
 	if err != nil && err != migrate.ErrNoChange {
 		return 0, err
@@ -45,11 +142,12 @@ func UpgradeDB(db *sql.DB) (uint, error) {
 }
 
 // MigrateDBTo runs migrations to a specific version. To undo all migrations, pass target version 0
-func MigrateDBTo(db *sql.DB, targetVersion uint) (version uint, err error) {
-	m, err := setupMigrations(db)
-	if err != nil && err != migrate.ErrNoChange {
+func MigrateDBTo(db *SQLDB, targetVersion uint, opts ...MigrationOption) (version uint, err error) {
+	m, release, err := setupMigrations(db, opts...)
+	if err != nil {
 		return
 	}
+	defer release()
 	if targetVersion == 0 {
 		err = m.Down()
 	} else {
@@ -64,19 +162,21 @@ func MigrateDBTo(db *sql.DB, targetVersion uint) (version uint, err error) {
 }
 
 // Version returns the current version of the db
-func Version(db *sql.DB) (uint, bool, error) {
-	m, err := setupMigrations(db)
-	if err != nil && err != migrate.ErrNoChange {
+func Version(db *SQLDB) (uint, bool, error) {
+	m, release, err := setupMigrations(db)
+	if err != nil {
 		return 0, false, err
 	}
+	defer release()
 	return m.Version()
 }
 
 // Force changes DB version and resets its dirty flag without running migrations.
-func Force(db *sql.DB, targetVersion int) error {
-	m, err := setupMigrations(db)
+func Force(db *SQLDB, targetVersion int) error {
+	m, release, err := setupMigrations(db)
 	if err != nil {
 		return err
 	}
+	defer release()
 	return m.Force(targetVersion)
 }
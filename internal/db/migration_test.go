@@ -0,0 +1,74 @@
+package db_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"alielgamal.com/myservice/internal/config"
+	internalDB "alielgamal.com/myservice/internal/db"
+	testDB "alielgamal.com/myservice/internal/db/test"
+)
+
+// untenantedVersion the last version before apps became multi-tenant
+const untenantedVersion = 8
+
+func TestBackfillTenant(t *testing.T) {
+	appConfig, _ := config.ReadConfig()
+	testBackfillTenant(t, func(t *testing.T) (*internalDB.SQLDB, func()) {
+		db, tearDown, err := testDB.SetupTestDB(t.Name(), untenantedVersion, appConfig)
+		require.NoError(t, err)
+		return db, tearDown
+	})
+}
+
+func TestSQLiteBackfillTenant(t *testing.T) {
+	testBackfillTenant(t, func(t *testing.T) (*internalDB.SQLDB, func()) {
+		db, tearDown, err := testDB.SetupTestSQLiteDB(filepath.Join(t.TempDir(), "test.db"), untenantedVersion)
+		require.NoError(t, err)
+		return db, tearDown
+	})
+}
+
+// testBackfillTenant runs the tests of moving the apps from before tenancy to the backfill tenant, whatever the DB is
+func testBackfillTenant(t *testing.T, setupDB func(t *testing.T) (*internalDB.SQLDB, func())) {
+	ctx := context.Background()
+	addApp := func(t *testing.T, db *internalDB.SQLDB) {
+		_, err := db.ExecContext(ctx, "INSERT INTO app (id, content, created_by, modified_by) VALUES ('id1', '{}', 'admin', 'admin')")
+		require.NoError(t, err)
+	}
+
+	t.Run("Moves the existing apps to the backfill tenant", func(t *testing.T) {
+		db, tearDown := setupDB(t)
+		defer tearDown()
+		addApp(t, db)
+
+		_, err := internalDB.UpgradeDB(db, internalDB.WithBackfillTenant("acme"))
+		require.NoError(t, err)
+
+		// Superusers bypass the row-level security of Postgres DBs, like the test DBs do
+		var tenant string
+		require.NoError(t, db.QueryRowContext(ctx, "SELECT tenant FROM app WHERE id = 'id1'").Scan(&tenant))
+		assert.Equal(t, "acme", tenant)
+	})
+
+	t.Run("Fails when there are apps and no backfill tenant", func(t *testing.T) {
+		db, tearDown := setupDB(t)
+		defer tearDown()
+		addApp(t, db)
+
+		_, err := internalDB.UpgradeDB(db)
+		assert.Error(t, err)
+	})
+
+	t.Run("Migrates DBs without apps without a backfill tenant", func(t *testing.T) {
+		db, tearDown := setupDB(t)
+		defer tearDown()
+
+		_, err := internalDB.UpgradeDB(db)
+		assert.NoError(t, err)
+	})
+}
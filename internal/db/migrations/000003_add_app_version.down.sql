@@ -0,0 +1 @@
+ALTER TABLE app DROP COLUMN IF EXISTS version;
@@ -0,0 +1,2 @@
+ALTER TABLE app DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE app DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,12 @@
+CREATE TABLE app_history (
+    revision BIGSERIAL PRIMARY KEY,
+    id VARCHAR(36) NOT NULL,
+    version BIGINT NOT NULL,
+    operation VARCHAR(10) NOT NULL,
+    content JSONB NOT NULL,
+    diff JSONB NOT NULL,
+    actor VARCHAR(50) NOT NULL CHECK(length(actor) > 0),
+    at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX app_history_id_idx ON app_history(id, revision);
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS app_notify ON app;
+DROP FUNCTION IF EXISTS stored_notify();
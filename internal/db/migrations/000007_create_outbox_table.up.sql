@@ -0,0 +1,16 @@
+CREATE TABLE outbox (
+    id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+    position BIGSERIAL NOT NULL,
+    type VARCHAR(100) NOT NULL CHECK(length(type) > 0),
+    source VARCHAR(63) NOT NULL,
+    subject VARCHAR(36) NOT NULL,
+    version BIGINT NOT NULL,
+    actor VARCHAR(50) NOT NULL CHECK(length(actor) > 0),
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NULL
+);
+
+CREATE INDEX outbox_pending_idx ON outbox(position) WHERE delivered_at IS NULL;
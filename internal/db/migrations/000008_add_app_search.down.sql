@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS app_search_idx;
+ALTER TABLE app DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,4 @@
+ALTER TABLE app ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    to_tsvector('simple', coalesce(content->>'name', ' ') || ' ' || coalesce(content->>'description', ' '))
+) STORED;
+CREATE INDEX app_search_idx ON app USING GIN(search_vector);
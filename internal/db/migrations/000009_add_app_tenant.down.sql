@@ -0,0 +1,46 @@
+DROP POLICY IF EXISTS app_history_tenant ON app_history;
+ALTER TABLE app_history NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE app_history DISABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS app_tenant ON app;
+ALTER TABLE app NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE app DISABLE ROW LEVEL SECURITY;
+
+DROP INDEX IF EXISTS app_tenant_idx;
+ALTER TABLE app_history DROP COLUMN IF EXISTS tenant;
+ALTER TABLE app DROP COLUMN IF EXISTS tenant;
+
+-- Notifications no longer carry the tenant
+CREATE OR REPLACE FUNCTION stored_notify()
+RETURNS TRIGGER AS $$
+DECLARE
+    changed RECORD;
+    operation TEXT;
+    version BIGINT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+        operation := 'delete';
+        version := OLD.version + 1;
+    ELSE
+        changed := NEW;
+        version := NEW.version;
+        IF TG_OP = 'INSERT' THEN
+            operation := 'add';
+        ELSIF to_jsonb(OLD) ->> 'deleted_at' IS NULL AND to_jsonb(NEW) ->> 'deleted_at' IS NOT NULL THEN
+            operation := 'delete';
+        ELSIF to_jsonb(OLD) ->> 'deleted_at' IS NOT NULL AND to_jsonb(NEW) ->> 'deleted_at' IS NULL THEN
+            operation := 'restore';
+        ELSE
+            operation := 'patch';
+        END IF;
+    END IF;
+
+    PERFORM pg_notify(TG_TABLE_NAME, json_build_object(
+        'operation', operation,
+        'id', changed.id,
+        'version', version,
+        'at', LOCALTIMESTAMP
+    )::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
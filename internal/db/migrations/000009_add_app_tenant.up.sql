@@ -0,0 +1,68 @@
+-- Existing apps are moved to the backfill tenant, which the service sets in the stored.backfill_tenant setting of the
+-- migration connection (see DB.BACKFILL_TENANT). Their tenant is unknown otherwise, so migrating fails.
+DO $$
+BEGIN
+    IF coalesce(current_setting('stored.backfill_tenant', true), '') = ''
+        AND (EXISTS (SELECT 1 FROM app) OR EXISTS (SELECT 1 FROM app_history)) THEN
+        RAISE EXCEPTION 'the tenant of the existing apps is unknown, set DB.BACKFILL_TENANT to the tenant to move them to';
+    END IF;
+END
+$$;
+
+ALTER TABLE app ADD COLUMN tenant VARCHAR(50) NOT NULL DEFAULT current_setting('stored.backfill_tenant', true) CHECK(length(tenant) > 0);
+ALTER TABLE app ALTER COLUMN tenant DROP DEFAULT;
+CREATE INDEX app_tenant_idx ON app(tenant);
+
+ALTER TABLE app_history ADD COLUMN tenant VARCHAR(50) NOT NULL DEFAULT current_setting('stored.backfill_tenant', true) CHECK(length(tenant) > 0);
+ALTER TABLE app_history ALTER COLUMN tenant DROP DEFAULT;
+
+-- Rows are only visible to the transactions scoped to their tenant using the stored.tenant setting. The policies are
+-- forced on the owner of the tables too, but not on superusers or roles with BYPASSRLS.
+ALTER TABLE app ENABLE ROW LEVEL SECURITY;
+ALTER TABLE app FORCE ROW LEVEL SECURITY;
+CREATE POLICY app_tenant ON app
+    USING (tenant = current_setting('stored.tenant', true))
+    WITH CHECK (tenant = current_setting('stored.tenant', true));
+
+ALTER TABLE app_history ENABLE ROW LEVEL SECURITY;
+ALTER TABLE app_history FORCE ROW LEVEL SECURITY;
+CREATE POLICY app_history_tenant ON app_history
+    USING (tenant = current_setting('stored.tenant', true))
+    WITH CHECK (tenant = current_setting('stored.tenant', true));
+
+-- Notifications are sent to the listeners of all tenants, so they carry the tenant of the written row
+CREATE OR REPLACE FUNCTION stored_notify()
+RETURNS TRIGGER AS $$
+DECLARE
+    changed RECORD;
+    operation TEXT;
+    version BIGINT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+        operation := 'delete';
+        version := OLD.version + 1;
+    ELSE
+        changed := NEW;
+        version := NEW.version;
+        IF TG_OP = 'INSERT' THEN
+            operation := 'add';
+        ELSIF to_jsonb(OLD) ->> 'deleted_at' IS NULL AND to_jsonb(NEW) ->> 'deleted_at' IS NOT NULL THEN
+            operation := 'delete';
+        ELSIF to_jsonb(OLD) ->> 'deleted_at' IS NOT NULL AND to_jsonb(NEW) ->> 'deleted_at' IS NULL THEN
+            operation := 'restore';
+        ELSE
+            operation := 'patch';
+        END IF;
+    END IF;
+
+    PERFORM pg_notify(TG_TABLE_NAME, json_build_object(
+        'operation', operation,
+        'id', changed.id,
+        'version', version,
+        'at', LOCALTIMESTAMP,
+        'tenant', to_jsonb(changed) ->> 'tenant'
+    )::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
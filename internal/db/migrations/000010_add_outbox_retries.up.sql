@@ -0,0 +1,8 @@
+-- Relays lease the events they deliver using locked_until, which also delays the retries of failed events. Events that
+-- keep failing are dead-lettered so that the later events of their subject can be delivered.
+ALTER TABLE outbox ADD COLUMN locked_until TIMESTAMP NULL;
+ALTER TABLE outbox ADD COLUMN dead_at TIMESTAMP NULL;
+
+DROP INDEX IF EXISTS outbox_pending_idx;
+CREATE INDEX outbox_pending_idx ON outbox(position) WHERE delivered_at IS NULL AND dead_at IS NULL;
+CREATE INDEX outbox_subject_idx ON outbox(source, subject, position) WHERE delivered_at IS NULL AND dead_at IS NULL;
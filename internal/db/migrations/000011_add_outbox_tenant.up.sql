@@ -0,0 +1,2 @@
+-- Events carry the tenant of the written item, which is NULL for the items of stores that are not multi-tenant
+ALTER TABLE outbox ADD COLUMN tenant VARCHAR(50) NULL;
@@ -0,0 +1 @@
+-- SQLite generates uuids without an extension
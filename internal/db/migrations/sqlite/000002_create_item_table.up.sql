@@ -0,0 +1,8 @@
+CREATE TABLE app (
+    id VARCHAR(36) NOT NULL PRIMARY KEY CONSTRAINT app_id_check CHECK(length(id) > 0),
+    content TEXT NOT NULL CONSTRAINT app_content_check CHECK(json_valid(content)),
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    modified_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    created_by VARCHAR(50) NOT NULL CONSTRAINT app_created_by_check CHECK(length(created_by) > 0),
+    modified_by VARCHAR(50) NOT NULL CONSTRAINT app_modified_by_check CHECK(length(modified_by) > 0)
+);
@@ -0,0 +1 @@
+ALTER TABLE app ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+ALTER TABLE app DROP COLUMN deleted_by;
+ALTER TABLE app DROP COLUMN deleted_at;
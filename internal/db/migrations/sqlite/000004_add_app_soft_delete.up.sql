@@ -0,0 +1,2 @@
+ALTER TABLE app ADD COLUMN deleted_at TIMESTAMP NULL;
+ALTER TABLE app ADD COLUMN deleted_by VARCHAR(50) NULL CONSTRAINT app_deleted_by_check CHECK(length(deleted_by) > 0);
@@ -0,0 +1,12 @@
+CREATE TABLE app_history (
+    revision INTEGER PRIMARY KEY AUTOINCREMENT,
+    id VARCHAR(36) NOT NULL,
+    version BIGINT NOT NULL,
+    operation VARCHAR(10) NOT NULL,
+    content TEXT NOT NULL CONSTRAINT app_history_content_check CHECK(json_valid(content)),
+    diff TEXT NOT NULL CONSTRAINT app_history_diff_check CHECK(json_valid(diff)),
+    actor VARCHAR(50) NOT NULL CONSTRAINT app_history_actor_check CHECK(length(actor) > 0),
+    at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE INDEX app_history_id_idx ON app_history(id, revision);
@@ -0,0 +1 @@
+-- SQLite has no notifications, so stores can't be watched
@@ -0,0 +1,19 @@
+CREATE TABLE outbox (
+    id VARCHAR(36) NOT NULL UNIQUE DEFAULT (lower(
+        hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+        substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))
+    )),
+    position INTEGER PRIMARY KEY AUTOINCREMENT,
+    type VARCHAR(100) NOT NULL CONSTRAINT outbox_type_check CHECK(length(type) > 0),
+    source VARCHAR(63) NOT NULL,
+    subject VARCHAR(36) NOT NULL,
+    version BIGINT NOT NULL,
+    actor VARCHAR(50) NOT NULL CONSTRAINT outbox_actor_check CHECK(length(actor) > 0),
+    payload TEXT NOT NULL CONSTRAINT outbox_payload_check CHECK(json_valid(payload)),
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    delivered_at TIMESTAMP NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NULL
+);
+
+CREATE INDEX outbox_pending_idx ON outbox(position) WHERE delivered_at IS NULL;
@@ -0,0 +1,10 @@
+-- The searchable text is lower-cased with a space before every word, which makes searching for a word prefix finding
+-- the prefix after a space. Punctuation separates words like in the 'simple' text search configuration of Postgres.
+ALTER TABLE app ADD COLUMN search_vector TEXT GENERATED ALWAYS AS (
+    ' ' || lower(
+        replace(replace(replace(replace(replace(replace(replace(replace(replace(replace(replace(replace(replace(replace(
+            coalesce(content->>'name', '') || ' ' || coalesce(content->>'description', ''),
+        char(9), ' '), char(10), ' '), char(13), ' '), '.', ' '), ',', ' '), ';', ' '), ':', ' '), '!', ' '), '?', ' '),
+        '-', ' '), '_', ' '), '(', ' '), ')', ' '), '/', ' ')
+    )
+) VIRTUAL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS app_tenant_idx;
+ALTER TABLE app_history DROP COLUMN tenant;
+ALTER TABLE app DROP COLUMN tenant;
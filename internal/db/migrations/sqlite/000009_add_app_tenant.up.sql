@@ -0,0 +1,9 @@
+-- SQLite has no row-level security, so stores scope their statements to the tenant themselves
+-- Existing apps are moved to the backfill tenant, which the service sets in a temporary table of the migration
+-- connection (see DB.BACKFILL_TENANT). Their tenant is unknown otherwise, so migrating fails the NOT NULL constraint.
+-- SQLite can only add columns with a constant default, which is replaced right away.
+ALTER TABLE app ADD COLUMN tenant VARCHAR(50) NOT NULL DEFAULT 'unknown' CONSTRAINT app_tenant_check CHECK(length(tenant) > 0);
+UPDATE app SET tenant = (SELECT value FROM temp.migration_setting WHERE name = 'backfill_tenant');
+CREATE INDEX app_tenant_idx ON app(tenant);
+ALTER TABLE app_history ADD COLUMN tenant VARCHAR(50) NOT NULL DEFAULT 'unknown' CONSTRAINT app_history_tenant_check CHECK(length(tenant) > 0);
+UPDATE app_history SET tenant = (SELECT value FROM temp.migration_setting WHERE name = 'backfill_tenant');
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS outbox_subject_idx;
+DROP INDEX IF EXISTS outbox_pending_idx;
+CREATE INDEX outbox_pending_idx ON outbox(position) WHERE delivered_at IS NULL;
+
+ALTER TABLE outbox DROP COLUMN dead_at;
+ALTER TABLE outbox DROP COLUMN locked_until;
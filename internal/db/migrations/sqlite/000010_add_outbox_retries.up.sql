@@ -0,0 +1,6 @@
+ALTER TABLE outbox ADD COLUMN locked_until TIMESTAMP NULL;
+ALTER TABLE outbox ADD COLUMN dead_at TIMESTAMP NULL;
+
+DROP INDEX IF EXISTS outbox_pending_idx;
+CREATE INDEX outbox_pending_idx ON outbox(position) WHERE delivered_at IS NULL AND dead_at IS NULL;
+CREATE INDEX outbox_subject_idx ON outbox(source, subject, position) WHERE delivered_at IS NULL AND dead_at IS NULL;
@@ -0,0 +1 @@
+ALTER TABLE outbox ADD COLUMN tenant VARCHAR(50) NULL;
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// SQLiteTimeLayout the layout of the times stored in SQLite DBs. Times are stored as UTC text in this layout, which
+// sorts like the times and is read back by the driver.
+const SQLiteTimeLayout = "2006-01-02 15:04:05.000000"
+
+const currentTimestamp = "CURRENT_TIMESTAMP"
+
+// sqliteTx wraps sql.Tx to translate the statements of the transaction for SQLite. CURRENT_TIMESTAMP is the start time
+// of the transaction, like in Postgres.
+type sqliteTx struct {
+	tx  *sql.Tx
+	now time.Time
+}
+
+// QueryRowContext mirrors sql.Tx#QueryRowContext
+func (t *sqliteTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	query, args = sqliteStatement(query, args, t.now)
+	return t.tx.QueryRowContext(ctx, query, args...)
+}
+
+// ExecContext mirrors sql.Tx#ExecContext
+func (t *sqliteTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	query, args = sqliteStatement(query, args, t.now)
+	return t.tx.ExecContext(ctx, query, args...)
+}
+
+// QueryContext mirrors sql.Tx#QueryContext
+func (t *sqliteTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	query, args = sqliteStatement(query, args, t.now)
+	return t.tx.QueryContext(ctx, query, args...)
+}
+
+// Commit mirrors sql.Tx#Commit
+func (t *sqliteTx) Commit() error {
+	return t.tx.Commit()
+}
+
+// Rollback mirrors sql.Tx#Rollback
+func (t *sqliteTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// sqliteStatement translates a statement written for Postgres and its args for SQLite. Positional parameters ($1)
+// become numbered parameters (?1), CURRENT_TIMESTAMP becomes the passed time and times are passed in
+// SQLiteTimeLayout. Byte slices are passed as text since SQLite reads blobs as binary JSON.
+func sqliteStatement(query string, args []any, now time.Time) (string, []any) {
+	b := strings.Builder{}
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			c = '?'
+		case strings.HasPrefix(query[i:], currentTimestamp) && (i == 0 || !isWordByte(query[i-1])) &&
+			(i+len(currentTimestamp) == len(query) || !isWordByte(query[i+len(currentTimestamp)])):
+			b.WriteString("'")
+			b.WriteString(now.UTC().Format(SQLiteTimeLayout))
+			b.WriteString("'")
+			i += len(currentTimestamp) - 1
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	sqliteArgs := make([]any, len(args))
+	for i, a := range args {
+		sqliteArgs[i] = sqliteArg(a)
+	}
+	return b.String(), sqliteArgs
+}
+
+// sqliteArg returns the value of an arg that SQLite compares like Postgres does
+func sqliteArg(arg any) any {
+	if t, ok := arg.(time.Time); ok {
+		return t.UTC().Format(SQLiteTimeLayout)
+	}
+	v := reflect.ValueOf(arg)
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 && !v.IsNil() {
+		return string(v.Bytes())
+	}
+	return arg
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordByte(c byte) bool {
+	return isDigit(c) || c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -24,8 +24,7 @@ func SetupTestDB(dbName string, targetDBVersion uint, appConfig config.Config) (
 	db := sql.OpenDB(connector)
 	defer db.Close()
 
-	dbName = strings.Replace(strings.ToLower(dbName), "/", "_", -1)
-	dbName = strings.Replace(dbName, "'", "_", -1)
+	dbName = testDBName(dbName)
 
 	if _, err = db.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %v", dbName)); err != nil {
 		return nil, nil, err
@@ -39,18 +38,47 @@ func SetupTestDB(dbName string, targetDBVersion uint, appConfig config.Config) (
 	if err != nil {
 		return nil, nil, err
 	}
-	tDB := sql.OpenDB(tConnector)
+	tDB := &internalDB.SQLDB{DB: sql.OpenDB(tConnector)}
+	return migrateTestDB(tDB, targetDBVersion)
+}
+
+// SetupTestSQLiteDB creates a SQLite DB in the passed file, like a file in t.TempDir(). Returns a function that should
+// be called with deferred by the test. If targetDBVersion is not set, the DB is upgraded to latest version
+func SetupTestSQLiteDB(fileName string, targetDBVersion uint) (*internalDB.SQLDB, func(), error) {
+	sqlDB, err := sql.Open(internalDB.SQLiteDriver, fileName+"?_txlock=immediate&_busy_timeout=5000")
+	if err != nil {
+		return nil, nil, err
+	}
+	return migrateTestDB(&internalDB.SQLDB{DB: sqlDB, Driver: internalDB.SQLiteDriver}, targetDBVersion)
+}
 
+// migrateTestDB migrates a test DB to targetDBVersion, or to the latest version if it is not set
+func migrateTestDB(tDB *internalDB.SQLDB, targetDBVersion uint) (*internalDB.SQLDB, func(), error) {
+	var err error
 	if targetDBVersion == 0 {
 		_, err = internalDB.UpgradeDB(tDB)
 	} else {
 		_, err = internalDB.MigrateDBTo(tDB, targetDBVersion)
 	}
 	if err != nil {
+		tDB.DB.Close()
 		return nil, nil, err
 	}
 
-	teardownF := func() { tDB.Close() }
+	teardownF := func() { tDB.DB.Close() }
 
-	return &internalDB.SQLDB{DB: tDB}, teardownF, err
+	return tDB, teardownF, err
+}
+
+// NewTestListener returns a function that creates listeners connected to the test DB set up by SetupTestDB for dbName
+func NewTestListener(dbName string, appConfig config.Config) func() internalDB.Listener {
+	url := fmt.Sprintf(appConfig.DBConfig.GetURLTemplate(), testDBName(dbName))
+	return func() internalDB.Listener {
+		return internalDB.NewPQListener(url)
+	}
+}
+
+func testDBName(dbName string) string {
+	dbName = strings.Replace(strings.ToLower(dbName), "/", "_", -1)
+	return strings.Replace(dbName, "'", "_", -1)
 }
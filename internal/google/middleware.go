@@ -85,6 +85,12 @@ func authMiddleware(logger logr.Logger, projectNumber int64, region string, back
 			logger.Info("Cannot parse email claim from JWT ID Token", "emailClaim", emailClaim, "payload", payload)
 		}
 
+		// The hosted domain claim is only set for users of a Google Workspace organization. Consumer accounts are left
+		// without a tenant, so they can't use multi-tenant data.
+		if hd, ok := payload.Claims["hd"].(string); ok {
+			c.Set(internal.TenantContextKey, hd)
+		}
+
 		c.Next()
 	}
 }
@@ -8,7 +8,6 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"alielgamal.com/myservice/internal"
-	"alielgamal.com/myservice/internal/db"
 )
 
 // RouteRelativePath the relative path that the route will be configured at
@@ -16,17 +15,22 @@ const RouteRelativePath = "health"
 const pingTimeout = time.Second
 const dbErrorStatusText = "Error connecting to DB"
 
+// Pinger checks the connection to the DB. db.DB is a Pinger.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
 // SetupRoutes adds health routes handling
-func SetupRoutes(routes gin.IRoutes, db db.DB, dbVersion uint) {
+func SetupRoutes(routes gin.IRoutes, db Pinger, dbVersion uint) {
 	setupRoutes(routes, db, dbVersion, internal.Version, internal.GitTag, internal.GitCommit, internal.BuildDate)
 }
 
-func setupRoutes(routes gin.IRoutes, db db.DB, dbVersion uint, version string, gitTag string, gitCommit string, buildDate string) {
+func setupRoutes(routes gin.IRoutes, db Pinger, dbVersion uint, version string, gitTag string, gitCommit string, buildDate string) {
 	routes.GET(RouteRelativePath, (&handler{db, dbVersion, version, gitTag, gitCommit, buildDate}).healthHandler)
 }
 
 type handler struct {
-	db             db.DB
+	db             Pinger
 	DBVersion      uint
 	ServiceVersion string
 	gitTag         string
@@ -0,0 +1,289 @@
+// Package outbox relays the events that stores with an outbox (see stored.WithOutbox) record in the same transaction
+// as their writes. Events are delivered at least once, so sinks should use the event ID to drop duplicates.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	internalDB "alielgamal.com/myservice/internal/db"
+)
+
+var tracer = otel.Tracer("myservice/outbox")
+
+// Table the name of the outbox table created by the migrations
+const Table = "outbox"
+
+// DefaultBatchSize the maximum number of events relayed by a single RelayPending
+const DefaultBatchSize = 100
+
+// DefaultMaxAttempts the number of failed deliveries after which an event is dead-lettered
+const DefaultMaxAttempts = 10
+
+// DefaultLease the time that a relay has to deliver the events it claimed before other relays can claim them again
+const DefaultLease = 5 * time.Minute
+
+// maxBackoff the longest time that an event waits to be delivered again after a failure
+const maxBackoff = time.Hour
+
+const (
+	// claimableStmt selects the oldest events that are neither delivered, dead-lettered nor leased, and that are the
+	// first undelivered event of their subject
+	claimableStmt = "SELECT o.id, o.type, o.source, o.subject, o.version, o.actor, o.payload, o.tenant, o.created_at, o.attempts FROM outbox o " +
+		"WHERE o.delivered_at IS NULL AND o.dead_at IS NULL AND (o.locked_until IS NULL OR o.locked_until <= CURRENT_TIMESTAMP) " +
+		"AND NOT EXISTS (SELECT 1 FROM outbox e WHERE e.source = o.source AND e.subject = o.subject AND e.position < o.position " +
+		"AND e.delivered_at IS NULL AND e.dead_at IS NULL) ORDER BY o.position LIMIT $1"
+	lockedClaimableStmt = claimableStmt + " FOR UPDATE SKIP LOCKED"
+	claimTemplateStmt   = "UPDATE outbox SET locked_until=$1, attempts=attempts+1 WHERE id IN (%v)"
+	deliveredStmt       = "UPDATE outbox SET delivered_at=CURRENT_TIMESTAMP, locked_until=NULL, last_error=NULL WHERE id=$1"
+	failedStmt          = "UPDATE outbox SET locked_until=$2, last_error=$3 WHERE id=$1"
+	deadStmt            = "UPDATE outbox SET dead_at=CURRENT_TIMESTAMP, locked_until=NULL, last_error=$2 WHERE id=$1"
+)
+
+// Event a domain event recorded in the outbox
+type Event struct {
+	// ID a unique id of the event that sinks can use to drop duplicates
+	ID string `json:"id"`
+
+	// Type the type of the event, <table>.<operation> unless the write was passed stored.PublishAs
+	Type string `json:"type"`
+
+	// Source the table of the stored item that was written
+	Source string `json:"source"`
+
+	// Subject the id of the stored item that was written
+	Subject string `json:"subject"`
+
+	// Version the version of the stored item after the write
+	Version int64 `json:"version"`
+
+	// Actor the identification of the user who did the write
+	Actor string `json:"actor"`
+
+	// Payload the content of the stored item after the write, without its secret attributes
+	Payload json.RawMessage `json:"payload"`
+
+	// Tenant the tenant of the stored item, which is empty for the items of stores that are not multi-tenant
+	Tenant string `json:"tenant,omitempty"`
+
+	// CreatedAt the time of the write
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Sink delivers events to their destination
+type Sink interface {
+	// Deliver delivers a single event. If it fails, the event is delivered again later.
+	Deliver(ctx context.Context, event Event) error
+}
+
+// Relay delivers the pending events of the outbox to sinks. The events of a subject (a stored item) are delivered in
+// the order they were recorded, while the events of different subjects are delivered in any order. Multiple relays can
+// run against the same DB since events are claimed by a single relay at a time using a lease. An event that keeps
+// failing is retried with an exponential backoff, and is dead-lettered after maxAttempts deliveries so that the later
+// events of its subject are delivered.
+type Relay struct {
+	db           internalDB.DB
+	claimStmt    string
+	logger       logr.Logger
+	sinks        []Sink
+	pollInterval time.Duration
+	batchSize    int
+	maxAttempts  int
+	lease        time.Duration
+
+	deliveredCounter metric.Int64Counter
+	failedCounter    metric.Int64Counter
+	deadCounter      metric.Int64Counter
+}
+
+// claimed an event claimed by a relay, with the number of times it has been claimed including this time
+type claimed struct {
+	Event
+	attempts int
+}
+
+// NewRelay creates a relay that checks for pending events every pollInterval and delivers them to all sinks. Events
+// that fail maxAttempts times are dead-lettered. A maxAttempts that is not positive uses DefaultMaxAttempts.
+func NewRelay(db internalDB.DB, logger logr.Logger, pollInterval time.Duration, maxAttempts int, sinks ...Sink) *Relay {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	meter := otel.Meter("internal/outbox")
+	deliveredCounter, _ := meter.Int64Counter("outbox.delivered_count", metric.WithDescription("Number of delivered events"), metric.WithUnit("Count"))
+	failedCounter, _ := meter.Int64Counter("outbox.failed_count", metric.WithDescription("Number of failed event deliveries"), metric.WithUnit("Count"))
+	deadCounter, _ := meter.Int64Counter("outbox.dead_count", metric.WithDescription("Number of dead-lettered events"), metric.WithUnit("Count"))
+
+	stmt := lockedClaimableStmt
+	if internalDB.DriverOf(db) == internalDB.SQLiteDriver {
+		stmt = claimableStmt
+	}
+
+	return &Relay{
+		db:               db,
+		claimStmt:        stmt,
+		logger:           logger.WithName("outbox.relay"),
+		sinks:            sinks,
+		pollInterval:     pollInterval,
+		batchSize:        DefaultBatchSize,
+		maxAttempts:      maxAttempts,
+		lease:            DefaultLease,
+		deliveredCounter: deliveredCounter,
+		failedCounter:    failedCounter,
+		deadCounter:      deadCounter,
+	}
+}
+
+// Run relays pending events until ctx is done
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		relayed, err := r.RelayPending(ctx)
+		if err != nil {
+			r.logger.Error(err, "failed to relay outbox events")
+		}
+		if err == nil && relayed > 0 && ctx.Err() == nil {
+			// There may be more pending events, like the next events of the delivered subjects
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending delivers a single batch of pending events, which has at most one event of each subject, and returns
+// the number of delivered events. The events are claimed in a short transaction and delivered outside of it, so no
+// rows stay locked while the sinks are called.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "outbox.relayPending")
+	defer span.End()
+
+	leasedUntil := time.Now().Add(r.lease)
+	events, err := r.claim(ctx, leasedUntil)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, e := range events {
+		if time.Now().After(leasedUntil) {
+			// The remaining events may have been claimed by another relay, so they are left to be claimed again
+			break
+		}
+
+		if err := r.deliver(ctx, e.Event); err != nil {
+			if err := r.fail(ctx, e, err); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+
+		if _, err := r.db.ExecContext(ctx, deliveredStmt, e.ID); err != nil {
+			return delivered, err
+		}
+		r.deliveredCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("type", e.Type)))
+		delivered++
+	}
+
+	return delivered, nil
+}
+
+// claim leases the oldest pending events until leasedUntil, counting their delivery attempt
+func (r *Relay) claim(ctx context.Context, leasedUntil time.Time) ([]claimed, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	events, err := pending(ctx, tx, r.claimStmt, r.batchSize)
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+
+	params := []any{leasedUntil}
+	placeholders := make([]string, 0, len(events))
+	for i := range events {
+		params = append(params, events[i].ID)
+		placeholders = append(placeholders, fmt.Sprintf("$%v", len(params)))
+		events[i].attempts++
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(claimTemplateStmt, strings.Join(placeholders, ", ")), params...); err != nil {
+		return nil, err
+	}
+	return events, tx.Commit()
+}
+
+// fail records the failed delivery of an event, which is retried after a backoff or dead-lettered if it has been
+// attempted maxAttempts times
+func (r *Relay) fail(ctx context.Context, e claimed, deliveryErr error) error {
+	r.logger.Error(deliveryErr, "failed to deliver outbox event", "id", e.ID, "type", e.Type, "attempts", e.attempts)
+	r.failedCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("type", e.Type)))
+
+	if e.attempts >= r.maxAttempts {
+		r.logger.Info("Dead-lettering outbox event", "id", e.ID, "type", e.Type, "attempts", e.attempts)
+		r.deadCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("type", e.Type)))
+		_, err := r.db.ExecContext(ctx, deadStmt, e.ID, deliveryErr.Error())
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, failedStmt, e.ID, time.Now().Add(r.backoff(e.attempts)), deliveryErr.Error())
+	return err
+}
+
+// backoff returns the time to wait before delivering an event again after it failed the passed number of attempts,
+// which doubles from the poll interval with every attempt up to maxBackoff
+func (r *Relay) backoff(attempts int) time.Duration {
+	backoff := r.pollInterval
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
+
+// deliver delivers an event to all sinks
+func (r *Relay) deliver(ctx context.Context, e Event) error {
+	for _, s := range r.sinks {
+		if err := s.Deliver(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pending returns the oldest claimable events using the passed statement, which locks them in Postgres
+func pending(ctx context.Context, tx internalDB.Tx, stmt string, limit int) ([]claimed, error) {
+	rows, err := tx.QueryContext(ctx, stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []claimed{}
+	for rows.Next() {
+		e := claimed{}
+		var payload []byte
+		var tenant sql.NullString
+		if err := rows.Scan(&e.ID, &e.Type, &e.Source, &e.Subject, &e.Version, &e.Actor, &payload, &tenant, &e.CreatedAt, &e.attempts); err != nil {
+			return nil, err
+		}
+		e.Payload = payload
+		e.Tenant = tenant.String
+		result = append(result, e)
+	}
+
+	return result, rows.Err()
+}
@@ -0,0 +1,204 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"alielgamal.com/myservice/internal/config"
+	internalDB "alielgamal.com/myservice/internal/db"
+	testDB "alielgamal.com/myservice/internal/db/test"
+	"alielgamal.com/myservice/internal/stored"
+)
+
+type recordingSink struct {
+	events []Event
+	err    error
+
+	// failSubject makes only the events of the subject fail with err if it is set
+	failSubject string
+
+	// onDeliver is called with every event before it is delivered
+	onDeliver func(e Event)
+}
+
+func (s *recordingSink) Deliver(_ context.Context, e Event) error {
+	if s.onDeliver != nil {
+		s.onDeliver(e)
+	}
+	if s.err != nil && (s.failSubject == "" || s.failSubject == e.Subject) {
+		return s.err
+	}
+	s.events = append(s.events, e)
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	appConfig, _ := config.ReadConfig()
+	testRelay(t, func(t *testing.T) (*internalDB.SQLDB, func()) {
+		db, tearDown, err := testDB.SetupTestDB(t.Name(), 0, appConfig)
+		require.NoError(t, err)
+		return db, tearDown
+	})
+}
+
+func TestSQLiteRelay(t *testing.T) {
+	testRelay(t, func(t *testing.T) (*internalDB.SQLDB, func()) {
+		db, tearDown, err := testDB.SetupTestSQLiteDB(filepath.Join(t.TempDir(), "test.db"), 0)
+		require.NoError(t, err)
+		return db, tearDown
+	})
+}
+
+// testRelay runs the tests that every relay passes, whatever its DB is
+func testRelay(t *testing.T, setupDB func(t *testing.T) (*internalDB.SQLDB, func())) {
+	ctx := stored.ForTenant(context.Background(), "tenant1")
+	admin := "admin@example.com"
+	pollInterval := 50 * time.Millisecond
+
+	type content struct {
+		S   string `json:"s"`
+		Key string `json:"key,omitempty" stored:"readonly,secret"`
+	}
+
+	prepare := func(t *testing.T) (func(), *internalDB.SQLDB, stored.Store[content], *Relay, *recordingSink) {
+		db, tearDown := setupDB(t)
+
+		s := stored.NewStore[content](db, "app", stored.WithOutbox(Table), stored.WithTenancy())
+		_, err := s.Add(ctx, admin, "id1", content{S: "a", Key: "secret"})
+		require.NoError(t, err)
+		_, err = s.Patch(ctx, admin, "id1", map[string]any{"s": "b"}, stored.PublishAs("app.renamed"))
+		require.NoError(t, err)
+
+		sink := &recordingSink{}
+		return tearDown, db, s, NewRelay(db, logr.Discard(), pollInterval, 2, sink), sink
+	}
+	relayAll := func(t *testing.T, relay *Relay) int {
+		total := 0
+		for {
+			relayed, err := relay.RelayPending(ctx)
+			require.NoError(t, err)
+			if relayed == 0 {
+				return total
+			}
+			total += relayed
+		}
+	}
+
+	t.Run("Delivers pending events in order once", func(t *testing.T) {
+		tearDown, _, _, relay, sink := prepare(t)
+		defer tearDown()
+
+		assert.Equal(t, 2, relayAll(t, relay))
+		require.Len(t, sink.events, 2)
+
+		assert.Equal(t, "app.add", sink.events[0].Type)
+		assert.Equal(t, "app", sink.events[0].Source)
+		assert.Equal(t, "id1", sink.events[0].Subject)
+		assert.Equal(t, int64(1), sink.events[0].Version)
+		assert.JSONEq(t, `{"s":"a"}`, string(sink.events[0].Payload), "secret attributes are left out")
+		assert.Equal(t, "tenant1", sink.events[0].Tenant)
+
+		assert.Equal(t, "app.renamed", sink.events[1].Type)
+		assert.Equal(t, int64(2), sink.events[1].Version)
+		assert.JSONEq(t, `{"s":"b"}`, string(sink.events[1].Payload))
+		assert.NotEqual(t, sink.events[0].ID, sink.events[1].ID)
+
+		assert.Equal(t, 0, relayAll(t, relay))
+	})
+
+	t.Run("Delivers failed events again after a backoff", func(t *testing.T) {
+		tearDown, _, _, relay, sink := prepare(t)
+		defer tearDown()
+
+		sink.err = errors.New("sink is down")
+		relayed, err := relay.RelayPending(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, relayed)
+
+		sink.err = nil
+		relayed, err = relay.RelayPending(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, relayed, "the failed event is backed off and blocks the later event of its subject")
+
+		time.Sleep(2 * pollInterval)
+		assert.Equal(t, 2, relayAll(t, relay))
+		require.Len(t, sink.events, 2)
+		assert.Equal(t, "app.add", sink.events[0].Type)
+	})
+
+	t.Run("Dead-letters events that keep failing", func(t *testing.T) {
+		tearDown, db, _, relay, sink := prepare(t)
+		defer tearDown()
+
+		sink.err = errors.New("event is rejected")
+		for range relay.maxAttempts {
+			relayed, err := relay.RelayPending(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 0, relayed)
+			time.Sleep(2 * relay.backoff(relay.maxAttempts))
+		}
+
+		sink.err = nil
+		assert.Equal(t, 1, relayAll(t, relay))
+		require.Len(t, sink.events, 1)
+		assert.Equal(t, "app.renamed", sink.events[0].Type)
+
+		var dead int
+		var lastError string
+		require.NoError(t, db.QueryRowContext(ctx, "SELECT count(*), max(last_error) FROM outbox WHERE dead_at IS NOT NULL").Scan(&dead, &lastError))
+		assert.Equal(t, 1, dead)
+		assert.Equal(t, "event is rejected", lastError)
+	})
+
+	t.Run("Delivers the events of other subjects while a subject fails", func(t *testing.T) {
+		tearDown, _, s, relay, sink := prepare(t)
+		defer tearDown()
+
+		_, err := s.Add(ctx, admin, "id2", content{S: "c"})
+		require.NoError(t, err)
+
+		sink.err = errors.New("subject is rejected")
+		sink.failSubject = "id1"
+		relayed, err := relay.RelayPending(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, relayed)
+		require.Len(t, sink.events, 1)
+		assert.Equal(t, "id2", sink.events[0].Subject)
+	})
+
+	t.Run("Delivers claimed events outside of the claim transaction", func(t *testing.T) {
+		tearDown, db, _, relay, sink := prepare(t)
+		defer tearDown()
+
+		// Another relay runs while the events are delivered. It would be blocked by the locks of the claim if it
+		// was still open, and it can't claim the leased events or the later events of their subjects.
+		other := NewRelay(db, logr.Discard(), pollInterval, 2, &recordingSink{})
+		sink.onDeliver = func(Event) {
+			relayed, err := other.RelayPending(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, relayed)
+		}
+
+		assert.Equal(t, 2, relayAll(t, relay))
+	})
+
+	t.Run("Records deletes before the item is gone", func(t *testing.T) {
+		tearDown, _, s, relay, sink := prepare(t)
+		defer tearDown()
+
+		require.NoError(t, s.Delete(ctx, admin, "id1"))
+		assert.Equal(t, 3, relayAll(t, relay))
+
+		require.Len(t, sink.events, 3)
+		assert.Equal(t, "app.delete", sink.events[2].Type)
+		assert.Equal(t, int64(3), sink.events[2].Version)
+		assert.JSONEq(t, `{"s":"b"}`, string(sink.events[2].Payload))
+	})
+}
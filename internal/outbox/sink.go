@@ -0,0 +1,76 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// IdempotencyKeyHeader the header in which WebhookSink sends the event ID
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// DefaultWebhookTimeout the time that WebhookSink waits for a response by default
+const DefaultWebhookTimeout = 10 * time.Second
+
+// LogSink logs events without their payload. Helpful for development and as a fallback when no other sink is set up.
+type LogSink struct {
+	Logger logr.Logger
+}
+
+// Deliver logs the event
+func (s LogSink) Deliver(_ context.Context, e Event) error {
+	s.Logger.Info("Outbox event", "id", e.ID, "type", e.Type, "source", e.Source, "subject", e.Subject, "version", e.Version, "actor", e.Actor, "tenant", e.Tenant)
+	return nil
+}
+
+// WebhookSink posts events as JSON to a URL. The event ID is sent in the Idempotency-Key header.
+type WebhookSink struct {
+	URL string
+
+	// Timeout the time to wait for a response when Client is nil, so that a hung webhook can't stall the relay
+	// (default DefaultWebhookTimeout)
+	Timeout time.Duration
+
+	// Client the client that posts the events instead of a client with Timeout. A client without a timeout makes the
+	// relay wait as long as the webhook does.
+	Client *http.Client
+}
+
+// Deliver posts the event and fails unless the response has a 2xx status
+func (s WebhookSink) Deliver(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IdempotencyKeyHeader, e.ID)
+
+	client := s.Client
+	if client == nil {
+		timeout := s.Timeout
+		if timeout <= 0 {
+			timeout = DefaultWebhookTimeout
+		}
+		client = &http.Client{Timeout: timeout}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded to event '%v' with status %v", e.ID, res.StatusCode)
+	}
+	return nil
+}
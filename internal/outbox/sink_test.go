@@ -0,0 +1,58 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSink(t *testing.T) {
+	event := Event{ID: "event-id", Type: "app.add", Source: "app", Subject: "app-id", Version: 1, Actor: "admin",
+		Payload: json.RawMessage(`{"disabled":false}`)}
+
+	t.Run("Posts the event with its id as idempotency key", func(t *testing.T) {
+		var received Event
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, event.ID, r.Header.Get(IdempotencyKeyHeader))
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		err := WebhookSink{URL: server.URL}.Deliver(context.Background(), event)
+		require.NoError(t, err)
+		assert.Equal(t, event, received)
+	})
+
+	t.Run("Fails on non-2xx responses", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		err := WebhookSink{URL: server.URL}.Deliver(context.Background(), event)
+		assert.Error(t, err)
+	})
+
+	t.Run("Fails when the webhook doesn't respond in time", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		timeout := 50 * time.Millisecond
+		start := time.Now()
+		err := WebhookSink{URL: server.URL, Timeout: timeout}.Deliver(context.Background(), event)
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), 10*timeout)
+	})
+}
@@ -0,0 +1,70 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"alielgamal.com/myservice/internal/response"
+	"alielgamal.com/myservice/internal/stored"
+)
+
+// ErrInvalidRequest is returned when the params or the body of a request can't be read
+var ErrInvalidRequest = errors.New("invalid request")
+
+// ErrForbidden is returned when the Authorize hook rejects a request
+var ErrForbidden = errors.New("forbidden")
+
+// ErrPreconditionFailed is returned when the If-Match header of a request can never match the version of an item
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// Status returns the status of the error response of a request that failed with the error. Errors that are not caused
+// by the request are internal errors.
+func Status(err error) int {
+	switch {
+	case errors.Is(err, ErrForbidden), errors.Is(err, stored.ErrTenantRequired):
+		return http.StatusForbidden
+	case errors.Is(err, stored.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, stored.ErrAlreadyExists):
+		return http.StatusConflict
+	case errors.Is(err, stored.ErrConflict), errors.Is(err, ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrInvalidRequest), errors.Is(err, stored.ErrInvalidContent), errors.Is(err, stored.ErrInvalidAttribute),
+		errors.Is(err, stored.ErrReadOnlyAttribute), errors.Is(err, stored.ErrInvalidCondition), errors.Is(err, stored.ErrInvalidSort),
+		errors.Is(err, stored.ErrInvalidAggregation), errors.Is(err, stored.ErrInvalidCursor), errors.Is(err, stored.ErrSearchDisabled):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// WriteError writes the error response of a failed request with the status and the message of the error
+func WriteError(c *gin.Context, code int, err error) {
+	c.JSON(code, response.ErrorResponse{
+		Err: response.ErrorDetail{
+			Code: code,
+			Msg:  err.Error(),
+		}})
+}
+
+// Fail logs the error of a request for the item with the id, which is empty for requests of many items, and writes the
+// error response with the status that matches the error (see Status)
+func (h *Handler[T]) Fail(c *gin.Context, err error, id string) {
+	code := Status(err)
+	h.logger.Error(err, "request failed", "method", c.Request.Method, "path", c.FullPath(), "id", id, "code", code)
+	if id != "" {
+		// The errors of the store don't name the resource
+		switch {
+		case errors.Is(err, stored.ErrNotFound):
+			err = fmt.Errorf("cannot find %v with id: %v", h.config.Name, id)
+		case errors.Is(err, stored.ErrDeleted):
+			err = fmt.Errorf("%v with the id '%v' is deleted, and its id can't be used until it is restored", h.config.Name, id)
+		case errors.Is(err, stored.ErrAlreadyExists):
+			err = fmt.Errorf("%v with the id '%v' already exists", h.config.Name, id)
+		}
+	}
+	WriteError(c, code, err)
+}
@@ -0,0 +1,278 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"alielgamal.com/myservice/internal/response"
+	"alielgamal.com/myservice/internal/stored"
+)
+
+// NDJSONContentType the content type that clients accept to have all listed items streamed as newline-delimited JSON
+const NDJSONContentType = "application/x-ndjson"
+
+const filterQueryParam = "filter"
+const limitQueryParam = "limit"
+const sortQueryParam = "sort"
+const cursorQueryParam = "cursor"
+const searchQueryParam = "q"
+
+// fieldsQueryParam the query param that selects the comma-separated content fields returned when reading items. All
+// fields are returned if it is missing.
+const fieldsQueryParam = "fields"
+
+// streamFlushInterval the number of streamed items written between flushes of the response
+const streamFlushInterval = 100
+
+func (h *Handler[T]) list(c *gin.Context) {
+	ctx, end := h.startSpan(c, ListOperation)
+	defer end()
+	if err := h.authorize(c, ListOperation, ""); err != nil {
+		h.Fail(c, err, "")
+		return
+	}
+
+	conds, err := h.Conditions(c)
+	if err != nil {
+		h.Fail(c, err, "")
+		return
+	}
+
+	opts := stored.ListOptions{Cursor: c.Query(cursorQueryParam)}
+	if v, hasLimit := c.GetQuery(limitQueryParam); hasLimit {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > stored.MaxPageLimit {
+			h.Fail(c, fmt.Errorf("%w: invalid value for limit: %v", ErrInvalidRequest, v), "")
+			return
+		}
+		opts.Limit = limit
+	}
+	if v, hasSort := c.GetQuery(sortQueryParam); hasSort {
+		sort, ok := h.config.Sorts[strings.TrimPrefix(v, "-")]
+		if !ok {
+			h.Fail(c, fmt.Errorf("%w: invalid value for sort: %v", ErrInvalidRequest, v), "")
+			return
+		}
+		sort.Descending = strings.HasPrefix(v, "-")
+		opts.Sort = sort
+	}
+	query, hasQuery := c.GetQuery(searchQueryParam)
+	if hasQuery && (opts.Cursor != "" || opts.Sort != (stored.Sort{})) {
+		h.Fail(c, fmt.Errorf("%w: search results are sorted by relevance and can't be sorted or paged", ErrInvalidRequest), "")
+		return
+	}
+
+	streamed := c.NegotiateFormat(gin.MIMEJSON, NDJSONContentType) == NDJSONContentType
+	if streamed && (hasQuery || opts.Limit != 0 || opts.Sort != (stored.Sort{}) || opts.Cursor != "") {
+		h.Fail(c, fmt.Errorf("%w: streamed items are all the items that match the filters and can't be sorted, paged or searched", ErrInvalidRequest), "")
+		return
+	}
+
+	// Only pages are read projected to the fields, while streamed and searched items are trimmed to them below
+	fields := queryFields(c)
+	if streamed {
+		h.stream(ctx, c, conds, fields)
+		return
+	}
+	result := &stored.Page[T]{}
+	if hasQuery {
+		// Search results have no cursor, so only the most relevant page is returned
+		limit := opts.Limit
+		if limit == 0 {
+			limit = stored.DefaultPageLimit
+		}
+		result.Items, err = h.store.Search(ctx, query, limit, readOptions(conds, nil)...)
+	} else {
+		result, err = h.store.ListPage(ctx, opts, readOptions(conds, fields)...)
+	}
+	if err != nil {
+		h.Fail(c, err, "")
+		return
+	}
+
+	if fields == nil {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	body := &stored.Page[map[string]any]{Items: make([]stored.Stored[map[string]any], 0, len(result.Items)), NextCursor: result.NextCursor}
+	for _, item := range result.Items {
+		s, err := sparse(item, fields)
+		if err != nil {
+			h.Fail(c, err, item.ID)
+			return
+		}
+		body.Items = append(body.Items, s)
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// stream writes every item that fills the conditions as a line of JSON as soon as it is read from the store, so the
+// items are never all in memory. Failures after the first item has been written can't change the status of the
+// response, so they are written as an error line that ends the stream.
+func (h *Handler[T]) stream(ctx context.Context, c *gin.Context, conds []stored.Condition, fields []string) {
+	encoder := json.NewEncoder(c.Writer)
+	written := 0
+	for item, err := range h.store.Iter(ctx, readOptions(conds, nil)...) {
+		var line any = item
+		if err == nil && fields != nil {
+			line, err = sparse(item, fields)
+		}
+		if err != nil {
+			if written == 0 {
+				h.Fail(c, err, "")
+				return
+			}
+			h.logger.Error(err, "failed to stream items from store", "written", written)
+			_ = encoder.Encode(response.ErrorResponse{Err: response.ErrorDetail{Code: Status(err), Msg: err.Error()}})
+			return
+		}
+
+		if written == 0 {
+			c.Header("Content-Type", NDJSONContentType)
+			c.Status(http.StatusOK)
+		}
+		if err := encoder.Encode(line); err != nil {
+			// The client is gone, breaking the loop stops reading from the store
+			h.logger.Error(err, "failed to write streamed items", "written", written)
+			return
+		}
+		written++
+		if written%streamFlushInterval == 0 {
+			c.Writer.Flush()
+		}
+	}
+
+	if written == 0 {
+		c.Header("Content-Type", NDJSONContentType)
+		c.Status(http.StatusOK)
+	}
+}
+
+// Conditions returns the conditions that the query params of a request select items by: the filters of the resource
+// followed by the JSON condition of the filter query param
+func (h *Handler[T]) Conditions(c *gin.Context) ([]stored.Condition, error) {
+	conds := []stored.Condition{}
+	for _, f := range h.config.Filters {
+		v, ok := c.GetQuery(f)
+		if !ok {
+			continue
+		}
+		value, err := filterValue(h.filters[f], v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid value for %v: %v", ErrInvalidRequest, f, v)
+		}
+		conds = append(conds, stored.Condition{Attribute: f, Op: stored.EqualOperator, Value: value})
+	}
+	if v, hasFilter := c.GetQuery(filterQueryParam); hasFilter {
+		filter := stored.Condition{}
+		if err := json.Unmarshal([]byte(v), &filter); err != nil {
+			return nil, fmt.Errorf("%w: invalid value for filter: %w", ErrInvalidRequest, err)
+		}
+		conds = append(conds, filter)
+	}
+	return conds, nil
+}
+
+// filterValue parses the value of a filter query param as the type of its attribute. Strings are taken as is, while
+// the other types are parsed as JSON.
+func filterValue(t reflect.Type, v string) (any, error) {
+	if t.Kind() == reflect.String {
+		return v, nil
+	}
+	value := reflect.New(t)
+	if err := json.Unmarshal([]byte(v), value.Interface()); err != nil {
+		return nil, err
+	}
+	return value.Elem().Interface(), nil
+}
+
+// topLevelAttributes returns the types of the top-level JSON attributes of a struct content type by name
+func topLevelAttributes(t reflect.Type) map[string]reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	result := map[string]reflect.Type{}
+	if t.Kind() != reflect.Struct {
+		return result
+	}
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		result[name] = f.Type
+	}
+	return result
+}
+
+// queryFields returns the content fields that a request selects, or nil if it selects all of them
+func queryFields(c *gin.Context) []string {
+	v := c.Query(fieldsQueryParam)
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+// readOptions returns the options of reading the items that fill the conditions, projected to the fields if any
+func readOptions(conds []stored.Condition, fields []string) []stored.ReadOption {
+	opts := make([]stored.ReadOption, 0, len(conds)+1)
+	for _, cond := range conds {
+		opts = append(opts, cond)
+	}
+	if fields != nil {
+		opts = append(opts, stored.Fields(fields...))
+	}
+	return opts
+}
+
+// sparse returns the item with a content that only has the selected top-level fields, instead of the zero value of the
+// other fields. Nested fields select their top-level field.
+func sparse[T any](item stored.Stored[T], fields []string) (stored.Stored[map[string]any], error) {
+	contentJSON, err := json.Marshal(item.Content)
+	if err != nil {
+		return stored.Stored[map[string]any]{}, err
+	}
+	content := map[string]any{}
+	if err := json.Unmarshal(contentJSON, &content); err != nil {
+		return stored.Stored[map[string]any]{}, err
+	}
+
+	selected := map[string]any{}
+	for _, f := range fields {
+		keys, err := stored.ParseAttribute(f)
+		if err != nil {
+			return stored.Stored[map[string]any]{}, err
+		}
+		if v, ok := content[keys[0]]; ok {
+			selected[keys[0]] = v
+		}
+	}
+
+	return stored.Stored[map[string]any]{
+		ID:         item.ID,
+		Content:    selected,
+		CreatedBy:  item.CreatedBy,
+		CreatedAt:  item.CreatedAt,
+		ModifiedBy: item.ModifiedBy,
+		ModifiedAt: item.ModifiedAt,
+		Version:    item.Version,
+		DeletedAt:  item.DeletedAt,
+		DeletedBy:  item.DeletedBy,
+		ExpiresAt:  item.ExpiresAt,
+	}, nil
+}
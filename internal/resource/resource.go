@@ -0,0 +1,338 @@
+// Package resource registers the REST routes of the entities kept in a stored.Store, so that every entity serves the
+// same requests and reports failures using the same error responses
+package resource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"alielgamal.com/myservice/internal"
+	"alielgamal.com/myservice/internal/stored"
+)
+
+var tracer = otel.Tracer("myservice.resource")
+
+// IDParam the route param of the id of the item in the routes of single items
+const IDParam = "id"
+
+// ETagHeader the response header that contains the version of the item, which clients pass back using IfMatchHeader
+const ETagHeader = "ETag"
+
+// IfMatchHeader the request header that makes writes fail unless the item is still at the version of the ETag
+const IfMatchHeader = "If-Match"
+
+// Operation an operation on the items of a resource, which is checked by the Authorize hook
+type Operation string
+
+const (
+	// CreateOperation adds an item
+	CreateOperation Operation = "create"
+
+	// GetOperation reads an item
+	GetOperation Operation = "get"
+
+	// PatchOperation updates some attributes of an item
+	PatchOperation Operation = "patch"
+
+	// ListOperation reads many items
+	ListOperation Operation = "list"
+
+	// DeleteOperation deletes an item
+	DeleteOperation Operation = "delete"
+)
+
+// Config the configuration of the routes of a resource. All fields but Name are optional.
+type Config[T any] struct {
+	// Name the singular name of the items in error messages, like app
+	Name string
+
+	// Defaults sets the values of a new item that are not up to the client, like generated secrets. Missing ids are
+	// generated before it is called.
+	Defaults func(c *gin.Context, item *stored.Stored[T])
+
+	// ReadOnly the top-level attributes of the content that clients can't patch, in addition to the attributes tagged
+	// stored:"readonly"
+	ReadOnly []string
+
+	// Filters the top-level attributes of the content that items can be listed by using a query param of the same
+	// name, like ?disabled=true. The values are parsed as the type of the attribute. Any condition can also be passed
+	// as JSON using the filter query param.
+	Filters []string
+
+	// Sorts the fields that items can be listed by using the sort query param. Prefixing the field with '-' sorts in
+	// descending order.
+	Sorts map[string]stored.Sort
+
+	// Authorize checks that the user of the request may do the operation on the item with the id, which is empty for
+	// ListOperation. Requests that fail the check are rejected with 403.
+	Authorize func(c *gin.Context, op Operation, id string) error
+}
+
+// Handler serves the routes of a resource. Its exported methods help other routes of the resource to be served
+// consistently.
+type Handler[T any] struct {
+	logger   logr.Logger
+	store    stored.Store[T]
+	config   Config[T]
+	filters  map[string]reflect.Type
+	readOnly map[string]bool
+}
+
+// Register adds the routes that create, get, patch, list and delete the items of store under the path relative to
+// routes: POST and GET <path>, and GET, PATCH and DELETE <path>/:id. It panics if a filter is not a top-level
+// attribute of the content.
+func Register[T any](routes gin.IRoutes, path string, logger logr.Logger, store stored.Store[T], config Config[T]) *Handler[T] {
+	h := &Handler[T]{
+		logger:   logger.WithName(config.Name + ".handler"),
+		store:    store,
+		config:   config,
+		filters:  map[string]reflect.Type{},
+		readOnly: map[string]bool{},
+	}
+	attributes := topLevelAttributes(reflect.TypeFor[T]())
+	for _, f := range config.Filters {
+		t, ok := attributes[f]
+		if !ok {
+			panic(fmt.Sprintf("filter '%v' is not a top-level attribute of %v", f, config.Name))
+		}
+		h.filters[f] = t
+	}
+	for _, a := range config.ReadOnly {
+		h.readOnly[a] = true
+	}
+
+	routes.POST(path, h.create)
+	routes.GET(path, h.list)
+	routes.GET(path+"/:"+IDParam, h.get)
+	routes.PATCH(path+"/:"+IDParam, h.patch)
+	routes.DELETE(path+"/:"+IDParam, h.delete)
+	return h
+}
+
+// Context returns the context of the request, which scopes the items to the tenant of the authenticated user. Users
+// without a tenant are not scoped to any, so that multi-tenant stores reject their requests with 403.
+func Context(c *gin.Context) context.Context {
+	tenant, ok := internal.TenantFromGinContext(c)
+	if !ok {
+		return c.Request.Context()
+	}
+	return stored.ForTenant(c.Request.Context(), tenant)
+}
+
+// authorize checks that the user of the request may do the operation on the item with the id (see Config.Authorize)
+func (h *Handler[T]) authorize(c *gin.Context, op Operation, id string) error {
+	if h.config.Authorize == nil {
+		return nil
+	}
+	if err := h.config.Authorize(c, op, id); err != nil {
+		return fmt.Errorf("%w: %w", ErrForbidden, err)
+	}
+	return nil
+}
+
+// startSpan starts the span of a request doing the operation
+func (h *Handler[T]) startSpan(c *gin.Context, op Operation) (context.Context, func()) {
+	ctx, span := tracer.Start(Context(c), "resource."+string(op))
+	span.SetAttributes(attribute.String("resource", h.config.Name))
+	return ctx, func() { span.End() }
+}
+
+func (h *Handler[T]) create(c *gin.Context) {
+	p := stored.Stored[T]{}
+	if err := c.BindJSON(&p); err != nil {
+		h.Fail(c, fmt.Errorf("%w: %w", ErrInvalidRequest, err), "")
+		return
+	}
+	if p.ID == "" {
+		p.ID = uuid.NewString()
+	}
+
+	ctx, end := h.startSpan(c, CreateOperation)
+	defer end()
+	if err := h.authorize(c, CreateOperation, p.ID); err != nil {
+		h.Fail(c, err, p.ID)
+		return
+	}
+
+	if h.config.Defaults != nil {
+		h.config.Defaults(c, &p)
+	}
+	result, err := h.store.Add(ctx, internal.UserFromGinContext(c), p.ID, p.Content)
+	if err != nil {
+		h.Fail(c, err, p.ID)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler[T]) get(c *gin.Context) {
+	id := c.Param(IDParam)
+	ctx, end := h.startSpan(c, GetOperation)
+	defer end()
+	if err := h.authorize(c, GetOperation, id); err != nil {
+		h.Fail(c, err, id)
+		return
+	}
+
+	fields := queryFields(c)
+	result, err := h.store.Get(ctx, id, readOptions(nil, fields)...)
+	if err != nil {
+		h.Fail(c, err, id)
+		return
+	}
+
+	c.Header(ETagHeader, ETag(result.Version))
+	if fields == nil {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	body, err := sparse(*result, fields)
+	if err != nil {
+		h.Fail(c, err, id)
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+func (h *Handler[T]) patch(c *gin.Context) {
+	id := c.Param(IDParam)
+	ctx, end := h.startSpan(c, PatchOperation)
+	defer end()
+	if err := h.authorize(c, PatchOperation, id); err != nil {
+		h.Fail(c, err, id)
+		return
+	}
+
+	delta := map[string]any{}
+	if err := c.BindJSON(&delta); err != nil {
+		h.Fail(c, fmt.Errorf("%w: %w", ErrInvalidRequest, err), id)
+		return
+	}
+	for k := range delta {
+		keys, err := stored.ParseAttribute(k)
+		if err != nil {
+			h.Fail(c, err, id)
+			return
+		}
+		if h.readOnly[keys[0]] {
+			h.Fail(c, fmt.Errorf("%w: '%v'", stored.ErrReadOnlyAttribute, k), id)
+			return
+		}
+	}
+
+	var result *stored.Stored[T]
+	version, err := h.ifMatchVersion(ctx, c, id)
+	if err == nil && version == 0 {
+		result, err = h.store.Patch(ctx, internal.UserFromGinContext(c), id, delta)
+	} else if err == nil {
+		result, err = h.store.PatchVersion(ctx, internal.UserFromGinContext(c), id, version, delta)
+	}
+	if err != nil {
+		h.Fail(c, err, id)
+		return
+	}
+
+	c.Header(ETagHeader, ETag(result.Version))
+	c.AbortWithStatus(http.StatusOK)
+}
+
+func (h *Handler[T]) delete(c *gin.Context) {
+	id := c.Param(IDParam)
+	ctx, end := h.startSpan(c, DeleteOperation)
+	defer end()
+	if err := h.authorize(c, DeleteOperation, id); err != nil {
+		h.Fail(c, err, id)
+		return
+	}
+
+	if err := h.store.Delete(ctx, internal.UserFromGinContext(c), id); err != nil {
+		h.Fail(c, err, id)
+		return
+	}
+
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// ifMatchVersion returns the version of the item with the id that a write must be applied to for the If-Match header
+// of the request to be met, or 0 if the request has no If-Match header. The store checks the version of a single
+// listed tag as part of the write, while the item is read to find which of many listed tags it is at.
+func (h *Handler[T]) ifMatchVersion(ctx context.Context, c *gin.Context, id string) (int64, error) {
+	versions, ok := IfMatch(c)
+	if !ok {
+		return 0, nil
+	}
+	if len(versions) == 0 {
+		return 0, fmt.Errorf("%w: no entity tag of the %v header can match: %v", ErrPreconditionFailed, IfMatchHeader, c.GetHeader(IfMatchHeader))
+	}
+	if len(versions) == 1 {
+		return versions[0], nil
+	}
+
+	current, err := h.store.Get(stored.SkipCache(ctx), id)
+	if err != nil {
+		return 0, err
+	}
+	if err := MatchVersion(id, versions, current.Version); err != nil {
+		return 0, err
+	}
+	return current.Version, nil
+}
+
+// ETag returns a strong entity tag for the passed version of a stored item
+func ETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// IfMatch returns the versions of the entity tags listed by the If-Match headers of the request. ok is false if there
+// is no If-Match header or it is '*', which means any version is acceptable. A request with ok but no versions can
+// never be met.
+func IfMatch(c *gin.Context) (versions []int64, ok bool) {
+	return ifMatchVersions(strings.Join(c.Request.Header.Values(IfMatchHeader), ","))
+}
+
+// MatchVersion returns an error that fails the precondition of an If-Match header unless the version of the item with
+// the id is one of the versions listed by the header
+func MatchVersion(id string, versions []int64, version int64) error {
+	if slices.Contains(versions, version) {
+		return nil
+	}
+	if len(versions) == 1 {
+		return &stored.ConflictError{ID: id, ExpectedVersion: versions[0], ActualVersion: version}
+	}
+	return fmt.Errorf("%w: stored item '%v' is at version %v but one of the versions %v was expected", ErrPreconditionFailed, id, version, versions)
+}
+
+// ifMatchVersions parses the value of an If-Match header, which is '*' or a comma-separated list of entity tags. If-Match
+// compares the tags using the strong comparison, so weak tags and tags that are not versions of a stored item are left
+// out of the versions as they never match.
+func ifMatchVersions(header string) (versions []int64, ok bool) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil, false
+	}
+	versions = []int64{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+		if err != nil || version <= 0 {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	return versions, true
+}
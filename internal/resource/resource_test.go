@@ -0,0 +1,220 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"alielgamal.com/myservice/internal/response"
+	"alielgamal.com/myservice/internal/stored"
+)
+
+type widget struct {
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	Secret string `json:"secret"`
+	Owner  string `json:"owner"`
+}
+
+func TestResource(t *testing.T) {
+	path := "widgets"
+	errDenied := errors.New("only admins can delete widgets")
+	config := Config[widget]{
+		Name: "widget",
+		Defaults: func(c *gin.Context, item *stored.Stored[widget]) {
+			item.Content.Secret = "generated"
+		},
+		ReadOnly: []string{"owner"},
+		Filters:  []string{"name", "size"},
+		Sorts:    map[string]stored.Sort{"size": {Attribute: "size"}},
+		Authorize: func(c *gin.Context, op Operation, id string) error {
+			if op == DeleteOperation && c.GetHeader("X-Role") != "admin" {
+				return errDenied
+			}
+			return nil
+		},
+	}
+
+	newRouter := func(t *testing.T) *gin.Engine {
+		r := gin.New()
+		Register(r, path, logr.Discard(), stored.NewMemoryStore[widget]("widget"), config)
+		return r
+	}
+	serve := func(r *gin.Engine, method string, target string, body any, headers map[string]string) *httptest.ResponseRecorder {
+		reader := bytes.NewReader(nil)
+		if body != nil {
+			bodyJSON, _ := json.Marshal(body)
+			reader = bytes.NewReader(bodyJSON)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/"+path+target, reader)
+		req.RemoteAddr = "10.0.0.1:50000"
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	errorOf := func(t *testing.T, w *httptest.ResponseRecorder) response.ErrorDetail {
+		result := response.ErrorResponse{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		assert.Equal(t, w.Code, result.Err.Code)
+		return result.Err
+	}
+
+	t.Run("Creates items with the defaults", func(t *testing.T) {
+		r := newRouter(t)
+
+		w := serve(r, http.MethodPost, "", stored.Stored[widget]{ID: "w1", Content: widget{Name: "Bolt", Secret: "mine"}}, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		added := stored.Stored[widget]{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &added))
+		assert.Equal(t, widget{Name: "Bolt", Secret: "generated"}, added.Content)
+
+		w = serve(r, http.MethodGet, "/w1", nil, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"1"`, w.Header().Get(ETagHeader))
+
+		w = serve(r, http.MethodPost, "", stored.Stored[widget]{ID: "w1"}, nil)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, "widget with the id 'w1' already exists", errorOf(t, w).Msg)
+	})
+
+	t.Run("Patches items except their read-only attributes", func(t *testing.T) {
+		r := newRouter(t)
+		require.Equal(t, http.StatusOK, serve(r, http.MethodPost, "", stored.Stored[widget]{ID: "w1"}, nil).Code)
+
+		w := serve(r, http.MethodPatch, "/w1", map[string]any{"size": 3}, map[string]string{IfMatchHeader: `"1"`})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"2"`, w.Header().Get(ETagHeader))
+
+		w = serve(r, http.MethodPatch, "/w1", map[string]any{"size": 4}, map[string]string{IfMatchHeader: `"1"`})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		w = serve(r, http.MethodPatch, "/w1", map[string]any{"size": 4}, map[string]string{IfMatchHeader: "1"})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		w = serve(r, http.MethodPatch, "/w1", map[string]any{"size": 4}, map[string]string{IfMatchHeader: `W/"2"`})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		w = serve(r, http.MethodPatch, "/w1", map[string]any{"size": 4}, map[string]string{IfMatchHeader: `"1", W/"2"`})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		w = serve(r, http.MethodPatch, "/w1", map[string]any{"size": 4}, map[string]string{IfMatchHeader: `W/"2", "1", "2"`})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"3"`, w.Header().Get(ETagHeader))
+		w = serve(r, http.MethodPatch, "/w1", map[string]any{"owner": "me"}, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = serve(r, http.MethodPatch, "/w1", map[string]any{"/owner": "me"}, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "read-only attributes are found in JSON pointers too")
+		assert.Equal(t, "read-only attribute: '/owner'", errorOf(t, w).Msg)
+		w = serve(r, http.MethodPatch, "/w1", map[string]any{"owner..name": "me"}, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = serve(r, http.MethodPatch, "/w1", map[string]any{"unknown": 1}, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = serve(r, http.MethodPatch, "/missing", map[string]any{"size": 4}, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "cannot find widget with id: missing", errorOf(t, w).Msg)
+	})
+
+	t.Run("Lists items by the filters", func(t *testing.T) {
+		r := newRouter(t)
+		for i, name := range []string{"Bolt", "Nut", "Bolt"} {
+			w := serve(r, http.MethodPost, "", stored.Stored[widget]{ID: fmt.Sprint("w", i)}, nil)
+			require.Equal(t, http.StatusOK, w.Code)
+			w = serve(r, http.MethodPatch, fmt.Sprint("/w", i), map[string]any{"name": name, "size": i}, nil)
+			require.Equal(t, http.StatusOK, w.Code)
+		}
+		list := func(t *testing.T, query string) []string {
+			w := serve(r, http.MethodGet, query, nil, nil)
+			require.Equal(t, http.StatusOK, w.Code)
+			listed := stored.Page[widget]{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+			ids := []string{}
+			for _, item := range listed.Items {
+				ids = append(ids, item.ID)
+			}
+			return ids
+		}
+
+		assert.Equal(t, []string{"w0", "w2"}, list(t, "?name=Bolt&sort=size"))
+		assert.Equal(t, []string{"w2"}, list(t, "?name=Bolt&size=2"))
+		assert.Equal(t, []string{"w2", "w1", "w0"}, list(t, "?sort=-size"))
+		assert.Equal(t, []string{"w1"}, list(t, `?filter={"attribute":"size","op":"=","value":1}`))
+
+		for _, query := range []string{"?size=big", "?sort=name", "?limit=0", "?filter=x"} {
+			w := serve(r, http.MethodGet, query, nil, nil)
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
+	})
+
+	t.Run("Rejects requests that fail the authorization", func(t *testing.T) {
+		r := newRouter(t)
+		require.Equal(t, http.StatusOK, serve(r, http.MethodPost, "", stored.Stored[widget]{ID: "w1"}, nil).Code)
+
+		w := serve(r, http.MethodDelete, "/w1", nil, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, errorOf(t, w).Msg, errDenied.Error())
+
+		w = serve(r, http.MethodDelete, "/w1", nil, map[string]string{"X-Role": "admin"})
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		w = serve(r, http.MethodGet, "/w1", nil, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Panics when a filter is not a top-level attribute", func(t *testing.T) {
+		assert.Panics(t, func() {
+			Register(gin.New(), path, logr.Discard(), stored.NewMemoryStore[widget]("widget"), Config[widget]{Name: "widget", Filters: []string{"color"}})
+		})
+	})
+}
+
+func TestIfMatchVersions(t *testing.T) {
+	tests := []struct {
+		header   string
+		versions []int64
+		ok       bool
+	}{
+		{"", nil, false},
+		{"*", nil, false},
+		{`"3"`, []int64{3}, true},
+		{`"2", "3"`, []int64{2, 3}, true},
+		{`W/"3"`, []int64{}, true},
+		{`W/"2", "3"`, []int64{3}, true},
+		{`"a", 3, "0"`, []int64{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			versions, ok := ifMatchVersions(tt.header)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.versions, versions)
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{fmt.Errorf("%w: denied", ErrForbidden), http.StatusForbidden},
+		{stored.ErrNotFound, http.StatusNotFound},
+		{stored.ErrAlreadyExists, http.StatusConflict},
+		{fmt.Errorf("%w: %w", stored.ErrDeleted, stored.ErrAlreadyExists), http.StatusConflict},
+		{&stored.ConflictError{ID: "a", ExpectedVersion: 1, ActualVersion: 2}, http.StatusPreconditionFailed},
+		{fmt.Errorf("%w: a", stored.ErrInvalidCondition), http.StatusBadRequest},
+		{fmt.Errorf("%w: a", ErrInvalidRequest), http.StatusBadRequest},
+		{errors.New("db error"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			assert.Equal(t, tt.code, Status(tt.err))
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package stored
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	internalDB "alielgamal.com/myservice/internal/db"
+)
+
+const (
+	countTemplateStmt     = "SELECT COUNT(*) FROM %v %v"
+	aggregateTemplateStmt = "SELECT %v FROM %v %v%v"
+)
+
+// AggregateFunction the function that Aggregate computes for every group of stored items
+type AggregateFunction string
+
+const (
+	// CountFunction counts the items of the group
+	CountFunction AggregateFunction = "count"
+
+	// MinFunction the minimum value of a column or a numeric attribute among the items of the group
+	MinFunction AggregateFunction = "min"
+
+	// MaxFunction the maximum value of a column or a numeric attribute among the items of the group
+	MaxFunction AggregateFunction = "max"
+)
+
+// TimeBucket the length of the time intervals that time columns are grouped by
+type TimeBucket string
+
+const (
+	// HourBucket groups by the hour
+	HourBucket TimeBucket = "hour"
+
+	// DayBucket groups by the day
+	DayBucket TimeBucket = "day"
+
+	// WeekBucket groups by the week, starting on Monday
+	WeekBucket TimeBucket = "week"
+
+	// MonthBucket groups by the month
+	MonthBucket TimeBucket = "month"
+
+	// YearBucket groups by the year
+	YearBucket TimeBucket = "year"
+)
+
+func (b TimeBucket) valid() bool {
+	switch b {
+	case HourBucket, DayBucket, WeekBucket, MonthBucket, YearBucket:
+		return true
+	}
+	return false
+}
+
+// GroupBy a column or a content attribute that stored items are grouped by. Either a Column or an Attribute should be
+// set.
+type GroupBy struct {
+	Column    Column
+	Attribute string
+
+	// Bucket groups the items of a time column by the start of the interval their time is in, like the week they
+	// were created in
+	Bucket TimeBucket
+}
+
+// Aggregation defines how Aggregate groups stored items and what it computes for every group
+type Aggregation struct {
+	// GroupBy the columns and attributes the items are grouped by. All the items form a single group if it is empty.
+	GroupBy []GroupBy
+
+	// Function the function computed for every group. Defaults to CountFunction.
+	Function AggregateFunction
+
+	// Column the column that MinFunction and MaxFunction are computed on. Either a Column or an Attribute should be set
+	// for them.
+	Column Column
+
+	// Attribute the numeric attribute that MinFunction and MaxFunction are computed on
+	Attribute string
+}
+
+// Group the result of an aggregation for a single group of stored items
+type Group struct {
+	// Keys the values that the items of the group share, in the same order as the GroupBy of the Aggregation. Missing
+	// attributes are nil.
+	Keys []any `json:"keys"`
+
+	// Value the result of the aggregation function. It is an int64 for CountFunction. It is nil if no item of the group
+	// has a value.
+	Value any `json:"value"`
+}
+
+func (s sqlStore[T]) Count(ctx context.Context, opts ...ReadOption) (int64, error) {
+	ctx, span := tracer.Start(ctx, "store.count")
+	defer span.End()
+
+	q, err := s.query(newReadOptions(opts))
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err = s.read(ctx, func(querier internalDB.Querier) error {
+		return querier.QueryRowContext(ctx, fmt.Sprintf(countTemplateStmt, s.table, q.whereClause()), q.params...).Scan(&count)
+	})
+	return count, err
+}
+
+func (s sqlStore[T]) Aggregate(ctx context.Context, agg Aggregation, opts ...ReadOption) ([]Group, error) {
+	ctx, span := tracer.Start(ctx, "store.aggregate")
+	defer span.End()
+
+	q, err := s.query(newReadOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	exprs := []string{}
+	orders := []string{}
+	for i, g := range agg.GroupBy {
+		expr, order, err := s.schema.groupByExpression(s.dialect, g)
+		if err != nil {
+			return nil, err
+		}
+		if order == "" {
+			order = fmt.Sprint(i + 1)
+		}
+		exprs = append(exprs, expr)
+		orders = append(orders, order)
+	}
+	value, err := s.schema.aggregateExpression(s.dialect, agg)
+	if err != nil {
+		return nil, err
+	}
+
+	groupClause := ""
+	if len(exprs) > 0 {
+		positions := make([]string, 0, len(exprs))
+		for i := range exprs {
+			positions = append(positions, fmt.Sprint(i+1))
+		}
+		groupClause = fmt.Sprintf(" GROUP BY %v ORDER BY %v", strings.Join(positions, ", "), strings.Join(orders, ", "))
+	}
+
+	aggregateStmt := fmt.Sprintf(aggregateTemplateStmt, strings.Join(append(exprs, value), ", "), s.table, q.whereClause(), groupClause)
+	result := []Group{}
+	err = s.read(ctx, func(querier internalDB.Querier) error {
+		rows, err := querier.QueryContext(ctx, aggregateStmt, q.params...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			// Attributes are scanned as JSON while columns are scanned as the type the driver decodes them to
+			values := make([]any, len(exprs)+1)
+			dest := make([]any, len(values))
+			for i := range values {
+				dest[i] = &values[i]
+			}
+			if err := rows.Scan(dest...); err != nil {
+				return err
+			}
+
+			g := Group{Keys: make([]any, len(exprs))}
+			for i, gb := range agg.GroupBy {
+				if g.Keys[i], err = scannedValue(values[i], gb.Attribute != "", gb.Column.isTime()); err != nil {
+					return err
+				}
+			}
+			if g.Value, err = scannedValue(values[len(exprs)], agg.Attribute != "", agg.Column.isTime()); err != nil {
+				return err
+			}
+			result = append(result, g)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// groupByExpression returns the SQL expression of a group by and the expression that the groups are sorted by, which
+// is empty if they are sorted by the group by expression
+func (s schema) groupByExpression(d dialect, g GroupBy) (expr string, order string, err error) {
+	if (g.Column == "") == (g.Attribute == "") {
+		return "", "", fmt.Errorf("%w: either a column or an attribute should be grouped by", ErrInvalidAggregation)
+	}
+	if g.Attribute != "" {
+		if g.Bucket != "" {
+			return "", "", fmt.Errorf("%w: attribute '%v' can't be bucketed", ErrInvalidAggregation, g.Attribute)
+		}
+		path, err := s.path(g.Attribute)
+		if err != nil {
+			return "", "", err
+		}
+		return d.value(path), d.groupOrder(path), nil
+	}
+
+	if !g.Column.valid() {
+		return "", "", fmt.Errorf("%w: unknown column '%v'", ErrInvalidAggregation, g.Column)
+	}
+	if g.Bucket == "" {
+		return string(g.Column), "", nil
+	}
+	if !g.Bucket.valid() {
+		return "", "", fmt.Errorf("%w: unknown bucket '%v'", ErrInvalidAggregation, g.Bucket)
+	}
+	if !g.Column.isTime() {
+		return "", "", fmt.Errorf("%w: column '%v' is not a time column", ErrInvalidAggregation, g.Column)
+	}
+	return d.bucket(g.Bucket, g.Column), "", nil
+}
+
+// aggregateExpression returns the SQL expression of the aggregation function
+func (s schema) aggregateExpression(d dialect, agg Aggregation) (string, error) {
+	switch agg.Function {
+	case "", CountFunction:
+		if agg.Column != "" || agg.Attribute != "" {
+			return "", fmt.Errorf("%w: %v doesn't accept a column or an attribute", ErrInvalidAggregation, CountFunction)
+		}
+		return "COUNT(*)", nil
+	case MinFunction, MaxFunction:
+	default:
+		return "", fmt.Errorf("%w: unknown function '%v'", ErrInvalidAggregation, agg.Function)
+	}
+
+	if (agg.Column == "") == (agg.Attribute == "") {
+		return "", fmt.Errorf("%w: %v requires either a column or an attribute", ErrInvalidAggregation, agg.Function)
+	}
+	if agg.Attribute != "" {
+		path, err := s.path(agg.Attribute)
+		if err != nil {
+			return "", err
+		}
+		return d.aggregate(agg.Function, path), nil
+	}
+	if !agg.Column.valid() {
+		return "", fmt.Errorf("%w: unknown column '%v'", ErrInvalidAggregation, agg.Column)
+	}
+	return fmt.Sprintf("%v(%v)", strings.ToUpper(string(agg.Function)), agg.Column), nil
+}
+
+// scannedValue returns the Go value of a scanned aggregation value, decoding the JSON of attributes. Drivers that can't
+// tell the type of computed times, like the SQLite driver, scan them as text, which is parsed for time columns.
+func scannedValue(scanned any, isJSON bool, isTime bool) (any, error) {
+	var raw []byte
+	switch v := scanned.(type) {
+	case []byte:
+		raw = v
+	case string:
+		if isTime {
+			return time.Parse(time.DateTime, v)
+		}
+		raw = []byte(v)
+	default:
+		return scanned, nil
+	}
+	if !isJSON {
+		return scanned, nil
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,264 @@
+package stored
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	internalDB "alielgamal.com/myservice/internal/db"
+)
+
+const (
+	addManyTemplateStmt   = "INSERT INTO %v(id, content, created_by, modified_by, created_at, modified_at%v) VALUES %v RETURNING id, created_at, modified_at, version"
+	addManyValuesTemplate = "($%v, $%v, $1, $1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP%v)"
+	savepointStmt         = "SAVEPOINT batch_item"
+	rollbackSavepointStmt = "ROLLBACK TO SAVEPOINT batch_item"
+	releaseSavepointStmt  = "RELEASE SAVEPOINT batch_item"
+
+	// addManyChunkSize the maximum number of rows per multi-row insert, which keeps the number of parameters far below
+	// the limits of Postgres and SQLite.
+	addManyChunkSize = 1000
+)
+
+// BatchMode controls how a batch write handles the items that fail to be written
+type BatchMode int
+
+const (
+	// AllOrNothing fails the whole batch and writes nothing if any item fails to be written
+	AllOrNothing BatchMode = iota
+
+	// PerItem writes the items that succeed and reports the error of each item that fails in its BatchResult
+	PerItem
+)
+
+// ItemPatch the attributes to patch in a single stored item of a batch
+type ItemPatch struct {
+	// ID the id of the stored item to patch
+	ID string `json:"id" binding:"required,min=1,max=36"`
+
+	// Version if not 0, the patch is only applied if the stored item is still at this version (see PatchVersion)
+	Version int64 `json:"version,omitempty"`
+
+	// Attributes the attributes to patch (see Patch)
+	Attributes map[string]any `json:"attributes" binding:"required"`
+}
+
+// BatchResult the result of writing a single item of a batch
+type BatchResult[T any] struct {
+	// Item the written stored item. It is nil if the item failed to be written.
+	Item *Stored[T]
+
+	// Err the reason the item failed to be written
+	Err error
+}
+
+// BatchItemError is returned when a batch in AllOrNothing mode fails because of a specific item
+type BatchItemError struct {
+	// Index the index of the failing item in the batch
+	Index int
+
+	// ID the id of the failing item
+	ID string
+
+	// Err the reason the item failed to be written
+	Err error
+}
+
+// Error returns a description of the failure
+func (e *BatchItemError) Error() string {
+	return fmt.Sprintf("batch item %v with id '%v' failed: %v", e.Index, e.ID, e.Err)
+}
+
+// Unwrap returns the reason the item failed to be written
+func (e *BatchItemError) Unwrap() error {
+	return e.Err
+}
+
+func (s sqlStore[T]) AddMany(ctx context.Context, creator string, items []Stored[T], mode BatchMode, opts ...WriteOption) ([]BatchResult[T], error) {
+	ctx, span := tracer.Start(ctx, "store.addMany")
+	defer span.End()
+
+	w, err := newWriteOptions(s.expiry, opts)
+	if err != nil {
+		return nil, err
+	}
+	if mode == AllOrNothing {
+		if err := duplicateID(s.table, items); err != nil {
+			return nil, err
+		}
+	}
+	var results []BatchResult[T]
+	err = s.inTx(ctx, func(tx internalDB.Tx) error {
+		var err error
+		if mode == PerItem {
+			results, err = batchPerItem(ctx, tx, items, func(item Stored[T]) (*Stored[T], error) {
+				return s.addTx(ctx, tx, creator, item.ID, item.Content, w)
+			})
+			return err
+		}
+
+		results = make([]BatchResult[T], 0, len(items))
+		for start := 0; start < len(items); start += addManyChunkSize {
+			added, err := s.addChunk(ctx, tx, creator, start, items[start:min(start+addManyChunkSize, len(items))], w)
+			if err != nil {
+				return err
+			}
+			results = append(results, added...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	deletedIDErrors(ctx, s, s.softDelete, items, results)
+	return results, nil
+}
+
+// addChunk adds the items using a single multi-row insert. If the insert fails, it is not known which item caused it.
+// The items start at the passed index of the batch.
+func (s sqlStore[T]) addChunk(ctx context.Context, tx internalDB.Tx, creator string, first int, items []Stored[T], w writeOptions) ([]BatchResult[T], error) {
+	columns, columnValues := tenantInsert(s.dialect, s.tenancy)
+	values := make([]string, 0, len(items))
+	params := []any{creator}
+	if s.expiry {
+		// All the items share the expiry of the write
+		params = append(params, expiresAtParam(w.expiresAt))
+		columns += ", " + expiresAtColumn
+		columnValues += fmt.Sprintf(", $%v", len(params))
+	}
+	contents := make([][]byte, 0, len(items))
+	ids := make([]string, 0, len(items))
+	for i, item := range items {
+		if err := s.validate(item.Content); err != nil {
+			return nil, &BatchItemError{Index: first + i, ID: item.ID, Err: err}
+		}
+		contentJSON, err := json.Marshal(item.Content)
+		if err != nil {
+			return nil, &BatchItemError{Index: first + i, ID: item.ID, Err: err}
+		}
+		values = append(values, fmt.Sprintf(addManyValuesTemplate, len(params)+1, len(params)+2, columnValues))
+		params = append(params, item.ID, contentJSON)
+		contents = append(contents, contentJSON)
+		ids = append(ids, item.ID)
+	}
+	if err := s.purgeExpired(ctx, tx, ids...); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(addManyTemplateStmt, s.table, columns, strings.Join(values, ", ")), params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Rows are matched by id since the order of the returned rows is not guaranteed
+	added := map[string]*Stored[T]{}
+	for rows.Next() {
+		r := &Stored[T]{CreatedBy: creator, ModifiedBy: creator, ExpiresAt: w.expiresAt}
+		if err := rows.Scan(&r.ID, &r.CreatedAt, &r.ModifiedAt, &r.Version); err != nil {
+			return nil, err
+		}
+		added[r.ID] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult[T], 0, len(items))
+	for i, item := range items {
+		r, ok := added[item.ID]
+		if !ok {
+			return nil, &BatchItemError{Index: first + i, ID: item.ID, Err: errors.New("the insert returned no row for the item")}
+		}
+		r.Content = item.Content
+		if err := s.afterWrite(ctx, tx, AddOperation, item.ID, creator, json.RawMessage(contents[i]), w); err != nil {
+			return nil, err
+		}
+		results = append(results, BatchResult[T]{Item: r})
+	}
+	return results, nil
+}
+
+func (s sqlStore[T]) PatchMany(ctx context.Context, updater string, patches []ItemPatch, mode BatchMode, opts ...WriteOption) ([]BatchResult[T], error) {
+	ctx, span := tracer.Start(ctx, "store.patchMany")
+	defer span.End()
+
+	w, err := newWriteOptions(s.expiry, opts)
+	if err != nil {
+		return nil, err
+	}
+	var results []BatchResult[T]
+	err = s.inTx(ctx, func(tx internalDB.Tx) error {
+		var err error
+		if mode == PerItem {
+			results, err = batchPerItem(ctx, tx, patches, func(p ItemPatch) (*Stored[T], error) {
+				return s.patchTx(ctx, tx, updater, p.ID, p.Version, p.Attributes, w)
+			})
+			return err
+		}
+
+		results = make([]BatchResult[T], 0, len(patches))
+		for i, p := range patches {
+			patched, err := s.patchTx(ctx, tx, updater, p.ID, p.Version, p.Attributes, w)
+			if err != nil {
+				return &BatchItemError{Index: i, ID: p.ID, Err: storeError(err)}
+			}
+			results = append(results, BatchResult[T]{Item: patched})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// duplicateID returns a *BatchItemError for the first item that has the id of an earlier item of the batch, which
+// fails like adding an id that is already used. A multi-row insert can't tell which of its items failed otherwise.
+func duplicateID[T any](table string, items []Stored[T]) error {
+	seen := make(map[string]int, len(items))
+	for i, item := range items {
+		if j, ok := seen[item.ID]; ok {
+			return &BatchItemError{Index: i, ID: item.ID, Err: idInUse(table, fmt.Errorf("the id is used by batch item %v", j))}
+		}
+		seen[item.ID] = i
+	}
+	return nil
+}
+
+// deletedIDErrors wraps the errors of the items of a batch that failed to be added using deletedIDError. It is called
+// once the batch is written since it reads from the store.
+func deletedIDErrors[T any](ctx context.Context, s Store[T], softDelete bool, items []Stored[T], results []BatchResult[T]) {
+	for i := range results {
+		if results[i].Err != nil {
+			results[i].Err = deletedIDError(ctx, s, softDelete, items[i].ID, results[i].Err)
+		}
+	}
+}
+
+// batchPerItem writes every item within its own savepoint, so that a failing item only rolls back its own write
+func batchPerItem[T any, I any](ctx context.Context, tx internalDB.Tx, items []I, write func(I) (*Stored[T], error)) ([]BatchResult[T], error) {
+	results := make([]BatchResult[T], 0, len(items))
+	for _, item := range items {
+		if _, err := tx.ExecContext(ctx, savepointStmt); err != nil {
+			return nil, err
+		}
+
+		written, err := write(item)
+		if err != nil {
+			if _, err := tx.ExecContext(ctx, rollbackSavepointStmt); err != nil {
+				return nil, err
+			}
+			results = append(results, BatchResult[T]{Err: storeError(err)})
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, releaseSavepointStmt); err != nil {
+			return nil, err
+		}
+		results = append(results, BatchResult[T]{Item: written})
+	}
+	return results, nil
+}
@@ -0,0 +1,341 @@
+package stored
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultCacheSize     = 1000
+	defaultCacheTTL      = time.Minute
+	cacheRewatchInterval = 5 * time.Second
+
+	// cacheLoadTimeout bounds the reads of the items that miss the cache, which are not canceled with the Gets that
+	// wait for them
+	cacheLoadTimeout = 30 * time.Second
+)
+
+var meter = otel.Meter("myservice/store")
+
+// CacheOption configures a store created by NewCachedStore
+type CacheOption func(*cacheOptions)
+
+type cacheOptions struct {
+	size int
+	ttl  time.Duration
+}
+
+// WithCacheSize bounds the number of items kept in the cache (default 1000). The least recently read items are
+// evicted first.
+func WithCacheSize(size int) CacheOption {
+	return func(o *cacheOptions) {
+		o.size = size
+	}
+}
+
+// WithCacheTTL sets how long items are kept in the cache after they are read from the store (default one minute),
+// which bounds how stale reads are when the writes of other replicas can't be watched.
+func WithCacheTTL(ttl time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.ttl = ttl
+	}
+}
+
+type skipCacheKey struct{}
+
+// SkipCache returns a context that makes CachedStore reads go to the wrapped store. Mark the context of reads whose
+// result is written back, which must not be stale.
+func SkipCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipCacheKey{}, true)
+}
+
+func skipCache(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipCacheKey{}).(bool)
+	return skip
+}
+
+// CachedStore is a Store that serves Get from a bounded LRU cache of the items of the wrapped store. All other methods
+// go to the wrapped store. Concurrent Gets that miss the same item read it from the wrapped store once, using the
+// values of the context of the first of them but not its cancellation, so that the other Gets don't fail when it is
+// canceled. Every Get stops waiting when its own context is done.
+// Writes through the CachedStore drop the written items from the cache. The writes of other replicas are dropped by
+// watching the wrapped store if it can be watched (see WithListener), otherwise the cached items are stale for up to
+// the TTL.
+// Gets that are passed read options and Gets of contexts marked using SkipCache bypass the cache. Cached items are only
+// served to the tenant of the context they were read using (see ForTenant). The returned items share the values
+// referenced by their content with the cache, so they must not be modified.
+type CachedStore[T any] struct {
+	Store[T]
+
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	// generation is incremented by every invalidation, so that the items read before are not cached
+	generation uint64
+	loads      singleflight.Group
+
+	hits       metric.Int64Counter
+	misses     metric.Int64Counter
+	evictions  metric.Int64Counter
+	attributes metric.MeasurementOption
+}
+
+// cacheEntry an item kept by a CachedStore
+type cacheEntry[T any] struct {
+	id string
+	// tenant the tenant of the context that the item was read using, which is the only tenant it is served to
+	tenant    string
+	item      *Stored[T]
+	expiresAt time.Time
+}
+
+// cacheLoad the result of reading an item from the wrapped store, which is shared by concurrent Gets of the same tenant
+type cacheLoad[T any] struct {
+	tenant string
+	item   *Stored[T]
+	err    error
+}
+
+// NewCachedStore creates a CachedStore of the items of store, which is stored in table. The table names the metrics of
+// the cache. The writes of other replicas are watched until ctx is done.
+func NewCachedStore[T any](ctx context.Context, table string, store Store[T], opts ...CacheOption) *CachedStore[T] {
+	o := cacheOptions{size: defaultCacheSize, ttl: defaultCacheTTL}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	hits, _ := meter.Int64Counter("store.cache.hits", metric.WithDescription("Number of Gets served from the cache"), metric.WithUnit("Count"))
+	misses, _ := meter.Int64Counter("store.cache.misses", metric.WithDescription("Number of Gets read from the store"), metric.WithUnit("Count"))
+	evictions, _ := meter.Int64Counter("store.cache.evictions", metric.WithDescription("Number of items evicted from the cache"), metric.WithUnit("Count"))
+
+	s := &CachedStore[T]{
+		Store:      store,
+		size:       o.size,
+		ttl:        o.ttl,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+		hits:       hits,
+		misses:     misses,
+		evictions:  evictions,
+		attributes: metric.WithAttributes(attribute.String("table", table)),
+	}
+	go s.watch(ctx)
+	return s
+}
+
+// watch drops the items written by other replicas from the cache until ctx is done. It purges the cache whenever
+// writes may have been missed.
+func (s *CachedStore[T]) watch(ctx context.Context) {
+	for {
+		changes, err := s.Store.Watch(AllTenants(ctx))
+		if errors.Is(err, ErrWatchDisabled) {
+			return
+		}
+		if err == nil {
+			// The writes made before watching were missed
+			s.Purge()
+			for c := range changes {
+				s.Invalidate(c.ID)
+			}
+		}
+		s.Purge()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cacheRewatchInterval):
+		}
+	}
+}
+
+// Invalidate drops an item from the cache
+func (s *CachedStore[T]) Invalidate(id string) {
+	s.mu.Lock()
+	s.generation++
+	if e, ok := s.entries[id]; ok {
+		s.lru.Remove(e)
+		delete(s.entries, id)
+	}
+	s.mu.Unlock()
+	s.loads.Forget(id)
+}
+
+// Purge drops all items from the cache
+func (s *CachedStore[T]) Purge() {
+	s.mu.Lock()
+	s.generation++
+	ids := make([]string, 0, len(s.entries))
+	for id := range s.entries {
+		ids = append(ids, id)
+	}
+	s.entries = map[string]*list.Element{}
+	s.lru.Init()
+	s.mu.Unlock()
+	for _, id := range ids {
+		s.loads.Forget(id)
+	}
+}
+
+func (s *CachedStore[T]) Get(ctx context.Context, id string, opts ...ReadOption) (*Stored[T], error) {
+	if len(opts) > 0 || skipCache(ctx) {
+		return s.Store.Get(ctx, id, opts...)
+	}
+
+	tenant, _ := tenantOf(ctx)
+	if item, ok := s.cached(id, tenant); ok {
+		s.hits.Add(ctx, 1, s.attributes)
+		return item, nil
+	}
+	s.misses.Add(ctx, 1, s.attributes)
+
+	loads := s.loads.DoChan(id, func() (any, error) {
+		s.mu.Lock()
+		generation := s.generation
+		s.mu.Unlock()
+
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cacheLoadTimeout)
+		defer cancel()
+		item, err := s.Store.Get(loadCtx, id)
+		if err == nil {
+			s.cache(loadCtx, id, tenant, item, generation)
+		}
+		return cacheLoad[T]{tenant: tenant, item: item, err: err}, nil
+	})
+	var load cacheLoad[T]
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-loads:
+		load = result.Val.(cacheLoad[T])
+	}
+	if load.tenant != tenant {
+		// The item was read for another tenant, which may not see the same item
+		return s.Store.Get(ctx, id)
+	}
+	if load.err != nil {
+		return nil, load.err
+	}
+	item := *load.item
+	return &item, nil
+}
+
+// cached returns a copy of the cached item if it was read for the tenant and neither the entry nor the item has expired
+func (s *CachedStore[T]) cached(id string, tenant string) (*Stored[T], bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[id]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry[T])
+	if entry.tenant != tenant {
+		return nil, false
+	}
+	if !time.Now().Before(entry.expiresAt) {
+		s.lru.Remove(e)
+		delete(s.entries, id)
+		return nil, false
+	}
+	s.lru.MoveToFront(e)
+	item := *entry.item
+	return &item, true
+}
+
+// cache keeps an item read at the passed generation unless it has been invalidated since, evicting the least recently
+// read item if the cache is full
+func (s *CachedStore[T]) cache(ctx context.Context, id string, tenant string, item *Stored[T], generation uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if generation != s.generation {
+		return
+	}
+	entry := &cacheEntry[T]{id: id, tenant: tenant, item: item, expiresAt: time.Now().Add(s.ttl)}
+	if item.ExpiresAt != nil && item.ExpiresAt.Before(entry.expiresAt) {
+		// The item is missing from the store once it expires
+		entry.expiresAt = *item.ExpiresAt
+	}
+	if e, ok := s.entries[id]; ok {
+		e.Value = entry
+		s.lru.MoveToFront(e)
+		return
+	}
+	s.entries[id] = s.lru.PushFront(entry)
+
+	for s.lru.Len() > s.size {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*cacheEntry[T]).id)
+		s.evictions.Add(ctx, 1, s.attributes)
+	}
+}
+
+func (s *CachedStore[T]) Add(ctx context.Context, creator string, id string, content T, opts ...WriteOption) (*Stored[T], error) {
+	defer s.Invalidate(id)
+	return s.Store.Add(ctx, creator, id, content, opts...)
+}
+
+func (s *CachedStore[T]) Patch(ctx context.Context, updater string, id string, attributes map[string]any, opts ...WriteOption) (*Stored[T], error) {
+	defer s.Invalidate(id)
+	return s.Store.Patch(ctx, updater, id, attributes, opts...)
+}
+
+func (s *CachedStore[T]) PatchVersion(ctx context.Context, updater string, id string, version int64, attributes map[string]any, opts ...WriteOption) (*Stored[T], error) {
+	defer s.Invalidate(id)
+	return s.Store.PatchVersion(ctx, updater, id, version, attributes, opts...)
+}
+
+func (s *CachedStore[T]) AddMany(ctx context.Context, creator string, items []Stored[T], mode BatchMode, opts ...WriteOption) ([]BatchResult[T], error) {
+	defer func() {
+		for _, item := range items {
+			s.Invalidate(item.ID)
+		}
+	}()
+	return s.Store.AddMany(ctx, creator, items, mode, opts...)
+}
+
+func (s *CachedStore[T]) PatchMany(ctx context.Context, updater string, patches []ItemPatch, mode BatchMode, opts ...WriteOption) ([]BatchResult[T], error) {
+	defer func() {
+		for _, p := range patches {
+			s.Invalidate(p.ID)
+		}
+	}()
+	return s.Store.PatchMany(ctx, updater, patches, mode, opts...)
+}
+
+func (s *CachedStore[T]) Put(ctx context.Context, updater string, id string, content T, opts ...WriteOption) (*Stored[T], error) {
+	defer s.Invalidate(id)
+	return s.Store.Put(ctx, updater, id, content, opts...)
+}
+
+func (s *CachedStore[T]) PutVersion(ctx context.Context, updater string, id string, version int64, content T, opts ...WriteOption) (*Stored[T], error) {
+	defer s.Invalidate(id)
+	return s.Store.PutVersion(ctx, updater, id, version, content, opts...)
+}
+
+func (s *CachedStore[T]) Upsert(ctx context.Context, actor string, id string, content T, opts ...WriteOption) (*Stored[T], error) {
+	defer s.Invalidate(id)
+	return s.Store.Upsert(ctx, actor, id, content, opts...)
+}
+
+func (s *CachedStore[T]) Delete(ctx context.Context, deleter string, id string) error {
+	defer s.Invalidate(id)
+	return s.Store.Delete(ctx, deleter, id)
+}
+
+func (s *CachedStore[T]) Restore(ctx context.Context, restorer string, id string) (*Stored[T], error) {
+	defer s.Invalidate(id)
+	return s.Store.Restore(ctx, restorer, id)
+}
@@ -0,0 +1,312 @@
+package stored
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore counts the Gets that reach the wrapped store. Gets wait for release if it is set, then fail if their
+// context is done. It can't be watched, so that the cache only drops the items written through it.
+type countingStore[T any] struct {
+	Store[T]
+	gets    atomic.Int64
+	release chan struct{}
+}
+
+func (s *countingStore[T]) Get(ctx context.Context, id string, opts ...ReadOption) (*Stored[T], error) {
+	s.gets.Add(1)
+	if s.release != nil {
+		<-s.release
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.Store.Get(ctx, id, opts...)
+}
+
+func (s *countingStore[T]) Watch(context.Context, ...Condition) (<-chan Change[T], error) {
+	return nil, ErrWatchDisabled
+}
+
+func TestCachedStore(t *testing.T) {
+	type content struct {
+		I int    `json:"i"`
+		S string `json:"s"`
+	}
+	admin := "admin@example.com"
+	table := "stored"
+	id := "id1"
+	fixture := content{I: 5, S: "Some Text"}
+
+	newCachedStore := func(t *testing.T, store Store[content], opts ...CacheOption) (*CachedStore[content], *countingStore[content]) {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		counting := &countingStore[content]{Store: store}
+		return NewCachedStore[content](ctx, table, counting, opts...), counting
+	}
+
+	t.Run("Serves Get from the cache", func(t *testing.T) {
+		ctx := context.Background()
+		s, counting := newCachedStore(t, NewMemoryStore[content](table))
+		added, err := s.Add(ctx, admin, id, fixture)
+		require.NoError(t, err)
+
+		for range 3 {
+			fetched, err := s.Get(ctx, id)
+			require.NoError(t, err)
+			assert.Equal(t, *added, *fetched)
+		}
+		assert.Equal(t, int64(1), counting.gets.Load())
+
+		_, err = s.Get(ctx, "missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.Get(ctx, "missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Equal(t, int64(3), counting.gets.Load(), "Missing items are not cached")
+	})
+
+	t.Run("Bypasses the cache for projections and marked contexts", func(t *testing.T) {
+		ctx := context.Background()
+		s, counting := newCachedStore(t, NewMemoryStore[content](table, WithSoftDelete()))
+		_, err := s.Add(ctx, admin, id, fixture)
+		require.NoError(t, err)
+		_, err = s.Get(ctx, id)
+		require.NoError(t, err)
+
+		projected, err := s.Get(ctx, id, Fields("i"))
+		require.NoError(t, err)
+		assert.Equal(t, content{I: fixture.I}, projected.Content)
+		_, err = s.Get(ctx, id, IncludeDeleted())
+		require.NoError(t, err)
+		_, err = s.Get(SkipCache(ctx), id)
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), counting.gets.Load())
+
+		fetched, err := s.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, fixture, fetched.Content, "Projected reads are not cached")
+	})
+
+	t.Run("Serves items only to the tenant they were read for", func(t *testing.T) {
+		tenantA := ForTenant(context.Background(), "a")
+		tenantB := ForTenant(context.Background(), "b")
+		s, counting := newCachedStore(t, NewMemoryStore[content](table, WithTenancy()))
+		_, err := s.Add(tenantA, admin, id, fixture)
+		require.NoError(t, err)
+
+		_, err = s.Get(tenantA, id)
+		require.NoError(t, err)
+		_, err = s.Get(tenantA, id)
+		require.NoError(t, err)
+		_, err = s.Get(tenantB, id)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Equal(t, int64(2), counting.gets.Load())
+	})
+
+	t.Run("Drops written items", func(t *testing.T) {
+		ctx := context.Background()
+		s, _ := newCachedStore(t, NewMemoryStore[content](table))
+		added, err := s.Add(ctx, admin, id, fixture)
+		require.NoError(t, err)
+
+		writes := map[string]func() error{
+			"Patch": func() error {
+				_, err := s.Patch(ctx, admin, id, map[string]any{"i": 6})
+				return err
+			},
+			"PatchVersion": func() error {
+				fetched, err := s.Get(ctx, id)
+				require.NoError(t, err)
+				_, err = s.PatchVersion(ctx, admin, id, fetched.Version, map[string]any{"i": 7})
+				return err
+			},
+			"Put": func() error {
+				_, err := s.Put(ctx, admin, id, content{I: 8})
+				return err
+			},
+			"Upsert": func() error {
+				_, err := s.Upsert(ctx, admin, id, content{I: 9})
+				return err
+			},
+			"PatchMany": func() error {
+				_, err := s.PatchMany(ctx, admin, []ItemPatch{{ID: id, Attributes: map[string]any{"i": 10}}}, AllOrNothing)
+				return err
+			},
+		}
+		version := added.Version
+		for name, write := range writes {
+			_, err := s.Get(ctx, id)
+			require.NoError(t, err)
+			require.NoError(t, write(), name)
+
+			fetched, err := s.Get(ctx, id)
+			require.NoError(t, err)
+			assert.Greater(t, fetched.Version, version, name)
+			version = fetched.Version
+		}
+
+		require.NoError(t, s.Delete(ctx, admin, id))
+		_, err = s.Get(ctx, id)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Drops items written by other replicas", func(t *testing.T) {
+		ctx := context.Background()
+		store := NewMemoryStore[content](table)
+		s := NewCachedStore[content](t.Context(), table, store)
+		other := NewCachedStore[content](t.Context(), table, store)
+		_, err := s.Add(ctx, admin, id, fixture)
+		require.NoError(t, err)
+		_, err = s.Get(ctx, id)
+		require.NoError(t, err)
+
+		_, err = other.Patch(ctx, admin, id, map[string]any{"i": 6})
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			fetched, err := s.Get(ctx, id)
+			return err == nil && fetched.Content.I == 6
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Expires items after the TTL", func(t *testing.T) {
+		ctx := context.Background()
+		s, counting := newCachedStore(t, NewMemoryStore[content](table), WithCacheTTL(10*time.Millisecond))
+		_, err := s.Add(ctx, admin, id, fixture)
+		require.NoError(t, err)
+
+		_, err = s.Get(ctx, id)
+		require.NoError(t, err)
+		time.Sleep(20 * time.Millisecond)
+		_, err = s.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), counting.gets.Load())
+	})
+
+	t.Run("Expires items when they expire in the store", func(t *testing.T) {
+		ctx := context.Background()
+		s, _ := newCachedStore(t, NewMemoryStore[content](table, WithExpiry()))
+		_, err := s.Add(ctx, admin, id, fixture, ExpireAt(time.Now().Add(20*time.Millisecond)))
+		require.NoError(t, err)
+
+		_, err = s.Get(ctx, id)
+		require.NoError(t, err)
+		time.Sleep(30 * time.Millisecond)
+		_, err = s.Get(ctx, id)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Evicts the least recently read items", func(t *testing.T) {
+		ctx := context.Background()
+		s, counting := newCachedStore(t, NewMemoryStore[content](table), WithCacheSize(2))
+		for _, id := range []string{"a", "b", "c"} {
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+		}
+
+		for _, id := range []string{"a", "b", "a", "c"} {
+			_, err := s.Get(ctx, id)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, int64(3), counting.gets.Load())
+
+		_, err := s.Get(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), counting.gets.Load())
+		_, err = s.Get(ctx, "b")
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), counting.gets.Load(), "b was evicted")
+	})
+
+	t.Run("Reads concurrent misses once", func(t *testing.T) {
+		ctx := context.Background()
+		s, counting := newCachedStore(t, NewMemoryStore[content](table))
+		_, err := s.Add(ctx, admin, id, fixture)
+		require.NoError(t, err)
+
+		counting.release = make(chan struct{})
+		wg := sync.WaitGroup{}
+		for range 10 {
+			wg.Go(func() {
+				fetched, err := s.Get(ctx, id)
+				assert.NoError(t, err)
+				assert.Equal(t, fixture, fetched.Content)
+			})
+		}
+		assert.Eventually(t, func() bool {
+			return counting.gets.Load() > 0
+		}, time.Second, time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		close(counting.release)
+		wg.Wait()
+		assert.Equal(t, int64(1), counting.gets.Load())
+	})
+
+	t.Run("Keeps reading a miss when the first Get is canceled", func(t *testing.T) {
+		ctx := context.Background()
+		s, counting := newCachedStore(t, NewMemoryStore[content](table))
+		_, err := s.Add(ctx, admin, id, fixture)
+		require.NoError(t, err)
+
+		counting.release = make(chan struct{})
+		firstCtx, cancelFirst := context.WithCancel(ctx)
+		first := make(chan error)
+		go func() {
+			_, err := s.Get(firstCtx, id)
+			first <- err
+		}()
+		assert.Eventually(t, func() bool {
+			return counting.gets.Load() > 0
+		}, time.Second, time.Millisecond)
+
+		second := make(chan *Stored[content])
+		go func() {
+			fetched, err := s.Get(ctx, id)
+			assert.NoError(t, err)
+			second <- fetched
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		cancelFirst()
+		assert.ErrorIs(t, <-first, context.Canceled, "the canceled Get stops waiting for the read")
+		close(counting.release)
+		fetched := <-second
+		require.NotNil(t, fetched)
+		assert.Equal(t, fixture, fetched.Content)
+		assert.Equal(t, int64(1), counting.gets.Load())
+
+		_, err = s.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), counting.gets.Load(), "the read item is cached")
+	})
+
+	t.Run("Doesn't cache items read before a write", func(t *testing.T) {
+		ctx := context.Background()
+		s, counting := newCachedStore(t, NewMemoryStore[content](table))
+		_, err := s.Add(ctx, admin, id, fixture)
+		require.NoError(t, err)
+
+		counting.release = make(chan struct{})
+		read := make(chan struct{})
+		go func() {
+			defer close(read)
+			_, err := s.Get(ctx, id)
+			assert.NoError(t, err)
+		}()
+		assert.Eventually(t, func() bool {
+			return counting.gets.Load() > 0
+		}, time.Second, time.Millisecond)
+		s.Invalidate(id)
+		close(counting.release)
+		<-read
+
+		_, err = s.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), counting.gets.Load())
+	})
+}
@@ -0,0 +1,213 @@
+package stored
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	internalDB "alielgamal.com/myservice/internal/db"
+)
+
+// SchemaChecker is implemented by the stores whose tables can be checked against the schema required by their options
+type SchemaChecker interface {
+	// CheckSchema returns an error wrapping ErrSchemaMismatch if a table of the store misses a column, an index, a
+	// trigger or the row-level security required by the options of the store
+	CheckSchema(ctx context.Context) error
+}
+
+const (
+	// indexesStmt selects the definitions of the indexes of the Postgres table passed as $1
+	indexesStmt = "SELECT indexdef FROM pg_indexes WHERE schemaname = current_schema() AND tablename = $1"
+
+	// triggerFunctionsStmt selects the functions run by the triggers of the Postgres table passed as $1
+	triggerFunctionsStmt = "SELECT p.proname FROM pg_trigger t JOIN pg_proc p ON p.oid = t.tgfoid WHERE t.tgrelid = to_regclass($1) AND NOT t.tgisinternal"
+
+	// rowSecurityStmt selects whether row-level security is enabled and forced on the Postgres table passed as $1
+	rowSecurityStmt = "SELECT relrowsecurity, relforcerowsecurity FROM pg_class WHERE oid = to_regclass($1)"
+)
+
+// Registry the stores whose tables are checked at startup and whose expired items are deleted by a Reaper, by table.
+// The zero value is not usable; create registries using NewRegistry.
+type Registry struct {
+	mu     sync.Mutex
+	stores map[string]any
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{stores: map[string]any{}}
+}
+
+// Register adds a store to the registry, replacing the store registered for the same table. Stores that neither have
+// a table to check nor expire items are ignored.
+func Register[T any](r *Registry, table string, store Store[T]) {
+	_, checker := store.(SchemaChecker)
+	_, reapable := store.(Reapable)
+	if !checker && !reapable {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stores[table] = store
+}
+
+// registeredStores returns the tables of the stores of the registry that implement I, sorted by name, and the stores
+func registeredStores[I any](r *Registry) ([]string, []I) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tables := []string{}
+	stores := []I{}
+	for _, table := range slices.Sorted(maps.Keys(r.stores)) {
+		if s, ok := r.stores[table].(I); ok {
+			tables = append(tables, table)
+			stores = append(stores, s)
+		}
+	}
+	return tables, stores
+}
+
+// Check checks the tables of all the registered stores, which is meant to be done at startup after running the
+// migrations. The errors of all the tables that don't match are joined.
+func (r *Registry) Check(ctx context.Context) error {
+	_, stores := registeredStores[SchemaChecker](r)
+
+	errs := []error{}
+	for _, s := range stores {
+		errs = append(errs, s.CheckSchema(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+func (s sqlStore[T]) CheckSchema(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "store.checkSchema")
+	defer span.End()
+
+	required := []string{string(IDColumn), contentColumn, string(CreatedAtColumn), string(ModifiedAtColumn),
+		string(CreatedByColumn), string(ModifiedByColumn), "version"}
+	if s.softDelete {
+		required = append(required, "deleted_at", "deleted_by")
+	}
+	if s.tenancy {
+		required = append(required, tenantColumn)
+	}
+	if s.search {
+		required = append(required, searchColumn)
+	}
+	if s.expiry {
+		required = append(required, expiresAtColumn)
+	}
+	err := s.checkColumns(ctx, s.table, required)
+	if err == nil && internalDB.DriverOf(s.db) != internalDB.SQLiteDriver {
+		// SQLite tables have neither the indexes of JSONB nor triggers nor row-level security
+		err = s.checkPostgresTable(ctx, s.table)
+	}
+
+	if s.history {
+		required := []string{"revision", string(IDColumn), "version", "operation", contentColumn, "diff", "actor", "at"}
+		if s.tenancy {
+			required = append(required, tenantColumn)
+		}
+		historyErr := s.checkColumns(ctx, s.table+historyTableSuffix, required)
+		if historyErr == nil && s.tenancy && internalDB.DriverOf(s.db) != internalDB.SQLiteDriver {
+			historyErr = s.checkRowSecurity(ctx, s.table+historyTableSuffix)
+		}
+		err = errors.Join(err, historyErr)
+	}
+	return err
+}
+
+// checkPostgresTable returns an error if the Postgres table of the store misses an index, a trigger or the row-level
+// security required by the options of the store
+func (s sqlStore[T]) checkPostgresTable(ctx context.Context, table string) error {
+	indexes, err := s.selectStrings(ctx, indexesStmt, table)
+	if err != nil {
+		return err
+	}
+	missing := []string{}
+	if !slices.ContainsFunc(indexes, func(def string) bool { return strings.Contains(def, "USING gin ("+contentColumn) }) {
+		missing = append(missing, "the GIN index of "+contentColumn)
+	}
+	if s.search && !slices.ContainsFunc(indexes, func(def string) bool { return strings.Contains(def, "USING gin ("+searchColumn) }) {
+		missing = append(missing, "the GIN index of "+searchColumn)
+	}
+
+	functions, err := s.selectStrings(ctx, triggerFunctionsStmt, table)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(functions, "update_modified_at") {
+		missing = append(missing, "the trigger running update_modified_at")
+	}
+	if s.newListener != nil && !slices.Contains(functions, "stored_notify") {
+		missing = append(missing, "the trigger running stored_notify")
+	}
+
+	if len(missing) > 0 {
+		err = fmt.Errorf("%w: table %v misses %v", ErrSchemaMismatch, table, strings.Join(missing, ", "))
+	}
+	if s.tenancy {
+		err = errors.Join(err, s.checkRowSecurity(ctx, table))
+	}
+	return err
+}
+
+// checkRowSecurity returns an error unless row-level security is enabled and forced on the Postgres table, which
+// multi-tenant stores rely on to scope every statement to the tenant
+func (s sqlStore[T]) checkRowSecurity(ctx context.Context, table string) error {
+	var enabled, forced bool
+	if err := s.db.QueryRowContext(ctx, rowSecurityStmt, table).Scan(&enabled, &forced); err != nil {
+		return err
+	}
+	if !enabled || !forced {
+		return fmt.Errorf("%w: table %v doesn't enable and force row-level security", ErrSchemaMismatch, table)
+	}
+	return nil
+}
+
+// selectStrings returns the strings selected by a statement that is passed the table as $1
+func (s sqlStore[T]) selectStrings(ctx context.Context, stmt string, table string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, stmt, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, rows.Err()
+}
+
+// checkColumns returns an error if the table misses any of the required columns
+func (s sqlStore[T]) checkColumns(ctx context.Context, table string, required []string) error {
+	selected, err := s.selectStrings(ctx, s.dialect.columnsStmt(), table)
+	if err != nil {
+		return err
+	}
+	columns := map[string]bool{}
+	for _, column := range selected {
+		columns[column] = true
+	}
+
+	if len(columns) == 0 {
+		return fmt.Errorf("%w: table %v doesn't exist", ErrSchemaMismatch, table)
+	}
+	missing := []string{}
+	for _, c := range required {
+		if !columns[c] {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: table %v misses the columns %v", ErrSchemaMismatch, table, missing)
+	}
+	return nil
+}
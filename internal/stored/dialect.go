@@ -0,0 +1,210 @@
+package stored
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	internalDB "alielgamal.com/myservice/internal/db"
+)
+
+// dialect renders the SQL that differs between the DBs that stores support. The rest of the statements are written for
+// Postgres and are translated for the other DBs by internalDB.SQLDB.
+type dialect interface {
+	// value returns the expression of the JSON value at the path inside the content, which is NULL if it is missing
+	value(path attributePath) string
+
+	// without returns the expression of the JSON value of expr without the attributes at the paths
+	without(expr string, paths []attributePath) string
+
+	// set returns the assignments that write the JSON values of the placeholders at the paths inside the content
+	set(paths []attributePath, placeholders []string) string
+
+	// condition returns the SQL of a valid condition on the attribute at the path
+	condition(q *queryBuilder, path attributePath, c Condition) (string, error)
+
+	// sortExpression returns the expression that items are sorted by the attribute at the path. Missing attributes are
+	// sorted as JSON null to keep the order total.
+	sortExpression(path attributePath) string
+
+	// sortValue returns the expression of the JSON value that cursors keep for the attribute at the path
+	sortValue(path attributePath) string
+
+	// cursorParam returns the query param that compares the JSON value kept by a cursor with the sort expression
+	cursorParam(value json.RawMessage) (any, error)
+
+	// object returns the expression of a JSON object built from the expressions of its keys and values
+	object(args []string) string
+
+	// groupOrder returns the expression that the groups of the attribute at the path are sorted by, or an empty string
+	// if they are sorted by the group key itself
+	groupOrder(path attributePath) string
+
+	// bucket returns the expression of the start of the interval of the time column
+	bucket(b TimeBucket, column Column) string
+
+	// aggregate returns the expression of the aggregation function on the numeric attribute at the path
+	aggregate(fn AggregateFunction, path attributePath) string
+
+	// tenant returns the expression of the tenant of the transaction (see setTenant)
+	tenant() string
+
+	// setTenant scopes the statements of the transaction to the tenant
+	setTenant(ctx context.Context, tx internalDB.Tx, tenant string) error
+
+	// setReaping lets the statements of the transaction see the expired items of all tenants (see Reap)
+	setReaping(ctx context.Context, tx internalDB.Tx) error
+
+	// columnsStmt returns the statement that selects the names of the columns of the table passed as $1
+	columnsStmt() string
+
+	// search adds the condition that matches the words of the query to q and returns the expression of the rank of
+	// the matches, the best first. It returns an empty string if the query has no words.
+	search(q *queryBuilder, query string) string
+}
+
+// newDialect returns the dialect of the driver of db
+func newDialect(db internalDB.DB, s schema) dialect {
+	if internalDB.DriverOf(db) == internalDB.SQLiteDriver {
+		return sqlite{schema: s}
+	}
+	return postgres{}
+}
+
+// postgres the dialect of Postgres DBs, where the content is JSONB
+type postgres struct{}
+
+func (postgres) value(path attributePath) string {
+	return path.sql()
+}
+
+func (postgres) without(expr string, paths []attributePath) string {
+	for _, path := range paths {
+		keys := make([]string, 0, len(path))
+		for _, k := range path {
+			keys = append(keys, quoteLiteral(k))
+		}
+		expr = fmt.Sprintf("(%v #- ARRAY[%v]::text[])", expr, strings.Join(keys, ", "))
+	}
+	return expr
+}
+
+func (postgres) set(paths []attributePath, placeholders []string) string {
+	stmts := make([]string, 0, len(paths))
+	for i, path := range paths {
+		stmts = append(stmts, fmt.Sprintf(setAttributeTemplate, path.sql(), placeholders[i]))
+	}
+	return strings.Join(stmts, ", ")
+}
+
+// condition renders conditions to use the GIN index on the content (containment and JSON path matching) whenever the
+// operator allows
+func (postgres) condition(q *queryBuilder, path attributePath, c Condition) (string, error) {
+	switch c.Op {
+	case InOperator, NotInOperator:
+		// Containment would match objects and arrays that have more than the values, so the values are compared using
+		// equality like =
+		placeholders := []string{}
+		for _, v := range sliceValues(c.Value) {
+			value, err := json.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			placeholders = append(placeholders, q.param(value))
+		}
+		return fmt.Sprintf("%v %v (%v)", path.sql(), c.Op, strings.Join(placeholders, ", ")), nil
+	case ContainsOperator:
+		doc, err := path.containing(c.Value)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v @> %v", contentColumn, q.param(doc)), nil
+	case ExistsOperator:
+		return fmt.Sprintf("%v @? %v::jsonpath", contentColumn, q.param(path.jsonPath(""))), nil
+	case IsNotNullOperator:
+		return fmt.Sprintf("%v @? %v::jsonpath", contentColumn, q.param(path.jsonPath(notNullFilter))), nil
+	case IsNullOperator:
+		return fmt.Sprintf("NOT (%v @? %v::jsonpath)", contentColumn, q.param(path.jsonPath(notNullFilter))), nil
+	case LikeOperator, ILikeOperator:
+		return fmt.Sprintf("(%v #>> '{}') %v %v", path.sql(), c.Op, q.param(c.Value)), nil
+	case BetweenOperator:
+		bounds := sliceValues(c.Value)
+		lower, err := json.Marshal(bounds[0])
+		if err != nil {
+			return "", err
+		}
+		upper, err := json.Marshal(bounds[1])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v BETWEEN %v AND %v", path.sql(), q.param(lower), q.param(upper)), nil
+	default:
+		value, err := json.Marshal(c.Value)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(conditionTemplate, path.sql(), c.Op, q.param(value)), nil
+	}
+}
+
+func (postgres) sortExpression(path attributePath) string {
+	return fmt.Sprintf("COALESCE(%v, 'null'::jsonb)", path.sql())
+}
+
+func (d postgres) sortValue(path attributePath) string {
+	return d.sortExpression(path)
+}
+
+// cursorParam compares the value as JSONB
+func (postgres) cursorParam(value json.RawMessage) (any, error) {
+	return []byte(value), nil
+}
+
+func (postgres) object(args []string) string {
+	return fmt.Sprintf("jsonb_build_object(%v)", strings.Join(args, ", "))
+}
+
+func (postgres) groupOrder(attributePath) string {
+	return ""
+}
+
+func (postgres) bucket(b TimeBucket, column Column) string {
+	return fmt.Sprintf("date_trunc('%v', %v)", b, column)
+}
+
+// aggregate aggregates the attribute as a number since JSON values have no order that Postgres can aggregate
+func (postgres) aggregate(fn AggregateFunction, path attributePath) string {
+	return fmt.Sprintf("to_jsonb(%v((%v)::numeric))", strings.ToUpper(string(fn)), path.sql())
+}
+
+func (postgres) tenant() string {
+	return fmt.Sprintf("current_setting('%v')", tenantSetting)
+}
+
+// setTenant sets the tenant setting until the end of the transaction, which row-level security policies check too
+func (postgres) setTenant(ctx context.Context, tx internalDB.Tx, tenant string) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf("SELECT set_config('%v', $1, true)", tenantSetting), tenant)
+	return err
+}
+
+// setReaping sets the reap setting until the end of the transaction, which the reap policies of multi-tenant tables
+// check
+func (postgres) setReaping(ctx context.Context, tx internalDB.Tx) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf("SELECT set_config('%v', 'on', true)", reapSetting))
+	return err
+}
+
+func (postgres) columnsStmt() string {
+	return "SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1"
+}
+
+func (postgres) search(q *queryBuilder, query string) string {
+	tsQuery := prefixQuery(query)
+	if tsQuery == "" {
+		return ""
+	}
+	tsQueryExpr := fmt.Sprintf("to_tsquery('%v', %v)", searchConfig, q.param(tsQuery))
+	q.where(fmt.Sprintf("%v @@ %v", searchColumn, tsQueryExpr))
+	return fmt.Sprintf("ts_rank(%v, %v)", searchColumn, tsQueryExpr)
+}
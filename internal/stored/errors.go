@@ -0,0 +1,184 @@
+package stored
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// integrityConstraintViolationClass the class of the Postgres error codes of constraint violations
+const integrityConstraintViolationClass = "23"
+
+// ErrNotFound is returned when a stored item doesn't exist. The error of the driver is wrapped with it.
+var ErrNotFound = errors.New("stored item not found")
+
+// ErrAlreadyExists is returned when adding a stored item that violates a unique constraint, like an id that is already
+// used. It is returned together with a *ConstraintViolationError.
+var ErrAlreadyExists = errors.New("stored item already exists")
+
+// ErrDeleted is returned together with ErrAlreadyExists when adding a stored item with the id of a soft-deleted item,
+// which has to be restored using Restore for its id to be used again
+var ErrDeleted = errors.New("stored item is deleted")
+
+// ErrConflict is matched by a *ConflictError using errors.Is
+var ErrConflict = errors.New("conflict")
+
+// ErrSoftDeleteDisabled is returned when attempting to restore an item in a store that is not in soft-delete mode
+var ErrSoftDeleteDisabled = errors.New("soft-delete is not enabled for this store")
+
+// ErrHistoryDisabled is returned when asking for the history of an item in a store that doesn't keep history
+var ErrHistoryDisabled = errors.New("history is not enabled for this store")
+
+// ErrWatchDisabled is returned when watching a store that has no listener
+var ErrWatchDisabled = errors.New("watch is not enabled for this store")
+
+// ErrSearchDisabled is returned when searching a store that is not searchable
+var ErrSearchDisabled = errors.New("search is not enabled for this store")
+
+// ErrExpiryDisabled is returned when writing with ExpireAt to a store or reaping a store that doesn't expire items
+var ErrExpiryDisabled = errors.New("expiry is not enabled for this store")
+
+// ErrTenantRequired is returned when using a multi-tenant store (see WithTenancy) with a context that is not marked
+// using ForTenant
+var ErrTenantRequired = errors.New("tenant required")
+
+// ErrSchemaMismatch is returned when the table of a store doesn't have the columns required by the options of the store
+// (see Stored)
+var ErrSchemaMismatch = errors.New("table doesn't match the stored schema")
+
+// ErrInvalidAttribute is returned when an attribute is not a valid path to a JSON attribute of the content type
+var ErrInvalidAttribute = errors.New("invalid attribute")
+
+// ErrReadOnlyAttribute is returned when patching a read-only attribute without AllowReadOnly
+var ErrReadOnlyAttribute = errors.New("read-only attribute")
+
+// ErrInvalidCondition is returned when a condition has an unknown operator or a value that doesn't fit its operator
+var ErrInvalidCondition = errors.New("invalid condition")
+
+// ErrInvalidSort is returned when listing items with a sort that is not supported
+var ErrInvalidSort = errors.New("invalid sort")
+
+// ErrInvalidAggregation is returned when aggregating items using an unknown function, column or bucket
+var ErrInvalidAggregation = errors.New("invalid aggregation")
+
+// ErrInvalidCursor is returned when listing items with a cursor that was not returned by a previous page of the same sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ConflictError is returned when a write expects a stored item to be at a specific version but it is not.
+type ConflictError struct {
+	// ID the id of the stored item that was being written
+	ID string
+
+	// ExpectedVersion the version that the writer expected the stored item to be at
+	ExpectedVersion int64
+
+	// ActualVersion the version that the stored item is actually at
+	ActualVersion int64
+}
+
+// Error returns a description of the conflict
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("stored item '%v' is at version %v but version %v was expected", e.ID, e.ActualVersion, e.ExpectedVersion)
+}
+
+// Is makes errors.Is match ErrConflict
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// ConstraintViolationError is returned when a write violates a constraint of the table
+type ConstraintViolationError struct {
+	// Constraint the name of the violated constraint
+	Constraint string
+
+	// Err the error of the driver
+	Err error
+}
+
+// Error returns a description of the violation
+func (e *ConstraintViolationError) Error() string {
+	return fmt.Sprintf("constraint '%v' is violated: %v", e.Constraint, e.Err)
+}
+
+// Unwrap returns the error of the driver
+func (e *ConstraintViolationError) Unwrap() error {
+	return e.Err
+}
+
+// ErrInvalidContent is matched by an *InvalidContentError using errors.Is
+var ErrInvalidContent = errors.New("invalid content")
+
+// InvalidContentError is returned when a write would store content that doesn't match the content type of the store or
+// that is rejected by its validators. Nothing is written.
+type InvalidContentError struct {
+	// Attribute the patched attribute that is invalid. It is empty if the content is invalid as a whole.
+	Attribute string
+
+	// Err the reason the content is invalid
+	Err error
+}
+
+// Error returns a description of the invalid content
+func (e *InvalidContentError) Error() string {
+	if e.Attribute == "" {
+		return fmt.Sprintf("%v: %v", ErrInvalidContent, e.Err)
+	}
+	return fmt.Sprintf("%v: attribute '%v': %v", ErrInvalidContent, e.Attribute, e.Err)
+}
+
+// Is makes errors.Is match ErrInvalidContent
+func (e *InvalidContentError) Is(target error) bool {
+	return target == ErrInvalidContent
+}
+
+// Unwrap returns the reason the content is invalid
+func (e *InvalidContentError) Unwrap() error {
+	return e.Err
+}
+
+// storeError translates the errors of the driver into the errors of the store, wrapping them to keep their details.
+// Errors that are already translated are returned as is.
+func storeError(err error) error {
+	violation := &ConstraintViolationError{}
+	pgErr := &pq.Error{}
+	switch {
+	case err == nil, errors.Is(err, ErrNotFound), errors.As(err, &violation):
+		return err
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case errors.As(err, &pgErr) && pgErr.Code.Name() == "unique_violation":
+		return fmt.Errorf("%w: %w", ErrAlreadyExists, &ConstraintViolationError{Constraint: pgErr.Constraint, Err: err})
+	case errors.As(err, &pgErr) && pgErr.Code.Class() == integrityConstraintViolationClass:
+		return &ConstraintViolationError{Constraint: pgErr.Constraint, Err: err}
+	}
+	return sqliteError(err)
+}
+
+// idInUse returns the error of adding a stored item with an id that is already used, like the error of the primary key
+func idInUse(table string, err error) error {
+	return fmt.Errorf("%w: %w", ErrAlreadyExists, &ConstraintViolationError{Constraint: table + "_pkey", Err: err})
+}
+
+// deletedIDError returns the error of adding the stored item with the id, which wraps ErrDeleted if the id is already
+// used by a soft-deleted item. Getting soft-deleted items returns ErrNotFound, so callers can't tell otherwise why the
+// id is in use.
+func deletedIDError[T any](ctx context.Context, s Store[T], softDelete bool, id string, err error) error {
+	if !softDelete || !errors.Is(err, ErrAlreadyExists) {
+		return err
+	}
+	existing, getErr := s.Get(ctx, id, IncludeDeleted())
+	if getErr != nil || existing.DeletedAt == nil {
+		return err
+	}
+	return fmt.Errorf("%w, restore it to use its id again: %w", ErrDeleted, err)
+}
+
+// rowSecurityViolation returns whether the error is the error of Postgres when a write is rejected by a row-level
+// security policy
+func rowSecurityViolation(err error) bool {
+	pgErr := &pq.Error{}
+	return errors.As(err, &pgErr) && pgErr.Code.Name() == "insufficient_privilege"
+}
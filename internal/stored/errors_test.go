@@ -0,0 +1,60 @@
+package stored
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreError(t *testing.T) {
+	t.Run("Translates missing rows", func(t *testing.T) {
+		err := storeError(sql.ErrNoRows)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("Translates unique violations", func(t *testing.T) {
+		pgErr := &pq.Error{Code: "23505", Constraint: "app_pkey"}
+		err := storeError(fmt.Errorf("insert: %w", pgErr))
+		assert.ErrorIs(t, err, ErrAlreadyExists)
+		violation := &ConstraintViolationError{}
+		require.ErrorAs(t, err, &violation)
+		assert.Equal(t, "app_pkey", violation.Constraint)
+		assert.ErrorIs(t, err, pgErr)
+	})
+
+	t.Run("Translates other constraint violations", func(t *testing.T) {
+		pgErr := &pq.Error{Code: "23514", Constraint: "app_id_check"}
+		err := storeError(pgErr)
+		assert.NotErrorIs(t, err, ErrAlreadyExists)
+		violation := &ConstraintViolationError{}
+		require.ErrorAs(t, err, &violation)
+		assert.Equal(t, "app_id_check", violation.Constraint)
+	})
+
+	t.Run("Keeps other errors", func(t *testing.T) {
+		err := errors.New("connection refused")
+		assert.Equal(t, err, storeError(err))
+		assert.NoError(t, storeError(nil))
+
+		pgErr := &pq.Error{Code: "42P01"}
+		assert.Equal(t, pgErr, storeError(pgErr))
+	})
+
+	t.Run("Doesn't translate twice", func(t *testing.T) {
+		err := storeError(sql.ErrNoRows)
+		assert.Equal(t, err, storeError(err))
+		err = storeError(&pq.Error{Code: "23505"})
+		assert.Equal(t, err, storeError(err))
+	})
+
+	t.Run("Matches conflicts", func(t *testing.T) {
+		var err error = &ConflictError{ID: "a", ExpectedVersion: 1, ActualVersion: 2}
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+}
@@ -0,0 +1,161 @@
+package stored
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	internalDB "alielgamal.com/myservice/internal/db"
+)
+
+const (
+	expiresAtColumn     = "expires_at"
+	notExpiredCondition = "(expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)"
+	expiredCondition    = "expires_at <= CURRENT_TIMESTAMP"
+	upsertExpiryStmt    = ", expires_at=EXCLUDED.expires_at"
+	purgeTemplateStmt   = "DELETE FROM %v WHERE id IN (%v) AND %v%v"
+	reapTemplateStmt    = "DELETE FROM %v WHERE id IN (SELECT id FROM %v WHERE %v ORDER BY expires_at LIMIT $1%v)"
+	reapLockStmt        = " FOR UPDATE SKIP LOCKED"
+	setExpiryTemplate   = "expires_at=$%v"
+
+	// reapSetting the Postgres setting that lets the transactions of Reap see the expired items of all tenants, which
+	// the reap policies of multi-tenant tables check using current_setting('stored.reap', true)
+	reapSetting = "stored.reap"
+)
+
+// Reapable is implemented by the stores that delete their expired items on demand (see WithExpiry)
+type Reapable interface {
+	// Reap deletes up to limit expired items of all tenants, the earliest expired first, and returns the number of
+	// deleted items. Expired items are already treated as missing, so no revisions or events are recorded. It fails
+	// with ErrExpiryDisabled if the store doesn't expire items.
+	Reap(ctx context.Context, limit int) (int, error)
+}
+
+// ExpireAt makes a write of a store that expires items (see WithExpiry) set the expiry of the written items to the
+// passed time. Pass the zero time to make the written items never expire. Items that are added without it never expire,
+// while the other writes keep the expiry of the item. Expiries are kept in UTC with the microsecond precision of the
+// DBs.
+func ExpireAt(at time.Time) WriteOption {
+	return func(o *writeOptions) {
+		o.setExpiry = true
+		o.expiresAt = nil
+		if !at.IsZero() {
+			at = at.UTC().Truncate(time.Microsecond)
+			o.expiresAt = &at
+		}
+	}
+}
+
+// newWriteOptions applies the options of a write. It fails with ErrExpiryDisabled if they set an expiry and the store
+// doesn't expire items.
+func newWriteOptions(expiry bool, opts []WriteOption) (writeOptions, error) {
+	var w writeOptions
+	for _, opt := range opts {
+		opt(&w)
+	}
+	if w.setExpiry && !expiry {
+		return writeOptions{}, ErrExpiryDisabled
+	}
+	return w, nil
+}
+
+// expiresAtParam returns the query param of an expiry, which is NULL for items that never expire
+func expiresAtParam(expiresAt *time.Time) any {
+	if expiresAt == nil {
+		return nil
+	}
+	return *expiresAt
+}
+
+// expired reports whether the stored item is expired at the passed time
+func (s Stored[T]) expired(now time.Time) bool {
+	return s.ExpiresAt != nil && !s.ExpiresAt.After(now)
+}
+
+// purgeExpired deletes the expired items with the ids within the passed transaction, so that their ids can be added
+// again before they are reaped
+func (s sqlStore[T]) purgeExpired(ctx context.Context, tx internalDB.Tx, ids ...string) error {
+	if !s.expiry || len(ids) == 0 {
+		return nil
+	}
+	placeholders := make([]string, 0, len(ids))
+	params := make([]any, 0, len(ids))
+	for _, id := range ids {
+		params = append(params, id)
+		placeholders = append(placeholders, fmt.Sprintf("$%v", len(params)))
+	}
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(purgeTemplateStmt, s.table, strings.Join(placeholders, ", "), expiredCondition, s.scope), params...)
+	return err
+}
+
+func (s sqlStore[T]) Reap(ctx context.Context, limit int) (int, error) {
+	ctx, span := tracer.Start(ctx, "store.reap")
+	defer span.End()
+
+	if !s.expiry {
+		return 0, ErrExpiryDisabled
+	}
+
+	// Reaping is not scoped to a tenant, so it doesn't use inTx
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, storeError(err)
+	}
+	defer tx.Rollback()
+
+	if s.tenancy {
+		if err := s.dialect.setReaping(ctx, tx); err != nil {
+			return 0, storeError(err)
+		}
+	}
+	res, err := tx.ExecContext(ctx, s.reapStmt, limit)
+	if err != nil {
+		return 0, storeError(err)
+	}
+	reaped, err := res.RowsAffected()
+	if err != nil {
+		return 0, storeError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, storeError(err)
+	}
+	return int(reaped), nil
+}
+
+func (s *memoryStore[T]) Reap(_ context.Context, limit int) (int, error) {
+	if !s.expiry {
+		return 0, ErrExpiryDisabled
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	expired := []*memoryItem{}
+	for _, item := range s.items {
+		if item.expired(now) {
+			expired = append(expired, item)
+		}
+	}
+	slices.SortFunc(expired, func(a, b *memoryItem) int {
+		if c := a.ExpiresAt.Compare(*b.ExpiresAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	expired = expired[:min(limit, len(expired))]
+
+	// Like the notifications of the stored_notify trigger, watchers are notified of the reaped items
+	changes := make([]memoryChange, 0, len(expired))
+	for _, item := range expired {
+		changes = append(changes, memoryChange{operation: DeleteOperation, id: item.ID, version: item.Version + 1, at: now, tenant: s.owners[item.ID]})
+		delete(s.items, item.ID)
+		delete(s.owners, item.ID)
+	}
+	for w := range s.watchers {
+		w.notify(changes)
+	}
+	return len(expired), nil
+}
@@ -0,0 +1,185 @@
+package stored
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	internalDB "alielgamal.com/myservice/internal/db"
+)
+
+const (
+	historyTableSuffix         = "_history"
+	historyColumns             = "id, version, operation, content, diff, actor, at"
+	recordRevisionTemplateStmt = "INSERT INTO %v(id, version, operation, content, diff, actor, at%v) SELECT id, version+$5, $2, content, $3, $4, CURRENT_TIMESTAMP%v FROM %v WHERE id=$1%v"
+	historyTemplateStmt        = "SELECT %v FROM %v WHERE id=$1%v ORDER BY revision"
+	getAtVersionTemplateStmt   = "SELECT %v FROM %v WHERE id=$1 AND version=$2%v ORDER BY revision DESC LIMIT 1"
+	getAtTimeTemplateStmt      = "SELECT %v FROM %v WHERE id=$1 AND at<=$2%v ORDER BY revision DESC LIMIT 1"
+)
+
+// Operation is the kind of write that created a revision
+type Operation string
+
+const (
+	// AddOperation a revision created by Add or by Upsert adding a new item
+	AddOperation Operation = "add"
+
+	// PatchOperation a revision created by Patch or PatchVersion
+	PatchOperation Operation = "patch"
+
+	// PutOperation a revision created by Put, PutVersion or by Upsert replacing an existing item
+	PutOperation Operation = "put"
+
+	// DeleteOperation a revision created by Delete
+	DeleteOperation Operation = "delete"
+
+	// RestoreOperation a revision created by Restore
+	RestoreOperation Operation = "restore"
+)
+
+// Revision is an immutable snapshot of a stored item that was taken right after it was written
+type Revision[T any] struct {
+	// ID the id of the stored item
+	ID string `json:"id"`
+
+	// Version the version of the stored item after the write
+	Version int64 `json:"version"`
+
+	// Operation the kind of write
+	Operation Operation `json:"operation"`
+
+	// Content the content of the stored item after the write
+	Content T `json:"content"`
+
+	// Diff the attributes that were written. It is the whole content for adds and puts, and empty for deletes and
+	// restores.
+	Diff map[string]any `json:"diff"`
+
+	// Actor the identification of the user who did the write
+	Actor string `json:"actor"`
+
+	// At the time of the write
+	At time.Time `json:"at"`
+}
+
+// At identifies a point in the history of a stored item. Create one using AtVersion or AtTime.
+type At struct {
+	version int64
+	time    time.Time
+}
+
+// AtVersion identifies the revision in which a stored item reached a specific version
+func AtVersion(version int64) At {
+	return At{version: version}
+}
+
+// AtTime identifies the latest revision of a stored item at a specific time
+func AtTime(t time.Time) At {
+	return At{time: t}
+}
+
+// historyStmts contains the statements used by stores that keep history
+type historyStmts struct {
+	recordRevision string
+	history        string
+	getAtVersion   string
+	getAtTime      string
+}
+
+// newHistoryStmts creates the history statements of the table. Revisions of multi-tenant stores keep the tenant of
+// the item, and are scoped like the item (see tenantScope and tenantInsert).
+func newHistoryStmts(table string, scope string, tenantColumns string) historyStmts {
+	historyTable := table + historyTableSuffix
+	return historyStmts{
+		recordRevision: fmt.Sprintf(recordRevisionTemplateStmt, historyTable, tenantColumns, tenantColumns, table, scope),
+		history:        fmt.Sprintf(historyTemplateStmt, historyColumns, historyTable, scope),
+		getAtVersion:   fmt.Sprintf(getAtVersionTemplateStmt, historyColumns, historyTable, scope),
+		getAtTime:      fmt.Sprintf(getAtTimeTemplateStmt, historyColumns, historyTable, scope),
+	}
+}
+
+// recordRevision appends the current state of a stored item to its history if the store keeps history. The
+// versionOffset is added to the current version of the stored item, which is needed to record a revision before the
+// write that creates it.
+func (s sqlStore[T]) recordRevision(ctx context.Context, tx internalDB.Tx, op Operation, id string, actor string, diff any, versionOffset int64) error {
+	if !s.history {
+		return nil
+	}
+
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, s.historyStmts.recordRevision, id, op, diffJSON, actor, versionOffset)
+	return err
+}
+
+func (s sqlStore[T]) History(ctx context.Context, id string) ([]Revision[T], error) {
+	ctx, span := tracer.Start(ctx, "store.history")
+	defer span.End()
+
+	if !s.history {
+		return nil, ErrHistoryDisabled
+	}
+
+	result := []Revision[T]{}
+	err := s.read(ctx, func(querier internalDB.Querier) error {
+		rows, err := querier.QueryContext(ctx, s.historyStmts.history, id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			r := Revision[T]{}
+			if err := scanRevision(&r, rows); err != nil {
+				return err
+			}
+			result = append(result, r)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s sqlStore[T]) GetAt(ctx context.Context, id string, at At) (*Revision[T], error) {
+	ctx, span := tracer.Start(ctx, "store.getAt")
+	defer span.End()
+
+	if !s.history {
+		return nil, ErrHistoryDisabled
+	}
+
+	result := &Revision[T]{}
+	err := s.read(ctx, func(querier internalDB.Querier) error {
+		if at.version != 0 {
+			return scanRevision(result, querier.QueryRowContext(ctx, s.historyStmts.getAtVersion, id, at.version))
+		}
+		return scanRevision(result, querier.QueryRowContext(ctx, s.historyStmts.getAtTime, id, at.time))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if at.version == 0 && result.Operation == DeleteOperation {
+		// The stored item didn't exist at that time
+		return nil, storeError(sql.ErrNoRows)
+	}
+	return result, nil
+}
+
+func scanRevision[T any](result *Revision[T], row scanner) error {
+	var contentJSON, diffJSON []byte
+	err := row.Scan(&result.ID, &result.Version, &result.Operation, &contentJSON, &diffJSON, &result.Actor, &result.At)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(contentJSON, &result.Content); err != nil {
+		return err
+	}
+	return json.Unmarshal(diffJSON, &result.Diff)
+}
@@ -0,0 +1,1249 @@
+package stored
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewMemoryStore creates a store for a specific Stored T that keeps the items in memory, which is meant for tests and
+// local development. It is safe for concurrent use and behaves like a store created by NewStore with the same options,
+// except that:
+//   - the table is only used to name the violated constraints in errors
+//   - WithOutbox is ignored since there is no outbox table
+//   - Watch is enabled without WithListener
+//   - Search matches the words of all the string attributes of the content since there is no search_vector column
+func NewMemoryStore[T any](table string, opts ...Option) Store[T] {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &memoryStore[T]{
+		table:         table,
+		softDelete:    o.softDelete,
+		history:       o.history,
+		search:        o.search,
+		tenancy:       o.tenancy,
+		expiry:        o.expiry,
+		schema:        newSchema[T](),
+		tagValidation: o.tagValidation,
+		validators:    o.validators,
+		items:         map[string]*memoryItem{},
+		revisions:     map[string][]memoryRevision{},
+		owners:        map[string]string{},
+		watchers:      map[*memoryWatcher]struct{}{},
+	}
+}
+
+// memoryItem a stored item with its content kept as JSON. Items are never modified once stored; writes replace them.
+type memoryItem = Stored[json.RawMessage]
+
+// memoryRevision a revision of a stored item kept by a memory store
+type memoryRevision struct {
+	id        string
+	version   int64
+	operation Operation
+	content   json.RawMessage
+	diff      json.RawMessage
+	actor     string
+	at        time.Time
+	tenant    string
+}
+
+// memoryChange a write that watchers are notified of, like the notifications of the stored_notify trigger
+type memoryChange struct {
+	operation Operation
+	id        string
+	version   int64
+	at        time.Time
+	tenant    string
+
+	// item the stored item right after the write. It is nil for items deleted from stores that are not in soft-delete
+	// mode.
+	item *memoryItem
+}
+
+type memoryStore[T any] struct {
+	table      string
+	softDelete bool
+	history    bool
+	search     bool
+	tenancy    bool
+	expiry     bool
+
+	schema        schema
+	tagValidation bool
+	validators    []Validator
+
+	mu        sync.RWMutex
+	items     map[string]*memoryItem
+	revisions map[string][]memoryRevision
+	// owners the tenant of every item of a multi-tenant store
+	owners   map[string]string
+	watchers map[*memoryWatcher]struct{}
+}
+
+// memoryTx stages the writes of a transaction until it is committed
+type memoryTx struct {
+	// now the time of all the writes of the transaction, like CURRENT_TIMESTAMP
+	now time.Time
+	// tenant the tenant that the transaction is scoped to, which is empty if the store is not multi-tenant
+	tenant string
+	// write the options of the writes of the transaction
+	write writeOptions
+
+	items     map[string]*memoryItem
+	owners    map[string]string
+	staged    map[string]*memoryItem
+	revisions []memoryRevision
+	changes   []memoryChange
+}
+
+// memorySavepoint the state of a transaction that it can be rolled back to
+type memorySavepoint struct {
+	staged    map[string]*memoryItem
+	revisions int
+	changes   int
+}
+
+// get returns the item with the id as written by the transaction, or nil if there is none, it belongs to another
+// tenant or it has expired
+func (tx *memoryTx) get(id string) *memoryItem {
+	item, ok := tx.staged[id]
+	if !ok {
+		if tx.owners[id] != tx.tenant {
+			return nil
+		}
+		item = tx.items[id]
+	}
+	if item == nil || item.expired(tx.now) {
+		return nil
+	}
+	return item
+}
+
+// exists reports whether the id is used by an item of any tenant, like the primary key of the table. Expired items are
+// replaced by the items added with their id, like SQL stores purge them.
+func (tx *memoryTx) exists(id string) bool {
+	item, ok := tx.staged[id]
+	if !ok {
+		item = tx.items[id]
+	}
+	return item != nil && !item.expired(tx.now)
+}
+
+// set stages the item with the id. A nil item removes it.
+func (tx *memoryTx) set(id string, item *memoryItem) {
+	tx.staged[id] = item
+}
+
+func (tx *memoryTx) savepoint() memorySavepoint {
+	return memorySavepoint{staged: maps.Clone(tx.staged), revisions: len(tx.revisions), changes: len(tx.changes)}
+}
+
+func (tx *memoryTx) rollbackTo(sp memorySavepoint) {
+	tx.staged = sp.staged
+	tx.revisions = tx.revisions[:sp.revisions]
+	tx.changes = tx.changes[:sp.changes]
+}
+
+// tenant returns the tenant that the operations of the context are scoped to, which is empty if the store is not
+// multi-tenant
+func (s *memoryStore[T]) tenant(ctx context.Context) (string, error) {
+	if !s.tenancy {
+		return "", nil
+	}
+	tenant, ok := tenantOf(ctx)
+	if !ok {
+		return "", ErrTenantRequired
+	}
+	return tenant, nil
+}
+
+// inTx runs f in a transaction that is only committed if f succeeds. Transactions are serialized and scoped to the
+// tenant of the context in multi-tenant stores.
+func (s *memoryStore[T]) inTx(ctx context.Context, f func(tx *memoryTx) error) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &memoryTx{
+		now:    time.Now().UTC().Truncate(time.Microsecond),
+		tenant: tenant,
+		items:  s.items,
+		owners: s.owners,
+		staged: map[string]*memoryItem{},
+	}
+	if err := f(tx); err != nil {
+		return err
+	}
+
+	for id, item := range tx.staged {
+		if item == nil {
+			delete(s.items, id)
+			delete(s.owners, id)
+		} else {
+			s.items[id] = item
+			if s.tenancy {
+				s.owners[id] = tenant
+			}
+		}
+	}
+	for _, r := range tx.revisions {
+		s.revisions[r.id] = append(s.revisions[r.id], r)
+	}
+	for w := range s.watchers {
+		w.notify(tx.changes)
+	}
+	return nil
+}
+
+// afterWrite records the revision of a write if the store keeps history and the change that watchers are notified of
+func (s *memoryStore[T]) afterWrite(tx *memoryTx, op Operation, item *memoryItem, actor string, diff any) error {
+	if s.history {
+		diffJSON, err := json.Marshal(diff)
+		if err != nil {
+			return err
+		}
+		tx.revisions = append(tx.revisions, memoryRevision{
+			id:        item.ID,
+			version:   item.Version,
+			operation: op,
+			content:   item.Content,
+			diff:      diffJSON,
+			actor:     actor,
+			at:        tx.now,
+			tenant:    tx.tenant,
+		})
+	}
+
+	// Like the trigger, watchers see all updates of the content as patches
+	change := memoryChange{operation: op, id: item.ID, version: item.Version, at: tx.now, tenant: tx.tenant, item: item}
+	if op == PutOperation {
+		change.operation = PatchOperation
+	}
+	if op == DeleteOperation && !s.softDelete {
+		change.item = nil
+	}
+	tx.changes = append(tx.changes, change)
+	return nil
+}
+
+// checkViolation returns the error of a write that leaves a column empty, like the check constraints of the table
+func (s *memoryStore[T]) checkViolation(column string) error {
+	return &ConstraintViolationError{
+		Constraint: fmt.Sprintf("%v_%v_check", s.table, column),
+		Err:        fmt.Errorf("%v can't be empty", column),
+	}
+}
+
+// notFound returns the error of a stored item that doesn't exist
+func notFound(id string) error {
+	return fmt.Errorf("%w: '%v'", ErrNotFound, id)
+}
+
+func (s *memoryStore[T]) validate(content T) error {
+	return validateContent(content, s.tagValidation, s.validators)
+}
+
+// stored decodes a stored item, with the content projected to the attributes below root unless it is nil
+func (s *memoryStore[T]) stored(item *memoryItem, root projectionNode) (*Stored[T], error) {
+	result := &Stored[T]{
+		ID:         item.ID,
+		CreatedBy:  item.CreatedBy,
+		CreatedAt:  item.CreatedAt,
+		ModifiedBy: item.ModifiedBy,
+		ModifiedAt: item.ModifiedAt,
+		Version:    item.Version,
+	}
+	if item.DeletedAt != nil {
+		deletedAt := *item.DeletedAt
+		result.DeletedAt = &deletedAt
+		result.DeletedBy = item.DeletedBy
+	}
+	if item.ExpiresAt != nil {
+		expiresAt := *item.ExpiresAt
+		result.ExpiresAt = &expiresAt
+	}
+
+	content := []byte(item.Content)
+	if root != nil {
+		doc, err := decodeJSON(content)
+		if err != nil {
+			return nil, err
+		}
+		if content, err = json.Marshal(root.project(doc)); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(content, &result.Content); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// added returns the stored item of an added item with the content as it was passed
+func added[T any](item *memoryItem, content T) *Stored[T] {
+	return &Stored[T]{
+		ID:         item.ID,
+		Content:    content,
+		CreatedBy:  item.CreatedBy,
+		CreatedAt:  item.CreatedAt,
+		ModifiedBy: item.ModifiedBy,
+		ModifiedAt: item.ModifiedAt,
+		Version:    item.Version,
+		ExpiresAt:  item.ExpiresAt,
+	}
+}
+
+// writeTx runs f in a transaction (see inTx) whose writes apply the passed write options
+func (s *memoryStore[T]) writeTx(ctx context.Context, opts []WriteOption, f func(tx *memoryTx) error) error {
+	w, err := newWriteOptions(s.expiry, opts)
+	if err != nil {
+		return err
+	}
+	return s.inTx(ctx, func(tx *memoryTx) error {
+		tx.write = w
+		return f(tx)
+	})
+}
+
+func (s *memoryStore[T]) Add(ctx context.Context, creator string, id string, content T, opts ...WriteOption) (*Stored[T], error) {
+	var result *Stored[T]
+	err := s.writeTx(ctx, opts, func(tx *memoryTx) error {
+		var err error
+		result, err = s.addTx(tx, creator, id, content)
+		return err
+	})
+	if err != nil {
+		return nil, deletedIDError(ctx, s, s.softDelete, id, err)
+	}
+	return result, nil
+}
+
+// addTx adds a new stored item within the passed transaction
+func (s *memoryStore[T]) addTx(tx *memoryTx, creator string, id string, content T) (*Stored[T], error) {
+	if err := s.validate(content); err != nil {
+		return nil, err
+	}
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.insert(tx, creator, id, contentJSON)
+	if err != nil {
+		return nil, err
+	}
+	return added(item, content), nil
+}
+
+// insert adds a new item with the JSON content within the passed transaction
+func (s *memoryStore[T]) insert(tx *memoryTx, creator string, id string, contentJSON []byte) (*memoryItem, error) {
+	if id == "" {
+		return nil, s.checkViolation(string(IDColumn))
+	}
+	if creator == "" {
+		return nil, s.checkViolation(string(CreatedByColumn))
+	}
+	if tx.exists(id) {
+		return nil, idInUse(s.table, fmt.Errorf("key (id)=(%v) already exists", id))
+	}
+
+	item := &memoryItem{
+		ID:         id,
+		Content:    contentJSON,
+		CreatedBy:  creator,
+		CreatedAt:  tx.now,
+		ModifiedBy: creator,
+		ModifiedAt: tx.now,
+		Version:    1,
+		ExpiresAt:  tx.write.expiresAt,
+	}
+	tx.set(id, item)
+	if err := s.afterWrite(tx, AddOperation, item, creator, json.RawMessage(contentJSON)); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *memoryStore[T]) Patch(ctx context.Context, updater string, id string, attributes map[string]any, opts ...WriteOption) (*Stored[T], error) {
+	return s.patch(ctx, updater, id, 0, attributes, opts)
+}
+
+func (s *memoryStore[T]) PatchVersion(ctx context.Context, updater string, id string, version int64, attributes map[string]any, opts ...WriteOption) (*Stored[T], error) {
+	return s.patch(ctx, updater, id, version, attributes, opts)
+}
+
+func (s *memoryStore[T]) patch(ctx context.Context, updater string, id string, version int64, attributes map[string]any, opts []WriteOption) (*Stored[T], error) {
+	var result *Stored[T]
+	err := s.writeTx(ctx, opts, func(tx *memoryTx) error {
+		var err error
+		result, err = s.patchTx(ctx, tx, updater, id, version, attributes)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// patchTx applies the attributes to the stored item within the passed transaction
+func (s *memoryStore[T]) patchTx(ctx context.Context, tx *memoryTx, updater string, id string, version int64, attributes map[string]any) (*Stored[T], error) {
+	paths := make([]attributePath, 0, len(attributes))
+	values := make([]any, 0, len(attributes))
+	for k, v := range attributes {
+		path, err := parsePath(k)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.schema.checkAttribute(k, path, v); err != nil {
+			return nil, err
+		}
+		if !tx.write.allowReadOnly && s.schema.readOnly(path) {
+			return nil, fmt.Errorf("%w: '%v'", ErrReadOnlyAttribute, k)
+		}
+		value, err := jsonValue(v)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+		values = append(values, value)
+	}
+
+	return s.updateTx(tx, PatchOperation, updater, id, version, func(content json.RawMessage) ([]byte, error) {
+		doc, err := decodeJSON(content)
+		if err != nil {
+			return nil, err
+		}
+		for i, path := range paths {
+			if doc, err = path.set(doc, values[i]); err != nil {
+				return nil, err
+			}
+		}
+		return json.Marshal(doc)
+	}, attributes)
+}
+
+func (s *memoryStore[T]) Put(ctx context.Context, updater string, id string, content T, opts ...WriteOption) (*Stored[T], error) {
+	return s.put(ctx, updater, id, 0, content, opts)
+}
+
+func (s *memoryStore[T]) PutVersion(ctx context.Context, updater string, id string, version int64, content T, opts ...WriteOption) (*Stored[T], error) {
+	return s.put(ctx, updater, id, version, content, opts)
+}
+
+func (s *memoryStore[T]) put(ctx context.Context, updater string, id string, version int64, content T, opts []WriteOption) (*Stored[T], error) {
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *Stored[T]
+	err = s.writeTx(ctx, opts, func(tx *memoryTx) error {
+		var err error
+		result, err = s.updateTx(tx, PutOperation, updater, id, version, func(json.RawMessage) ([]byte, error) {
+			return contentJSON, nil
+		}, json.RawMessage(contentJSON))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// updateTx replaces the content of the stored item with the content returned by update within the passed transaction.
+// If version is not 0, the update is only applied if the stored item is still at that version.
+func (s *memoryStore[T]) updateTx(tx *memoryTx, op Operation, updater string, id string, version int64, update func(content json.RawMessage) ([]byte, error), diff any) (*Stored[T], error) {
+	current := tx.get(id)
+	if current == nil || current.DeletedAt != nil {
+		return nil, notFound(id)
+	}
+	if version != 0 && current.Version != version {
+		return nil, &ConflictError{ID: id, ExpectedVersion: version, ActualVersion: current.Version}
+	}
+	if updater == "" {
+		return nil, s.checkViolation(string(ModifiedByColumn))
+	}
+
+	contentJSON, err := update(current.Content)
+	if err != nil {
+		return nil, err
+	}
+	item := *current
+	item.Content = contentJSON
+	item.ModifiedBy = updater
+	item.ModifiedAt = tx.now
+	item.Version++
+	if tx.write.setExpiry {
+		item.ExpiresAt = tx.write.expiresAt
+	}
+
+	result, err := s.stored(&item, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Like SQL stores, the content is validated after the update to validate patches merged into the stored content
+	if err := s.validate(result.Content); err != nil {
+		return nil, err
+	}
+	tx.set(id, &item)
+	if err := s.afterWrite(tx, op, &item, updater, diff); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *memoryStore[T]) Upsert(ctx context.Context, actor string, id string, content T, opts ...WriteOption) (*Stored[T], error) {
+	if err := s.validate(content); err != nil {
+		return nil, err
+	}
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *Stored[T]
+	err = s.writeTx(ctx, opts, func(tx *memoryTx) error {
+		current := tx.get(id)
+		if current == nil {
+			item, err := s.insert(tx, actor, id, contentJSON)
+			if err != nil {
+				return err
+			}
+			result, err = s.stored(item, nil)
+			return err
+		}
+		if actor == "" {
+			return s.checkViolation(string(CreatedByColumn))
+		}
+
+		item := *current
+		item.Content = contentJSON
+		item.ModifiedBy = actor
+		item.ModifiedAt = tx.now
+		item.Version++
+		item.DeletedAt = nil
+		item.DeletedBy = ""
+		if tx.write.setExpiry {
+			item.ExpiresAt = tx.write.expiresAt
+		}
+		tx.set(id, &item)
+		if err := s.afterWrite(tx, PutOperation, &item, actor, json.RawMessage(contentJSON)); err != nil {
+			return err
+		}
+		var err error
+		result, err = s.stored(&item, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *memoryStore[T]) AddMany(ctx context.Context, creator string, items []Stored[T], mode BatchMode, opts ...WriteOption) ([]BatchResult[T], error) {
+	if mode == AllOrNothing {
+		if err := duplicateID(s.table, items); err != nil {
+			return nil, err
+		}
+	}
+	var results []BatchResult[T]
+	err := s.writeTx(ctx, opts, func(tx *memoryTx) error {
+		if mode == PerItem {
+			results = memoryBatchPerItem(tx, items, func(item Stored[T]) (*Stored[T], error) {
+				return s.addTx(tx, creator, item.ID, item.Content)
+			})
+			return nil
+		}
+
+		// Like the multi-row inserts of SQL stores, all the items are validated before any is added
+		contents := make([][]byte, 0, len(items))
+		for i, item := range items {
+			if err := s.validate(item.Content); err != nil {
+				return &BatchItemError{Index: i, ID: item.ID, Err: err}
+			}
+			contentJSON, err := json.Marshal(item.Content)
+			if err != nil {
+				return &BatchItemError{Index: i, ID: item.ID, Err: err}
+			}
+			contents = append(contents, contentJSON)
+		}
+
+		results = make([]BatchResult[T], 0, len(items))
+		for i, item := range items {
+			inserted, err := s.insert(tx, creator, item.ID, contents[i])
+			if err != nil {
+				return err
+			}
+			results = append(results, BatchResult[T]{Item: added(inserted, item.Content)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	deletedIDErrors(ctx, s, s.softDelete, items, results)
+	return results, nil
+}
+
+func (s *memoryStore[T]) PatchMany(ctx context.Context, updater string, patches []ItemPatch, mode BatchMode, opts ...WriteOption) ([]BatchResult[T], error) {
+	var results []BatchResult[T]
+	err := s.writeTx(ctx, opts, func(tx *memoryTx) error {
+		if mode == PerItem {
+			results = memoryBatchPerItem(tx, patches, func(p ItemPatch) (*Stored[T], error) {
+				return s.patchTx(ctx, tx, updater, p.ID, p.Version, p.Attributes)
+			})
+			return nil
+		}
+
+		results = make([]BatchResult[T], 0, len(patches))
+		for i, p := range patches {
+			patched, err := s.patchTx(ctx, tx, updater, p.ID, p.Version, p.Attributes)
+			if err != nil {
+				return &BatchItemError{Index: i, ID: p.ID, Err: err}
+			}
+			results = append(results, BatchResult[T]{Item: patched})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// memoryBatchPerItem writes every item after a savepoint, so that a failing item only rolls back its own write
+func memoryBatchPerItem[T any, I any](tx *memoryTx, items []I, write func(I) (*Stored[T], error)) []BatchResult[T] {
+	results := make([]BatchResult[T], 0, len(items))
+	for _, item := range items {
+		sp := tx.savepoint()
+		written, err := write(item)
+		if err != nil {
+			tx.rollbackTo(sp)
+			results = append(results, BatchResult[T]{Err: err})
+			continue
+		}
+		results = append(results, BatchResult[T]{Item: written})
+	}
+	return results
+}
+
+func (s *memoryStore[T]) Get(ctx context.Context, id string, opts ...ReadOption) (*Stored[T], error) {
+	o := newReadOptions(opts)
+	root, err := s.schema.projection(o.fields)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateConditions(o.conds); err != nil {
+		return nil, err
+	}
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	item, owner := s.items[id], s.owners[id]
+	s.mu.RUnlock()
+	if item == nil || owner != tenant || (item.DeletedAt != nil && !o.includeDeleted) || item.expired(time.Now()) {
+		return nil, notFound(id)
+	}
+	ok, err := matchesAll(o.conds, item)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, notFound(id)
+	}
+	return s.stored(item, root)
+}
+
+func (s *memoryStore[T]) List(ctx context.Context, opts ...ReadOption) ([]Stored[T], error) {
+	o := newReadOptions(opts)
+	items, err := s.matching(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	return s.storedAll(items, o.fields)
+}
+
+func (s *memoryStore[T]) Iter(ctx context.Context, opts ...ReadOption) iter.Seq2[Stored[T], error] {
+	return func(yield func(Stored[T], error) bool) {
+		o := newReadOptions(opts)
+		root, err := s.schema.projection(o.fields)
+		if err != nil {
+			yield(Stored[T]{}, err)
+			return
+		}
+		items, err := s.matching(ctx, o)
+		if err != nil {
+			yield(Stored[T]{}, err)
+			return
+		}
+
+		for _, item := range items {
+			if err := ctx.Err(); err != nil {
+				yield(Stored[T]{}, err)
+				return
+			}
+			r, err := s.stored(item, root)
+			if err != nil {
+				yield(Stored[T]{}, err)
+				return
+			}
+			if !yield(*r, nil) {
+				return
+			}
+		}
+	}
+}
+
+// storedAll decodes the stored items, with the content projected to the fields if any are passed
+func (s *memoryStore[T]) storedAll(items []*memoryItem, fields []string) ([]Stored[T], error) {
+	root, err := s.schema.projection(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Stored[T], 0, len(items))
+	for _, item := range items {
+		r, err := s.stored(item, root)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *r)
+	}
+	return result, nil
+}
+
+// validateConditions validates the conditions like SQL stores do, by rendering them
+func (s *memoryStore[T]) validateConditions(conds []Condition) error {
+	return (&queryBuilder{schema: s.schema, dialect: postgres{}}).addConditions(conds)
+}
+
+// matching returns the items that fill the conditions of the read options, sorted by id
+func (s *memoryStore[T]) matching(ctx context.Context, o readOptions) ([]*memoryItem, error) {
+	// Conditions are validated like SQL stores do even if there are no items to match
+	if err := s.validateConditions(o.conds); err != nil {
+		return nil, err
+	}
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	items := s.sortedItems(tenant)
+	s.mu.RUnlock()
+	return s.filter(items, o)
+}
+
+// sortedItems returns all the items of the tenant sorted by id. The lock must be held.
+func (s *memoryStore[T]) sortedItems(tenant string) []*memoryItem {
+	items := []*memoryItem{}
+	for id, item := range s.items {
+		if s.owners[id] == tenant {
+			items = append(items, item)
+		}
+	}
+	slices.SortFunc(items, func(a, b *memoryItem) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return items
+}
+
+// filter returns the items that fill the conditions of the read options. Expired items are skipped, and so are
+// soft-deleted items unless the read options include them.
+func (s *memoryStore[T]) filter(items []*memoryItem, o readOptions) ([]*memoryItem, error) {
+	now := time.Now()
+	result := []*memoryItem{}
+	for _, item := range items {
+		if (item.DeletedAt != nil && !o.includeDeleted) || item.expired(now) {
+			continue
+		}
+		ok, err := matchesAll(o.conds, item)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func (s *memoryStore[T]) ListPage(ctx context.Context, page ListOptions, opts ...ReadOption) (*Page[T], error) {
+	if err := page.Sort.validate(); err != nil {
+		return nil, err
+	}
+	var sortPath attributePath
+	if page.Sort.Attribute != "" {
+		var err error
+		if sortPath, err = s.schema.path(page.Sort.Attribute); err != nil {
+			return nil, err
+		}
+	}
+
+	o := newReadOptions(opts)
+	items, err := s.matching(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+
+	// Missing attributes are sorted as JSON null like SQL stores do
+	values := make(map[string]any, len(items))
+	for _, item := range items {
+		if sortPath == nil {
+			values[item.ID] = columnValue(page.Sort.Column, *item)
+			continue
+		}
+		doc, err := decodeJSON(item.Content)
+		if err != nil {
+			return nil, err
+		}
+		values[item.ID], _ = sortPath.lookup(doc)
+	}
+	compare := func(aValue any, aID string, bValue any, bID string) int {
+		var result int
+		if sortPath != nil {
+			result = compareJSON(aValue, bValue)
+		} else {
+			result, _ = compareColumn(aValue, bValue)
+		}
+		result = cmp.Or(result, strings.Compare(aID, bID))
+		if page.Sort.Descending {
+			return -result
+		}
+		return result
+	}
+	slices.SortFunc(items, func(a, b *memoryItem) int {
+		return compare(values[a.ID], a.ID, values[b.ID], b.ID)
+	})
+
+	if page.Cursor != "" {
+		id, value, err := decodeCursor(page.Sort, page.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if sortPath != nil {
+			if value, err = decodeJSON(value.([]byte)); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+			}
+		}
+		items = slices.DeleteFunc(items, func(item *memoryItem) bool {
+			return compare(values[item.ID], item.ID, value, id) <= 0
+		})
+	}
+
+	result := &Page[T]{}
+	limit := page.limit()
+	if len(items) > limit {
+		last := items[limit-1]
+		lastSortValue := values[last.ID]
+		if sortPath != nil {
+			valueJSON, err := json.Marshal(lastSortValue)
+			if err != nil {
+				return nil, err
+			}
+			lastSortValue = json.RawMessage(valueJSON)
+		}
+		if result.NextCursor, err = encodeCursor(page.Sort, last.ID, lastSortValue); err != nil {
+			return nil, err
+		}
+		items = items[:limit]
+	}
+
+	if result.Items, err = s.storedAll(items, o.fields); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *memoryStore[T]) Search(ctx context.Context, query string, limit int, opts ...ReadOption) ([]Stored[T], error) {
+	if !s.search {
+		return nil, ErrSearchDisabled
+	}
+
+	o := newReadOptions(opts)
+	items, err := s.matching(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	queryWords := searchWords(strings.ToLower(query))
+	if len(queryWords) == 0 {
+		return []Stored[T]{}, nil
+	}
+
+	// Items are ranked by the number of their words that start with a word of the query
+	ranks := map[string]int{}
+	for _, item := range items {
+		doc, err := decodeJSON(item.Content)
+		if err != nil {
+			return nil, err
+		}
+		words := searchWords(strings.ToLower(strings.Join(jsonStrings(doc), " ")))
+		rank := 0
+		for _, q := range queryWords {
+			matched := 0
+			for _, w := range words {
+				if strings.HasPrefix(w, q) {
+					matched++
+				}
+			}
+			if matched == 0 {
+				rank = 0
+				break
+			}
+			rank += matched
+		}
+		if rank > 0 {
+			ranks[item.ID] = rank
+		}
+	}
+
+	items = slices.DeleteFunc(items, func(item *memoryItem) bool {
+		return ranks[item.ID] == 0
+	})
+	slices.SortStableFunc(items, func(a, b *memoryItem) int {
+		return cmp.Compare(ranks[b.ID], ranks[a.ID])
+	})
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return s.storedAll(items, o.fields)
+}
+
+func (s *memoryStore[T]) Count(ctx context.Context, opts ...ReadOption) (int64, error) {
+	items, err := s.matching(ctx, newReadOptions(opts))
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(items)), nil
+}
+
+func (s *memoryStore[T]) Aggregate(ctx context.Context, agg Aggregation, opts ...ReadOption) ([]Group, error) {
+	items, err := s.matching(ctx, newReadOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	// The aggregation is validated like SQL stores do even if there are no items to aggregate
+	for _, g := range agg.GroupBy {
+		if _, _, err := s.schema.groupByExpression(postgres{}, g); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.schema.aggregateExpression(postgres{}, agg); err != nil {
+		return nil, err
+	}
+	return aggregate(agg, items)
+}
+
+func (s *memoryStore[T]) Delete(ctx context.Context, deleter string, id string) error {
+	return s.inTx(ctx, func(tx *memoryTx) error {
+		current := tx.get(id)
+		if current == nil || current.DeletedAt != nil {
+			return notFound(id)
+		}
+
+		item := *current
+		item.Version++
+		if !s.softDelete {
+			tx.set(id, nil)
+			// The history keeps the content of the deleted item like SQL stores do
+			return s.afterWrite(tx, DeleteOperation, &item, deleter, map[string]any{})
+		}
+
+		if deleter == "" {
+			return s.checkViolation("deleted_by")
+		}
+		deletedAt := tx.now
+		item.DeletedAt = &deletedAt
+		item.DeletedBy = deleter
+		tx.set(id, &item)
+		return s.afterWrite(tx, DeleteOperation, &item, deleter, map[string]any{})
+	})
+}
+
+func (s *memoryStore[T]) Restore(ctx context.Context, restorer string, id string) (*Stored[T], error) {
+	if !s.softDelete {
+		return nil, ErrSoftDeleteDisabled
+	}
+
+	var result *Stored[T]
+	err := s.inTx(ctx, func(tx *memoryTx) error {
+		current := tx.get(id)
+		if current == nil || current.DeletedAt == nil {
+			return notFound(id)
+		}
+		if restorer == "" {
+			return s.checkViolation(string(ModifiedByColumn))
+		}
+
+		item := *current
+		item.DeletedAt = nil
+		item.DeletedBy = ""
+		item.ModifiedBy = restorer
+		item.ModifiedAt = tx.now
+		item.Version++
+		tx.set(id, &item)
+		if err := s.afterWrite(tx, RestoreOperation, &item, restorer, map[string]any{}); err != nil {
+			return err
+		}
+		var err error
+		result, err = s.stored(&item, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *memoryStore[T]) History(ctx context.Context, id string) ([]Revision[T], error) {
+	if !s.history {
+		return nil, ErrHistoryDisabled
+	}
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Revisions are only appended, so the revisions read under the lock don't change afterwards
+	s.mu.RLock()
+	revisions := s.revisions[id]
+	s.mu.RUnlock()
+
+	result := make([]Revision[T], 0, len(revisions))
+	for _, r := range revisions {
+		if r.tenant != tenant {
+			continue
+		}
+		revision, err := decodeRevision[T](r)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *revision)
+	}
+	return result, nil
+}
+
+func (s *memoryStore[T]) GetAt(ctx context.Context, id string, at At) (*Revision[T], error) {
+	if !s.history {
+		return nil, ErrHistoryDisabled
+	}
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	revisions := s.revisions[id]
+	s.mu.RUnlock()
+
+	for _, r := range slices.Backward(revisions) {
+		if r.tenant != tenant {
+			continue
+		}
+		if at.version != 0 && r.version != at.version || at.version == 0 && r.at.After(at.time) {
+			continue
+		}
+		if at.version == 0 && r.operation == DeleteOperation {
+			// The stored item didn't exist at that time
+			break
+		}
+		return decodeRevision[T](r)
+	}
+	return nil, notFound(id)
+}
+
+func decodeRevision[T any](r memoryRevision) (*Revision[T], error) {
+	result := &Revision[T]{ID: r.id, Version: r.version, Operation: r.operation, Actor: r.actor, At: r.at}
+	if err := json.Unmarshal(r.content, &result.Content); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(r.diff, &result.Diff); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// memoryWatcher queues the changes that a single Watch of a memory store is notified of until they are delivered
+type memoryWatcher struct {
+	mu      sync.Mutex
+	pending []memoryChange
+	wake    chan struct{}
+}
+
+// notify queues the changes without blocking the writer
+func (w *memoryWatcher) notify(changes []memoryChange) {
+	if len(changes) == 0 {
+		return
+	}
+	w.mu.Lock()
+	w.pending = append(w.pending, changes...)
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take empties the queue and returns the changes that were in it
+func (w *memoryWatcher) take() []memoryChange {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	changes := w.pending
+	w.pending = nil
+	return changes
+}
+
+func (s *memoryStore[T]) Watch(ctx context.Context, conds ...Condition) (<-chan Change[T], error) {
+	if err := s.validateConditions(conds); err != nil {
+		return nil, err
+	}
+	all := s.tenancy && allTenants(ctx)
+	if all && len(conds) > 0 {
+		return nil, fmt.Errorf("%w: the changes of all tenants can't be filtered", ErrInvalidCondition)
+	}
+	tenant := ""
+	if !all {
+		var err error
+		if tenant, err = s.tenant(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	w := &memoryWatcher{wake: make(chan struct{}, 1)}
+	// The watcher is registered under the same lock as the missed changes are read, so that no change falls in between
+	s.mu.Lock()
+	var missed []Change[T]
+	if since, resume := watchSince(ctx); resume && !all {
+		var err error
+		if missed, err = s.changesSince(ctx, tenant, since, conds); err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+	}
+	s.watchers[w] = struct{}{}
+	s.mu.Unlock()
+
+	changes := make(chan Change[T])
+	go s.watch(ctx, w, missed, conds, changes)
+	return changes, nil
+}
+
+// watch delivers the missed changes then the changes that the watcher is notified of until ctx is done
+func (s *memoryStore[T]) watch(ctx context.Context, w *memoryWatcher, missed []Change[T], conds []Condition, changes chan<- Change[T]) {
+	defer close(changes)
+	defer func() {
+		s.mu.Lock()
+		delete(s.watchers, w)
+		s.mu.Unlock()
+	}()
+
+	send := func(c Change[T]) bool {
+		select {
+		case changes <- c:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for _, c := range missed {
+		if !send(c) {
+			return
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+			for _, n := range w.take() {
+				c, matches, err := s.change(ctx, n, conds)
+				if err != nil {
+					return
+				}
+				if matches && !send(c) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// change creates the change of a write. It doesn't match if the stored item didn't fill the conditions right after the
+// write.
+func (s *memoryStore[T]) change(ctx context.Context, n memoryChange, conds []Condition) (Change[T], bool, error) {
+	c := Change[T]{Operation: n.operation, ID: n.id, Version: n.version, At: n.at}
+	if s.tenancy {
+		if allTenants(ctx) {
+			// Like SQL stores, the items of all tenants are not delivered
+			return c, true, nil
+		}
+		if tenant, _ := tenantOf(ctx); n.tenant != tenant {
+			return Change[T]{}, false, nil
+		}
+	}
+	if n.item == nil {
+		// There is nothing left to match the conditions against
+		return c, true, nil
+	}
+
+	ok, err := matchesAll(conds, n.item)
+	if err != nil || !ok {
+		return Change[T]{}, false, err
+	}
+	if c.Item, err = s.stored(n.item, nil); err != nil {
+		return Change[T]{}, false, err
+	}
+	return c, true, nil
+}
+
+// changesSince returns the latest change of every stored item of the tenant that fills the conditions and was written
+// since the passed time, oldest first. Items deleted from stores that are not in soft-delete mode cannot be caught up.
+// The lock must be held.
+func (s *memoryStore[T]) changesSince(ctx context.Context, tenant string, since time.Time, conds []Condition) ([]Change[T], error) {
+	items, err := s.filter(s.sortedItems(tenant), readOptions{conds: conds, includeDeleted: true})
+	if err != nil {
+		return nil, err
+	}
+	result := []Change[T]{}
+	for _, item := range items {
+		if item.ModifiedAt.Before(since) && (item.DeletedAt == nil || item.DeletedAt.Before(since)) {
+			continue
+		}
+		stored, err := s.stored(item, nil)
+		if err != nil {
+			return nil, err
+		}
+		c := Change[T]{Operation: PatchOperation, ID: item.ID, Version: item.Version, At: item.ModifiedAt, Item: stored}
+		if item.DeletedAt != nil {
+			c.Operation = DeleteOperation
+			c.At = *item.DeletedAt
+		} else if item.Version == 1 {
+			c.Operation = AddOperation
+		}
+		result = append(result, c)
+	}
+	slices.SortStableFunc(result, func(a, b Change[T]) int {
+		return a.At.Compare(b.At)
+	})
+	return result, nil
+}
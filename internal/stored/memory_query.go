@@ -0,0 +1,689 @@
+package stored
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math/big"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The conditions, sorts and aggregations of memory stores follow the semantics of their SQL in Postgres: attributes
+// are compared as JSONB and conditions on missing attributes are unknown, like SQL NULL.
+
+// sqlBool a boolean of SQL, which is unknown when it is computed from a missing value
+type sqlBool int
+
+const (
+	sqlFalse sqlBool = iota
+	sqlTrue
+	sqlUnknown
+)
+
+func toSQLBool(b bool) sqlBool {
+	if b {
+		return sqlTrue
+	}
+	return sqlFalse
+}
+
+// decodeJSON decodes a JSON document keeping its numbers as json.Number, so that they are compared exactly
+func decodeJSON(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var result any
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// jsonValue returns the decoded JSON of a value
+func jsonValue(value any) (any, error) {
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(valueJSON)
+}
+
+// lookup returns the value at the path inside a decoded JSON document like subscripting the content does. It returns
+// false if there is no value at the path.
+func (p attributePath) lookup(doc any) (any, bool) {
+	for _, k := range p {
+		switch d := doc.(type) {
+		case map[string]any:
+			v, ok := d[k]
+			if !ok {
+				return nil, false
+			}
+			doc = v
+		case []any:
+			i, err := strconv.Atoi(k)
+			if err != nil {
+				return nil, false
+			}
+			if i < 0 {
+				i += len(d)
+			}
+			if i < 0 || i >= len(d) {
+				return nil, false
+			}
+			doc = d[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// lookupStrict returns the value at the path inside a decoded JSON document like a strict JSON path does, which only
+// goes through objects
+func (p attributePath) lookupStrict(doc any) (any, bool) {
+	for _, k := range p {
+		d, ok := doc.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = d[k]; !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// set returns the decoded JSON document with the value at the path, like assigning to a subscript of the content
+// does. Missing and null objects along the path are created, and arrays are padded with nulls up to the index.
+func (p attributePath) set(doc any, value any) (any, error) {
+	if len(p) == 0 {
+		return value, nil
+	}
+
+	switch d := doc.(type) {
+	case nil:
+		child, err := p[1:].set(nil, value)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{p[0]: child}, nil
+	case map[string]any:
+		child, err := p[1:].set(d[p[0]], value)
+		if err != nil {
+			return nil, err
+		}
+		d[p[0]] = child
+		return d, nil
+	case []any:
+		i, err := strconv.Atoi(p[0])
+		if err != nil {
+			return nil, fmt.Errorf("'%v' is not a valid index of an array", p[0])
+		}
+		if i < 0 {
+			i += len(d)
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("index %v is out of the bounds of an array", p[0])
+		}
+		for len(d) <= i {
+			d = append(d, nil)
+		}
+		if d[i], err = p[1:].set(d[i], value); err != nil {
+			return nil, err
+		}
+		return d, nil
+	default:
+		return nil, fmt.Errorf("cannot set '%v' inside a scalar", p[0])
+	}
+}
+
+// matchesAll returns whether the stored item fills all the conditions
+func matchesAll(conds []Condition, item *memoryItem) (bool, error) {
+	if len(conds) == 0 {
+		return true, nil
+	}
+	doc, err := decodeJSON(item.Content)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range conds {
+		b, err := matches(c, item, doc)
+		if err != nil || b != sqlTrue {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matches evaluates a valid condition against the stored item, whose content is decoded as doc
+func matches(c Condition, item *memoryItem, doc any) (sqlBool, error) {
+	switch c.Op {
+	case AndOperator, OrOperator:
+		// A false child decides AND and a true child decides OR, otherwise an unknown child makes the result unknown
+		decisive := toSQLBool(c.Op == OrOperator)
+		result := toSQLBool(c.Op == AndOperator)
+		for _, child := range c.Value.([]Condition) {
+			b, err := matches(child, item, doc)
+			if err != nil {
+				return sqlFalse, err
+			}
+			if b == decisive {
+				return b, nil
+			}
+			if b == sqlUnknown {
+				result = sqlUnknown
+			}
+		}
+		return result, nil
+	case NotOperator:
+		b, err := matches(c.Value.(Condition), item, doc)
+		if err != nil || b == sqlUnknown {
+			return b, err
+		}
+		return toSQLBool(b == sqlFalse), nil
+	}
+
+	if c.Column != "" {
+		return matchesColumn(c, columnValue(c.Column, *item))
+	}
+
+	path, err := parsePath(c.Attribute)
+	if err != nil {
+		return sqlFalse, err
+	}
+	switch c.Op {
+	case ContainsOperator:
+		ok, err := contains(path, doc, c.Value)
+		return toSQLBool(ok), err
+	case ExistsOperator:
+		_, ok := path.lookupStrict(doc)
+		return toSQLBool(ok), nil
+	case IsNotNullOperator, IsNullOperator:
+		v, ok := path.lookupStrict(doc)
+		return toSQLBool((ok && v != nil) == (c.Op == IsNotNullOperator)), nil
+	}
+
+	value, ok := path.lookup(doc)
+	if !ok {
+		return sqlUnknown, nil
+	}
+	switch c.Op {
+	case InOperator, NotInOperator:
+		for _, v := range sliceValues(c.Value) {
+			other, err := jsonValue(v)
+			if err != nil {
+				return sqlFalse, err
+			}
+			if compareJSON(value, other) == 0 {
+				return toSQLBool(c.Op == InOperator), nil
+			}
+		}
+		return toSQLBool(c.Op == NotInOperator), nil
+	case LikeOperator, ILikeOperator:
+		if value == nil {
+			return sqlUnknown, nil
+		}
+		text, ok := value.(string)
+		if !ok {
+			textJSON, err := json.Marshal(value)
+			if err != nil {
+				return sqlFalse, err
+			}
+			text = string(textJSON)
+		}
+		return like(text, c.Value.(string), c.Op == ILikeOperator)
+	case BetweenOperator:
+		bounds := sliceValues(c.Value)
+		lower, err := jsonValue(bounds[0])
+		if err != nil {
+			return sqlFalse, err
+		}
+		upper, err := jsonValue(bounds[1])
+		if err != nil {
+			return sqlFalse, err
+		}
+		return toSQLBool(compareJSON(value, lower) >= 0 && compareJSON(value, upper) <= 0), nil
+	default:
+		other, err := jsonValue(c.Value)
+		if err != nil {
+			return sqlFalse, err
+		}
+		return toSQLBool(compared(compareJSON(value, other), c.Op)), nil
+	}
+}
+
+// matchesColumn evaluates a valid condition on a column whose value is passed
+func matchesColumn(c Condition, value any) (sqlBool, error) {
+	switch c.Op {
+	case InOperator, NotInOperator:
+		in := false
+		for _, v := range sliceValues(c.Value) {
+			result, err := compareColumn(value, v)
+			if err != nil {
+				return sqlFalse, err
+			}
+			in = in || result == 0
+		}
+		return toSQLBool(in == (c.Op == InOperator)), nil
+	case BetweenOperator:
+		bounds := sliceValues(c.Value)
+		lower, err := compareColumn(value, bounds[0])
+		if err != nil {
+			return sqlFalse, err
+		}
+		upper, err := compareColumn(value, bounds[1])
+		if err != nil {
+			return sqlFalse, err
+		}
+		return toSQLBool(lower >= 0 && upper <= 0), nil
+	case LikeOperator, ILikeOperator:
+		text, ok := value.(string)
+		if !ok {
+			return sqlFalse, fmt.Errorf("%w: %v is not supported on column '%v'", ErrInvalidCondition, c.Op, c.Column)
+		}
+		return like(text, c.Value.(string), c.Op == ILikeOperator)
+	default:
+		result, err := compareColumn(value, c.Value)
+		if err != nil {
+			return sqlFalse, err
+		}
+		return toSQLBool(compared(result, c.Op)), nil
+	}
+}
+
+// compared returns whether the result of a comparison fills the comparison operator
+func compared(result int, op Operator) bool {
+	switch op {
+	case EqualOperator:
+		return result == 0
+	case NotEqualOperator:
+		return result != 0
+	case GreaterThanOperator:
+		return result > 0
+	case LessThanOperator:
+		return result < 0
+	case GreaterThanOrEqualOpertor:
+		return result >= 0
+	case LessThanOrEqualOperator:
+		return result <= 0
+	}
+	return false
+}
+
+// timeLayouts the layouts of the times that can be compared with time columns
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999", "2006-01-02 15:04:05.999999", time.DateOnly}
+
+// compareColumn compares the value of a column with a value, which is converted to the type of the column like
+// Postgres converts query parameters
+func compareColumn(column any, value any) (int, error) {
+	t, ok := column.(time.Time)
+	if !ok {
+		return strings.Compare(fmt.Sprint(column), fmt.Sprint(value)), nil
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		return t.Compare(v), nil
+	case string:
+		for _, layout := range timeLayouts {
+			if parsed, err := time.Parse(layout, v); err == nil {
+				return t.Compare(parsed), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("%w: '%v' is not a time", ErrInvalidCondition, value)
+}
+
+// jsonRank the order of the types of JSON values in Postgres: null < string < number < boolean < array < object
+func jsonRank(value any) int {
+	switch value.(type) {
+	case string:
+		return 1
+	case json.Number:
+		return 2
+	case bool:
+		return 3
+	case []any:
+		return 4
+	case map[string]any:
+		return 5
+	}
+	return 0
+}
+
+// compareJSON compares decoded JSON values like Postgres compares JSONB values
+func compareJSON(a any, b any) int {
+	if result := cmp.Compare(jsonRank(a), jsonRank(b)); result != 0 {
+		return result
+	}
+
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case json.Number:
+		x, _ := new(big.Rat).SetString(a.String())
+		y, _ := new(big.Rat).SetString(b.(json.Number).String())
+		if x == nil || y == nil {
+			return strings.Compare(a.String(), b.(json.Number).String())
+		}
+		return x.Cmp(y)
+	case bool:
+		switch {
+		case a == b.(bool):
+			return 0
+		case a:
+			return 1
+		}
+		return -1
+	case []any:
+		// Longer arrays are greater, then arrays are compared element by element
+		b := b.([]any)
+		if result := cmp.Compare(len(a), len(b)); result != 0 {
+			return result
+		}
+		for i := range a {
+			if result := compareJSON(a[i], b[i]); result != 0 {
+				return result
+			}
+		}
+	case map[string]any:
+		// Larger objects are greater, then objects are compared key by key in the order that JSONB stores the keys in
+		b := b.(map[string]any)
+		if result := cmp.Compare(len(a), len(b)); result != 0 {
+			return result
+		}
+		aKeys := slices.SortedFunc(maps.Keys(a), compareJSONKeys)
+		bKeys := slices.SortedFunc(maps.Keys(b), compareJSONKeys)
+		for i := range aKeys {
+			if result := compareJSONKeys(aKeys[i], bKeys[i]); result != 0 {
+				return result
+			}
+			if result := compareJSON(a[aKeys[i]], b[bKeys[i]]); result != 0 {
+				return result
+			}
+		}
+	}
+	return 0
+}
+
+// compareJSONKeys orders keys like JSONB stores them: shorter keys first
+func compareJSONKeys(a string, b string) int {
+	return cmp.Or(cmp.Compare(len(a), len(b)), strings.Compare(a, b))
+}
+
+// contains returns whether the document contains the value at the path, like the containment of the content does
+func contains(path attributePath, doc any, value any) (bool, error) {
+	containing, err := path.containing(value)
+	if err != nil {
+		return false, err
+	}
+	other, err := decodeJSON(containing)
+	if err != nil {
+		return false, err
+	}
+	return containsJSON(doc, other), nil
+}
+
+// containsJSON returns whether a contains b as per JSONB containment: objects contain the objects whose keys they have
+// with contained values, arrays contain the arrays whose elements are all contained by one of their elements, and
+// scalars only contain equal scalars
+func containsJSON(a any, b any) bool {
+	switch b := b.(type) {
+	case map[string]any:
+		a, ok := a.(map[string]any)
+		if !ok {
+			return false
+		}
+		for k, v := range b {
+			if av, ok := a[k]; !ok || !containsJSON(av, v) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		a, ok := a.([]any)
+		if !ok {
+			return false
+		}
+		for _, v := range b {
+			if !slices.ContainsFunc(a, func(av any) bool { return containsJSON(av, v) }) {
+				return false
+			}
+		}
+		return true
+	default:
+		return jsonRank(a) == jsonRank(b) && compareJSON(a, b) == 0
+	}
+}
+
+// like matches a text against a SQL LIKE pattern, where % matches any text, _ matches any character and \ escapes
+func like(text string, pattern string, insensitive bool) (sqlBool, error) {
+	expr := strings.Builder{}
+	expr.WriteString("(?s")
+	if insensitive {
+		expr.WriteString("i")
+	}
+	expr.WriteString(")^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			expr.WriteString(".*")
+		case r == '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		return sqlFalse, fmt.Errorf("%w: LIKE pattern '%v' ends with an escape character", ErrInvalidCondition, pattern)
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return sqlFalse, err
+	}
+	return toSQLBool(re.MatchString(text)), nil
+}
+
+// jsonStrings returns all the strings inside a decoded JSON document, excluding the keys of objects
+func jsonStrings(doc any) []string {
+	switch d := doc.(type) {
+	case string:
+		return []string{d}
+	case []any:
+		result := []string{}
+		for _, v := range d {
+			result = append(result, jsonStrings(v)...)
+		}
+		return result
+	case map[string]any:
+		result := []string{}
+		for _, k := range slices.Sorted(maps.Keys(d)) {
+			result = append(result, jsonStrings(d[k])...)
+		}
+		return result
+	}
+	return nil
+}
+
+// truncate returns the start of the bucket that a time is in, like date_trunc does
+func (b TimeBucket) truncate(t time.Time) time.Time {
+	switch b {
+	case HourBucket:
+		return t.Truncate(time.Hour)
+	case DayBucket:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	case WeekBucket:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		// Weeks start on Monday
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case MonthBucket:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	case YearBucket:
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
+	}
+	return t
+}
+
+// memoryGroup the items of a group of an aggregation in a memory store
+type memoryGroup struct {
+	// keys the group by values of the group. Attributes are decoded JSON and missing attributes are nil.
+	keys []any
+
+	// values the values that the function is computed on, without the missing ones
+	values []any
+
+	// count the number of items of the group
+	count int64
+}
+
+// aggregate computes a valid aggregation on the items
+func aggregate(agg Aggregation, items []*memoryItem) ([]Group, error) {
+	var aggPath attributePath
+	if agg.Attribute != "" {
+		aggPath, _ = parsePath(agg.Attribute)
+	}
+	groupPaths := make([]attributePath, len(agg.GroupBy))
+	for i, g := range agg.GroupBy {
+		if g.Attribute != "" {
+			groupPaths[i], _ = parsePath(g.Attribute)
+		}
+	}
+
+	groups := map[string]*memoryGroup{}
+	for _, item := range items {
+		doc, err := decodeJSON(item.Content)
+		if err != nil {
+			return nil, err
+		}
+
+		keys := make([]any, len(agg.GroupBy))
+		for i, g := range agg.GroupBy {
+			switch {
+			case groupPaths[i] != nil:
+				keys[i], _ = groupPaths[i].lookup(doc)
+			case g.Bucket != "":
+				keys[i] = g.Bucket.truncate(columnValue(g.Column, *item).(time.Time))
+			default:
+				keys[i] = columnValue(g.Column, *item)
+			}
+		}
+		keysJSON, err := json.Marshal(keys)
+		if err != nil {
+			return nil, err
+		}
+		group, ok := groups[string(keysJSON)]
+		if !ok {
+			group = &memoryGroup{keys: keys}
+			groups[string(keysJSON)] = group
+		}
+		group.count++
+
+		switch {
+		case aggPath != nil:
+			value, ok := aggPath.lookup(doc)
+			if !ok {
+				continue
+			}
+			// Attributes are aggregated as numbers, which fails for other values like it does in Postgres
+			if _, isNumber := value.(json.Number); !isNumber {
+				return nil, fmt.Errorf("attribute '%v' has a value that is not a number: %v", agg.Attribute, value)
+			}
+			group.values = append(group.values, value)
+		case agg.Column != "":
+			group.values = append(group.values, columnValue(agg.Column, *item))
+		}
+	}
+
+	sorted := slices.SortedFunc(maps.Values(groups), func(a, b *memoryGroup) int {
+		for i := range agg.GroupBy {
+			if result := compareGroupKeys(a.keys[i], b.keys[i], groupPaths[i] != nil); result != 0 {
+				return result
+			}
+		}
+		return 0
+	})
+
+	result := make([]Group, 0, len(sorted))
+	for _, group := range sorted {
+		g := Group{Keys: make([]any, len(group.keys))}
+		for i, key := range group.keys {
+			g.Keys[i] = key
+			if groupPaths[i] != nil {
+				g.Keys[i] = plainJSON(key)
+			}
+		}
+		g.Value = aggregateValue(agg, group)
+		result = append(result, g)
+	}
+	return result, nil
+}
+
+// compareGroupKeys compares the keys of groups like ORDER BY does. Missing attributes are sorted last like NULL.
+func compareGroupKeys(a any, b any, isJSON bool) int {
+	if !isJSON {
+		result, _ := compareColumn(a, b)
+		return result
+	}
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	return compareJSON(a, b)
+}
+
+// aggregateValue computes the function of the aggregation on the values of a group
+func aggregateValue(agg Aggregation, group *memoryGroup) any {
+	if agg.Function == "" || agg.Function == CountFunction {
+		return group.count
+	}
+	if len(group.values) == 0 {
+		return nil
+	}
+
+	compare := func(a, b any) int {
+		if agg.Attribute != "" {
+			return compareJSON(a, b)
+		}
+		result, _ := compareColumn(a, b)
+		return result
+	}
+	value := slices.MinFunc(group.values, compare)
+	if agg.Function == MaxFunction {
+		value = slices.MaxFunc(group.values, compare)
+	}
+	if agg.Attribute != "" {
+		return plainJSON(value)
+	}
+	return value
+}
+
+// plainJSON converts a decoded JSON value to the value that decoding it without json.Number gives, which is what
+// aggregations of SQL stores return
+func plainJSON(value any) any {
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var result any
+	if err := json.Unmarshal(valueJSON, &result); err != nil {
+		return value
+	}
+	return result
+}
@@ -0,0 +1,806 @@
+package stored
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	type nested struct {
+		X int    `json:"x"`
+		Y string `json:"y"`
+	}
+	type content struct {
+		I int      `json:"i"`
+		B bool     `json:"b"`
+		S string   `json:"s"`
+		N *nested  `json:"n,omitempty"`
+		L []string `json:"l,omitempty"`
+		K string   `json:"k,omitempty" stored:"readonly"`
+	}
+	admin := "admin@example.com"
+	updater := "admin2@example.com"
+	table := "stored"
+	ctx := context.Background()
+	id := "id1"
+	fixture := content{I: 5, B: true, S: "Some Text"}
+
+	t.Run("Add and Get", func(t *testing.T) {
+		s := NewMemoryStore[content](table)
+
+		added, err := s.Add(ctx, admin, id, fixture)
+		require.NoError(t, err)
+		assert.False(t, added.CreatedAt.IsZero())
+		assert.Equal(t, added.CreatedAt, added.ModifiedAt)
+		assert.Equal(t, admin, added.CreatedBy)
+		assert.Equal(t, admin, added.ModifiedBy)
+		assert.Equal(t, int64(1), added.Version)
+		assert.Equal(t, fixture, added.Content)
+
+		fetched, err := s.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, *added, *fetched)
+
+		// The returned items don't share their content with the store
+		fetched.Content.S = "changed"
+		fetched, err = s.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, fixture, fetched.Content)
+
+		_, err = s.Get(ctx, "missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Add fails when", func(t *testing.T) {
+		s := NewMemoryStore[content](table)
+		_, err := s.Add(ctx, admin, id, fixture)
+		require.NoError(t, err)
+
+		tests := []struct {
+			name       string
+			id         string
+			creator    string
+			constraint string
+		}{
+			{"missing id", "", admin, table + "_id_check"},
+			{"missing creator", "abc", "", table + "_created_by_check"},
+			{"the id already exists", id, admin, table + "_pkey"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				added, err := s.Add(ctx, tt.creator, tt.id, fixture)
+				violation := &ConstraintViolationError{}
+				require.ErrorAs(t, err, &violation)
+				assert.Equal(t, tt.constraint, violation.Constraint)
+				assert.Nil(t, added)
+			})
+		}
+
+		_, err = s.Add(ctx, admin, id, fixture)
+		assert.ErrorIs(t, err, ErrAlreadyExists)
+	})
+
+	t.Run("Patch", func(t *testing.T) {
+		s := NewMemoryStore[content](table)
+		added, err := s.Add(ctx, admin, id, content{I: 5, B: true, S: "Some Text", L: []string{"a"}})
+		require.NoError(t, err)
+
+		patched, err := s.Patch(ctx, updater, id, map[string]any{"i": 6, "n.y": "y", "/l/1": "b"})
+		require.NoError(t, err)
+		assert.Equal(t, content{I: 6, B: true, S: "Some Text", N: &nested{Y: "y"}, L: []string{"a", "b"}}, patched.Content)
+		assert.Equal(t, int64(2), patched.Version)
+		assert.Equal(t, updater, patched.ModifiedBy)
+		assert.Equal(t, added.CreatedAt, patched.CreatedAt)
+
+		fetched, err := s.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, *patched, *fetched)
+	})
+
+	t.Run("Patch fails when", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			ctx        context.Context
+			id         string
+			attributes map[string]any
+			expected   error
+		}{
+			{"the item doesn't exist", ctx, "missing", map[string]any{"i": 6}, ErrNotFound},
+			{"the attribute is not modeled", ctx, id, map[string]any{"z": 6}, ErrInvalidContent},
+			{"the value doesn't fit the attribute", ctx, id, map[string]any{"i": "six"}, ErrInvalidContent},
+			{"the path is invalid", ctx, id, map[string]any{"n..x": 6}, ErrInvalidAttribute},
+			{"the attribute is read-only", ctx, id, map[string]any{"k": "key"}, ErrReadOnlyAttribute},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				s := NewMemoryStore[content](table)
+				_, err := s.Add(ctx, admin, id, fixture)
+				require.NoError(t, err)
+
+				patched, err := s.Patch(tt.ctx, updater, tt.id, tt.attributes)
+				assert.ErrorIs(t, err, tt.expected)
+				assert.Nil(t, patched)
+
+				fetched, err := s.Get(ctx, id)
+				require.NoError(t, err)
+				assert.Equal(t, int64(1), fetched.Version)
+			})
+		}
+	})
+
+	t.Run("Patch validates the patched content", func(t *testing.T) {
+		s := NewMemoryStore[content](table, WithValidator(ValidatorFunc(func(c any) error {
+			if c.(content).I < 0 {
+				return errors.New("i can't be negative")
+			}
+			return nil
+		})))
+		_, err := s.Add(ctx, admin, id, fixture)
+		require.NoError(t, err)
+
+		_, err = s.Patch(ctx, updater, id, map[string]any{"i": -1})
+		assert.ErrorIs(t, err, ErrInvalidContent)
+		fetched, err := s.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, fixture, fetched.Content)
+	})
+
+	t.Run("PatchVersion and PutVersion fail with a conflict", func(t *testing.T) {
+		s := NewMemoryStore[content](table)
+		_, err := s.Add(ctx, admin, id, fixture)
+		require.NoError(t, err)
+
+		_, err = s.PatchVersion(ctx, updater, id, 2, map[string]any{"i": 6})
+		conflict := &ConflictError{}
+		require.ErrorAs(t, err, &conflict)
+		assert.Equal(t, int64(1), conflict.ActualVersion)
+
+		_, err = s.PutVersion(ctx, updater, id, 2, fixture)
+		assert.ErrorIs(t, err, ErrConflict)
+
+		patched, err := s.PatchVersion(ctx, updater, id, 1, map[string]any{"i": 6})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), patched.Version)
+	})
+
+	t.Run("Put replaces the content", func(t *testing.T) {
+		s := NewMemoryStore[content](table)
+		added, err := s.Add(ctx, admin, id, content{I: 1, N: &nested{X: 1}})
+		require.NoError(t, err)
+
+		put, err := s.Put(ctx, updater, id, fixture)
+		require.NoError(t, err)
+		assert.Equal(t, fixture, put.Content)
+		assert.Equal(t, added.CreatedBy, put.CreatedBy)
+		assert.Equal(t, updater, put.ModifiedBy)
+		assert.Equal(t, int64(2), put.Version)
+
+		_, err = s.Put(ctx, updater, "missing", fixture)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Upsert adds, replaces and restores", func(t *testing.T) {
+		s := NewMemoryStore[content](table, WithSoftDelete())
+
+		upserted, err := s.Upsert(ctx, admin, id, fixture)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), upserted.Version)
+
+		require.NoError(t, s.Delete(ctx, admin, id))
+		upserted, err = s.Upsert(ctx, updater, id, content{I: 6})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), upserted.Version)
+		assert.Equal(t, content{I: 6}, upserted.Content)
+		assert.Equal(t, admin, upserted.CreatedBy)
+		assert.Nil(t, upserted.DeletedAt)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		s := NewMemoryStore[content](table)
+		_, err := s.Add(ctx, admin, id, fixture)
+		require.NoError(t, err)
+
+		require.NoError(t, s.Delete(ctx, admin, id))
+		_, err = s.Get(ctx, id, IncludeDeleted())
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, s.Delete(ctx, admin, id), ErrNotFound)
+
+		_, err = s.Restore(ctx, admin, id)
+		assert.ErrorIs(t, err, ErrSoftDeleteDisabled)
+	})
+
+	t.Run("Soft delete and Restore", func(t *testing.T) {
+		s := NewMemoryStore[content](table, WithSoftDelete())
+		_, err := s.Add(ctx, admin, id, fixture)
+		require.NoError(t, err)
+
+		require.NoError(t, s.Delete(ctx, updater, id))
+		_, err = s.Get(ctx, id)
+		assert.ErrorIs(t, err, ErrNotFound)
+		listed, err := s.List(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, listed)
+		_, err = s.Patch(ctx, admin, id, map[string]any{"i": 6})
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		deleted, err := s.Get(ctx, id, IncludeDeleted())
+		require.NoError(t, err)
+		require.NotNil(t, deleted.DeletedAt)
+		assert.Equal(t, updater, deleted.DeletedBy)
+		assert.Equal(t, int64(2), deleted.Version)
+
+		_, err = s.Add(ctx, admin, id, fixture)
+		assert.ErrorIs(t, err, ErrDeleted)
+		assert.ErrorIs(t, err, ErrAlreadyExists)
+
+		restored, err := s.Restore(ctx, admin, id)
+		require.NoError(t, err)
+		assert.Nil(t, restored.DeletedAt)
+		assert.Equal(t, int64(3), restored.Version)
+		_, err = s.Add(ctx, admin, id, fixture)
+		assert.NotErrorIs(t, err, ErrDeleted)
+
+		_, err = s.Restore(ctx, admin, id)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("AddMany", func(t *testing.T) {
+		items := []Stored[content]{{ID: "1", Content: fixture}, {ID: id, Content: fixture}, {ID: "3", Content: fixture}}
+
+		t.Run("Adds nothing if any item fails in AllOrNothing mode", func(t *testing.T) {
+			s := NewMemoryStore[content](table)
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+
+			_, err = s.AddMany(ctx, admin, items, AllOrNothing)
+			assert.ErrorIs(t, err, ErrAlreadyExists)
+			count, err := s.Count(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), count)
+		})
+
+		t.Run("Reports failing items in PerItem mode", func(t *testing.T) {
+			s := NewMemoryStore[content](table)
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+
+			results, err := s.AddMany(ctx, admin, items, PerItem)
+			require.NoError(t, err)
+			require.Len(t, results, 3)
+			assert.Equal(t, "1", results[0].Item.ID)
+			assert.ErrorIs(t, results[1].Err, ErrAlreadyExists)
+			assert.Equal(t, "3", results[2].Item.ID)
+			count, err := s.Count(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), count)
+		})
+
+		t.Run("Rejects duplicate ids in AllOrNothing mode", func(t *testing.T) {
+			s := NewMemoryStore[content](table)
+
+			_, err := s.AddMany(ctx, admin, append(items, Stored[content]{ID: "1", Content: fixture}), AllOrNothing)
+			assert.ErrorIs(t, err, ErrAlreadyExists)
+			batchErr := &BatchItemError{}
+			require.ErrorAs(t, err, &batchErr)
+			assert.Equal(t, 3, batchErr.Index)
+			count, err := s.Count(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, int64(0), count)
+		})
+
+		t.Run("Reports soft-deleted ids in PerItem mode", func(t *testing.T) {
+			s := NewMemoryStore[content](table, WithSoftDelete())
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			require.NoError(t, s.Delete(ctx, admin, id))
+
+			results, err := s.AddMany(ctx, admin, items, PerItem)
+			require.NoError(t, err)
+			require.Len(t, results, 3)
+			assert.ErrorIs(t, results[1].Err, ErrDeleted)
+		})
+	})
+
+	t.Run("PatchMany", func(t *testing.T) {
+		patches := []ItemPatch{{ID: id, Attributes: map[string]any{"i": 6}}, {ID: "missing", Attributes: map[string]any{"i": 6}}}
+
+		t.Run("Patches nothing if any patch fails in AllOrNothing mode", func(t *testing.T) {
+			s := NewMemoryStore[content](table)
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+
+			_, err = s.PatchMany(ctx, updater, patches, AllOrNothing)
+			batchErr := &BatchItemError{}
+			require.ErrorAs(t, err, &batchErr)
+			assert.Equal(t, 1, batchErr.Index)
+			assert.ErrorIs(t, err, ErrNotFound)
+			fetched, err := s.Get(ctx, id)
+			require.NoError(t, err)
+			assert.Equal(t, fixture, fetched.Content)
+		})
+
+		t.Run("Reports failing patches in PerItem mode", func(t *testing.T) {
+			s := NewMemoryStore[content](table)
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+
+			results, err := s.PatchMany(ctx, updater, patches, PerItem)
+			require.NoError(t, err)
+			require.Len(t, results, 2)
+			assert.Equal(t, 6, results[0].Item.Content.I)
+			assert.ErrorIs(t, results[1].Err, ErrNotFound)
+		})
+	})
+
+	t.Run("List", func(t *testing.T) {
+		fixtures := map[string]content{
+			"1": {I: 0, B: true, S: "a", N: &nested{X: 1, Y: "x"}, L: []string{"red", "blue"}},
+			"2": {I: 10, B: false, S: "b", N: &nested{X: 2, Y: "y"}, L: []string{"blue"}},
+			"3": {I: 20, B: true, S: "c"},
+			"4": {I: 30, B: false, S: "d"},
+		}
+		s := NewMemoryStore[content](table)
+		for _, id := range []string{"1", "2", "3", "4"} {
+			_, err := s.Add(ctx, admin, id, fixtures[id])
+			require.NoError(t, err)
+		}
+
+		tests := []struct {
+			name     string
+			cond     []Condition
+			expected []string
+		}{
+			{"all results", nil, []string{"1", "2", "3", "4"}},
+			{"equal int", []Condition{{Attribute: "i", Op: EqualOperator, Value: 0}}, []string{"1"}},
+			{"not equal int", []Condition{{Attribute: "i", Op: NotEqualOperator, Value: 0}}, []string{"2", "3", "4"}},
+			{"greater than int", []Condition{{Attribute: "i", Op: GreaterThanOperator, Value: 10}}, []string{"3", "4"}},
+			{"less than equal int", []Condition{{Attribute: "i", Op: LessThanOrEqualOperator, Value: 10}}, []string{"1", "2"}},
+			{"numbers compare with strings as JSON", []Condition{{Attribute: "i", Op: LessThanOperator, Value: "0"}}, []string{}},
+			{"equal bool", []Condition{{Attribute: "b", Op: EqualOperator, Value: true}}, []string{"1", "3"}},
+			{"greater than string", []Condition{{Attribute: "s", Op: GreaterThanOperator, Value: "b"}}, []string{"3", "4"}},
+			{"equal nested", []Condition{{Attribute: "n.y", Op: EqualOperator, Value: "y"}}, []string{"2"}},
+			{"greater than nested JSON pointer", []Condition{{Attribute: "/n/x", Op: GreaterThanOperator, Value: 1}}, []string{"2"}},
+			{"in int", []Condition{{Attribute: "i", Op: InOperator, Value: []int{0, 20}}}, []string{"1", "3"}},
+			{"in nested", []Condition{{Attribute: "n.x", Op: InOperator, Value: []int{2, 3}}}, []string{"2"}},
+			{"not in int", []Condition{{Attribute: "i", Op: NotInOperator, Value: []int{0, 20}}}, []string{"2", "4"}},
+			{"in object", []Condition{{Attribute: "n", Op: InOperator, Value: []nested{{X: 1, Y: "x"}}}}, []string{"1"}},
+			{"in object is not containment", []Condition{{Attribute: "n", Op: InOperator, Value: []any{map[string]any{"x": 1}}}}, []string{}},
+			{"in array is not containment", []Condition{{Attribute: "l", Op: InOperator, Value: []any{[]string{"blue"}}}}, []string{"2"}},
+			{"not in object skips missing attributes", []Condition{{Attribute: "n", Op: NotInOperator, Value: []nested{{X: 1, Y: "x"}}}}, []string{"2"}},
+			{"not in skips missing attributes", []Condition{{Attribute: "n.x", Op: NotInOperator, Value: []int{1}}}, []string{"2"}},
+			{"contains", []Condition{{Attribute: "l", Op: ContainsOperator, Value: []string{"blue"}}}, []string{"1", "2"}},
+			{"contains all", []Condition{{Attribute: "l", Op: ContainsOperator, Value: []string{"red", "blue"}}}, []string{"1"}},
+			{"exists nested", []Condition{{Attribute: "n.x", Op: ExistsOperator}}, []string{"1", "2"}},
+			{"is null", []Condition{{Attribute: "n", Op: IsNullOperator}}, []string{"3", "4"}},
+			{"is not null", []Condition{{Attribute: "n", Op: IsNotNullOperator}}, []string{"1", "2"}},
+			{"like is case sensitive", []Condition{{Attribute: "s", Op: LikeOperator, Value: "A%"}}, []string{}},
+			{"ilike", []Condition{{Attribute: "s", Op: ILikeOperator, Value: "A%"}}, []string{"1"}},
+			{"like nested", []Condition{{Attribute: "n.y", Op: LikeOperator, Value: "_"}}, []string{"1", "2"}},
+			{"between", []Condition{{Attribute: "i", Op: BetweenOperator, Value: []int{10, 20}}}, []string{"2", "3"}},
+			{"or", []Condition{Or(Condition{Attribute: "i", Op: EqualOperator, Value: 0}, Condition{Attribute: "s", Op: EqualOperator, Value: "d"})}, []string{"1", "4"}},
+			{"not", []Condition{Not(Condition{Attribute: "b", Op: EqualOperator, Value: true})}, []string{"2", "4"}},
+			{"not on a missing attribute is unknown", []Condition{Not(Condition{Attribute: "n.x", Op: EqualOperator, Value: 1})}, []string{"2"}},
+			{"or with an unknown condition", []Condition{Or(Condition{Attribute: "n.x", Op: EqualOperator, Value: 1}, Condition{Attribute: "i", Op: EqualOperator, Value: 30})}, []string{"1", "4"}},
+			{"column", []Condition{{Column: IDColumn, Op: InOperator, Value: []string{"1", "3"}}}, []string{"1", "3"}},
+			{"column or attribute", []Condition{Or(Condition{Column: CreatedByColumn, Op: NotEqualOperator, Value: admin}, Condition{Attribute: "i", Op: EqualOperator, Value: 30})}, []string{"4"}},
+			{"time column", []Condition{{Column: CreatedAtColumn, Op: LessThanOperator, Value: time.Now().Add(time.Hour)}}, []string{"1", "2", "3", "4"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				result, err := s.List(ctx, Where(tt.cond...))
+				require.NoError(t, err)
+				ids := []string{}
+				for _, r := range result {
+					ids = append(ids, r.ID)
+				}
+				assert.Equal(t, tt.expected, ids)
+			})
+		}
+
+		t.Run("Fails on invalid conditions", func(t *testing.T) {
+			_, err := s.List(ctx, Condition{Attribute: "i", Op: InOperator, Value: 1})
+			assert.ErrorIs(t, err, ErrInvalidCondition)
+			_, err = s.List(ctx, Condition{Attribute: "z", Op: EqualOperator, Value: 1})
+			assert.ErrorIs(t, err, ErrInvalidAttribute)
+		})
+	})
+
+	t.Run("Iter", func(t *testing.T) {
+		s := NewMemoryStore[content](table)
+		for i, id := range []string{"1", "2", "3"} {
+			_, err := s.Add(ctx, admin, id, content{I: i})
+			require.NoError(t, err)
+		}
+
+		ids := []string{}
+		for item, err := range s.Iter(ctx, Condition{Attribute: "i", Op: GreaterThanOperator, Value: 0}) {
+			require.NoError(t, err)
+			ids = append(ids, item.ID)
+		}
+		assert.Equal(t, []string{"2", "3"}, ids)
+
+		ids = []string{}
+		for item := range s.Iter(ctx) {
+			ids = append(ids, item.ID)
+			break
+		}
+		assert.Equal(t, []string{"1"}, ids)
+
+		canceled, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var last error
+		for _, err := range s.Iter(canceled) {
+			cancel()
+			last = err
+		}
+		assert.ErrorIs(t, last, context.Canceled)
+	})
+
+	t.Run("ListPage", func(t *testing.T) {
+		s := NewMemoryStore[content](table)
+		for i, v := range []int{30, 10, 20, 10, 0} {
+			_, err := s.Add(ctx, admin, fmt.Sprint(i+1), content{I: v})
+			require.NoError(t, err)
+		}
+
+		tests := []struct {
+			name     string
+			sort     Sort
+			expected []string
+		}{
+			{"by id", Sort{}, []string{"1", "2", "3", "4", "5"}},
+			{"by attribute", Sort{Attribute: "i"}, []string{"5", "2", "4", "3", "1"}},
+			{"by attribute descending", Sort{Attribute: "i", Descending: true}, []string{"1", "3", "4", "2", "5"}},
+			{"by column descending", Sort{Column: CreatedByColumn, Descending: true}, []string{"5", "4", "3", "2", "1"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				ids := []string{}
+				opts := ListOptions{Limit: 2, Sort: tt.sort}
+				for {
+					page, err := s.ListPage(ctx, opts)
+					require.NoError(t, err)
+					for _, item := range page.Items {
+						ids = append(ids, item.ID)
+					}
+					if page.NextCursor == "" {
+						break
+					}
+					opts.Cursor = page.NextCursor
+				}
+				assert.Equal(t, tt.expected, ids)
+			})
+		}
+
+		_, err := s.ListPage(ctx, ListOptions{Sort: Sort{Attribute: "i"}, Cursor: "bad"})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+		_, err = s.ListPage(ctx, ListOptions{Sort: Sort{Attribute: "z"}})
+		assert.ErrorIs(t, err, ErrInvalidAttribute)
+	})
+
+	t.Run("Project", func(t *testing.T) {
+		s := NewMemoryStore[content](table)
+		_, err := s.Add(ctx, admin, id, content{I: 5, B: true, S: "text", N: &nested{X: 1, Y: "y"}})
+		require.NoError(t, err)
+		fields := []string{"i", "n.x"}
+		expected := content{I: 5, N: &nested{X: 1}}
+
+		fetched, err := s.Get(ctx, id, Fields(fields...))
+		require.NoError(t, err)
+		assert.Equal(t, expected, fetched.Content)
+
+		page, err := s.ListPage(ctx, ListOptions{}, Fields(fields...))
+		require.NoError(t, err)
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, expected, page.Items[0].Content)
+
+		listed, err := s.List(ctx, Fields(fields...), Condition{Attribute: "s", Op: EqualOperator, Value: "text"})
+		require.NoError(t, err)
+		require.Len(t, listed, 1)
+		assert.Equal(t, expected, listed[0].Content)
+
+		fetched, err = s.Get(ctx, id, Fields(fields...), Condition{Attribute: "s", Op: EqualOperator, Value: "text"})
+		require.NoError(t, err)
+		assert.Equal(t, expected, fetched.Content)
+		_, err = s.Get(ctx, id, Condition{Attribute: "s", Op: EqualOperator, Value: "other"})
+		assert.ErrorIs(t, err, ErrNotFound, "items that don't fill the conditions are not found")
+
+		_, err = s.Get(ctx, id, Fields("z"))
+		assert.ErrorIs(t, err, ErrInvalidAttribute)
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		s := NewMemoryStore[content](table, WithSearch())
+		for id, s2 := range map[string]string{"1": "payroll", "2": "payments and payroll", "3": "invoices", "4": "Payroll archive"} {
+			_, err := s.Add(ctx, admin, id, content{I: len(id), S: s2})
+			require.NoError(t, err)
+		}
+		ids := func(items []Stored[content]) []string {
+			result := []string{}
+			for _, item := range items {
+				result = append(result, item.ID)
+			}
+			return result
+		}
+
+		found, err := s.Search(ctx, "pay", 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2", "1", "4"}, ids(found))
+
+		found, err = s.Search(ctx, "pay", 2)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2", "1"}, ids(found), "only the best matches up to the limit are returned")
+
+		found, err = s.Search(ctx, "PAYROLL arch", 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"4"}, ids(found))
+
+		found, err = s.Search(ctx, "' & |", 0)
+		require.NoError(t, err)
+		assert.Empty(t, found)
+
+		_, err = NewMemoryStore[content](table).Search(ctx, "pay", 0)
+		assert.ErrorIs(t, err, ErrSearchDisabled)
+	})
+
+	t.Run("Count and Aggregate", func(t *testing.T) {
+		s := NewMemoryStore[content](table)
+		for i, c := range []content{{I: 1, B: true}, {I: 2, B: false}, {I: 3, B: true}} {
+			_, err := s.Add(ctx, admin, fmt.Sprint(i), c)
+			require.NoError(t, err)
+		}
+
+		count, err := s.Count(ctx, Condition{Attribute: "b", Op: EqualOperator, Value: true})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+
+		groups, err := s.Aggregate(ctx, Aggregation{GroupBy: []GroupBy{{Attribute: "b"}}})
+		require.NoError(t, err)
+		assert.Equal(t, []Group{{Keys: []any{false}, Value: int64(1)}, {Keys: []any{true}, Value: int64(2)}}, groups)
+
+		groups, err = s.Aggregate(ctx, Aggregation{GroupBy: []GroupBy{{Attribute: "b"}}, Function: MaxFunction, Attribute: "i"})
+		require.NoError(t, err)
+		assert.Equal(t, []Group{{Keys: []any{false}, Value: float64(2)}, {Keys: []any{true}, Value: float64(3)}}, groups)
+
+		groups, err = s.Aggregate(ctx, Aggregation{GroupBy: []GroupBy{{Column: CreatedAtColumn, Bucket: YearBucket}}})
+		require.NoError(t, err)
+		require.Len(t, groups, 1)
+		now := time.Now().UTC()
+		assert.Equal(t, time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.UTC), groups[0].Keys[0])
+
+		_, err = s.Aggregate(ctx, Aggregation{GroupBy: []GroupBy{{Attribute: "b", Bucket: DayBucket}}})
+		assert.ErrorIs(t, err, ErrInvalidAggregation)
+	})
+
+	t.Run("History", func(t *testing.T) {
+		s := NewMemoryStore[content](table, WithSoftDelete(), WithHistory())
+		added, err := s.Add(ctx, admin, id, fixture)
+		require.NoError(t, err)
+		patched, err := s.Patch(ctx, updater, id, map[string]any{"i": 6})
+		require.NoError(t, err)
+		_, err = s.PatchVersion(ctx, updater, id, 1, map[string]any{"i": 7})
+		require.Error(t, err)
+		require.NoError(t, s.Delete(ctx, admin, id))
+		_, err = s.Restore(ctx, updater, id)
+		require.NoError(t, err)
+
+		revisions, err := s.History(ctx, id)
+		require.NoError(t, err)
+		require.Len(t, revisions, 4)
+		assert.Equal(t, AddOperation, revisions[0].Operation)
+		assert.Equal(t, map[string]any{"i": float64(5), "b": true, "s": "Some Text"}, revisions[0].Diff)
+		assert.Equal(t, PatchOperation, revisions[1].Operation)
+		assert.Equal(t, patched.Content, revisions[1].Content)
+		assert.Equal(t, map[string]any{"i": float64(6)}, revisions[1].Diff)
+		assert.Equal(t, updater, revisions[1].Actor)
+		assert.Equal(t, DeleteOperation, revisions[2].Operation)
+		assert.Equal(t, RestoreOperation, revisions[3].Operation)
+		assert.Equal(t, int64(4), revisions[3].Version)
+
+		atVersion, err := s.GetAt(ctx, id, AtVersion(1))
+		require.NoError(t, err)
+		assert.Equal(t, fixture, atVersion.Content)
+		_, err = s.GetAt(ctx, id, AtTime(added.CreatedAt.Add(-time.Second)))
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		_, err = NewMemoryStore[content](table).History(ctx, id)
+		assert.ErrorIs(t, err, ErrHistoryDisabled)
+	})
+
+	t.Run("Watch", func(t *testing.T) {
+		receive := func(t *testing.T, changes <-chan Change[content]) Change[content] {
+			select {
+			case c, ok := <-changes:
+				require.True(t, ok)
+				return c
+			case <-time.After(5 * time.Second):
+				require.FailNow(t, "no change was delivered")
+				return Change[content]{}
+			}
+		}
+
+		t.Run("Delivers the changes of matching items", func(t *testing.T) {
+			s := NewMemoryStore[content](table)
+			watchCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			changes, err := s.Watch(watchCtx, Condition{Attribute: "b", Op: EqualOperator, Value: true})
+			require.NoError(t, err)
+
+			_, err = s.Add(ctx, admin, "other", content{B: false})
+			require.NoError(t, err)
+			added, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			put, err := s.Put(ctx, admin, id, content{B: true, I: 6})
+			require.NoError(t, err)
+			require.NoError(t, s.Delete(ctx, admin, id))
+
+			c := receive(t, changes)
+			assert.Equal(t, AddOperation, c.Operation)
+			assert.Equal(t, added.Content, c.Item.Content)
+
+			c = receive(t, changes)
+			assert.Equal(t, PatchOperation, c.Operation)
+			assert.Equal(t, put.Version, c.Version)
+			assert.Equal(t, put.Content, c.Item.Content)
+
+			c = receive(t, changes)
+			assert.Equal(t, DeleteOperation, c.Operation)
+			assert.Nil(t, c.Item)
+
+			cancel()
+			_, ok := <-changes
+			assert.False(t, ok)
+		})
+
+		t.Run("Catches up the changes since a time", func(t *testing.T) {
+			s := NewMemoryStore[content](table, WithSoftDelete())
+			added, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			require.NoError(t, s.Delete(ctx, admin, id))
+
+			watchCtx, cancel := context.WithCancel(WatchSince(ctx, added.CreatedAt))
+			defer cancel()
+			changes, err := s.Watch(watchCtx)
+			require.NoError(t, err)
+
+			c := receive(t, changes)
+			assert.Equal(t, DeleteOperation, c.Operation)
+			assert.NotNil(t, c.Item.DeletedAt)
+		})
+
+		t.Run("Fails on invalid conditions", func(t *testing.T) {
+			_, err := NewMemoryStore[content](table).Watch(ctx, Condition{Attribute: "i", Op: "~"})
+			assert.ErrorIs(t, err, ErrInvalidCondition)
+		})
+	})
+
+	t.Run("Tenancy", func(t *testing.T) {
+		tenantA := ForTenant(ctx, "a")
+		tenantB := ForTenant(ctx, "b")
+		s := NewMemoryStore[content](table, WithTenancy(), WithHistory())
+
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		changes, err := s.Watch(ForTenant(watchCtx, "a"))
+		require.NoError(t, err)
+		all, err := s.Watch(AllTenants(watchCtx))
+		require.NoError(t, err)
+		_, err = s.Watch(watchCtx)
+		assert.ErrorIs(t, err, ErrTenantRequired)
+
+		_, err = s.Add(tenantB, admin, "other", fixture)
+		require.NoError(t, err)
+		_, err = s.Add(tenantA, admin, id, fixture)
+		require.NoError(t, err)
+		_, err = s.Add(tenantB, admin, id, fixture)
+		assert.ErrorIs(t, err, ErrAlreadyExists)
+		_, err = s.Upsert(tenantB, admin, id, fixture)
+		assert.ErrorIs(t, err, ErrAlreadyExists)
+		_, err = s.Add(ctx, admin, "third", fixture)
+		assert.ErrorIs(t, err, ErrTenantRequired)
+
+		_, err = s.Get(tenantB, id)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.Patch(tenantB, updater, id, map[string]any{"i": 6})
+		assert.ErrorIs(t, err, ErrNotFound)
+		listed, err := s.List(tenantA)
+		require.NoError(t, err)
+		require.Len(t, listed, 1)
+		assert.Equal(t, id, listed[0].ID)
+		revisions, err := s.History(tenantB, id)
+		require.NoError(t, err)
+		assert.Empty(t, revisions)
+
+		// A hard-deleted id can be used by another tenant
+		require.NoError(t, s.Delete(tenantA, admin, id))
+		_, err = s.Add(tenantB, admin, id, fixture)
+		require.NoError(t, err)
+
+		select {
+		case c := <-changes:
+			assert.Equal(t, AddOperation, c.Operation)
+			assert.Equal(t, id, c.ID)
+			assert.Equal(t, fixture, c.Item.Content)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no change was delivered")
+		}
+		select {
+		case c := <-all:
+			assert.Equal(t, "other", c.ID)
+			assert.Nil(t, c.Item)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no change was delivered")
+		}
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		s := NewMemoryStore[content](table, WithExpiry(), WithTenancy())
+		expired := ExpireAt(time.Now().Add(-time.Hour))
+		tenantA := ForTenant(ctx, "a")
+
+		_, err := s.Add(tenantA, admin, "expired", fixture, expired)
+		require.NoError(t, err)
+		_, err = s.Add(ForTenant(ctx, "b"), admin, "other", fixture, expired)
+		require.NoError(t, err)
+		_, err = s.Add(tenantA, admin, id, fixture, ExpireAt(time.Now().Add(time.Hour)))
+		require.NoError(t, err)
+
+		_, err = s.Get(tenantA, "expired")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.Patch(tenantA, updater, "expired", map[string]any{"i": 6})
+		assert.ErrorIs(t, err, ErrNotFound)
+		listed, err := s.List(tenantA)
+		require.NoError(t, err)
+		require.Len(t, listed, 1)
+		assert.NotNil(t, listed[0].ExpiresAt)
+
+		patched, err := s.Patch(tenantA, updater, id, map[string]any{"i": 6}, ExpireAt(time.Time{}))
+		require.NoError(t, err)
+		assert.Nil(t, patched.ExpiresAt)
+		added, err := s.Add(tenantA, admin, "expired", fixture)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), added.Version)
+		_, err = s.Patch(tenantA, updater, "expired", map[string]any{"i": 6}, expired)
+		require.NoError(t, err)
+
+		reaped, err := s.(Reapable).Reap(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, 1, reaped)
+		reaped, err = s.(Reapable).Reap(ctx, 10)
+		require.NoError(t, err)
+		assert.Equal(t, 1, reaped)
+
+		_, err = NewMemoryStore[content](table).Add(ctx, admin, id, fixture, expired)
+		assert.ErrorIs(t, err, ErrExpiryDisabled)
+		_, err = NewMemoryStore[content](table).(Reapable).Reap(ctx, 1)
+		assert.ErrorIs(t, err, ErrExpiryDisabled)
+	})
+
+	t.Run("Is safe for concurrent use", func(t *testing.T) {
+		s := NewMemoryStore[content](table)
+		_, err := s.Add(ctx, admin, id, fixture)
+		require.NoError(t, err)
+
+		wg := sync.WaitGroup{}
+		for i := range 20 {
+			wg.Go(func() {
+				_, err := s.Patch(ctx, updater, id, map[string]any{"s": fmt.Sprint(i)})
+				assert.NoError(t, err)
+				_, err = s.List(ctx, Condition{Attribute: "b", Op: EqualOperator, Value: true})
+				assert.NoError(t, err)
+			})
+		}
+		wg.Wait()
+
+		fetched, err := s.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, int64(21), fetched.Version)
+	})
+}
@@ -0,0 +1,193 @@
+package stored
+
+import (
+	"context"
+	"time"
+
+	internalDB "alielgamal.com/myservice/internal/db"
+)
+
+// Option configures optional behaviors of a store created by NewStore
+type Option func(*options)
+
+type options struct {
+	softDelete  bool
+	history     bool
+	outboxTable string
+	newListener func() internalDB.Listener
+	search      bool
+	tenancy     bool
+	expiry      bool
+
+	tagValidation bool
+	validators    []Validator
+}
+
+// WriteOption configures a single write of a store
+type WriteOption func(*writeOptions)
+
+type writeOptions struct {
+	// expiresAt the expiry that the write sets if setExpiry is true, which is nil for items that never expire
+	expiresAt *time.Time
+	setExpiry bool
+	// allowReadOnly whether patches may write the attributes of fields tagged `stored:"readonly"`
+	allowReadOnly bool
+	// eventType the type of the event that the write records in the outbox, which is <table>.<operation> if empty
+	eventType string
+}
+
+// WithSoftDelete makes Delete mark stored items as deleted instead of removing them. Soft-deleted items are hidden from
+// Get and List unless they are passed IncludeDeleted, and can be brought back using Restore.
+func WithSoftDelete() Option {
+	return func(o *options) {
+		o.softDelete = true
+	}
+}
+
+// WithHistory makes every write append a revision of the written item to a companion history table named
+// <table>_history, in the same transaction as the write. The history can be read using History and GetAt.
+func WithHistory() Option {
+	return func(o *options) {
+		o.history = true
+	}
+}
+
+// WithOutbox makes every write append an event with the written content to the passed outbox table, in the same
+// transaction as the write. Events are typed <table>.<operation> unless the write is passed PublishAs. The
+// attributes tagged stored:"secret" are left out of the content of events, and the events of multi-tenant stores
+// carry the tenant of the written item.
+func WithOutbox(table string) Option {
+	return func(o *options) {
+		o.outboxTable = table
+	}
+}
+
+// WithListener enables Watch. Every call to Watch listens to the notifications of the table using its own listener
+// created by newListener. The table must have the stored_notify trigger (see Stored).
+func WithListener(newListener func() internalDB.Listener) Option {
+	return func(o *options) {
+		o.newListener = newListener
+	}
+}
+
+// WithSearch enables Search. The table must have a search_vector column that is generated from the searchable
+// attributes using the simple text search configuration, and a GIN index on it (see Stored).
+func WithSearch() Option {
+	return func(o *options) {
+		o.search = true
+	}
+}
+
+// WithTenancy makes the store multi-tenant: every item belongs to the tenant that added it, and every operation is
+// scoped to the tenant of its context (see ForTenant), failing with ErrTenantRequired if there is none. Ids are unique
+// across tenants. The table and its history table must have a tenant column.
+func WithTenancy() Option {
+	return func(o *options) {
+		o.tenancy = true
+	}
+}
+
+// WithExpiry makes the store expire items at the time set by the writes that are passed ExpireAt. Expired items are
+// treated as missing by all operations but History and GetAt, and are deleted later by Reap (see Reaper). The table
+// must have an expires_at column.
+func WithExpiry() Option {
+	return func(o *options) {
+		o.expiry = true
+	}
+}
+
+// WithTagValidation makes every write validate the content using its validate and binding struct tags (see
+// github.com/go-playground/validator). Writes of invalid content fail with an *InvalidContentError.
+func WithTagValidation() Option {
+	return func(o *options) {
+		o.tagValidation = true
+	}
+}
+
+// WithValidator makes every write validate the content using the passed validator. Patches are validated after they
+// are merged into the stored content. Writes of content rejected by the validator fail with an *InvalidContentError.
+// The option can be passed multiple times to add multiple validators.
+func WithValidator(v Validator) Option {
+	return func(o *options) {
+		o.validators = append(o.validators, v)
+	}
+}
+
+// ReadOption configures a single read of a store. Conditions are read options that make the read only return the items
+// that fill them. Read options are plain values rather than functions, so they can be compared like conditions.
+type ReadOption interface {
+	applyRead(o *readOptions)
+}
+
+type readOptions struct {
+	conds []Condition
+	// fields the attributes that the content of the read items is projected to, which is the whole content if empty
+	fields         []string
+	includeDeleted bool
+}
+
+// newReadOptions collects the passed options of a read
+func newReadOptions(opts []ReadOption) readOptions {
+	o := readOptions{}
+	for _, opt := range opts {
+		opt.applyRead(&o)
+	}
+	return o
+}
+
+type whereOption []Condition
+
+func (w whereOption) applyRead(o *readOptions) {
+	o.conds = append(o.conds, w...)
+}
+
+// Where makes a read only return the items that fill all the passed conditions. It is the same as passing the
+// conditions one by one, for when they are already in a slice.
+func Where(conds ...Condition) ReadOption {
+	return whereOption(conds)
+}
+
+type fieldsOption []string
+
+func (f fieldsOption) applyRead(o *readOptions) {
+	o.fields = append(o.fields, f...)
+}
+
+// Fields makes a read project the content of the read items to the passed attributes, leaving the rest of the content
+// zero. Count and Aggregate ignore it.
+func Fields(fields ...string) ReadOption {
+	return fieldsOption(fields)
+}
+
+type includeDeletedOption struct{}
+
+func (includeDeletedOption) applyRead(o *readOptions) {
+	o.includeDeleted = true
+}
+
+// IncludeDeleted makes a read include soft-deleted items
+func IncludeDeleted() ReadOption {
+	return includeDeletedOption{}
+}
+
+type watchSinceKey struct{}
+
+// WatchSince returns a context that makes Watch start by delivering the changes since the passed time. Pass the At of
+// the last received change to resume watching without missing changes.
+func WatchSince(ctx context.Context, since time.Time) context.Context {
+	return context.WithValue(ctx, watchSinceKey{}, since)
+}
+
+func watchSince(ctx context.Context) (time.Time, bool) {
+	since, ok := ctx.Value(watchSinceKey{}).(time.Time)
+	return since, ok
+}
+
+// AllowReadOnly makes a patch write the attributes of fields tagged `stored:"readonly"`, which patches reject with
+// ErrReadOnlyAttribute otherwise. Only pass it to the writes of the service itself, never to writes requested by
+// clients.
+func AllowReadOnly() WriteOption {
+	return func(o *writeOptions) {
+		o.allowReadOnly = true
+	}
+}
@@ -0,0 +1,46 @@
+package stored
+
+import (
+	"context"
+	"fmt"
+
+	internalDB "alielgamal.com/myservice/internal/db"
+)
+
+const (
+	recordEventTemplateStmt = "INSERT INTO %v(type, source, subject, version, actor, payload, tenant, created_at) SELECT $2, $3, id, version+$4, $5, %v, %v, CURRENT_TIMESTAMP FROM %v WHERE id=$1%v"
+	eventTypeTemplate       = "%v.%v"
+)
+
+// PublishAs makes a write to a store with an outbox record its event using the passed type instead of the default
+// <table>.<operation> type. Use it to publish domain events like "app.api_key_reset".
+func PublishAs(eventType string) WriteOption {
+	return func(o *writeOptions) {
+		o.eventType = eventType
+	}
+}
+
+// recordEvent appends an event with the current content of a stored item, without its secret attributes, and the tenant
+// of the item to the outbox if the store has one. The
+// versionOffset is added to the current version of the stored item, which is needed to record an event before the
+// write that creates it.
+func (s sqlStore[T]) recordEvent(ctx context.Context, tx internalDB.Tx, op Operation, id string, actor string, versionOffset int64, w writeOptions) error {
+	if s.outboxStmt == "" {
+		return nil
+	}
+
+	eventType := w.eventType
+	if eventType == "" {
+		eventType = fmt.Sprintf(eventTypeTemplate, s.table, op)
+	}
+	_, err := tx.ExecContext(ctx, s.outboxStmt, id, eventType, s.table, versionOffset, actor)
+	return err
+}
+
+// afterWrite records the history and outbox entries of a write in the same transaction as the write
+func (s sqlStore[T]) afterWrite(ctx context.Context, tx internalDB.Tx, op Operation, id string, actor string, diff any, w writeOptions) error {
+	if err := s.recordRevision(ctx, tx, op, id, actor, diff, 0); err != nil {
+		return err
+	}
+	return s.recordEvent(ctx, tx, op, id, actor, 0, w)
+}
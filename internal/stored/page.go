@@ -0,0 +1,149 @@
+package stored
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultPageLimit the number of items returned by ListPage when no limit is specified
+	DefaultPageLimit = 100
+
+	// MaxPageLimit the maximum number of items that ListPage can return in a single page
+	MaxPageLimit = 1000
+)
+
+// Sort defines the order of the items returned by ListPage. Either a Column or a content Attribute should be set; if
+// none is set, items are sorted by their id. Items with the same value are always ordered by their id.
+type Sort struct {
+	Column     Column
+	Attribute  string
+	Descending bool
+}
+
+// ListOptions controls the page of items returned by ListPage
+type ListOptions struct {
+	// Limit the maximum number of items in the page. Defaults to DefaultPageLimit and can't exceed MaxPageLimit
+	Limit int
+
+	// Sort the order of the items
+	Sort Sort
+
+	// Cursor the NextCursor of the previous page. Empty to get the first page.
+	Cursor string
+}
+
+// Page a page of stored items returned by ListPage
+type Page[T any] struct {
+	// Items the stored items in the page
+	Items []Stored[T] `json:"items"`
+
+	// NextCursor an opaque token to pass in ListOptions to get the next page. Empty if this is the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// cursor the decoded content of a ListOptions Cursor
+type cursor struct {
+	// Sort identifies the sort the cursor was created for
+	Sort string `json:"s"`
+
+	// Value the sort value of the last item in the previous page
+	Value json.RawMessage `json:"v"`
+
+	// ID the id of the last item in the previous page
+	ID string `json:"i"`
+}
+
+func (o ListOptions) limit() int {
+	if o.Limit <= 0 {
+		return DefaultPageLimit
+	}
+	return min(o.Limit, MaxPageLimit)
+}
+
+func (s Sort) validate() error {
+	if s.Attribute != "" && s.Column != "" {
+		return fmt.Errorf("%w: either a column or an attribute can be sorted by", ErrInvalidSort)
+	}
+	if s.Column != "" && !s.Column.valid() {
+		return fmt.Errorf("%w: unknown column '%v'", ErrInvalidSort, s.Column)
+	}
+	return nil
+}
+
+// columnExpression returns the SQL expression that items are sorted by if the sort is not by an attribute
+func (s Sort) columnExpression() string {
+	if s.Column == "" {
+		return string(IDColumn)
+	}
+	return string(s.Column)
+}
+
+// key uniquely identifies the sort so that cursors can't be used with a different sort
+func (s Sort) key() string {
+	return fmt.Sprintf("%v:%v:%v", s.Column, s.Attribute, s.Descending)
+}
+
+// columnValue returns the value of the sort column in a stored item
+func columnValue[T any](c Column, item Stored[T]) any {
+	switch c {
+	case CreatedAtColumn:
+		return item.CreatedAt
+	case CreatedByColumn:
+		return item.CreatedBy
+	case ModifiedAtColumn:
+		return item.ModifiedAt
+	case ModifiedByColumn:
+		return item.ModifiedBy
+	default:
+		return item.ID
+	}
+}
+
+// encodeCursor creates a cursor that points after the passed item with the sort value
+func encodeCursor(s Sort, id string, value any) (string, error) {
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	cursorJSON, err := json.Marshal(cursor{Sort: s.key(), Value: valueJSON, ID: id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cursorJSON), nil
+}
+
+// decodeCursor decodes a cursor and returns the sort value as a query parameter
+func decodeCursor(s Sort, encoded string) (id string, value any, err error) {
+	cursorJSON, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	c := cursor{}
+	if err := json.Unmarshal(cursorJSON, &c); err != nil {
+		return "", nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	if c.Sort != s.key() {
+		return "", nil, fmt.Errorf("%w: the cursor was created for a different sort", ErrInvalidCursor)
+	}
+
+	switch {
+	case s.Attribute != "":
+		// Attributes are compared as JSON values that the dialect of the store converts
+		value = []byte(c.Value)
+	case s.Column.isTime():
+		t := time.Time{}
+		err = json.Unmarshal(c.Value, &t)
+		value = t
+	default:
+		str := ""
+		err = json.Unmarshal(c.Value, &str)
+		value = str
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	return c.ID, value, nil
+}
@@ -0,0 +1,85 @@
+package stored
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// contentColumn the column that contains the JSON content of stored items
+const contentColumn = "content"
+
+// notNullFilter a JSON path filter that only matches non-null values
+const notNullFilter = " ? (@ != null)"
+
+// attributePath the keys leading to a value inside the content of a stored item
+type attributePath []string
+
+// parsePath parses an attribute into a path inside the content. Attributes can either be dotted paths (a.b.c) or JSON
+// pointers (/a/b/c) which allow keys that contain dots. A plain attribute name (a) refers to a top-level value.
+func parsePath(attribute string) (attributePath, error) {
+	var keys []string
+	if strings.HasPrefix(attribute, "/") {
+		keys = strings.Split(attribute[1:], "/")
+		for i, k := range keys {
+			// JSON pointer escaping as per RFC 6901
+			keys[i] = strings.ReplaceAll(strings.ReplaceAll(k, "~1", "/"), "~0", "~")
+		}
+	} else {
+		keys = strings.Split(attribute, ".")
+	}
+
+	for _, k := range keys {
+		if k == "" {
+			return nil, fmt.Errorf("%w: '%v' contains an empty key", ErrInvalidAttribute, attribute)
+		}
+	}
+	return keys, nil
+}
+
+// ParseAttribute returns the keys of the path of an attribute inside the content, which is either a dotted path (a.b.c)
+// or a JSON pointer (/a/b/c) like the attributes of conditions, sorts and patches
+func ParseAttribute(attribute string) ([]string, error) {
+	return parsePath(attribute)
+}
+
+// sql returns the SQL expression that subscripts the content column to the value of the path
+func (p attributePath) sql() string {
+	b := strings.Builder{}
+	b.WriteString(contentColumn)
+	for _, k := range p {
+		b.WriteString("[")
+		b.WriteString(quoteLiteral(k))
+		b.WriteString("]")
+	}
+	return b.String()
+}
+
+// jsonPath returns a strict SQL/JSON path expression to the value of the path followed by the passed filter
+func (p attributePath) jsonPath(filter string) string {
+	b := strings.Builder{}
+	b.WriteString("strict $")
+	for _, k := range p {
+		// JSON path string literals follow the JSON escaping rules
+		key, _ := json.Marshal(k)
+		b.WriteString(".")
+		b.Write(key)
+	}
+	b.WriteString(filter)
+	return b.String()
+}
+
+// containing returns a JSON document that has the value nested at the path. The content contains this document if the
+// value at the path contains the value.
+func (p attributePath) containing(value any) ([]byte, error) {
+	doc := value
+	for i := len(p) - 1; i >= 0; i-- {
+		doc = map[string]any{p[i]: doc}
+	}
+	return json.Marshal(doc)
+}
+
+// quoteLiteral quotes a string to be used as a SQL string literal
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,61 @@
+package stored
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		name        string
+		attribute   string
+		expectedSQL string
+	}{
+		{"top-level attribute", "a", "content['a']"},
+		{"dotted path", "a.b.c", "content['a']['b']['c']"},
+		{"JSON pointer", "/a/b", "content['a']['b']"},
+		{"JSON pointer with dots", "/a.b/c", "content['a.b']['c']"},
+		{"JSON pointer with escaped characters", "/a~1b/c~0d", "content['a/b']['c~d']"},
+		{"quotes", "it's", "content['it''s']"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := parsePath(tt.attribute)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedSQL, path.sql())
+		})
+	}
+
+	t.Run("Fails when", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			attribute string
+		}{
+			{"empty attribute", ""},
+			{"empty dotted key", "a..b"},
+			{"trailing dot", "a."},
+			{"empty JSON pointer", "/"},
+			{"empty JSON pointer key", "/a//b"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := parsePath(tt.attribute)
+				assert.ErrorIs(t, err, ErrInvalidAttribute)
+			})
+		}
+	})
+}
+
+func TestAttributePathJSON(t *testing.T) {
+	path, err := parsePath(`a.b"c`)
+	require.NoError(t, err)
+
+	assert.Equal(t, `strict $."a"."b\"c"`, path.jsonPath(""))
+	assert.Equal(t, `strict $."a"."b\"c" ? (@ != null)`, path.jsonPath(notNullFilter))
+
+	doc, err := path.containing([]string{"x"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a": {"b\"c": ["x"]}}`, string(doc))
+}
@@ -0,0 +1,92 @@
+package stored
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// projectionNode the attributes projected below an attribute. A nil node projects the whole value of the attribute.
+type projectionNode map[string]projectionNode
+
+// readColumns returns the columns that reads select, with the content projected to the fields if any are passed (see
+// Get and ListOptions)
+func (s sqlStore[T]) readColumns(fields []string) (string, error) {
+	root, err := s.schema.projection(fields)
+	if err != nil || root == nil {
+		return s.columns, err
+	}
+	return fmt.Sprintf("%v AS %v%v", root.sql(s.dialect, nil), contentColumn, strings.TrimPrefix(s.columns, contentColumn)), nil
+}
+
+// projection returns the root node of the projected fields, or nil if no fields are passed
+func (s schema) projection(fields []string) (projectionNode, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	root := projectionNode{}
+	for _, a := range fields {
+		path, err := s.path(a)
+		if err != nil {
+			return nil, err
+		}
+		root.add(path)
+	}
+	return root, nil
+}
+
+// add projects the path below the node
+func (n projectionNode) add(path attributePath) {
+	for i, key := range path {
+		child, ok := n[key]
+		if i == len(path)-1 {
+			n[key] = nil
+			return
+		}
+		if ok && child == nil {
+			// The whole value is already projected
+			return
+		}
+		if !ok {
+			child = projectionNode{}
+			n[key] = child
+		}
+		n = child
+	}
+}
+
+// sql returns the SQL expression that builds a JSON object of the attributes projected below the node, where the node
+// is at the passed path inside the content
+func (n projectionNode) sql(d dialect, path attributePath) string {
+	keys := make([]string, 0, len(n))
+	for k := range n {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	args := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		childPath := append(slices.Clone(path), k)
+		value := d.value(childPath)
+		if n[k] != nil {
+			value = n[k].sql(d, childPath)
+		}
+		args = append(args, quoteLiteral(k), value)
+	}
+	return d.object(args)
+}
+
+// project returns the attributes projected below the node from a decoded JSON value. Missing attributes are null, like
+// in the SQL expression of the node.
+func (n projectionNode) project(value any) map[string]any {
+	object, _ := value.(map[string]any)
+	result := make(map[string]any, len(n))
+	for k, child := range n {
+		result[k] = object[k]
+		if child != nil {
+			result[k] = child.project(object[k])
+		}
+	}
+	return result
+}
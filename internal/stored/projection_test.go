@@ -0,0 +1,43 @@
+package stored
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadColumns(t *testing.T) {
+	type nested struct {
+		X int    `json:"x"`
+		Y string `json:"y"`
+	}
+	type content struct {
+		I int     `json:"i"`
+		N *nested `json:"n"`
+	}
+	s := NewStore[content](nil, "stored").(sqlStore[content])
+
+	tests := []struct {
+		name       string
+		attributes []string
+		expected   string
+	}{
+		{"no projection", nil, storedColumns},
+		{"top-level attributes", []string{"n", "i"}, "jsonb_build_object('i', content['i'], 'n', content['n']) AS content, created_by, created_at, modified_by, modified_at, version"},
+		{"nested attributes", []string{"n.x", "/n/y"}, "jsonb_build_object('n', jsonb_build_object('x', content['n']['x'], 'y', content['n']['y'])) AS content, created_by, created_at, modified_by, modified_at, version"},
+		{"nested attribute of a projected attribute", []string{"n", "n.x"}, "jsonb_build_object('n', content['n']) AS content, created_by, created_at, modified_by, modified_at, version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns, err := s.readColumns(tt.attributes)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, columns)
+		})
+	}
+
+	t.Run("Fails on unknown attributes", func(t *testing.T) {
+		_, err := s.readColumns([]string{"i", "z'], content['secret"})
+		assert.ErrorIs(t, err, ErrInvalidAttribute)
+	})
+}
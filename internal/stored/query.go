@@ -0,0 +1,100 @@
+package stored
+
+import (
+	"fmt"
+	"strings"
+)
+
+// queryBuilder accumulates the conditions and the positional parameters of a query. Attributes of conditions are only
+// rendered by the dialect if they are legal attributes of the schema.
+type queryBuilder struct {
+	schema     schema
+	dialect    dialect
+	conditions []string
+	params     []any
+}
+
+// param adds a positional parameter to the query and returns its placeholder
+func (q *queryBuilder) param(value any) string {
+	q.params = append(q.params, value)
+	return fmt.Sprintf("$%v", len(q.params))
+}
+
+// where adds a condition to the query. All conditions are ANDed together
+func (q *queryBuilder) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// addConditions adds the conditions on the content attributes to the query
+func (q *queryBuilder) addConditions(conds []Condition) error {
+	for _, c := range conds {
+		stmt, err := q.condition(c)
+		if err != nil {
+			return err
+		}
+		q.where(stmt)
+	}
+	return nil
+}
+
+// condition returns the SQL of a single condition
+func (q *queryBuilder) condition(c Condition) (string, error) {
+	if err := c.validate(); err != nil {
+		return "", err
+	}
+
+	switch c.Op {
+	case AndOperator, OrOperator:
+		stmts := []string{}
+		for _, child := range c.Value.([]Condition) {
+			stmt, err := q.condition(child)
+			if err != nil {
+				return "", err
+			}
+			stmts = append(stmts, stmt)
+		}
+		return fmt.Sprintf("(%v)", strings.Join(stmts, fmt.Sprintf(" %v ", c.Op))), nil
+	case NotOperator:
+		stmt, err := q.condition(c.Value.(Condition))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("NOT (%v)", stmt), nil
+	}
+
+	if c.Column != "" {
+		return q.columnCondition(c), nil
+	}
+
+	path, err := q.schema.path(c.Attribute)
+	if err != nil {
+		return "", err
+	}
+
+	return q.dialect.condition(q, path, c)
+}
+
+// columnCondition returns the SQL of a condition on a column. Column values are compared as is, without JSON encoding.
+func (q *queryBuilder) columnCondition(c Condition) string {
+	switch c.Op {
+	case InOperator, NotInOperator:
+		placeholders := []string{}
+		for _, v := range sliceValues(c.Value) {
+			placeholders = append(placeholders, q.param(v))
+		}
+		return fmt.Sprintf("%v %v (%v)", c.Column, c.Op, strings.Join(placeholders, ", "))
+	case BetweenOperator:
+		bounds := sliceValues(c.Value)
+		return fmt.Sprintf("%v BETWEEN %v AND %v", c.Column, q.param(bounds[0]), q.param(bounds[1]))
+	default:
+		return fmt.Sprintf(conditionTemplate, c.Column, c.Op, q.param(c.Value))
+	}
+}
+
+// whereClause returns the WHERE clause of the query or an empty string if the query has no conditions
+func (q *queryBuilder) whereClause() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("WHERE %v", strings.Join(q.conditions, " AND "))
+}
@@ -0,0 +1,96 @@
+package stored
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// DefaultReapBatchSize the maximum number of expired items deleted from a table by a single ReapRegistered
+const DefaultReapBatchSize = 100
+
+// Reaper deletes the expired items of the stores of a Registry (see WithExpiry) in batches. Multiple reapers
+// can run against the same DB since each expired item is only locked by a single reaper at a time.
+type Reaper struct {
+	logger    logr.Logger
+	registry  *Registry
+	interval  time.Duration
+	batchSize int
+
+	reapedCounter metric.Int64Counter
+	failedCounter metric.Int64Counter
+}
+
+// NewReaper creates a Reaper that reaps every interval up to batchSize expired items of every store of the registry. A
+// batchSize that is not positive uses DefaultReapBatchSize.
+func NewReaper(logger logr.Logger, registry *Registry, interval time.Duration, batchSize int) *Reaper {
+	if batchSize <= 0 {
+		batchSize = DefaultReapBatchSize
+	}
+	reapedCounter, _ := meter.Int64Counter("store.reaped_count", metric.WithDescription("Number of expired items deleted"), metric.WithUnit("Count"))
+	failedCounter, _ := meter.Int64Counter("store.reap_failed_count", metric.WithDescription("Number of failed reaps of expired items"), metric.WithUnit("Count"))
+
+	return &Reaper{
+		logger:        logger.WithName("store.reaper"),
+		registry:      registry,
+		interval:      interval,
+		batchSize:     batchSize,
+		reapedCounter: reapedCounter,
+		failedCounter: failedCounter,
+	}
+}
+
+// Run reaps the expired items of the stores of the registry until ctx is done
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		more, err := r.ReapRegistered(ctx)
+		if err != nil {
+			r.logger.Error(err, "failed to reap expired items")
+		}
+		if more && ctx.Err() == nil {
+			// There may be more expired items
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReapRegistered deletes a single batch of expired items from every store of the registry that expires items, and
+// reports whether any store deleted a full batch. The errors of all the failed stores are joined.
+func (r *Reaper) ReapRegistered(ctx context.Context) (bool, error) {
+	tables, stores := registeredStores[Reapable](r.registry)
+
+	more := false
+	errs := []error{}
+	for i, s := range stores {
+		attributes := metric.WithAttributes(attribute.String("table", tables[i]))
+		reaped, err := s.Reap(ctx, r.batchSize)
+		if errors.Is(err, ErrExpiryDisabled) {
+			continue
+		}
+		if err != nil {
+			r.failedCounter.Add(ctx, 1, attributes)
+			errs = append(errs, fmt.Errorf("table %v: %w", tables[i], err))
+			continue
+		}
+		if reaped > 0 {
+			r.logger.V(1).Info("Reaped expired items", "table", tables[i], "count", reaped)
+			r.reapedCounter.Add(ctx, int64(reaped), attributes)
+		}
+		more = more || reaped == r.batchSize
+	}
+	return more, errors.Join(errs...)
+}
@@ -0,0 +1,105 @@
+package stored
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingReapStore fails every Reap with err
+type failingReapStore[T any] struct {
+	Store[T]
+	err error
+}
+
+func (s failingReapStore[T]) Reap(context.Context, int) (int, error) {
+	return 0, s.err
+}
+
+func TestReaper(t *testing.T) {
+	type content struct {
+		I int `json:"i"`
+	}
+	admin := "admin@example.com"
+	ctx := context.Background()
+	expired := ExpireAt(time.Now().Add(-time.Hour))
+
+	remaining := func(s Store[content]) int {
+		m := s.(*memoryStore[content])
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return len(m.items)
+	}
+	addExpired := func(t *testing.T, s Store[content], count int) {
+		for i := range count {
+			_, err := s.Add(ctx, admin, fmt.Sprint("id", i), content{I: i}, expired)
+			require.NoError(t, err)
+		}
+	}
+
+	t.Run("Reaps the registered stores in batches", func(t *testing.T) {
+		registry := NewRegistry()
+		a := NewMemoryStore[content]("reaper_a", WithExpiry())
+		b := NewMemoryStore[content]("reaper_b", WithExpiry())
+		Register(registry, "reaper_a", a)
+		Register(registry, "reaper_b", b)
+		Register(registry, "reaper_c", NewMemoryStore[content]("reaper_c"))
+		addExpired(t, a, 3)
+		addExpired(t, b, 1)
+		_, err := b.Add(ctx, admin, "kept", content{})
+		require.NoError(t, err)
+
+		r := NewReaper(logr.Discard(), registry, time.Hour, 2)
+		more, err := r.ReapRegistered(ctx)
+		require.NoError(t, err)
+		assert.True(t, more)
+		assert.Equal(t, 1, remaining(a))
+		assert.Equal(t, 1, remaining(b))
+
+		more, err = r.ReapRegistered(ctx)
+		require.NoError(t, err)
+		assert.False(t, more)
+		assert.Equal(t, 0, remaining(a))
+		assert.Equal(t, 1, remaining(b))
+	})
+
+	t.Run("Keeps reaping the other stores when a store fails", func(t *testing.T) {
+		registry := NewRegistry()
+		a := NewMemoryStore[content]("reaper_a", WithExpiry())
+		Register(registry, "reaper_a", a)
+		Register(registry, "reaper_b", failingReapStore[content]{Store: NewMemoryStore[content]("reaper_b"), err: errors.New("boom")})
+		addExpired(t, a, 1)
+
+		_, err := NewReaper(logr.Discard(), registry, time.Hour, 0).ReapRegistered(ctx)
+		assert.ErrorContains(t, err, "reaper_b")
+		assert.Equal(t, 0, remaining(a))
+	})
+
+	t.Run("Runs until the context is done", func(t *testing.T) {
+		registry := NewRegistry()
+		a := NewMemoryStore[content]("reaper_a", WithExpiry())
+		Register(registry, "reaper_a", a)
+		addExpired(t, a, 5)
+
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			NewReaper(logr.Discard(), registry, 10*time.Millisecond, 2).Run(runCtx)
+			close(done)
+		}()
+		assert.Eventually(t, func() bool { return remaining(a) == 0 }, time.Second, 10*time.Millisecond)
+
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "the reaper didn't stop")
+		}
+	})
+}
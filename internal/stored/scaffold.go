@@ -0,0 +1,236 @@
+package stored
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// identifierPattern the names that scaffolded tables and searchable attributes can have, which never need quoting
+var identifierPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// attributePattern the top-level attributes that scaffolded tables can search
+var attributePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// maxTableLength the longest table name whose history table and constraints fit in a Postgres identifier
+const maxTableLength = 40
+
+// sqliteSearchSeparators the characters that separate the words of the search column of SQLite tables, like in the
+// 'simple' text search configuration of Postgres
+var sqliteSearchSeparators = []string{"char(9)", "char(10)", "char(13)", "'.'", "','", "';'", "':'", "'!'", "'?'", "'-'", "'_'", "'('", "')'", "'/'"}
+
+// TableSchema the optional parts of the schema of a stored table, which must match the options of its store
+type TableSchema struct {
+	// SoftDelete adds the columns of stores in soft-delete mode (see WithSoftDelete)
+	SoftDelete bool
+
+	// History adds the history table (see WithHistory)
+	History bool
+
+	// Watch adds the trigger that notifies the listeners of the table (see WithListener)
+	Watch bool
+
+	// Tenancy adds the tenant column and the row-level security policies of multi-tenant stores (see WithTenancy)
+	Tenancy bool
+
+	// Expiry adds the expiry column, and the reap policy of multi-tenant tables (see WithExpiry)
+	Expiry bool
+
+	// SearchAttributes the top-level attributes of the content that are searchable. If set, the search column of
+	// searchable stores is added (see WithSearch).
+	SearchAttributes []string
+}
+
+// Migration the statements that migrate a DB to a version and back
+type Migration struct {
+	Up   string
+	Down string
+}
+
+// Scaffold returns the Postgres and SQLite migrations that create a stored table with the schema (see Stored)
+func Scaffold(table string, s TableSchema) (postgres Migration, sqlite Migration, err error) {
+	if !identifierPattern.MatchString(table) || len(table) > maxTableLength {
+		return Migration{}, Migration{}, fmt.Errorf("invalid table name '%v': it must start with a lower-case letter, only have lower-case letters, digits and underscores and be at most %v characters long", table, maxTableLength)
+	}
+	for _, a := range s.SearchAttributes {
+		if !attributePattern.MatchString(a) {
+			return Migration{}, Migration{}, fmt.Errorf("%w: '%v' is not a top-level attribute", ErrInvalidAttribute, a)
+		}
+	}
+
+	down := fmt.Sprintf("DROP TABLE IF EXISTS %v;\n", table)
+	if s.History {
+		down = fmt.Sprintf("DROP TABLE IF EXISTS %v%v;\n", table, historyTableSuffix) + down
+	}
+	return Migration{Up: s.postgres(table), Down: down}, Migration{Up: s.sqlite(table), Down: down}, nil
+}
+
+// postgres returns the statements that create the table in Postgres, like the migrations of the app table
+func (s TableSchema) postgres(table string) string {
+	columns := []string{
+		"id VARCHAR(36) NOT NULL PRIMARY KEY CHECK(length(id) > 0)",
+		"content JSONB NOT NULL",
+		"created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP",
+		"modified_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP",
+		"created_by VARCHAR(50) NOT NULL CHECK(length(created_by) > 0)",
+		"modified_by VARCHAR(50) NOT NULL CHECK(length(modified_by) > 0)",
+		"version BIGINT NOT NULL DEFAULT 1",
+	}
+	if s.SoftDelete {
+		columns = append(columns, "deleted_at TIMESTAMP NULL", "deleted_by VARCHAR(50) NULL CHECK(length(deleted_by) > 0)")
+	}
+	if s.Tenancy {
+		columns = append(columns, "tenant VARCHAR(50) NOT NULL CHECK(length(tenant) > 0)")
+	}
+	if s.Expiry {
+		columns = append(columns, expiresAtColumn+" TIMESTAMP NULL")
+	}
+	if len(s.SearchAttributes) > 0 {
+		texts := make([]string, 0, len(s.SearchAttributes))
+		for _, a := range s.SearchAttributes {
+			texts = append(texts, fmt.Sprintf("coalesce(content->>'%v', ' ')", a))
+		}
+		columns = append(columns, fmt.Sprintf("%v tsvector GENERATED ALWAYS AS (to_tsvector('%v', %v)) STORED", searchColumn, searchConfig, strings.Join(texts, " || ' ' || ")))
+	}
+
+	b := &strings.Builder{}
+	writeCreateTable(b, table, columns)
+	fmt.Fprintf(b, "\nCREATE INDEX %v_content_idx ON %v USING GIN(content jsonb_path_ops);\n", table, table)
+	if s.Tenancy {
+		fmt.Fprintf(b, "CREATE INDEX %v_tenant_idx ON %v(tenant);\n", table, table)
+	}
+	if s.Expiry {
+		writeExpiryIndex(b, table)
+	}
+	if len(s.SearchAttributes) > 0 {
+		fmt.Fprintf(b, "CREATE INDEX %v_search_idx ON %v USING GIN(%v);\n", table, table, searchColumn)
+	}
+
+	// The functions of the triggers are created by the migrations of the app table
+	writeTrigger(b, table+"_update_modified_at", "BEFORE UPDATE", table, "update_modified_at")
+	if s.Watch {
+		writeTrigger(b, table+"_notify", "AFTER INSERT OR UPDATE OR DELETE", table, "stored_notify")
+	}
+
+	if s.History {
+		historyTable := table + historyTableSuffix
+		columns := []string{
+			"revision BIGSERIAL PRIMARY KEY",
+			"id VARCHAR(36) NOT NULL",
+			"version BIGINT NOT NULL",
+			"operation VARCHAR(10) NOT NULL",
+			"content JSONB NOT NULL",
+			"diff JSONB NOT NULL",
+			"actor VARCHAR(50) NOT NULL CHECK(length(actor) > 0)",
+			"at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP",
+		}
+		if s.Tenancy {
+			columns = append(columns, "tenant VARCHAR(50) NOT NULL CHECK(length(tenant) > 0)")
+		}
+		b.WriteString("\n")
+		writeCreateTable(b, historyTable, columns)
+		fmt.Fprintf(b, "\nCREATE INDEX %v_id_idx ON %v(id, revision);\n", historyTable, historyTable)
+	}
+
+	if s.Tenancy {
+		tables := []string{table}
+		if s.History {
+			tables = append(tables, table+historyTableSuffix)
+		}
+		for _, t := range tables {
+			fmt.Fprintf(b, "\nALTER TABLE %v ENABLE ROW LEVEL SECURITY;\n", t)
+			fmt.Fprintf(b, "ALTER TABLE %v FORCE ROW LEVEL SECURITY;\n", t)
+			fmt.Fprintf(b, "CREATE POLICY %v_tenant ON %v\n", t, t)
+			fmt.Fprintf(b, "    USING (tenant = current_setting('%v', true))\n", tenantSetting)
+			fmt.Fprintf(b, "    WITH CHECK (tenant = current_setting('%v', true));\n", tenantSetting)
+		}
+		if s.Expiry {
+			fmt.Fprintf(b, "CREATE POLICY %v_reap ON %v\n", table, table)
+			fmt.Fprintf(b, "    USING (current_setting('%v', true) = 'on' AND %v);\n", reapSetting, expiredCondition)
+		}
+	}
+	return b.String()
+}
+
+// sqlite returns the statements that create the table in SQLite, like the SQLite migrations of the app table. SQLite
+// has neither notifications nor row-level security, so the table can't be watched and multi-tenant stores scope their
+// statements themselves.
+func (s TableSchema) sqlite(table string) string {
+	now := "(strftime('%Y-%m-%d %H:%M:%f', 'now'))"
+	columns := []string{
+		fmt.Sprintf("id VARCHAR(36) NOT NULL PRIMARY KEY CONSTRAINT %v_id_check CHECK(length(id) > 0)", table),
+		fmt.Sprintf("content TEXT NOT NULL CONSTRAINT %v_content_check CHECK(json_valid(content))", table),
+		"created_at TIMESTAMP NOT NULL DEFAULT " + now,
+		"modified_at TIMESTAMP NOT NULL DEFAULT " + now,
+		fmt.Sprintf("created_by VARCHAR(50) NOT NULL CONSTRAINT %v_created_by_check CHECK(length(created_by) > 0)", table),
+		fmt.Sprintf("modified_by VARCHAR(50) NOT NULL CONSTRAINT %v_modified_by_check CHECK(length(modified_by) > 0)", table),
+		"version BIGINT NOT NULL DEFAULT 1",
+	}
+	if s.SoftDelete {
+		columns = append(columns, "deleted_at TIMESTAMP NULL", fmt.Sprintf("deleted_by VARCHAR(50) NULL CONSTRAINT %v_deleted_by_check CHECK(length(deleted_by) > 0)", table))
+	}
+	if s.Tenancy {
+		columns = append(columns, fmt.Sprintf("tenant VARCHAR(50) NOT NULL CONSTRAINT %v_tenant_check CHECK(length(tenant) > 0)", table))
+	}
+	if s.Expiry {
+		columns = append(columns, expiresAtColumn+" TIMESTAMP NULL")
+	}
+	if len(s.SearchAttributes) > 0 {
+		texts := make([]string, 0, len(s.SearchAttributes))
+		for _, a := range s.SearchAttributes {
+			texts = append(texts, fmt.Sprintf("coalesce(content->>'%v', '')", a))
+		}
+		// The searchable text is lower-cased with a space before every word (see sqlite.search)
+		text := strings.Join(texts, " || ' ' || ")
+		for _, sep := range sqliteSearchSeparators {
+			text = fmt.Sprintf("replace(%v, %v, ' ')", text, sep)
+		}
+		columns = append(columns, fmt.Sprintf("%v TEXT GENERATED ALWAYS AS (' ' || lower(%v)) VIRTUAL", searchColumn, text))
+	}
+
+	b := &strings.Builder{}
+	writeCreateTable(b, table, columns)
+	if s.Tenancy {
+		fmt.Fprintf(b, "\nCREATE INDEX %v_tenant_idx ON %v(tenant);\n", table, table)
+	}
+	if s.Expiry {
+		if !s.Tenancy {
+			b.WriteString("\n")
+		}
+		writeExpiryIndex(b, table)
+	}
+
+	if s.History {
+		historyTable := table + historyTableSuffix
+		columns := []string{
+			"revision INTEGER PRIMARY KEY AUTOINCREMENT",
+			"id VARCHAR(36) NOT NULL",
+			"version BIGINT NOT NULL",
+			"operation VARCHAR(10) NOT NULL",
+			fmt.Sprintf("content TEXT NOT NULL CONSTRAINT %v_content_check CHECK(json_valid(content))", historyTable),
+			fmt.Sprintf("diff TEXT NOT NULL CONSTRAINT %v_diff_check CHECK(json_valid(diff))", historyTable),
+			fmt.Sprintf("actor VARCHAR(50) NOT NULL CONSTRAINT %v_actor_check CHECK(length(actor) > 0)", historyTable),
+			"at TIMESTAMP NOT NULL DEFAULT " + now,
+		}
+		if s.Tenancy {
+			columns = append(columns, fmt.Sprintf("tenant VARCHAR(50) NOT NULL CONSTRAINT %v_tenant_check CHECK(length(tenant) > 0)", historyTable))
+		}
+		b.WriteString("\n")
+		writeCreateTable(b, historyTable, columns)
+		fmt.Fprintf(b, "\nCREATE INDEX %v_id_idx ON %v(id, revision);\n", historyTable, historyTable)
+	}
+	return b.String()
+}
+
+func writeCreateTable(b *strings.Builder, table string, columns []string) {
+	fmt.Fprintf(b, "CREATE TABLE %v (\n    %v\n);\n", table, strings.Join(columns, ",\n    "))
+}
+
+// writeExpiryIndex writes the partial index of the items that expire, which are the only items that Reap reads
+func writeExpiryIndex(b *strings.Builder, table string) {
+	fmt.Fprintf(b, "CREATE INDEX %v_%v_idx ON %v(%v) WHERE %v IS NOT NULL;\n", table, expiresAtColumn, table, expiresAtColumn, expiresAtColumn)
+}
+
+func writeTrigger(b *strings.Builder, name string, when string, table string, function string) {
+	fmt.Fprintf(b, "\nCREATE TRIGGER %v\n    %v ON %v\n    FOR EACH ROW\n    EXECUTE PROCEDURE %v();\n", name, when, table, function)
+}
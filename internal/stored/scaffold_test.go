@@ -0,0 +1,142 @@
+package stored
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"alielgamal.com/myservice/internal/config"
+	internalDB "alielgamal.com/myservice/internal/db"
+	testDB "alielgamal.com/myservice/internal/db/test"
+)
+
+func TestScaffold(t *testing.T) {
+	type content struct {
+		Name string `json:"name"`
+		Note string `json:"note"`
+	}
+	table := "widget"
+	admin := "admin@example.com"
+	ctx := ForTenant(context.Background(), "a")
+	full := TableSchema{SoftDelete: true, History: true, Watch: true, Tenancy: true, Expiry: true, SearchAttributes: []string{"name", "note"}}
+	fullOptions := []Option{WithSoftDelete(), WithHistory(), WithTenancy(), WithSearch(), WithExpiry()}
+
+	testScaffold := func(t *testing.T, db *internalDB.SQLDB, migration func(TableSchema) Migration) {
+		t.Run("Creates a table that the store can use", func(t *testing.T) {
+			m := migration(full)
+			_, err := db.DB.ExecContext(context.Background(), m.Up)
+			require.NoError(t, err)
+
+			s := NewStore[content](db, table, fullOptions...)
+			require.NoError(t, s.(SchemaChecker).CheckSchema(ctx))
+			_, err = s.Add(ctx, admin, "w1", content{Name: "Blue widget"})
+			require.NoError(t, err)
+			_, err = s.Patch(ctx, admin, "w1", map[string]any{"note": "round"})
+			require.NoError(t, err)
+			found, err := s.Search(ctx, "round", 0)
+			require.NoError(t, err)
+			assert.Len(t, found, 1)
+			revisions, err := s.History(ctx, "w1")
+			require.NoError(t, err)
+			assert.Len(t, revisions, 2)
+
+			_, err = db.DB.ExecContext(context.Background(), m.Down)
+			require.NoError(t, err)
+			assert.ErrorIs(t, s.(SchemaChecker).CheckSchema(ctx), ErrSchemaMismatch)
+		})
+
+		t.Run("Fails the check when the options need missing columns", func(t *testing.T) {
+			m := migration(TableSchema{})
+			_, err := db.DB.ExecContext(context.Background(), m.Up)
+			require.NoError(t, err)
+			defer db.DB.ExecContext(context.Background(), m.Down)
+
+			require.NoError(t, NewStore[content](db, table).(SchemaChecker).CheckSchema(ctx))
+			err = NewStore[content](db, table, fullOptions...).(SchemaChecker).CheckSchema(ctx)
+			assert.ErrorIs(t, err, ErrSchemaMismatch)
+			assert.ErrorContains(t, err, "deleted_at")
+			assert.ErrorContains(t, err, "expires_at")
+			assert.ErrorContains(t, err, "widget_history doesn't exist")
+		})
+	}
+
+	t.Run("Postgres", func(t *testing.T) {
+		appConfig, _ := config.ReadConfig()
+		db, tearDown, err := testDB.SetupTestDB(t.Name(), 0, appConfig)
+		require.NoError(t, err)
+		defer tearDown()
+
+		testScaffold(t, db, func(s TableSchema) Migration {
+			m, _, err := Scaffold(table, s)
+			require.NoError(t, err)
+			return m
+		})
+
+		t.Run("Fails the check when indexes, triggers or row-level security are missing", func(t *testing.T) {
+			m, _, err := Scaffold(table, full)
+			require.NoError(t, err)
+			_, err = db.DB.ExecContext(context.Background(), m.Up)
+			require.NoError(t, err)
+			defer db.DB.ExecContext(context.Background(), m.Down)
+
+			watched := append(slices.Clone(fullOptions), WithListener(func() internalDB.Listener { return nil }))
+			require.NoError(t, NewStore[content](db, table, watched...).(SchemaChecker).CheckSchema(ctx))
+
+			for _, stmt := range []string{
+				"DROP INDEX widget_content_idx",
+				"DROP INDEX widget_search_idx",
+				"DROP TRIGGER widget_update_modified_at ON widget",
+				"DROP TRIGGER widget_notify ON widget",
+				"ALTER TABLE widget NO FORCE ROW LEVEL SECURITY",
+				"ALTER TABLE widget_history DISABLE ROW LEVEL SECURITY",
+			} {
+				_, err = db.DB.ExecContext(context.Background(), stmt)
+				require.NoError(t, err)
+			}
+			err = NewStore[content](db, table, watched...).(SchemaChecker).CheckSchema(ctx)
+			assert.ErrorIs(t, err, ErrSchemaMismatch)
+			assert.ErrorContains(t, err, "the GIN index of content")
+			assert.ErrorContains(t, err, "the GIN index of search_vector")
+			assert.ErrorContains(t, err, "update_modified_at")
+			assert.ErrorContains(t, err, "stored_notify")
+			assert.ErrorContains(t, err, "table widget doesn't enable and force row-level security")
+			assert.ErrorContains(t, err, "table widget_history doesn't enable and force row-level security")
+		})
+	})
+
+	t.Run("SQLite", func(t *testing.T) {
+		db, tearDown, err := testDB.SetupTestSQLiteDB(filepath.Join(t.TempDir(), "test.db"), 0)
+		require.NoError(t, err)
+		defer tearDown()
+
+		testScaffold(t, db, func(s TableSchema) Migration {
+			_, m, err := Scaffold(table, s)
+			require.NoError(t, err)
+			return m
+		})
+	})
+
+	t.Run("Fails when", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			table  string
+			schema TableSchema
+		}{
+			{"the table name needs quoting", "Widget", TableSchema{}},
+			{"the table name is empty", "", TableSchema{}},
+			{"the table name is too long", "a_very_long_table_name_that_doesnt_fit_in_postgres", TableSchema{}},
+			{"a searchable attribute is nested", table, TableSchema{SearchAttributes: []string{"a.b"}}},
+			{"a searchable attribute needs quoting", table, TableSchema{SearchAttributes: []string{"x'"}}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, _, err := Scaffold(tt.table, tt.schema)
+				assert.Error(t, err)
+			})
+		}
+	})
+}
@@ -0,0 +1,275 @@
+package stored
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// tagValidators validate the content using its validate and binding struct tags
+var tagValidators = sync.OnceValue(func() []*validator.Validate {
+	binding := validator.New()
+	binding.SetTagName("binding")
+	return []*validator.Validate{validator.New(), binding}
+})
+
+// Validator validates the content of stored items before it is written
+type Validator interface {
+	// Validate returns an error if the content should not be written
+	Validate(content any) error
+}
+
+// ValidatorFunc adapts a function to a Validator
+type ValidatorFunc func(content any) error
+
+// Validate calls the function
+func (f ValidatorFunc) Validate(content any) error {
+	return f(content)
+}
+
+// readOnlyTag the option of the stored struct tag that marks a field as read-only (see AllowReadOnly)
+const readOnlyTag = "readonly"
+
+// secretTag the option of the stored struct tag that marks a field as secret, which leaves it out of the payload of
+// outbox events (see WithOutbox). Options are separated by commas, like stored:"readonly,secret".
+const secretTag = "secret"
+
+var jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+
+// schemaField a JSON attribute of a struct in the content type
+type schemaField struct {
+	t        reflect.Type
+	readOnly bool
+	secret   bool
+}
+
+// schema is the registry of the legal attributes of the content type of a store. It is built from the JSON tags of
+// the struct types reachable from the content type when the store is created. Types that can hold anything (like any)
+// allow any attribute below them.
+type schema struct {
+	t      reflect.Type
+	fields map[reflect.Type]map[string]schemaField
+}
+
+func newSchema[T any]() schema {
+	s := schema{t: reflect.TypeFor[T](), fields: map[reflect.Type]map[string]schemaField{}}
+	s.register(s.t)
+	return s
+}
+
+// register adds the JSON attributes of the struct types reachable from t to the registry
+func (s schema) register(t reflect.Type) {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Array:
+		s.register(t.Elem())
+	case reflect.Struct:
+		if _, ok := s.fields[t]; ok || reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+			// Types that decode themselves have no attributes as far as the registry is concerned
+			return
+		}
+		fields := map[string]schemaField{}
+		s.fields[t] = fields
+		s.registerFields(t, fields)
+	}
+}
+
+// registerFields adds the JSON attributes of the struct type t to fields. Fields of embedded structs are promoted
+// unless a field of the same name is less deeply nested, like encoding/json does.
+func (s schema) registerFields(t reflect.Type, fields map[string]schemaField) {
+	embedded := []reflect.Type{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		tags := strings.Split(f.Tag.Get("stored"), ",")
+		fields[name] = schemaField{t: f.Type, readOnly: slices.Contains(tags, readOnlyTag), secret: slices.Contains(tags, secretTag)}
+		s.register(f.Type)
+	}
+
+	for _, e := range embedded {
+		promoted := map[string]schemaField{}
+		s.registerFields(e, promoted)
+		for name, f := range promoted {
+			if _, ok := fields[name]; !ok {
+				fields[name] = f
+			}
+		}
+	}
+}
+
+// field returns the attribute at the path inside the content. The attribute is read-only if any attribute along the
+// path is.
+func (s schema) field(path attributePath) (schemaField, error) {
+	result := schemaField{t: s.t}
+	for _, key := range path {
+		t := result.t
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+
+		switch t.Kind() {
+		case reflect.Struct:
+			f, ok := s.fields[t][key]
+			if !ok {
+				return schemaField{}, fmt.Errorf("unknown attribute '%v'", key)
+			}
+			result = schemaField{t: f.t, readOnly: result.readOnly || f.readOnly}
+		case reflect.Map:
+			if t.Key().Kind() != reflect.String {
+				return schemaField{}, fmt.Errorf("'%v' is not a valid key of %v", key, t)
+			}
+			result.t = t.Elem()
+		case reflect.Slice, reflect.Array:
+			if _, err := strconv.Atoi(key); err != nil {
+				return schemaField{}, fmt.Errorf("'%v' is not a valid index of %v", key, t)
+			}
+			result.t = t.Elem()
+		case reflect.Interface:
+			// Anything can be stored below an interface
+			return result, nil
+		default:
+			return schemaField{}, fmt.Errorf("%v has no attribute '%v'", t, key)
+		}
+	}
+	return result, nil
+}
+
+// path parses an attribute and returns its path if it is a legal attribute of the content type
+func (s schema) path(attribute string) (attributePath, error) {
+	path, err := parsePath(attribute)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.field(path); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAttribute, err)
+	}
+	return path, nil
+}
+
+// checkAttribute returns an *InvalidContentError if storing the value at the path would make the content unreadable
+// as the content type
+func (s schema) checkAttribute(attribute string, path attributePath, value any) error {
+	f, err := s.field(path)
+	if err != nil {
+		return &InvalidContentError{Attribute: attribute, Err: err}
+	}
+
+	if value == nil {
+		switch f.t.Kind() {
+		case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+			return nil
+		}
+		return &InvalidContentError{Attribute: attribute, Err: fmt.Errorf("null is not a valid %v", f.t)}
+	}
+
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(valueJSON))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(reflect.New(f.t).Interface()); err != nil {
+		return &InvalidContentError{Attribute: attribute, Err: err}
+	}
+	return nil
+}
+
+// readOnly returns whether the attribute at the path is read-only
+func (s schema) readOnly(path attributePath) bool {
+	f, err := s.field(path)
+	return err == nil && f.readOnly
+}
+
+// secretPaths returns the paths of the secret attributes of the content. Only the attributes that are reached through
+// structs are found, since the elements of maps and slices have no fixed path.
+func (s schema) secretPaths() []attributePath {
+	return s.appendSecretPaths(nil, nil, s.t, map[reflect.Type]bool{})
+}
+
+// appendSecretPaths appends the paths of the secret attributes below the struct type t at the prefix path to result.
+// The types along the prefix are visiting, so that recursive types end.
+func (s schema) appendSecretPaths(result []attributePath, prefix attributePath, t reflect.Type, visiting map[reflect.Type]bool) []attributePath {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || visiting[t] {
+		return result
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	names := make([]string, 0, len(s.fields[t]))
+	for name := range s.fields[t] {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		f := s.fields[t][name]
+		path := append(slices.Clone(prefix), name)
+		if f.secret {
+			result = append(result, path)
+			continue
+		}
+		result = s.appendSecretPaths(result, path, f.t, visiting)
+	}
+	return result
+}
+
+// validate runs the validators of the store on the content
+func (s sqlStore[T]) validate(content T) error {
+	return validateContent(content, s.tagValidation, s.validators)
+}
+
+// validateContent runs the struct tag validators if tagValidation is set, then the passed validators on the content
+func validateContent(content any, tagValidation bool, validators []Validator) error {
+	if tagValidation {
+		v := reflect.ValueOf(content)
+		for v.Kind() == reflect.Pointer && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.Kind() == reflect.Struct {
+			for _, tv := range tagValidators() {
+				if err := tv.Struct(v.Interface()); err != nil {
+					return &InvalidContentError{Err: err}
+				}
+			}
+		}
+	}
+
+	for _, v := range validators {
+		if err := v.Validate(content); err != nil {
+			invalid := &InvalidContentError{}
+			if errors.As(err, &invalid) {
+				return err
+			}
+			return &InvalidContentError{Err: err}
+		}
+	}
+	return nil
+}
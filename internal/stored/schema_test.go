@@ -0,0 +1,199 @@
+package stored
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaCheckAttribute(t *testing.T) {
+	type embedded struct {
+		E string `json:"e"`
+	}
+	type nested struct {
+		X int `json:"x"`
+	}
+	type content struct {
+		embedded
+		I        int            `json:"i"`
+		B        bool           `json:"b"`
+		N        *nested        `json:"n,omitempty"`
+		L        []nested       `json:"l"`
+		M        map[string]int `json:"m"`
+		A        any            `json:"a"`
+		Untagged string
+		Ignored  string            `json:"-"`
+		Tags     map[string]string `json:"tags,omitempty"`
+	}
+	s := newSchema[content]()
+
+	tests := []struct {
+		name      string
+		attribute string
+		value     any
+	}{
+		{"int", "i", 3},
+		{"bool", "b", true},
+		{"nested struct", "n", map[string]any{"x": 1}},
+		{"nested attribute", "n.x", 1},
+		{"null pointer", "n", nil},
+		{"array item", "l.0.x", 2},
+		{"map value", "m.key", 2},
+		{"anything below any", "a.b.c", "value"},
+		{"embedded attribute", "e", "text"},
+		{"untagged field", "Untagged", "text"},
+		{"JSON pointer", "/tags/a.b", "text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := parsePath(tt.attribute)
+			require.NoError(t, err)
+			assert.NoError(t, s.checkAttribute(tt.attribute, path, tt.value))
+		})
+	}
+
+	t.Run("Fails when", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			attribute string
+			value     any
+		}{
+			{"unknown attribute", "z", 3},
+			{"ignored field", "Ignored", "text"},
+			{"wrong type", "b", "yes"},
+			{"fraction for int", "i", 1.5},
+			{"null for int", "i", nil},
+			{"unknown nested attribute", "n.z", 1},
+			{"unknown attribute inside value", "n", map[string]any{"z": 1}},
+			{"non-index key of array", "l.x", 1},
+			{"attribute of scalar", "i.x", 1},
+			{"wrong map value type", "m.key", "text"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				path, err := parsePath(tt.attribute)
+				require.NoError(t, err)
+				err = s.checkAttribute(tt.attribute, path, tt.value)
+				invalid := &InvalidContentError{}
+				require.ErrorAs(t, err, &invalid)
+				assert.ErrorIs(t, err, ErrInvalidContent)
+				assert.Equal(t, tt.attribute, invalid.Attribute)
+			})
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	type content struct {
+		Name  string `json:"name" binding:"required"`
+		Email string `json:"email" validate:"omitempty,email"`
+	}
+
+	t.Run("Passes valid content", func(t *testing.T) {
+		s := sqlStore[content]{tagValidation: true}
+		assert.NoError(t, s.validate(content{Name: "name", Email: "a@example.com"}))
+	})
+
+	t.Run("Fails when", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			store   sqlStore[content]
+			content content
+		}{
+			{"binding tag fails", sqlStore[content]{tagValidation: true}, content{}},
+			{"validate tag fails", sqlStore[content]{tagValidation: true}, content{Name: "name", Email: "not an email"}},
+			{"validator fails", sqlStore[content]{validators: []Validator{ValidatorFunc(func(any) error {
+				return assert.AnError
+			})}}, content{Name: "name"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assert.ErrorIs(t, tt.store.validate(tt.content), ErrInvalidContent)
+			})
+		}
+	})
+}
+
+func TestSchemaPath(t *testing.T) {
+	type Base struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	type content struct {
+		Base
+		Name   int               `json:"name"`
+		Secret string            `json:"secret" stored:"readonly"`
+		Owner  *Base             `json:"owner" stored:"readonly"`
+		Labels map[string]string `json:"labels"`
+		hidden string
+	}
+	s := newSchema[content]()
+
+	tests := []struct {
+		name      string
+		attribute string
+		readOnly  bool
+	}{
+		{"field", "labels", false},
+		{"promoted field", "id", false},
+		{"map value", "labels.a", false},
+		{"read-only field", "secret", true},
+		{"below read-only field", "owner.name", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := s.path(tt.attribute)
+			require.NoError(t, err)
+			assert.Equal(t, tt.readOnly, s.readOnly(path))
+		})
+	}
+
+	t.Run("Finds the secret attributes", func(t *testing.T) {
+		type credentials struct {
+			Token string `json:"token" stored:"secret"`
+			User  string `json:"user"`
+		}
+		type node struct {
+			Key   string            `json:"key" stored:"readonly,secret"`
+			Auth  *credentials      `json:"auth"`
+			Next  *node             `json:"next"`
+			Items []credentials     `json:"items"`
+			Tags  map[string]string `json:"tags"`
+		}
+		nodes := newSchema[node]()
+
+		// The secrets in items are left out as elements of slices have no fixed path, and next is not followed again
+		assert.Equal(t, []attributePath{{"auth", "token"}, {"key"}}, nodes.secretPaths())
+		path, err := nodes.path("key")
+		require.NoError(t, err)
+		assert.True(t, nodes.readOnly(path), "the secret field is still read-only")
+	})
+
+	t.Run("Shadows promoted fields", func(t *testing.T) {
+		path, err := s.path("name")
+		require.NoError(t, err)
+		assert.NoError(t, s.checkAttribute("name", path, 1))
+		assert.ErrorIs(t, s.checkAttribute("name", path, "text"), ErrInvalidContent)
+	})
+
+	t.Run("Fails when", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			attribute string
+		}{
+			{"unknown attribute", "z"},
+			{"unexported field", "hidden"},
+			{"embedded struct name", "Base"},
+			{"SQL injection", "a'] = '1'; DROP TABLE app; --"},
+			{"attribute of string", "secret.x"},
+			{"invalid path", "labels..a"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := s.path(tt.attribute)
+				assert.ErrorIs(t, err, ErrInvalidAttribute)
+			})
+		}
+	})
+}
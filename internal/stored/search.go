@@ -0,0 +1,89 @@
+package stored
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	internalDB "alielgamal.com/myservice/internal/db"
+)
+
+const (
+	// searchColumn the generated column that contains the text search vector of the searchable attributes
+	searchColumn = "search_vector"
+
+	// searchConfig the text search configuration of queries. It must match the configuration of searchColumn.
+	searchConfig = "simple"
+
+	searchTemplateStmt  = "SELECT id, %v FROM %v %v ORDER BY %v DESC, id%v"
+	searchLimitTemplate = " LIMIT %v"
+)
+
+func (s sqlStore[T]) Search(ctx context.Context, query string, limit int, opts ...ReadOption) ([]Stored[T], error) {
+	ctx, span := tracer.Start(ctx, "store.search")
+	defer span.End()
+
+	if !s.search {
+		return nil, ErrSearchDisabled
+	}
+
+	o := newReadOptions(opts)
+	columns, err := s.readColumns(o.fields)
+	if err != nil {
+		return nil, err
+	}
+	q, err := s.query(o)
+	if err != nil {
+		return nil, err
+	}
+	rank := s.dialect.search(q, query)
+	if rank == "" {
+		return []Stored[T]{}, nil
+	}
+
+	limitClause := ""
+	if limit > 0 {
+		limitClause = fmt.Sprintf(searchLimitTemplate, q.param(limit))
+	}
+	searchStmt := fmt.Sprintf(searchTemplateStmt, columns, s.table, q.whereClause(), rank, limitClause)
+	result := []Stored[T]{}
+	err = s.read(ctx, func(querier internalDB.Querier) error {
+		rows, err := querier.QueryContext(ctx, searchStmt, q.params...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			r := Stored[T]{}
+			if err := s.scanStored(&r, rows, &r.ID); err != nil {
+				return err
+			}
+			result = append(result, r)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// prefixQuery returns a text search query that matches the items that have a word starting with every word of the
+// query, or an empty string if the query has no words. Words only consist of letters and digits, so they never need to
+// be quoted.
+func prefixQuery(query string) string {
+	words := searchWords(query)
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// searchWords splits a text into its words, which consist of letters and digits
+func searchWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
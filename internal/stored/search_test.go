@@ -0,0 +1,27 @@
+package stored
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"single word", "pay", "pay:*"},
+		{"multiple words", "pay roll", "pay:* & roll:*"},
+		{"operators and quotes are separators", "pay & !roll | 'x':*", "pay:* & roll:* & x:*"},
+		{"non-ascii letters", "café 2024", "café:* & 2024:*"},
+		{"no words", " &|! ", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, prefixQuery(tt.query))
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package stored
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+
+	internalDB "alielgamal.com/myservice/internal/db"
+)
+
+// sqliteNull the SQL value that JSON null and missing attributes are compared and sorted as, which is lower than all
+// other values like JSON null is in Postgres
+const sqliteNull = "-9e999"
+
+// sqlite the dialect of SQLite DBs, where the content is JSON text read using the JSON functions of SQLite. Attributes
+// are compared by their SQL values, which matches Postgres as long as an attribute always has the same JSON type.
+type sqlite struct {
+	schema schema
+}
+
+// jsonPath returns the SQLite JSON path to the value of the path inside the content as a SQL string literal. Keys are
+// array indexes if they index a slice or an array of the content type.
+func (d sqlite) jsonPath(path attributePath) string {
+	b := strings.Builder{}
+	b.WriteString("$")
+	for i, k := range path {
+		if d.indexes(path[:i]) {
+			b.WriteString("[")
+			b.WriteString(k)
+			b.WriteString("]")
+			continue
+		}
+		key, _ := json.Marshal(k)
+		b.WriteString(".")
+		b.Write(key)
+	}
+	return quoteLiteral(b.String())
+}
+
+// indexes returns whether the keys below the path are array indexes
+func (d sqlite) indexes(path attributePath) bool {
+	f, err := d.schema.field(path)
+	if err != nil {
+		return false
+	}
+	t := f.t
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Slice || t.Kind() == reflect.Array
+}
+
+func (d sqlite) value(path attributePath) string {
+	return fmt.Sprintf("%v -> %v", contentColumn, d.jsonPath(path))
+}
+
+// sqlValue returns the expression of the SQL value of the attribute at the path, which is NULL if it is missing
+func (d sqlite) sqlValue(path attributePath) string {
+	jsonPath := d.jsonPath(path)
+	return fmt.Sprintf("iif(json_type(%v, %v) = 'null', %v, %v ->> %v)", contentColumn, jsonPath, sqliteNull, contentColumn, jsonPath)
+}
+
+func (d sqlite) without(expr string, paths []attributePath) string {
+	if len(paths) == 0 {
+		return expr
+	}
+	args := []string{expr}
+	for _, path := range paths {
+		args = append(args, d.jsonPath(path))
+	}
+	return fmt.Sprintf("json_remove(%v)", strings.Join(args, ", "))
+}
+
+func (d sqlite) set(paths []attributePath, placeholders []string) string {
+	args := make([]string, 0, 2*len(paths))
+	for i, path := range paths {
+		args = append(args, d.jsonPath(path), fmt.Sprintf("json(%v)", placeholders[i]))
+	}
+	return fmt.Sprintf("%v = json_set(%v, %v)", contentColumn, contentColumn, strings.Join(args, ", "))
+}
+
+func (d sqlite) condition(q *queryBuilder, path attributePath, c Condition) (string, error) {
+	jsonPath := d.jsonPath(path)
+	switch c.Op {
+	case InOperator, NotInOperator:
+		placeholders := []string{}
+		for _, v := range sliceValues(c.Value) {
+			value, err := sqliteParam(v)
+			if err != nil {
+				return "", err
+			}
+			placeholders = append(placeholders, q.param(value))
+		}
+		return fmt.Sprintf("%v %v (%v)", d.sqlValue(path), c.Op, strings.Join(placeholders, ", ")), nil
+	case ContainsOperator:
+		return d.containing(q, jsonPath, c.Value)
+	case ExistsOperator:
+		return fmt.Sprintf("json_type(%v, %v) IS NOT NULL", contentColumn, jsonPath), nil
+	case IsNotNullOperator:
+		return fmt.Sprintf("json_type(%v, %v) <> 'null'", contentColumn, jsonPath), nil
+	case IsNullOperator:
+		return fmt.Sprintf("ifnull(json_type(%v, %v), 'null') = 'null'", contentColumn, jsonPath), nil
+	case LikeOperator:
+		// LIKE ignores the case in SQLite, so case-sensitive patterns are matched using GLOB
+		return fmt.Sprintf("CAST(%v ->> %v AS TEXT) GLOB %v", contentColumn, jsonPath, q.param(globPattern(c.Value.(string)))), nil
+	case ILikeOperator:
+		return fmt.Sprintf("CAST(%v ->> %v AS TEXT) LIKE %v ESCAPE '\\'", contentColumn, jsonPath, q.param(c.Value)), nil
+	case BetweenOperator:
+		bounds := sliceValues(c.Value)
+		lower, err := sqliteParam(bounds[0])
+		if err != nil {
+			return "", err
+		}
+		upper, err := sqliteParam(bounds[1])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v BETWEEN %v AND %v", d.sqlValue(path), q.param(lower), q.param(upper)), nil
+	default:
+		value, err := sqliteParam(c.Value)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(conditionTemplate, d.sqlValue(path), c.Op, q.param(value)), nil
+	}
+}
+
+// containing returns the SQL that matches if the JSON value at the path contains the value as per JSONB containment.
+// The path is a SQL expression of a JSON path inside the content.
+func (d sqlite) containing(q *queryBuilder, path string, value any) (string, error) {
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	doc, err := decodeJSONNumbers(valueJSON)
+	if err != nil {
+		return "", err
+	}
+	return d.containingJSON(q, path, doc, 0), nil
+}
+
+// containingJSON renders containing for a decoded JSON value. The depth names the elements of the arrays that are
+// nested in the value.
+func (d sqlite) containingJSON(q *queryBuilder, path string, value any, depth int) string {
+	jsonType := fmt.Sprintf("json_type(%v, %v)", contentColumn, path)
+	switch v := value.(type) {
+	case map[string]any:
+		stmts := []string{fmt.Sprintf("%v = 'object'", jsonType)}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			key, _ := json.Marshal(k)
+			child := fmt.Sprintf("%v || %v", path, quoteLiteral("."+string(key)))
+			stmts = append(stmts, d.containingJSON(q, child, v[k], depth))
+		}
+		return fmt.Sprintf("(%v)", strings.Join(stmts, " AND "))
+	case []any:
+		stmts := []string{fmt.Sprintf("%v = 'array'", jsonType)}
+		element := fmt.Sprintf("e%v", depth)
+		for _, e := range v {
+			stmts = append(stmts, fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(%v, %v) AS %v WHERE %v)",
+				contentColumn, path, element, d.containingJSON(q, element+".fullkey", e, depth+1)))
+		}
+		return fmt.Sprintf("(%v)", strings.Join(stmts, " AND "))
+	case nil:
+		return fmt.Sprintf("%v = 'null'", jsonType)
+	case bool:
+		return fmt.Sprintf("%v = '%v'", jsonType, v)
+	case json.Number:
+		return fmt.Sprintf("(%v IN ('integer', 'real') AND json_extract(%v, %v) = %v)", jsonType, contentColumn, path, q.param(numberParam(v)))
+	default:
+		return fmt.Sprintf("(%v = 'text' AND json_extract(%v, %v) = %v)", jsonType, contentColumn, path, q.param(v))
+	}
+}
+
+func (d sqlite) sortExpression(path attributePath) string {
+	return fmt.Sprintf("ifnull(%v ->> %v, %v)", contentColumn, d.jsonPath(path), sqliteNull)
+}
+
+func (d sqlite) sortValue(path attributePath) string {
+	return d.value(path)
+}
+
+func (sqlite) cursorParam(value json.RawMessage) (any, error) {
+	return sqliteJSONParam(value)
+}
+
+func (sqlite) object(args []string) string {
+	return fmt.Sprintf("json_object(%v)", strings.Join(args, ", "))
+}
+
+// groupOrder sorts the groups by the SQL value of the key since JSON text doesn't sort like the values it encodes
+func (d sqlite) groupOrder(path attributePath) string {
+	return fmt.Sprintf("%v NULLS LAST", d.sqlValue(path))
+}
+
+func (sqlite) bucket(b TimeBucket, column Column) string {
+	switch b {
+	case HourBucket:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:00:00', %v)", column)
+	case WeekBucket:
+		// weekday 0 moves to the Sunday that ends the week, which starts 6 days before it
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d 00:00:00', %v, 'weekday 0', '-6 days')", column)
+	case MonthBucket:
+		return fmt.Sprintf("strftime('%%Y-%%m-01 00:00:00', %v)", column)
+	case YearBucket:
+		return fmt.Sprintf("strftime('%%Y-01-01 00:00:00', %v)", column)
+	default:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d 00:00:00', %v)", column)
+	}
+}
+
+func (d sqlite) aggregate(fn AggregateFunction, path attributePath) string {
+	return fmt.Sprintf("%v(CAST(%v ->> %v AS REAL))", strings.ToUpper(string(fn)), contentColumn, d.jsonPath(path))
+}
+
+func (sqlite) tenant() string {
+	return "(SELECT value FROM temp.stored_tenant)"
+}
+
+// setTenant keeps the tenant in a temporary table since SQLite has no settings. Temporary tables are only seen by the
+// connection that creates them, which runs the whole transaction.
+func (sqlite) setTenant(ctx context.Context, tx internalDB.Tx, tenant string) error {
+	for _, stmt := range []string{"CREATE TEMP TABLE IF NOT EXISTS stored_tenant(value TEXT NOT NULL)", "DELETE FROM temp.stored_tenant"} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO temp.stored_tenant(value) VALUES ($1)", tenant)
+	return err
+}
+
+// setReaping does nothing since SQLite has no row-level security, so the statements of Reap already see all tenants
+func (sqlite) setReaping(context.Context, internalDB.Tx) error {
+	return nil
+}
+
+// columnsStmt uses table_xinfo, which also has the generated columns unlike table_info
+func (sqlite) columnsStmt() string {
+	return "SELECT name FROM pragma_table_xinfo($1)"
+}
+
+// search finds the words in the search column, which has a space before every word of the searchable attributes. The
+// rank is the number of times the words are found.
+func (sqlite) search(q *queryBuilder, query string) string {
+	words := searchWords(query)
+	if len(words) == 0 {
+		return ""
+	}
+	ranks := make([]string, 0, len(words))
+	for _, w := range words {
+		word := fmt.Sprintf("(' ' || lower(%v))", q.param(w))
+		q.where(fmt.Sprintf("instr(%v, %v) > 0", searchColumn, word))
+		ranks = append(ranks, fmt.Sprintf("(length(%v) - length(replace(%v, %v, ''))) / length(%v)", searchColumn, searchColumn, word, word))
+	}
+	return strings.Join(ranks, " + ")
+}
+
+// sqliteParam returns the query param that compares a value with the SQL value of attributes
+func sqliteParam(value any) (any, error) {
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return sqliteJSONParam(valueJSON)
+}
+
+// sqliteJSONParam returns the query param that compares a JSON value with the SQL value of attributes. Objects and
+// arrays are compared as JSON text.
+func sqliteJSONParam(value json.RawMessage) (any, error) {
+	v, err := decodeJSONNumbers(value)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case nil:
+		return math.Inf(-1), nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case json.Number:
+		return numberParam(v), nil
+	case string:
+		return v, nil
+	default:
+		b := bytes.Buffer{}
+		if err := json.Compact(&b, value); err != nil {
+			return nil, err
+		}
+		return b.String(), nil
+	}
+}
+
+// decodeJSONNumbers decodes a JSON value keeping its numbers as json.Number
+func decodeJSONNumbers(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// numberParam returns an integer query param for integer numbers, which SQLite compares exactly
+func numberParam(n json.Number) any {
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+// globPattern converts a LIKE pattern to the GLOB pattern that matches the same texts
+func globPattern(pattern string) string {
+	b := strings.Builder{}
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case !escaped && r == '\\':
+			escaped = true
+			continue
+		case !escaped && r == '%':
+			b.WriteRune('*')
+		case !escaped && r == '_':
+			b.WriteRune('?')
+		case r == '*' || r == '?' || r == '[':
+			b.WriteString("[" + string(r) + "]")
+		default:
+			b.WriteRune(r)
+		}
+		escaped = false
+	}
+	return b.String()
+}
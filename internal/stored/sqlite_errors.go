@@ -0,0 +1,45 @@
+//go:build cgo
+
+package stored
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteError translates the errors of the SQLite driver like storeError translates the errors of the Postgres
+// driver. SQLite only reports the columns of the violated unique constraints, so they are named like Postgres names
+// them by default (<table>_pkey and <table>_<column>_key).
+func sqliteError(err error) error {
+	sqliteErr := sqlite3.Error{}
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code != sqlite3.ErrConstraint {
+		return err
+	}
+
+	_, detail, _ := strings.Cut(sqliteErr.Error(), ": ")
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintPrimaryKey:
+		table, _, _ := strings.Cut(detail, ".")
+		return fmt.Errorf("%w: %w", ErrAlreadyExists, &ConstraintViolationError{Constraint: table + "_pkey", Err: err})
+	case sqlite3.ErrConstraintUnique:
+		return fmt.Errorf("%w: %w", ErrAlreadyExists, &ConstraintViolationError{Constraint: uniqueConstraint(detail), Err: err})
+	case sqlite3.ErrConstraintCheck:
+		return &ConstraintViolationError{Constraint: detail, Err: err}
+	}
+	return &ConstraintViolationError{Err: err}
+}
+
+// uniqueConstraint returns the name of a unique constraint from the columns that SQLite reports, like "t.a, t.b"
+func uniqueConstraint(columns string) string {
+	table := ""
+	names := []string{}
+	for _, c := range strings.Split(columns, ", ") {
+		t, name, _ := strings.Cut(c, ".")
+		table = t
+		names = append(names, name)
+	}
+	return fmt.Sprintf("%v_%v_key", table, strings.Join(names, "_"))
+}
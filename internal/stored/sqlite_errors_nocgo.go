@@ -0,0 +1,8 @@
+//go:build !cgo
+
+package stored
+
+// sqliteError returns the error as is since the SQLite driver is not available without cgo
+func sqliteError(err error) error {
+	return err
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"iter"
 	"strings"
 
 	"go.opentelemetry.io/otel"
@@ -15,187 +17,884 @@ import (
 var tracer = otel.Tracer("myservice/store")
 
 const (
-	addTemplateStmt      = "INSERT INTO %v(id, content, created_by, modified_by) VALUES ($1, $2, $3, $3) RETURNING created_at, modified_at"
-	getTemplateStmt      = "SELECT content, created_by, created_at, modified_by, modified_at FROM %v WHERE id=$1"
-	patchTemplateStmt    = "UPDATE %v SET modified_by=$1, modified_at=CURRENT_TIMESTAMP, %v  WHERE id=$2 RETURNING content, created_by, created_at, modified_by, modified_at"
-	listTemplateStmt     = "SELECT id, content, created_by, created_at, modified_by, modified_at FROM %v %v"
+	storedColumns        = "content, created_by, created_at, modified_by, modified_at, version"
+	softDeleteColumns    = ", deleted_at, deleted_by"
+	notDeletedCondition  = "deleted_at IS NULL"
+	addTemplateStmt      = "INSERT INTO %v(id, content, created_by, modified_by, created_at, modified_at%v) VALUES ($1, $2, $3, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP%v) RETURNING created_at, modified_at, version"
+	getTemplateStmt      = "SELECT %v FROM %v WHERE id=$1%v"
+	versionTemplateStmt  = "SELECT version FROM %v WHERE id=$1%v"
+	patchTemplateStmt    = "UPDATE %v SET %v WHERE %v RETURNING %v"
+	listTemplateStmt     = "SELECT id, %v FROM %v %v"
+	listPageTemplateStmt = "SELECT id, %v FROM %v %v ORDER BY %v %v, id %v LIMIT %v"
+	deleteTemplateStmt   = "DELETE FROM %v WHERE id=$1%v"
+	softDeleteTemplate   = "UPDATE %v SET deleted_at=CURRENT_TIMESTAMP, deleted_by=$1, modified_at=CURRENT_TIMESTAMP, version=version+1 WHERE id=$2 AND deleted_at IS NULL%v"
+	restoreTemplateStmt  = "UPDATE %v SET deleted_at=NULL, deleted_by=NULL, modified_by=$1, modified_at=CURRENT_TIMESTAMP, version=version+1 WHERE id=$2 AND deleted_at IS NOT NULL%v RETURNING %v"
+	upsertTemplateStmt   = "INSERT INTO %v(id, content, created_by, modified_by, created_at, modified_at%v) VALUES ($1, $2, $3, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP%v) ON CONFLICT (id) DO UPDATE SET content=EXCLUDED.content, modified_by=EXCLUDED.modified_by, modified_at=CURRENT_TIMESTAMP, version=%v.version+1%v%v RETURNING %v"
+	upsertRestoreStmt    = ", deleted_at=NULL, deleted_by=NULL"
+	upsertTenantStmt     = " WHERE %v.tenant = EXCLUDED.tenant"
 	patchArgStartIndex   = 3
-	setAttributeTemplate = "content['%v'] = $%v"
-	conditionTemplate    = "content['%v'] %v $%v"
+	setAttributeTemplate = "%v = %v"
+	conditionTemplate    = "%v %v %v"
 )
 
-// Store An interface that provides Storage facility for any object that can be represents in JSON format
+// Store An interface that provides Storage facility for any object that can be represents in JSON format. Methods fail
+// with ErrNotFound when the stored item doesn't exist and with ErrAlreadyExists or a *ConstraintViolationError when
+// a write violates a constraint of the table, whatever the driver is.
 type Store[T any] interface {
-	// Add a new Stored item with a specific id and content
-	Add(ctx context.Context, creator string, id string, content T) (*Stored[T], error)
-
-	// Updates a single attribute in the content. This method doesn't check the attribute existence but guarantees
-	//  that content stored is still a valid. If it is not, the patch operation will fail without impacting storage.
-	Patch(ctx context.Context, updater string, id string, attributes map[string]any) (*Stored[T], error)
-
-	// Get finds a storable by its id
-	Get(ctx context.Context, id string) (*Stored[T], error)
+	// Add a new Stored item with a specific id and content. Adding the id of a soft-deleted item fails with ErrDeleted
+	// and ErrAlreadyExists, as the id is used until the item is restored using Restore or replaced using Upsert.
+	Add(ctx context.Context, creator string, id string, content T, opts ...WriteOption) (*Stored[T], error)
+
+	// Updates a single attribute in the content. Every attribute must be a JSON attribute of T and its value must fit
+	// the type of that attribute, and the patched content must pass the validators of the store. If it doesn't, an
+	// *InvalidContentError is returned without impacting storage.
+	// Attribute keys can be dotted paths (a.b.c) or JSON pointers (/a/b/c) to patch nested attributes.
+	Patch(ctx context.Context, updater string, id string, attributes map[string]any, opts ...WriteOption) (*Stored[T], error)
+
+	// PatchVersion behaves like Patch but only applies the patch if the stored item is still at the passed version.
+	// If the stored item has been modified since, a *ConflictError is returned and storage is not impacted.
+	PatchVersion(ctx context.Context, updater string, id string, version int64, attributes map[string]any, opts ...WriteOption) (*Stored[T], error)
+
+	// AddMany adds multiple stored items in a single transaction. In AllOrNothing mode, the items are added using
+	// multi-row inserts and nothing is added if any item fails, including items that repeat the id of an earlier item.
+	// In PerItem mode, every item that fails is reported in its BatchResult without impacting the others, like Add
+	// reports it. The results are in the same order as the items.
+	AddMany(ctx context.Context, creator string, items []Stored[T], mode BatchMode, opts ...WriteOption) ([]BatchResult[T], error)
+
+	// PatchMany applies multiple patches in a single transaction. In AllOrNothing mode, nothing is patched if any
+	// patch fails and a *BatchItemError is returned. In PerItem mode, every patch that fails is reported in its
+	// BatchResult without impacting the others. The results are in the same order as the patches.
+	PatchMany(ctx context.Context, updater string, patches []ItemPatch, mode BatchMode, opts ...WriteOption) ([]BatchResult[T], error)
+
+	// Put replaces the whole content of a stored item, keeping its created_* audit fields
+	Put(ctx context.Context, updater string, id string, content T, opts ...WriteOption) (*Stored[T], error)
+
+	// PutVersion behaves like Put but only replaces the content if the stored item is still at the passed version.
+	// If the stored item has been modified since, a *ConflictError is returned and storage is not impacted.
+	PutVersion(ctx context.Context, updater string, id string, version int64, content T, opts ...WriteOption) (*Stored[T], error)
+
+	// Upsert adds a stored item or replaces its whole content if it already exists, which makes it idempotent. The
+	// returned item is at version 1 only if it was added. Upserting a soft-deleted item restores it.
+	Upsert(ctx context.Context, actor string, id string, content T, opts ...WriteOption) (*Stored[T], error)
+
+	// Get finds a storable by its id. Pass Fields to only read those attributes of the content, which saves reading and
+	// transferring the rest of it; the other attributes are left at their zero value. Fields can be nested (a.b), but
+	// can't index arrays. Get fails with ErrNotFound if the item doesn't fill the passed conditions.
+	Get(ctx context.Context, id string, opts ...ReadOption) (*Stored[T], error)
 
 	// List returns all items that fill certain all conditions (AND operator between the conditions).
 	// if no conditions are passed, all stored items are returned.
-	List(ctx context.Context, conds ...Condition) ([]Stored[T], error)
+	// Conditions on attributes that are not JSON attributes of T fail with ErrInvalidAttribute.
+	List(ctx context.Context, opts ...ReadOption) ([]Stored[T], error)
+
+	// Iter streams the items that fill all conditions (AND operator between the conditions) one by one instead of
+	// buffering them like List. Failures, including the cancellation of the context, are yielded once as the last
+	// element of the sequence. Breaking out of the loop early releases the underlying resources.
+	Iter(ctx context.Context, opts ...ReadOption) iter.Seq2[Stored[T], error]
+
+	// ListPage returns a single page of the items that fill all conditions (AND operator between the conditions), sorted
+	// according to the options. Pass the NextCursor of the returned page in the options to get the following page.
+	ListPage(ctx context.Context, page ListOptions, opts ...ReadOption) (*Page[T], error)
+
+	// Search returns the items that fill all conditions (AND operator between the conditions) and have a word starting
+	// with every word of the query in their searchable attributes, the best matches first. Only the limit best matches
+	// are returned, or all of them if limit is 0. It fails with ErrSearchDisabled if the store is not searchable.
+	Search(ctx context.Context, query string, limit int, opts ...ReadOption) ([]Stored[T], error)
+
+	// Count returns the number of items that fill all conditions (AND operator between the conditions)
+	Count(ctx context.Context, opts ...ReadOption) (int64, error)
+
+	// Aggregate groups the items that fill all conditions (AND operator between the conditions) and computes the
+	// function of the aggregation for every group. Groups are sorted by their keys.
+	Aggregate(ctx context.Context, agg Aggregation, opts ...ReadOption) ([]Group, error)
+
+	// Delete removes a stored item. If the store is in soft-delete mode, the item is only marked as deleted and hidden
+	// from Get and List unless they are passed IncludeDeleted.
+	Delete(ctx context.Context, deleter string, id string) error
+
+	// Restore brings back a stored item that was soft-deleted. It fails with ErrSoftDeleteDisabled if the store is not
+	// in soft-delete mode.
+	Restore(ctx context.Context, restorer string, id string) (*Stored[T], error)
+
+	// History returns all the revisions of a stored item, oldest first. It fails with ErrHistoryDisabled if the store
+	// doesn't keep history.
+	History(ctx context.Context, id string) ([]Revision[T], error)
+
+	// GetAt returns the revision of a stored item at a specific version or time. It fails with ErrHistoryDisabled if
+	// the store doesn't keep history.
+	GetAt(ctx context.Context, id string, at At) (*Revision[T], error)
+
+	// Watch delivers the changes of the items that fill all conditions (AND operator between the conditions) after
+	// each change. Deletes from stores that are not in soft-delete mode are delivered regardless of the conditions.
+	// Changes are delivered at least once: the changes missed while reconnecting to the DB are caught up, which may
+	// deliver some changes again. The channel is closed when ctx is done or reading the changes fails; watch again
+	// with a context marked using WatchSince to resume. It fails with ErrWatchDisabled if the store has no listener.
+	Watch(ctx context.Context, conds ...Condition) (<-chan Change[T], error)
 }
 
-// NewStore creates a new store for a specific Stored T in a specific table
-func NewStore[T any](db internalDB.DB, table string) Store[T] {
-	return sqlStore[T]{
-		db:      db,
-		table:   table,
-		addStmt: fmt.Sprintf(addTemplateStmt, table),
-		getStmt: fmt.Sprintf(getTemplateStmt, table),
+// NewStore creates a new store for a specific Stored T in a specific table. The SQL of the store is rendered for the
+// driver of db (see internalDB.DriverOf). Stores of SQLite DBs can't be watched since SQLite has no notifications, so
+// their listener is ignored.
+func NewStore[T any](db internalDB.DB, table string, opts ...Option) Store[T] {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if internalDB.DriverOf(db) == internalDB.SQLiteDriver {
+		o.newListener = nil
+	}
+
+	sch := newSchema[T]()
+	d := newDialect(db, sch)
+	scope := tenantScope(d, o.tenancy)
+	tenantColumns, tenantValues := tenantInsert(d, o.tenancy)
+
+	// Expired items are treated as missing by the statements of single items
+	alive := ""
+	addColumns, addValues := tenantColumns, tenantValues
+	if o.expiry {
+		alive = " AND " + notExpiredCondition
+		addColumns += ", " + expiresAtColumn
+		addValues += ", $4"
+	}
+
+	columns := storedColumns
+	versionStmt := fmt.Sprintf(versionTemplateStmt, table, scope+alive)
+	deleteStmt := fmt.Sprintf(deleteTemplateStmt, table, scope+alive)
+	upsertRestore := ""
+	upsertTenant := ""
+	if o.softDelete {
+		columns += softDeleteColumns
+		versionStmt = fmt.Sprintf("%v AND %v", versionStmt, notDeletedCondition)
+		deleteStmt = fmt.Sprintf(softDeleteTemplate, table, scope+alive)
+		upsertRestore = upsertRestoreStmt
+	}
+	if o.expiry {
+		columns += ", " + expiresAtColumn
+	}
+	if o.tenancy {
+		// Items of other tenants are not replaced, so that upserting their ids returns no rows
+		upsertTenant = fmt.Sprintf(upsertTenantStmt, table)
+	}
+
+	s := sqlStore[T]{
+		db:          db,
+		table:       table,
+		softDelete:  o.softDelete,
+		history:     o.history,
+		tenancy:     o.tenancy,
+		expiry:      o.expiry,
+		newListener: o.newListener,
+		search:      o.search,
+		schema:      sch,
+		dialect:     d,
+		scope:       scope,
+		alive:       alive,
+		columns:     columns,
+		addStmt:     fmt.Sprintf(addTemplateStmt, table, addColumns, addValues),
+		getStmt:     fmt.Sprintf(getTemplateStmt, columns, table, scope+alive),
+		versionStmt: versionStmt,
+		deleteStmt:  deleteStmt,
+		restoreStmt: fmt.Sprintf(restoreTemplateStmt, table, scope+alive, columns),
+		upsertStmt:  fmt.Sprintf(upsertTemplateStmt, table, addColumns, addValues, table, upsertRestore, upsertTenant, columns),
+
+		tagValidation: o.tagValidation,
+		validators:    o.validators,
+	}
+	if o.history {
+		s.historyStmts = newHistoryStmts(table, scope, tenantColumns)
+	}
+	if o.expiry {
+		// Items that expire while being upserted keep their expiry unless the context sets one
+		s.upsertExpiryStmt = fmt.Sprintf(upsertTemplateStmt, table, addColumns, addValues, table, upsertRestore+upsertExpiryStmt, upsertTenant, columns)
+		lock := reapLockStmt
+		if internalDB.DriverOf(db) == internalDB.SQLiteDriver {
+			lock = ""
+		}
+		s.reapStmt = fmt.Sprintf(reapTemplateStmt, table, table, expiredCondition, lock)
+	}
+	if o.outboxTable != "" {
+		tenant := "NULL"
+		if o.tenancy {
+			tenant = tenantColumn
+		}
+		s.outboxStmt = fmt.Sprintf(recordEventTemplateStmt, o.outboxTable, d.without(contentColumn, sch.secretPaths()), tenant, table, scope)
 	}
+	return s
 }
 
 type sqlStore[T any] struct {
-	db      internalDB.DB
-	table   string
-	addStmt string
-	getStmt string
+	db          internalDB.DB
+	table       string
+	softDelete  bool
+	history     bool
+	tenancy     bool
+	expiry      bool
+	columns     string
+	addStmt     string
+	getStmt     string
+	versionStmt string
+	deleteStmt  string
+	restoreStmt string
+	upsertStmt  string
+	// upsertExpiryStmt the upsert statement that also replaces the expiry of existing items
+	upsertExpiryStmt string
+	reapStmt         string
+	historyStmts     historyStmts
+	outboxStmt       string
+	newListener      func() internalDB.Listener
+	search           bool
+
+	schema  schema
+	dialect dialect
+	// scope the condition that scopes statements to the tenant of the transaction in multi-tenant stores
+	scope string
+	// alive the condition that skips expired items in the statements of single items of stores that expire items
+	alive         string
+	tagValidation bool
+	validators    []Validator
+}
+
+// inTx runs f in a transaction that is only committed if f succeeds. Transactions of multi-tenant stores are scoped to
+// the tenant of the context.
+func (s sqlStore[T]) inTx(ctx context.Context, f func(tx internalDB.Tx) error) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if tenant != "" {
+		if err := s.dialect.setTenant(ctx, tx, tenant); err != nil {
+			return storeError(err)
+		}
+	}
+
+	if err := f(tx); err != nil {
+		return storeError(err)
+	}
+	return storeError(tx.Commit())
 }
 
-func (s sqlStore[T]) Add(ctx context.Context, creator string, id string, content T) (*Stored[T], error) {
+func (s sqlStore[T]) Add(ctx context.Context, creator string, id string, content T, opts ...WriteOption) (*Stored[T], error) {
 	ctx, span := tracer.Start(ctx, "store.add")
 	defer span.End()
 
-	contentJSON, err := json.Marshal(content)
+	w, err := newWriteOptions(s.expiry, opts)
 	if err != nil {
 		return nil, err
 	}
+	var result *Stored[T]
+	err = s.inTx(ctx, func(tx internalDB.Tx) error {
+		var err error
+		result, err = s.addTx(ctx, tx, creator, id, content, w)
+		return err
+	})
+	if err != nil {
+		return nil, deletedIDError(ctx, s, s.softDelete, id, err)
+	}
+	return result, nil
+}
 
-	row := s.db.QueryRowContext(ctx, s.addStmt, id, contentJSON, creator)
+// addTx adds a new stored item within the passed transaction
+func (s sqlStore[T]) addTx(ctx context.Context, tx internalDB.Tx, creator string, id string, content T, w writeOptions) (*Stored[T], error) {
+	if err := s.validate(content); err != nil {
+		return nil, err
+	}
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
 
 	result := &Stored[T]{
 		ID:         id,
 		Content:    content,
 		CreatedBy:  creator,
 		ModifiedBy: creator,
+		ExpiresAt:  w.expiresAt,
 	}
 
-	err = row.Scan(&result.CreatedAt, &result.ModifiedAt)
-	if err != nil {
+	params := []any{id, contentJSON, creator}
+	if s.expiry {
+		if err := s.purgeExpired(ctx, tx, id); err != nil {
+			return nil, err
+		}
+		params = append(params, expiresAtParam(w.expiresAt))
+	}
+	row := tx.QueryRowContext(ctx, s.addStmt, params...)
+	if err := row.Scan(&result.CreatedAt, &result.ModifiedAt, &result.Version); err != nil {
+		return nil, err
+	}
+	if err := s.afterWrite(ctx, tx, AddOperation, id, creator, json.RawMessage(contentJSON), w); err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-func (s sqlStore[T]) Patch(ctx context.Context, updater string, id string, attributes map[string]any) (*Stored[T], error) {
+func (s sqlStore[T]) Patch(ctx context.Context, updater string, id string, attributes map[string]any, opts ...WriteOption) (*Stored[T], error) {
 	ctx, span := tracer.Start(ctx, "store.patch")
 	defer span.End()
 
-	attributeStmts := []string{}
-	nextValueIndex := patchArgStartIndex
+	return s.patch(ctx, updater, id, 0, attributes, opts)
+}
+
+func (s sqlStore[T]) PatchVersion(ctx context.Context, updater string, id string, version int64, attributes map[string]any, opts ...WriteOption) (*Stored[T], error) {
+	ctx, span := tracer.Start(ctx, "store.patchVersion")
+	defer span.End()
+
+	return s.patch(ctx, updater, id, version, attributes, opts)
+}
+
+// patch applies the attributes to the stored item. If version is not 0, the patch is only applied if the stored item
+// is still at that version.
+func (s sqlStore[T]) patch(ctx context.Context, updater string, id string, version int64, attributes map[string]any, opts []WriteOption) (*Stored[T], error) {
+	w, err := newWriteOptions(s.expiry, opts)
+	if err != nil {
+		return nil, err
+	}
+	var result *Stored[T]
+	err = s.inTx(ctx, func(tx internalDB.Tx) error {
+		var err error
+		result, err = s.patchTx(ctx, tx, updater, id, version, attributes, w)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// patchTx applies the attributes to the stored item within the passed transaction
+func (s sqlStore[T]) patchTx(ctx context.Context, tx internalDB.Tx, updater string, id string, version int64, attributes map[string]any, w writeOptions) (*Stored[T], error) {
+	paths := []attributePath{}
+	placeholders := []string{}
 	queryParams := []any{updater, id}
 	for k, v := range attributes {
+		path, err := parsePath(k)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.schema.checkAttribute(k, path, v); err != nil {
+			return nil, err
+		}
+		if !w.allowReadOnly && s.schema.readOnly(path) {
+			return nil, fmt.Errorf("%w: '%v'", ErrReadOnlyAttribute, k)
+		}
 		jsonValue, err := json.Marshal(v)
 		if err != nil {
 			return nil, err
 		}
-		attributeStmts = append(attributeStmts, fmt.Sprintf(setAttributeTemplate, k, nextValueIndex))
 		queryParams = append(queryParams, jsonValue)
-		nextValueIndex++
+		paths = append(paths, path)
+		placeholders = append(placeholders, fmt.Sprintf("$%v", len(queryParams)))
 	}
+	setStmts := updateSetStmts()
+	if len(paths) > 0 {
+		setStmts = append(setStmts, s.dialect.set(paths, placeholders))
+	}
+
+	return s.updateTx(ctx, tx, PatchOperation, updater, id, version, setStmts, queryParams, attributes, w)
+}
 
-	patchStmt := fmt.Sprintf(patchTemplateStmt, s.table, strings.Join(attributeStmts, ","))
+func (s sqlStore[T]) Put(ctx context.Context, updater string, id string, content T, opts ...WriteOption) (*Stored[T], error) {
+	ctx, span := tracer.Start(ctx, "store.put")
+	defer span.End()
 
-	tx, err := s.db.BeginTx(ctx, nil)
+	return s.put(ctx, updater, id, 0, content, opts)
+}
+
+func (s sqlStore[T]) PutVersion(ctx context.Context, updater string, id string, version int64, content T, opts ...WriteOption) (*Stored[T], error) {
+	ctx, span := tracer.Start(ctx, "store.putVersion")
+	defer span.End()
+
+	return s.put(ctx, updater, id, version, content, opts)
+}
+
+// put replaces the content of the stored item. If version is not 0, the content is only replaced if the stored item
+// is still at that version.
+func (s sqlStore[T]) put(ctx context.Context, updater string, id string, version int64, content T, opts []WriteOption) (*Stored[T], error) {
+	w, err := newWriteOptions(s.expiry, opts)
 	if err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	setStmts := append(updateSetStmts(), fmt.Sprintf(setAttributeTemplate, contentColumn, fmt.Sprintf("$%v", patchArgStartIndex)))
+	queryParams := []any{updater, id, contentJSON}
 
-	row := tx.QueryRowContext(ctx, patchStmt, queryParams...)
+	var result *Stored[T]
+	err = s.inTx(ctx, func(tx internalDB.Tx) error {
+		var err error
+		result, err = s.updateTx(ctx, tx, PutOperation, updater, id, version, setStmts, queryParams, json.RawMessage(contentJSON), w)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// updateSetStmts returns the set statements that every update of a stored item needs. The updater is expected to be
+// the first query param.
+func updateSetStmts() []string {
+	return []string{"modified_by=$1", "modified_at=CURRENT_TIMESTAMP", "version=version+1"}
+}
+
+// updateTx updates the stored item within the passed transaction using the set statements. The query params are
+// expected to start with the updater and the id. If version is not 0, the update is only applied if the stored item
+// is still at that version.
+func (s sqlStore[T]) updateTx(ctx context.Context, tx internalDB.Tx, op Operation, updater string, id string, version int64, setStmts []string, queryParams []any, diff any, w writeOptions) (*Stored[T], error) {
+	if w.setExpiry {
+		queryParams = append(queryParams, expiresAtParam(w.expiresAt))
+		setStmts = append(setStmts, fmt.Sprintf(setExpiryTemplate, len(queryParams)))
+	}
+
+	whereStmt := "id=$2" + s.scope + s.alive
+	if s.softDelete {
+		whereStmt = fmt.Sprintf("%v AND %v", whereStmt, notDeletedCondition)
+	}
+	if version != 0 {
+		queryParams = append(queryParams, version)
+		whereStmt = fmt.Sprintf("%v AND version=$%v", whereStmt, len(queryParams))
+	}
+
+	updateStmt := fmt.Sprintf(patchTemplateStmt, s.table, strings.Join(setStmts, ", "), whereStmt, s.columns)
 
 	result := &Stored[T]{
 		ID: id,
 	}
 
-	err = s.scanStored(result, row)
+	row := tx.QueryRowContext(ctx, updateStmt, queryParams...)
+	err := s.scanStored(result, row)
+	if err == sql.ErrNoRows && version != 0 {
+		// Distinguish between a missing item and an item that has moved on to another version
+		var actualVersion int64
+		if err := tx.QueryRowContext(ctx, s.versionStmt, id).Scan(&actualVersion); err != nil {
+			return nil, err
+		}
+		return nil, &ConflictError{ID: id, ExpectedVersion: version, ActualVersion: actualVersion}
+	}
 	if err != nil {
 		return nil, err
 	}
+	// The content is validated after the update to validate patches merged into the stored content. Failing rolls
+	// back the transaction.
+	if err := s.validate(result.Content); err != nil {
+		return nil, err
+	}
+	if err := s.afterWrite(ctx, tx, op, id, updater, diff, w); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s sqlStore[T]) Upsert(ctx context.Context, actor string, id string, content T, opts ...WriteOption) (*Stored[T], error) {
+	ctx, span := tracer.Start(ctx, "store.upsert")
+	defer span.End()
 
-	err = tx.Commit()
+	w, err := newWriteOptions(s.expiry, opts)
 	if err != nil {
 		return nil, err
 	}
-	return result, err
+	if err := s.validate(content); err != nil {
+		return nil, err
+	}
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	upsertStmt := s.upsertStmt
+	params := []any{id, contentJSON, actor}
+	if s.expiry {
+		params = append(params, expiresAtParam(w.expiresAt))
+	}
+	if w.setExpiry {
+		upsertStmt = s.upsertExpiryStmt
+	}
+
+	result := &Stored[T]{
+		ID: id,
+	}
+
+	err = s.inTx(ctx, func(tx internalDB.Tx) error {
+		// Expired items are added again instead of being replaced
+		if err := s.purgeExpired(ctx, tx, id); err != nil {
+			return err
+		}
+		row := tx.QueryRowContext(ctx, upsertStmt, params...)
+		if err := s.scanStored(result, row); err != nil {
+			if s.tenancy && (errors.Is(err, sql.ErrNoRows) || rowSecurityViolation(err)) {
+				// The id is used by another tenant
+				return idInUse(s.table, err)
+			}
+			return err
+		}
+
+		op := PutOperation
+		if result.Version == 1 {
+			op = AddOperation
+		}
+		return s.afterWrite(ctx, tx, op, id, actor, json.RawMessage(contentJSON), w)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-func (s sqlStore[T]) Get(ctx context.Context, id string) (*Stored[T], error) {
+func (s sqlStore[T]) Get(ctx context.Context, id string, opts ...ReadOption) (*Stored[T], error) {
 	ctx, span := tracer.Start(ctx, "store.get")
 	defer span.End()
 
-	row := s.db.QueryRowContext(ctx, s.getStmt, id)
+	o := newReadOptions(opts)
+	if len(o.conds) > 0 {
+		return s.getWhere(ctx, id, o)
+	}
+
+	getStmt := s.getStmt
+	if len(o.fields) > 0 {
+		columns, err := s.readColumns(o.fields)
+		if err != nil {
+			return nil, err
+		}
+		getStmt = fmt.Sprintf(getTemplateStmt, columns, s.table, s.scope+s.alive)
+	}
+	if s.softDelete && !o.includeDeleted {
+		getStmt = fmt.Sprintf("%v AND %v", getStmt, notDeletedCondition)
+	}
 
 	result := &Stored[T]{
 		ID: id,
 	}
 
-	if err := s.scanStored(result, row); err != nil {
+	err := s.read(ctx, func(q internalDB.Querier) error {
+		return s.scanStored(result, q.QueryRowContext(ctx, getStmt, id))
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return result, nil
 }
-func (s sqlStore[T]) List(ctx context.Context, conds ...Condition) ([]Stored[T], error) {
+
+// getWhere finds the stored item by its id like Get, but only if it fills the conditions of the read options
+func (s sqlStore[T]) getWhere(ctx context.Context, id string, o readOptions) (*Stored[T], error) {
+	columns, err := s.readColumns(o.fields)
+	if err != nil {
+		return nil, err
+	}
+	q, err := s.query(o)
+	if err != nil {
+		return nil, err
+	}
+	q.where(fmt.Sprintf(conditionTemplate, IDColumn, EqualOperator, q.param(id)))
+
+	items, err := s.list(ctx, q, columns)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, storeError(sql.ErrNoRows)
+	}
+	return &items[0], nil
+}
+
+func (s sqlStore[T]) List(ctx context.Context, opts ...ReadOption) ([]Stored[T], error) {
 	ctx, span := tracer.Start(ctx, "store.list")
 	defer span.End()
 
-	conditionStmts := []string{}
-	nextValueIndex := 1
-	queryParams := []any{}
-	for _, c := range conds {
-		conditionStmts = append(conditionStmts, fmt.Sprintf(conditionTemplate, c.Attribute, c.Op, nextValueIndex))
-		nextValueIndex++
-		queryValue, err := json.Marshal(c.Value)
+	o := newReadOptions(opts)
+	columns, err := s.readColumns(o.fields)
+	if err != nil {
+		return nil, err
+	}
+	q, err := s.query(o)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.list(ctx, q, columns)
+}
+
+// list returns all the items that fill the conditions of the query builder, reading the passed columns
+func (s sqlStore[T]) list(ctx context.Context, q *queryBuilder, columns string) ([]Stored[T], error) {
+	result := []Stored[T]{}
+	for item, err := range s.iterate(ctx, q, columns) {
 		if err != nil {
 			return nil, err
 		}
-		queryParams = append(queryParams, queryValue)
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+func (s sqlStore[T]) Iter(ctx context.Context, opts ...ReadOption) iter.Seq2[Stored[T], error] {
+	return func(yield func(Stored[T], error) bool) {
+		ctx, span := tracer.Start(ctx, "store.iter")
+		defer span.End()
+
+		o := newReadOptions(opts)
+		columns, err := s.readColumns(o.fields)
+		if err != nil {
+			yield(Stored[T]{}, err)
+			return
+		}
+		q, err := s.query(o)
+		if err != nil {
+			yield(Stored[T]{}, err)
+			return
+		}
+		s.iterate(ctx, q, columns)(yield)
 	}
+}
 
-	listStmtCondition := ""
-	if len(conds) > 0 {
-		listStmtCondition = fmt.Sprintf("WHERE %v", strings.Join(conditionStmts, " AND "))
+// iterate streams the items that fill the conditions of the query builder, reading the passed columns. The rows are
+// closed as soon as the iteration stops.
+func (s sqlStore[T]) iterate(ctx context.Context, q *queryBuilder, columns string) iter.Seq2[Stored[T], error] {
+	return func(yield func(Stored[T], error) bool) {
+		listStmt := fmt.Sprintf(listTemplateStmt, columns, s.table, q.whereClause())
+
+		stopped := false
+		err := s.read(ctx, func(querier internalDB.Querier) error {
+			rows, err := querier.QueryContext(ctx, listStmt, q.params...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				r := Stored[T]{}
+				if err := s.scanStored(&r, rows, &r.ID); err != nil {
+					return err
+				}
+				if !yield(r, nil) {
+					stopped = true
+					return nil
+				}
+			}
+			return rows.Err()
+		})
+		if err != nil && !stopped {
+			yield(Stored[T]{}, err)
+		}
 	}
-	listStmt := fmt.Sprintf(listTemplateStmt, s.table, listStmtCondition)
-	var rows *sql.Rows
-	var err error
-	rows, err = s.db.QueryContext(ctx, listStmt, queryParams...)
+}
 
-	if err != nil {
+func (s sqlStore[T]) ListPage(ctx context.Context, page ListOptions, opts ...ReadOption) (*Page[T], error) {
+	ctx, span := tracer.Start(ctx, "store.listPage")
+	defer span.End()
+
+	if err := page.Sort.validate(); err != nil {
 		return nil, err
 	}
+	sortExpr := page.Sort.columnExpression()
+	var sortPath attributePath
+	if page.Sort.Attribute != "" {
+		var err error
+		if sortPath, err = s.schema.path(page.Sort.Attribute); err != nil {
+			return nil, err
+		}
+		sortExpr = s.dialect.sortExpression(sortPath)
+	}
 
-	result := []Stored[T]{}
-	for rows.Next() {
-		r := Stored[T]{}
-		var contentJSON []byte
-		err := rows.Scan(&r.ID, &contentJSON, &r.CreatedBy, &r.CreatedAt, &r.ModifiedBy, &r.ModifiedAt)
+	o := newReadOptions(opts)
+	q, err := s.query(o)
+	if err != nil {
+		return nil, err
+	}
+	direction, after := "ASC", ">"
+	if page.Sort.Descending {
+		direction, after = "DESC", "<"
+	}
+	if page.Cursor != "" {
+		id, value, err := decodeCursor(page.Sort, page.Cursor)
 		if err != nil {
 			return nil, err
 		}
-		err = json.Unmarshal(contentJSON, &r.Content)
+		if page.Sort.Attribute != "" {
+			if value, err = s.dialect.cursorParam(value.([]byte)); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+			}
+		}
+		q.where(fmt.Sprintf("(%v, id) %v (%v, %v)", sortExpr, after, q.param(value), q.param(id)))
+	}
+
+	columns, err := s.readColumns(o.fields)
+	if err != nil {
+		return nil, err
+	}
+	if page.Sort.Attribute != "" {
+		// The attribute value is needed to create the cursor
+		columns = fmt.Sprintf("%v, %v", s.dialect.sortValue(sortPath), columns)
+	}
+
+	// An extra item is fetched to know whether there is a next page
+	limit := page.limit()
+	listStmt := fmt.Sprintf(listPageTemplateStmt, columns, s.table, q.whereClause(), sortExpr, direction, direction, q.param(limit+1))
+	result := &Page[T]{Items: []Stored[T]{}}
+	err = s.read(ctx, func(querier internalDB.Querier) error {
+		rows, err := querier.QueryContext(ctx, listStmt, q.params...)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		defer rows.Close()
+
+		var lastSortValue any
+		for rows.Next() {
+			r := Stored[T]{}
+			dest := []any{&r.ID}
+			var attributeValue []byte
+			if page.Sort.Attribute != "" {
+				dest = append(dest, &attributeValue)
+			}
+			if err := s.scanStored(&r, rows, dest...); err != nil {
+				return err
+			}
+
+			if len(result.Items) == limit {
+				result.NextCursor, err = encodeCursor(page.Sort, result.Items[limit-1].ID, lastSortValue)
+				if err != nil {
+					return err
+				}
+				break
+			}
+
+			result.Items = append(result.Items, r)
+			if page.Sort.Attribute != "" {
+				lastSortValue = json.RawMessage(attributeValue)
+			} else {
+				lastSortValue = columnValue(page.Sort.Column, r)
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// query creates a query builder with the conditions of the read options and the ones that all reads from the store
+// should apply
+func (s sqlStore[T]) query(o readOptions) (*queryBuilder, error) {
+	q := &queryBuilder{schema: s.schema, dialect: s.dialect}
+	if err := q.addConditions(o.conds); err != nil {
+		return nil, err
+	}
+	if s.softDelete && !o.includeDeleted {
+		q.where(notDeletedCondition)
+	}
+	if s.expiry {
+		q.where(notExpiredCondition)
+	}
+	if s.tenancy {
+		q.where(fmt.Sprintf(conditionTemplate, tenantColumn, EqualOperator, s.dialect.tenant()))
+	}
+	return q, nil
+}
+
+func (s sqlStore[T]) Delete(ctx context.Context, deleter string, id string) error {
+	ctx, span := tracer.Start(ctx, "store.delete")
+	defer span.End()
+
+	return s.inTx(ctx, func(tx internalDB.Tx) error {
+		if !s.softDelete {
+			// The deleted item is gone after the delete, so its revision and event are recorded before it
+			if err := s.recordRevision(ctx, tx, DeleteOperation, id, deleter, map[string]any{}, 1); err != nil {
+				return err
+			}
+			if err := s.recordEvent(ctx, tx, DeleteOperation, id, deleter, 1, writeOptions{}); err != nil {
+				return err
+			}
+		}
+
+		var res sql.Result
+		var err error
+		if s.softDelete {
+			res, err = tx.ExecContext(ctx, s.deleteStmt, deleter, id)
+		} else {
+			res, err = tx.ExecContext(ctx, s.deleteStmt, id)
+		}
+		if err != nil {
+			return err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return sql.ErrNoRows
+		}
+		if !s.softDelete {
+			return nil
+		}
+		return s.afterWrite(ctx, tx, DeleteOperation, id, deleter, map[string]any{}, writeOptions{})
+	})
+}
+
+func (s sqlStore[T]) Restore(ctx context.Context, restorer string, id string) (*Stored[T], error) {
+	ctx, span := tracer.Start(ctx, "store.restore")
+	defer span.End()
+
+	if !s.softDelete {
+		return nil, ErrSoftDeleteDisabled
+	}
+
+	result := &Stored[T]{
+		ID: id,
+	}
+
+	err := s.inTx(ctx, func(tx internalDB.Tx) error {
+		row := tx.QueryRowContext(ctx, s.restoreStmt, restorer, id)
+		if err := s.scanStored(result, row); err != nil {
+			return err
 		}
-		result = append(result, r)
+		return s.afterWrite(ctx, tx, RestoreOperation, id, restorer, map[string]any{}, writeOptions{})
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return result, nil
 }
 
-func (s sqlStore[T]) scanStored(result *Stored[T], row *sql.Row) error {
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanStored scans the store columns of a row into result. Any passed dest are scanned before the store columns.
+func (s sqlStore[T]) scanStored(result *Stored[T], row scanner, dest ...any) error {
 	var contentJSON []byte
-	err := row.Scan(&contentJSON, &result.CreatedBy, &result.CreatedAt, &result.ModifiedBy, &result.ModifiedAt)
+	var deletedAt sql.NullTime
+	var deletedBy sql.NullString
+	var expiresAt sql.NullTime
+	dest = append(dest, &contentJSON, &result.CreatedBy, &result.CreatedAt, &result.ModifiedBy, &result.ModifiedAt, &result.Version)
+	if s.softDelete {
+		dest = append(dest, &deletedAt, &deletedBy)
+	}
+	if s.expiry {
+		dest = append(dest, &expiresAt)
+	}
+
+	err := row.Scan(dest...)
 	if err != nil {
 		return err
 	}
+	if deletedAt.Valid {
+		result.DeletedAt = &deletedAt.Time
+		result.DeletedBy = deletedBy.String
+	}
+	if expiresAt.Valid {
+		result.ExpiresAt = &expiresAt.Time
+	}
 	err = json.Unmarshal(contentJSON, &result.Content)
 	if err != nil {
 		return err
@@ -2,29 +2,24 @@ package stored
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"alielgamal.com/myservice/internal/config"
+	internalDB "alielgamal.com/myservice/internal/db"
 	testDB "alielgamal.com/myservice/internal/db/test"
 )
 
 func TestStore(t *testing.T) {
 	appConfig, _ := config.ReadConfig()
 
-	tableName := "stored"
-
-	type content struct {
-		I int    `json:"i"`
-		B bool   `json:"b"`
-		S string `json:"s"`
-	}
-	admin := "admin@example.com"
-
-	prepareMockDB := func(t *testing.T) (func(), Store[content]) {
+	prepareTable := func(t *testing.T, tableName string) (*internalDB.SQLDB, func()) {
 		db, tearDown, err := testDB.SetupTestDB(t.Name(), 0, appConfig)
 		require.Nil(t, err)
 
@@ -35,7 +30,13 @@ func TestStore(t *testing.T) {
 			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			modified_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			created_by VARCHAR(50) NOT NULL CHECK(length(created_by) > 0),
-			modified_by VARCHAR(50) NOT NULL CHECK(length(modified_by) > 0)
+			modified_by VARCHAR(50) NOT NULL CHECK(length(modified_by) > 0),
+			version BIGINT NOT NULL DEFAULT 1,
+			deleted_at TIMESTAMP NULL,
+			deleted_by VARCHAR(50) NULL CHECK(length(deleted_by) > 0),
+			tenant VARCHAR(50) NULL,
+			expires_at TIMESTAMP NULL,
+			search_vector TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', coalesce(content->>'s', ''))) STORED
 			)`,
 			tableName))
 		require.Nil(t, err)
@@ -45,9 +46,102 @@ func TestStore(t *testing.T) {
 			tableName))
 		require.Nil(t, err)
 
-		s := NewStore[content](db, tableName)
+		_, err = db.ExecContext(context.Background(), fmt.Sprintf(`
+		CREATE TABLE %v_history (
+			revision BIGSERIAL PRIMARY KEY,
+			id VARCHAR(36) NOT NULL,
+			version BIGINT NOT NULL,
+			operation VARCHAR(10) NOT NULL,
+			content JSONB NOT NULL,
+			diff JSONB NOT NULL,
+			actor VARCHAR(50) NOT NULL CHECK(length(actor) > 0),
+			at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			tenant VARCHAR(50) NULL
+			)`,
+			tableName))
+		require.Nil(t, err)
+
+		_, err = db.ExecContext(context.Background(), fmt.Sprintf(
+			"CREATE TRIGGER %v_notify AFTER INSERT OR UPDATE OR DELETE ON %v FOR EACH ROW EXECUTE PROCEDURE stored_notify()",
+			tableName, tableName))
+		require.Nil(t, err)
+
+		return db, tearDown
+	}
+
+	newListener := func(t *testing.T) func() internalDB.Listener {
+		return testDB.NewTestListener(t.Name(), appConfig)
+	}
+
+	testStore(t, prepareTable, newListener)
+}
+
+func TestSQLiteStore(t *testing.T) {
+	prepareTable := func(t *testing.T, tableName string) (*internalDB.SQLDB, func()) {
+		db, tearDown, err := testDB.SetupTestSQLiteDB(filepath.Join(t.TempDir(), "test.db"), 0)
+		require.Nil(t, err)
+
+		_, err = db.ExecContext(context.Background(), fmt.Sprintf(`
+		CREATE TABLE %v (
+			id VARCHAR(36) NOT NULL PRIMARY KEY CONSTRAINT %v_id_check CHECK(length(id) > 0),
+			content TEXT NOT NULL CHECK(json_valid(content)),
+			created_at TIMESTAMP NOT NULL,
+			modified_at TIMESTAMP NOT NULL,
+			created_by VARCHAR(50) NOT NULL CONSTRAINT %v_created_by_check CHECK(length(created_by) > 0),
+			modified_by VARCHAR(50) NOT NULL CONSTRAINT %v_modified_by_check CHECK(length(modified_by) > 0),
+			version BIGINT NOT NULL DEFAULT 1,
+			deleted_at TIMESTAMP NULL,
+			deleted_by VARCHAR(50) NULL CONSTRAINT %v_deleted_by_check CHECK(length(deleted_by) > 0),
+			tenant VARCHAR(50) NULL,
+			expires_at TIMESTAMP NULL,
+			search_vector TEXT GENERATED ALWAYS AS (' ' || lower(coalesce(content->>'s', ''))) VIRTUAL
+			)`,
+			tableName, tableName, tableName, tableName, tableName))
+		require.Nil(t, err)
+
+		_, err = db.ExecContext(context.Background(), fmt.Sprintf(`
+		CREATE TABLE %v_history (
+			revision INTEGER PRIMARY KEY AUTOINCREMENT,
+			id VARCHAR(36) NOT NULL,
+			version BIGINT NOT NULL,
+			operation VARCHAR(10) NOT NULL,
+			content TEXT NOT NULL,
+			diff TEXT NOT NULL,
+			actor VARCHAR(50) NOT NULL CHECK(length(actor) > 0),
+			at TIMESTAMP NOT NULL,
+			tenant VARCHAR(50) NULL
+			)`,
+			tableName))
+		require.Nil(t, err)
+
+		return db, tearDown
+	}
+
+	// SQLite has no notifications, so there is no listener
+	testStore(t, prepareTable, nil)
+}
+
+// testStore runs the tests that every sqlStore passes, whatever its DB is. The tests that need to watch the store are
+// skipped if newListener is nil.
+func testStore(t *testing.T, prepareTable func(t *testing.T, tableName string) (*internalDB.SQLDB, func()), newListener func(t *testing.T) func() internalDB.Listener) {
+	tableName := "stored"
+
+	type nested struct {
+		X int    `json:"x"`
+		Y string `json:"y"`
+	}
+	type content struct {
+		I int      `json:"i"`
+		B bool     `json:"b"`
+		S string   `json:"s"`
+		N *nested  `json:"n,omitempty"`
+		L []string `json:"l,omitempty"`
+	}
+	admin := "admin@example.com"
 
-		return tearDown, s
+	prepareMockDB := func(t *testing.T, opts ...Option) (func(), Store[content]) {
+		db, tearDown := prepareTable(t, tableName)
+		return tearDown, NewStore[content](db, tableName, opts...)
 	}
 
 	ctx := context.Background()
@@ -70,6 +164,7 @@ func TestStore(t *testing.T) {
 			assert.Equal(t, added.CreatedAt, added.ModifiedAt)
 			assert.Equal(t, admin, added.CreatedBy)
 			assert.Equal(t, admin, added.ModifiedBy)
+			assert.Equal(t, int64(1), added.Version)
 			assert.Equal(t, fixture, added.Content)
 			assert.Equal(t, id, added.ID)
 			assert.Equal(t, fixture, added.Content)
@@ -94,12 +189,27 @@ func TestStore(t *testing.T) {
 					tearDown, s := prepareMockDB(t)
 					defer tearDown()
 					added, err := s.Add(ctx, tt.creator, tt.id, tt.value)
-					assert.Error(t, err)
+					violation := &ConstraintViolationError{}
+					assert.ErrorAs(t, err, &violation)
 					assert.Nil(t, added)
 				})
 			}
 		})
 
+		t.Run("Fails when the id already exists", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			added, err := s.Add(ctx, admin, id, fixture)
+			assert.ErrorIs(t, err, ErrAlreadyExists)
+			violation := &ConstraintViolationError{}
+			require.ErrorAs(t, err, &violation)
+			assert.Equal(t, tableName+"_pkey", violation.Constraint)
+			assert.Nil(t, added)
+		})
+
 	})
 
 	t.Run("Patch", func(t *testing.T) {
@@ -121,6 +231,7 @@ func TestStore(t *testing.T) {
 			require.NoError(t, err)
 			assert.Equal(t, newContent, patched.Content)
 			assert.Equal(t, newAdmin, patched.ModifiedBy)
+			assert.Equal(t, int64(2), patched.Version)
 			assert.True(t, patched.CreatedAt.Before(patched.ModifiedAt))
 
 			fetched, err := s.Get(ctx, id)
@@ -128,20 +239,83 @@ func TestStore(t *testing.T) {
 			assert.Equal(t, *patched, *fetched)
 		})
 
-		t.Run("Allows patching unmodeleted attribte", func(t *testing.T) {
+		t.Run("Fails if patching unmodeled attribute", func(t *testing.T) {
 			tearDown, s := prepareMockDB(t)
 			defer tearDown()
 
 			id := "id1"
-			_, err := s.Add(ctx, admin, id, fixture)
+			added, err := s.Add(ctx, admin, id, fixture)
 			require.NoError(t, err)
 			newAdmin := "admin2@example.com"
 			patched, err := s.Patch(ctx, newAdmin, id, map[string]any{"Z": 3})
-			require.NoError(t, err)
+			invalid := &InvalidContentError{}
+			require.ErrorAs(t, err, &invalid)
+			assert.Equal(t, "Z", invalid.Attribute)
+			assert.Nil(t, patched)
 
+			// No changes applied
 			fetched, err := s.Get(ctx, id)
 			assert.NoError(t, err)
-			assert.Equal(t, *patched, *fetched)
+			assert.Equal(t, *added, *fetched)
+		})
+
+		t.Run("Successfully patches nested attributes", func(t *testing.T) {
+			tests := []struct {
+				name       string
+				attributes map[string]any
+			}{
+				{"dotted path", map[string]any{"n.x": 3, "n.y": "nested"}},
+				{"JSON pointer", map[string]any{"/n/x": 3, "/n/y": "nested"}},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					tearDown, s := prepareMockDB(t)
+					defer tearDown()
+
+					_, err := s.Add(ctx, admin, id, fixture)
+					require.NoError(t, err)
+					patched, err := s.Patch(ctx, admin, id, tt.attributes)
+					require.NoError(t, err)
+					assert.Equal(t, &nested{X: 3, Y: "nested"}, patched.Content.N)
+					assert.Equal(t, fixture.I, patched.Content.I)
+
+					fetched, err := s.Get(ctx, id)
+					assert.NoError(t, err)
+					assert.Equal(t, *patched, *fetched)
+				})
+			}
+		})
+
+		t.Run("Fails if patching an invalid attribute path", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			patched, err := s.Patch(ctx, admin, id, map[string]any{"n..x": 3})
+			assert.ErrorIs(t, err, ErrInvalidAttribute)
+			assert.Nil(t, patched)
+		})
+
+		t.Run("Fails if patching a read-only attribute without allowing it", func(t *testing.T) {
+			type protected struct {
+				Key  string `json:"key" stored:"readonly"`
+				Name string `json:"name"`
+			}
+			db, tearDown := prepareTable(t, tableName)
+			defer tearDown()
+			s := NewStore[protected](db, tableName)
+
+			_, err := s.Add(ctx, admin, id, protected{Key: "key"})
+			require.NoError(t, err)
+			patched, err := s.Patch(ctx, admin, id, map[string]any{"key": "new key", "name": "name"})
+			assert.ErrorIs(t, err, ErrReadOnlyAttribute)
+			assert.Nil(t, patched)
+
+			// The service itself can still patch it
+			patched, err = s.Patch(ctx, admin, id, map[string]any{"key": "new key"}, AllowReadOnly())
+			require.NoError(t, err)
+			assert.Equal(t, "new key", patched.Content.Key)
 		})
 
 		t.Run("Fails if patching breaks modeled attribute", func(t *testing.T) {
@@ -153,7 +327,28 @@ func TestStore(t *testing.T) {
 			require.NoError(t, err)
 			newAdmin := "admin2@example.com"
 			patched, err := s.Patch(ctx, newAdmin, id, map[string]any{"i": "Not Int!"})
-			assert.Error(t, err)
+			assert.ErrorIs(t, err, ErrInvalidContent)
+			assert.Nil(t, patched)
+
+			// No changes applied
+			fetched, err := s.Get(ctx, id)
+			assert.NoError(t, err)
+			assert.Equal(t, *added, *fetched)
+		})
+
+		t.Run("Fails if the patched content is rejected by a validator", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithValidator(ValidatorFunc(func(c any) error {
+				if c.(content).I < 0 {
+					return errors.New("i must not be negative")
+				}
+				return nil
+			})))
+			defer tearDown()
+
+			added, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			patched, err := s.Patch(ctx, admin, id, map[string]any{"i": -1})
+			assert.ErrorIs(t, err, ErrInvalidContent)
 			assert.Nil(t, patched)
 
 			// No changes applied
@@ -164,60 +359,1221 @@ func TestStore(t *testing.T) {
 
 	})
 
-	t.Run("List", func(t *testing.T) {
-		fixtures := map[string]content{
-			"1": {I: 0, B: true, S: "a"},
-			"2": {I: 10, B: false, S: "b"},
-			"3": {I: 20, B: true, S: "c"},
-			"4": {I: 30, B: false, S: "d"},
-		}
-		tests := []struct {
-			name             string
-			cond             []Condition
-			expectedFixtures []string
-		}{
-			{"empty result", []Condition{{Attribute: "i", Op: EqualOperator, Value: -1}}, []string{}},
-			{"all results", nil, []string{"1", "2", "3", "4"}},
-			{"equal int", []Condition{{Attribute: "i", Op: EqualOperator, Value: fixtures["1"].I}}, []string{"1"}},
-			{"not equal int", []Condition{{Attribute: "i", Op: NotEqualOperator, Value: fixtures["1"].I}}, []string{"2", "3", "4"}},
-			{"greater than int", []Condition{{Attribute: "i", Op: GreaterThanOperator, Value: fixtures["2"].I}}, []string{"3", "4"}},
-			{"greater than equal int", []Condition{{Attribute: "i", Op: GreaterThanOrEqualOpertor, Value: fixtures["2"].I}}, []string{"2", "3", "4"}},
-			{"less than int", []Condition{{Attribute: "i", Op: LessThanOperator, Value: fixtures["2"].I}}, []string{"1"}},
-			{"less than equal int", []Condition{{Attribute: "i", Op: LessThanOrEqualOperator, Value: fixtures["2"].I}}, []string{"1", "2"}},
-			{"equal bool", []Condition{{Attribute: "b", Op: EqualOperator, Value: true}}, []string{"1", "3"}},
-			{"not equal bool", []Condition{{Attribute: "b", Op: NotEqualOperator, Value: true}}, []string{"2", "4"}},
-			{"equal string", []Condition{{Attribute: "s", Op: EqualOperator, Value: fixtures["1"].S}}, []string{"1"}},
-			{"not equal string", []Condition{{Attribute: "s", Op: NotEqualOperator, Value: fixtures["1"].S}}, []string{"2", "3", "4"}},
-			{"greater than string", []Condition{{Attribute: "s", Op: GreaterThanOperator, Value: fixtures["2"].S}}, []string{"3", "4"}},
-			{"greater than equal string", []Condition{{Attribute: "s", Op: GreaterThanOrEqualOpertor, Value: fixtures["2"].S}}, []string{"2", "3", "4"}},
-			{"less than string", []Condition{{Attribute: "s", Op: LessThanOperator, Value: fixtures["2"].S}}, []string{"1"}},
-			{"less than equal string", []Condition{{Attribute: "s", Op: LessThanOrEqualOperator, Value: fixtures["2"].S}}, []string{"1", "2"}},
-			{"Ands Multiple Conditions", []Condition{{Attribute: "b", Op: EqualOperator, Value: true}, {Attribute: "i", Op: GreaterThanOperator, Value: fixtures["2"].I}}, []string{"3"}},
-		}
-		for _, tt := range tests {
-			t.Run(tt.name, func(t *testing.T) {
-				tearDown, s := prepareMockDB(t)
-				defer tearDown()
+	t.Run("PatchVersion", func(t *testing.T) {
 
-				// add fixtures
-				addedFixtures := map[string]Stored[content]{}
-				for id, f := range fixtures {
-					added, err := s.Add(ctx, admin, id, f)
-					require.NoError(t, err)
-					require.NotNil(t, added)
-					addedFixtures[id] = *added
-				}
+		t.Run("Successfully patches when the version matches", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
 
-				expected := []Stored[content]{}
-				for _, i := range tt.expectedFixtures {
-					expected = append(expected, addedFixtures[i])
-				}
+			added, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			patched, err := s.PatchVersion(ctx, admin, id, added.Version, map[string]any{"i": 7})
+			require.NoError(t, err)
+			assert.Equal(t, 7, patched.Content.I)
+			assert.Equal(t, added.Version+1, patched.Version)
+		})
+
+		t.Run("Fails with a conflict when the version does not match", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			added, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			_, err = s.Patch(ctx, admin, id, map[string]any{"i": 6})
+			require.NoError(t, err)
+
+			patched, err := s.PatchVersion(ctx, admin, id, added.Version, map[string]any{"i": 7})
+			assert.Nil(t, patched)
+			conflict := &ConflictError{}
+			require.ErrorAs(t, err, &conflict)
+			assert.Equal(t, added.Version, conflict.ExpectedVersion)
+			assert.Equal(t, added.Version+1, conflict.ActualVersion)
+
+			// No changes applied
+			fetched, err := s.Get(ctx, id)
+			assert.NoError(t, err)
+			assert.Equal(t, 6, fetched.Content.I)
+		})
+
+		t.Run("Fails when the item does not exist", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			patched, err := s.PatchVersion(ctx, admin, "missing", 1, map[string]any{"i": 7})
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.Nil(t, patched)
+		})
+	})
+
+	t.Run("Put", func(t *testing.T) {
+
+		t.Run("Replaces the content keeping the created audit fields", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			added, err := s.Add(ctx, admin, id, content{I: 5, N: &nested{X: 1}})
+			require.NoError(t, err)
+
+			updater := "admin2@example.com"
+			put, err := s.Put(ctx, updater, id, fixture)
+			require.NoError(t, err)
+			assert.Equal(t, fixture, put.Content)
+			assert.Equal(t, added.CreatedAt, put.CreatedAt)
+			assert.Equal(t, admin, put.CreatedBy)
+			assert.Equal(t, updater, put.ModifiedBy)
+			assert.Equal(t, int64(2), put.Version)
+
+			fetched, err := s.Get(ctx, id)
+			require.NoError(t, err)
+			assert.Equal(t, *put, *fetched)
+		})
+
+		t.Run("Fails when the item doesn't exist", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			_, err := s.Put(ctx, admin, id, fixture)
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+
+		t.Run("Fails when the version doesn't match", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+
+			_, err = s.PutVersion(ctx, admin, id, 2, content{I: 1})
+			conflict := &ConflictError{}
+			require.ErrorAs(t, err, &conflict)
+			assert.Equal(t, int64(1), conflict.ActualVersion)
+		})
+	})
+
+	t.Run("Upsert", func(t *testing.T) {
+
+		t.Run("Adds then replaces the item", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithHistory())
+			defer tearDown()
+
+			added, err := s.Upsert(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), added.Version)
+
+			updater := "admin2@example.com"
+			replaced, err := s.Upsert(ctx, updater, id, content{I: 1})
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), replaced.Version)
+			assert.Equal(t, content{I: 1}, replaced.Content)
+			assert.Equal(t, admin, replaced.CreatedBy)
+			assert.Equal(t, updater, replaced.ModifiedBy)
+
+			revisions, err := s.History(ctx, id)
+			require.NoError(t, err)
+			require.Len(t, revisions, 2)
+			assert.Equal(t, AddOperation, revisions[0].Operation)
+			assert.Equal(t, PutOperation, revisions[1].Operation)
+		})
+
+		t.Run("Restores a soft-deleted item", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithSoftDelete())
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			require.NoError(t, s.Delete(ctx, admin, id))
+
+			upserted, err := s.Upsert(ctx, admin, id, content{I: 1})
+			require.NoError(t, err)
+			assert.Nil(t, upserted.DeletedAt)
+
+			fetched, err := s.Get(ctx, id)
+			require.NoError(t, err)
+			assert.Equal(t, content{I: 1}, fetched.Content)
+		})
+	})
 
-				result, err := s.List(ctx, tt.cond...)
+	t.Run("AddMany", func(t *testing.T) {
+		items := []Stored[content]{{ID: "id1", Content: fixture}, {ID: "id2", Content: content{I: 7}}}
+
+		t.Run("Adds all items", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithHistory())
+			defer tearDown()
+
+			results, err := s.AddMany(ctx, admin, items, AllOrNothing)
+			require.NoError(t, err)
+			require.Len(t, results, 2)
+			for i, r := range results {
+				require.NoError(t, r.Err)
+				assert.Equal(t, items[i].ID, r.Item.ID)
+				assert.Equal(t, int64(1), r.Item.Version)
+
+				fetched, err := s.Get(ctx, items[i].ID)
 				require.NoError(t, err)
-				assert.ElementsMatch(t, expected, result)
+				assert.Equal(t, *r.Item, *fetched)
+			}
 
-			})
-		}
+			revisions, err := s.History(ctx, "id2")
+			require.NoError(t, err)
+			assert.Len(t, revisions, 1)
+		})
+
+		t.Run("Adds nothing if any item fails in AllOrNothing mode", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, "id2", fixture)
+			require.NoError(t, err)
+
+			results, err := s.AddMany(ctx, admin, items, AllOrNothing)
+			assert.Error(t, err)
+			assert.Nil(t, results)
+
+			_, err = s.Get(ctx, "id1")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+
+		t.Run("Reports failing items in PerItem mode", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, "id2", fixture)
+			require.NoError(t, err)
+
+			results, err := s.AddMany(ctx, admin, items, PerItem)
+			require.NoError(t, err)
+			require.Len(t, results, 2)
+			assert.NoError(t, results[0].Err)
+			assert.Error(t, results[1].Err)
+			assert.Nil(t, results[1].Item)
+
+			_, err = s.Get(ctx, "id1")
+			assert.NoError(t, err)
+		})
+
+		t.Run("Rejects duplicate ids in AllOrNothing mode", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			duplicated := append(items, Stored[content]{ID: "id1", Content: fixture})
+			_, err := s.AddMany(ctx, admin, duplicated, AllOrNothing)
+			assert.ErrorIs(t, err, ErrAlreadyExists)
+			batchErr := &BatchItemError{}
+			require.ErrorAs(t, err, &batchErr)
+			assert.Equal(t, 2, batchErr.Index)
+
+			_, err = s.Get(ctx, "id1")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+
+		t.Run("Reports soft-deleted ids in PerItem mode", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithSoftDelete())
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, "id2", fixture)
+			require.NoError(t, err)
+			require.NoError(t, s.Delete(ctx, admin, "id2"))
+
+			results, err := s.AddMany(ctx, admin, items, PerItem)
+			require.NoError(t, err)
+			require.Len(t, results, 2)
+			assert.NoError(t, results[0].Err)
+			assert.ErrorIs(t, results[1].Err, ErrDeleted)
+		})
+	})
+
+	t.Run("PatchMany", func(t *testing.T) {
+
+		t.Run("Patches nothing if any patch fails in AllOrNothing mode", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+
+			patches := []ItemPatch{{ID: id, Attributes: map[string]any{"i": 6}}, {ID: "missing", Attributes: map[string]any{"i": 6}}}
+			results, err := s.PatchMany(ctx, admin, patches, AllOrNothing)
+			assert.ErrorIs(t, err, ErrNotFound)
+			batchErr := &BatchItemError{}
+			require.ErrorAs(t, err, &batchErr)
+			assert.Equal(t, 1, batchErr.Index)
+			assert.Nil(t, results)
+
+			fetched, err := s.Get(ctx, id)
+			require.NoError(t, err)
+			assert.Equal(t, fixture, fetched.Content)
+		})
+
+		t.Run("Reports failing patches in PerItem mode", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+
+			patches := []ItemPatch{{ID: id, Version: 5, Attributes: map[string]any{"i": 6}}, {ID: id, Version: 1, Attributes: map[string]any{"i": 7}}}
+			results, err := s.PatchMany(ctx, admin, patches, PerItem)
+			require.NoError(t, err)
+			require.Len(t, results, 2)
+			conflict := &ConflictError{}
+			assert.ErrorAs(t, results[0].Err, &conflict)
+			require.NoError(t, results[1].Err)
+			assert.Equal(t, 7, results[1].Item.Content.I)
+		})
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+
+		t.Run("Removes the stored item", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			require.NoError(t, s.Delete(ctx, admin, id))
+
+			fetched, err := s.Get(ctx, id, IncludeDeleted())
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.Nil(t, fetched)
+		})
+
+		t.Run("Fails when the item does not exist", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			assert.ErrorIs(t, s.Delete(ctx, admin, "missing"), ErrNotFound)
+		})
+
+		t.Run("Hides soft-deleted items unless asked to include them", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithSoftDelete())
+			defer tearDown()
+
+			added, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			deleter := "admin2@example.com"
+			require.NoError(t, s.Delete(ctx, deleter, id))
+
+			_, err = s.Get(ctx, id)
+			assert.ErrorIs(t, err, ErrNotFound)
+			listed, err := s.List(ctx)
+			require.NoError(t, err)
+			assert.Empty(t, listed)
+			_, err = s.Patch(ctx, admin, id, map[string]any{"i": 1})
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, s.Delete(ctx, deleter, id), ErrNotFound)
+
+			fetched, err := s.Get(ctx, id, IncludeDeleted())
+			require.NoError(t, err)
+			require.NotNil(t, fetched.DeletedAt)
+			assert.Equal(t, deleter, fetched.DeletedBy)
+			assert.Equal(t, added.Version+1, fetched.Version)
+			listed, err = s.List(ctx, IncludeDeleted())
+			require.NoError(t, err)
+			assert.Equal(t, []Stored[content]{*fetched}, listed)
+		})
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+
+		t.Run("Brings back a soft-deleted item", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithSoftDelete())
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			require.NoError(t, s.Delete(ctx, admin, id))
+
+			restorer := "admin2@example.com"
+			restored, err := s.Restore(ctx, restorer, id)
+			require.NoError(t, err)
+			assert.Nil(t, restored.DeletedAt)
+			assert.Empty(t, restored.DeletedBy)
+			assert.Equal(t, restorer, restored.ModifiedBy)
+			assert.Equal(t, fixture, restored.Content)
+
+			fetched, err := s.Get(ctx, id)
+			require.NoError(t, err)
+			assert.Equal(t, *restored, *fetched)
+		})
+
+		t.Run("Is required to add the id of a soft-deleted item again", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithSoftDelete())
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			require.NoError(t, s.Delete(ctx, admin, id))
+
+			added, err := s.Add(ctx, admin, id, fixture)
+			assert.ErrorIs(t, err, ErrDeleted)
+			assert.ErrorIs(t, err, ErrAlreadyExists)
+			assert.Nil(t, added)
+
+			_, err = s.Restore(ctx, admin, id)
+			require.NoError(t, err)
+			_, err = s.Add(ctx, admin, id, fixture)
+			assert.ErrorIs(t, err, ErrAlreadyExists)
+			assert.NotErrorIs(t, err, ErrDeleted)
+		})
+
+		t.Run("Fails when the item is not deleted", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithSoftDelete())
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			restored, err := s.Restore(ctx, admin, id)
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.Nil(t, restored)
+		})
+
+		t.Run("Fails when soft-delete is disabled", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			restored, err := s.Restore(ctx, admin, id)
+			assert.ErrorIs(t, err, ErrSoftDeleteDisabled)
+			assert.Nil(t, restored)
+		})
+	})
+
+	t.Run("History", func(t *testing.T) {
+
+		t.Run("Records a revision for every write", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithSoftDelete(), WithHistory())
+			defer tearDown()
+
+			updater := "admin2@example.com"
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			patched, err := s.Patch(ctx, updater, id, map[string]any{"i": 6})
+			require.NoError(t, err)
+			require.NoError(t, s.Delete(ctx, admin, id))
+			_, err = s.Restore(ctx, updater, id)
+			require.NoError(t, err)
+
+			revisions, err := s.History(ctx, id)
+			require.NoError(t, err)
+			require.Len(t, revisions, 4)
+
+			assert.Equal(t, AddOperation, revisions[0].Operation)
+			assert.Equal(t, int64(1), revisions[0].Version)
+			assert.Equal(t, fixture, revisions[0].Content)
+			assert.Equal(t, map[string]any{"i": float64(5), "b": true, "s": "Some Text"}, revisions[0].Diff)
+			assert.Equal(t, admin, revisions[0].Actor)
+
+			assert.Equal(t, PatchOperation, revisions[1].Operation)
+			assert.Equal(t, patched.Version, revisions[1].Version)
+			assert.Equal(t, patched.Content, revisions[1].Content)
+			assert.Equal(t, map[string]any{"i": float64(6)}, revisions[1].Diff)
+			assert.Equal(t, updater, revisions[1].Actor)
+			assert.Equal(t, patched.ModifiedAt, revisions[1].At)
+
+			assert.Equal(t, DeleteOperation, revisions[2].Operation)
+			assert.Equal(t, RestoreOperation, revisions[3].Operation)
+			assert.Equal(t, int64(4), revisions[3].Version)
+		})
+
+		t.Run("Keeps the history of hard-deleted items", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithHistory())
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			require.NoError(t, s.Delete(ctx, admin, id))
+
+			revisions, err := s.History(ctx, id)
+			require.NoError(t, err)
+			require.Len(t, revisions, 2)
+			assert.Equal(t, DeleteOperation, revisions[1].Operation)
+			assert.Equal(t, fixture, revisions[1].Content)
+		})
+
+		t.Run("Doesn't record failed writes", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithHistory())
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			_, err = s.PatchVersion(ctx, admin, id, 5, map[string]any{"i": 6})
+			require.Error(t, err)
+
+			revisions, err := s.History(ctx, id)
+			require.NoError(t, err)
+			assert.Len(t, revisions, 1)
+		})
+
+		t.Run("Gets an item at a version or time", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithHistory())
+			defer tearDown()
+
+			added, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			_, err = s.Patch(ctx, admin, id, map[string]any{"i": 6})
+			require.NoError(t, err)
+
+			atVersion, err := s.GetAt(ctx, id, AtVersion(1))
+			require.NoError(t, err)
+			assert.Equal(t, fixture, atVersion.Content)
+
+			atTime, err := s.GetAt(ctx, id, AtTime(added.ModifiedAt))
+			require.NoError(t, err)
+			assert.Equal(t, fixture, atTime.Content)
+
+			_, err = s.GetAt(ctx, id, AtVersion(3))
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			_, err = s.GetAt(ctx, id, AtTime(added.CreatedAt.Add(-time.Second)))
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+
+		t.Run("Fails when history is disabled", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			_, err := s.History(ctx, id)
+			assert.ErrorIs(t, err, ErrHistoryDisabled)
+			_, err = s.GetAt(ctx, id, AtVersion(1))
+			assert.ErrorIs(t, err, ErrHistoryDisabled)
+		})
+	})
+
+	receive := func(t *testing.T, changes <-chan Change[content]) Change[content] {
+		select {
+		case c, ok := <-changes:
+			require.True(t, ok)
+			return c
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no change was delivered")
+			return Change[content]{}
+		}
+	}
+
+	t.Run("Watch", func(t *testing.T) {
+
+		t.Run("Delivers the changes of matching items", func(t *testing.T) {
+			if newListener == nil {
+				t.Skip("the DB has no listener")
+			}
+			tearDown, s := prepareMockDB(t, WithListener(newListener(t)))
+			defer tearDown()
+
+			watchCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			changes, err := s.Watch(watchCtx, Condition{Attribute: "b", Op: EqualOperator, Value: true})
+			require.NoError(t, err)
+
+			_, err = s.Add(ctx, admin, "other", content{B: false})
+			require.NoError(t, err)
+			added, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			patched, err := s.Patch(ctx, admin, id, map[string]any{"i": 6})
+			require.NoError(t, err)
+			require.NoError(t, s.Delete(ctx, admin, id))
+
+			c := receive(t, changes)
+			assert.Equal(t, AddOperation, c.Operation)
+			assert.Equal(t, id, c.ID)
+			assert.Equal(t, added.Content, c.Item.Content)
+
+			c = receive(t, changes)
+			assert.Equal(t, PatchOperation, c.Operation)
+			assert.Equal(t, patched.Version, c.Version)
+			assert.Equal(t, patched.Content, c.Item.Content)
+
+			c = receive(t, changes)
+			assert.Equal(t, DeleteOperation, c.Operation)
+			assert.Equal(t, id, c.ID)
+			assert.Nil(t, c.Item)
+		})
+
+		t.Run("Catches up the changes since a time", func(t *testing.T) {
+			if newListener == nil {
+				t.Skip("the DB has no listener")
+			}
+			tearDown, s := prepareMockDB(t, WithSoftDelete(), WithListener(newListener(t)))
+			defer tearDown()
+
+			added, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			require.NoError(t, s.Delete(ctx, admin, id))
+
+			watchCtx, cancel := context.WithCancel(WatchSince(ctx, added.CreatedAt))
+			defer cancel()
+			changes, err := s.Watch(watchCtx)
+			require.NoError(t, err)
+
+			c := receive(t, changes)
+			assert.Equal(t, DeleteOperation, c.Operation)
+			assert.Equal(t, id, c.ID)
+			assert.NotNil(t, c.Item.DeletedAt)
+		})
+
+		t.Run("Fails without a listener", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			_, err := s.Watch(ctx)
+			assert.ErrorIs(t, err, ErrWatchDisabled)
+		})
+
+		t.Run("Fails on invalid conditions", func(t *testing.T) {
+			if newListener == nil {
+				t.Skip("the DB has no listener")
+			}
+			tearDown, s := prepareMockDB(t, WithListener(newListener(t)))
+			defer tearDown()
+
+			_, err := s.Watch(ctx, Condition{Attribute: "i", Op: "~"})
+			assert.ErrorIs(t, err, ErrInvalidCondition)
+		})
+	})
+
+	t.Run("List", func(t *testing.T) {
+		fixtures := map[string]content{
+			"1": {I: 0, B: true, S: "a", N: &nested{X: 1, Y: "x"}, L: []string{"red", "blue"}},
+			"2": {I: 10, B: false, S: "b", N: &nested{X: 2, Y: "y"}, L: []string{"blue"}},
+			"3": {I: 20, B: true, S: "c"},
+			"4": {I: 30, B: false, S: "d"},
+		}
+		tests := []struct {
+			name             string
+			cond             []Condition
+			expectedFixtures []string
+		}{
+			{"empty result", []Condition{{Attribute: "i", Op: EqualOperator, Value: -1}}, []string{}},
+			{"all results", nil, []string{"1", "2", "3", "4"}},
+			{"equal int", []Condition{{Attribute: "i", Op: EqualOperator, Value: fixtures["1"].I}}, []string{"1"}},
+			{"not equal int", []Condition{{Attribute: "i", Op: NotEqualOperator, Value: fixtures["1"].I}}, []string{"2", "3", "4"}},
+			{"greater than int", []Condition{{Attribute: "i", Op: GreaterThanOperator, Value: fixtures["2"].I}}, []string{"3", "4"}},
+			{"greater than equal int", []Condition{{Attribute: "i", Op: GreaterThanOrEqualOpertor, Value: fixtures["2"].I}}, []string{"2", "3", "4"}},
+			{"less than int", []Condition{{Attribute: "i", Op: LessThanOperator, Value: fixtures["2"].I}}, []string{"1"}},
+			{"less than equal int", []Condition{{Attribute: "i", Op: LessThanOrEqualOperator, Value: fixtures["2"].I}}, []string{"1", "2"}},
+			{"equal bool", []Condition{{Attribute: "b", Op: EqualOperator, Value: true}}, []string{"1", "3"}},
+			{"not equal bool", []Condition{{Attribute: "b", Op: NotEqualOperator, Value: true}}, []string{"2", "4"}},
+			{"equal string", []Condition{{Attribute: "s", Op: EqualOperator, Value: fixtures["1"].S}}, []string{"1"}},
+			{"not equal string", []Condition{{Attribute: "s", Op: NotEqualOperator, Value: fixtures["1"].S}}, []string{"2", "3", "4"}},
+			{"greater than string", []Condition{{Attribute: "s", Op: GreaterThanOperator, Value: fixtures["2"].S}}, []string{"3", "4"}},
+			{"greater than equal string", []Condition{{Attribute: "s", Op: GreaterThanOrEqualOpertor, Value: fixtures["2"].S}}, []string{"2", "3", "4"}},
+			{"less than string", []Condition{{Attribute: "s", Op: LessThanOperator, Value: fixtures["2"].S}}, []string{"1"}},
+			{"less than equal string", []Condition{{Attribute: "s", Op: LessThanOrEqualOperator, Value: fixtures["2"].S}}, []string{"1", "2"}},
+			{"equal nested", []Condition{{Attribute: "n.y", Op: EqualOperator, Value: "y"}}, []string{"2"}},
+			{"greater than nested JSON pointer", []Condition{{Attribute: "/n/x", Op: GreaterThanOperator, Value: 1}}, []string{"2"}},
+			{"in int", []Condition{{Attribute: "i", Op: InOperator, Value: []int{0, 20}}}, []string{"1", "3"}},
+			{"in string", []Condition{{Attribute: "s", Op: InOperator, Value: []string{"b", "d"}}}, []string{"2", "4"}},
+			{"in nested", []Condition{{Attribute: "n.x", Op: InOperator, Value: []int{2, 3}}}, []string{"2"}},
+			{"not in int", []Condition{{Attribute: "i", Op: NotInOperator, Value: []int{0, 20}}}, []string{"2", "4"}},
+			{"in object", []Condition{{Attribute: "n", Op: InOperator, Value: []nested{{X: 1, Y: "x"}}}}, []string{"1"}},
+			{"in object is not containment", []Condition{{Attribute: "n", Op: InOperator, Value: []any{map[string]any{"x": 1}}}}, []string{}},
+			{"in array is not containment", []Condition{{Attribute: "l", Op: InOperator, Value: []any{[]string{"blue"}}}}, []string{"2"}},
+			{"not in object skips missing attributes", []Condition{{Attribute: "n", Op: NotInOperator, Value: []nested{{X: 1, Y: "x"}}}}, []string{"2"}},
+			{"not in skips missing attributes", []Condition{{Attribute: "n.x", Op: NotInOperator, Value: []int{1}}}, []string{"2"}},
+			{"contains", []Condition{{Attribute: "l", Op: ContainsOperator, Value: []string{"blue"}}}, []string{"1", "2"}},
+			{"contains all", []Condition{{Attribute: "l", Op: ContainsOperator, Value: []string{"red", "blue"}}}, []string{"1"}},
+			{"exists", []Condition{{Attribute: "n", Op: ExistsOperator}}, []string{"1", "2"}},
+			{"exists nested", []Condition{{Attribute: "n.x", Op: ExistsOperator}}, []string{"1", "2"}},
+			{"is null", []Condition{{Attribute: "n", Op: IsNullOperator}}, []string{"3", "4"}},
+			{"is not null", []Condition{{Attribute: "n", Op: IsNotNullOperator}}, []string{"1", "2"}},
+			{"like", []Condition{{Attribute: "s", Op: LikeOperator, Value: "a%"}}, []string{"1"}},
+			{"like is case sensitive", []Condition{{Attribute: "s", Op: LikeOperator, Value: "A%"}}, []string{}},
+			{"ilike", []Condition{{Attribute: "s", Op: ILikeOperator, Value: "A%"}}, []string{"1"}},
+			{"like nested", []Condition{{Attribute: "n.y", Op: LikeOperator, Value: "%y"}}, []string{"2"}},
+			{"between", []Condition{{Attribute: "i", Op: BetweenOperator, Value: []int{10, 20}}}, []string{"2", "3"}},
+			{"or", []Condition{Or(Condition{Attribute: "i", Op: EqualOperator, Value: 0}, Condition{Attribute: "s", Op: EqualOperator, Value: "d"})}, []string{"1", "4"}},
+			{"not", []Condition{Not(Condition{Attribute: "b", Op: EqualOperator, Value: true})}, []string{"2", "4"}},
+			{"nested and in or", []Condition{Or(
+				And(Condition{Attribute: "b", Op: EqualOperator, Value: true}, Condition{Attribute: "i", Op: GreaterThanOperator, Value: 0}),
+				Condition{Attribute: "i", Op: EqualOperator, Value: 10},
+			)}, []string{"2", "3"}},
+			{"column", []Condition{{Column: IDColumn, Op: InOperator, Value: []string{"1", "3"}}}, []string{"1", "3"}},
+			{"column or attribute", []Condition{Or(Condition{Column: CreatedByColumn, Op: NotEqualOperator, Value: admin}, Condition{Attribute: "i", Op: EqualOperator, Value: 30})}, []string{"4"}},
+			{"Ands Multiple Conditions", []Condition{{Attribute: "b", Op: EqualOperator, Value: true}, {Attribute: "i", Op: GreaterThanOperator, Value: fixtures["2"].I}}, []string{"3"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				tearDown, s := prepareMockDB(t)
+				defer tearDown()
+
+				// add fixtures
+				addedFixtures := map[string]Stored[content]{}
+				for id, f := range fixtures {
+					added, err := s.Add(ctx, admin, id, f)
+					require.NoError(t, err)
+					require.NotNil(t, added)
+					addedFixtures[id] = *added
+				}
+
+				expected := []Stored[content]{}
+				for _, i := range tt.expectedFixtures {
+					expected = append(expected, addedFixtures[i])
+				}
+
+				result, err := s.List(ctx, Where(tt.cond...))
+				require.NoError(t, err)
+				assert.ElementsMatch(t, expected, result)
+
+			})
+		}
+	})
+
+	t.Run("List fails on invalid conditions", func(t *testing.T) {
+		tearDown, s := prepareMockDB(t)
+		defer tearDown()
+
+		result, err := s.List(ctx, Condition{Attribute: "i", Op: InOperator, Value: 1})
+		assert.ErrorIs(t, err, ErrInvalidCondition)
+		assert.Nil(t, result)
+
+		result, err = s.List(ctx, Condition{Attribute: "i'] IS NOT NULL OR content['i", Op: EqualOperator, Value: 1})
+		assert.ErrorIs(t, err, ErrInvalidAttribute)
+		assert.Nil(t, result)
+	})
+
+	t.Run("Iter", func(t *testing.T) {
+		tearDown, s := prepareMockDB(t)
+		defer tearDown()
+
+		for i, id := range []string{"1", "2", "3"} {
+			_, err := s.Add(ctx, admin, id, content{I: i})
+			require.NoError(t, err)
+		}
+
+		t.Run("Streams the matching items", func(t *testing.T) {
+			ids := []string{}
+			for item, err := range s.Iter(ctx, Condition{Attribute: "i", Op: GreaterThanOperator, Value: 0}) {
+				require.NoError(t, err)
+				ids = append(ids, item.ID)
+			}
+			assert.ElementsMatch(t, []string{"2", "3"}, ids)
+		})
+
+		t.Run("Stops when the loop breaks", func(t *testing.T) {
+			count := 0
+			for _, err := range s.Iter(ctx) {
+				require.NoError(t, err)
+				count++
+				break
+			}
+			assert.Equal(t, 1, count)
+
+			// The connection of the stopped iteration is released
+			listed, err := s.List(ctx)
+			require.NoError(t, err)
+			assert.Len(t, listed, 3)
+		})
+
+		t.Run("Fails when the context is canceled", func(t *testing.T) {
+			canceled, cancel := context.WithCancel(ctx)
+			defer cancel()
+			var last error
+			for _, err := range s.Iter(canceled) {
+				cancel()
+				last = err
+			}
+			assert.ErrorIs(t, last, context.Canceled)
+		})
+
+		t.Run("Fails on invalid conditions", func(t *testing.T) {
+			errs := []error{}
+			for _, err := range s.Iter(ctx, Condition{Attribute: "i", Op: InOperator, Value: 1}) {
+				errs = append(errs, err)
+			}
+			require.Len(t, errs, 1)
+			assert.ErrorIs(t, errs[0], ErrInvalidCondition)
+		})
+	})
+
+	t.Run("Project", func(t *testing.T) {
+		tearDown, s := prepareMockDB(t)
+		defer tearDown()
+
+		added, err := s.Add(ctx, admin, id, content{I: 5, B: true, S: "text", N: &nested{X: 1, Y: "y"}})
+		require.NoError(t, err)
+		fields := []string{"i", "n.x"}
+		expected := content{I: 5, N: &nested{X: 1}}
+
+		fetched, err := s.Get(ctx, id, Fields(fields...))
+		require.NoError(t, err)
+		assert.Equal(t, expected, fetched.Content)
+		assert.Equal(t, added.Version, fetched.Version)
+
+		page, err := s.ListPage(ctx, ListOptions{Sort: Sort{Attribute: "s"}}, Fields(fields...), Condition{Attribute: "s", Op: EqualOperator, Value: "text"})
+		require.NoError(t, err)
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, expected, page.Items[0].Content)
+
+		listed, err := s.List(ctx)
+		require.NoError(t, err)
+		require.Len(t, listed, 1)
+		assert.Equal(t, "text", listed[0].Content.S, "reads without fields read the whole content")
+
+		fetched, err = s.Get(ctx, id, Fields(fields...), Condition{Attribute: "s", Op: EqualOperator, Value: "text"})
+		require.NoError(t, err)
+		assert.Equal(t, expected, fetched.Content)
+		_, err = s.Get(ctx, id, Condition{Attribute: "s", Op: EqualOperator, Value: "other"})
+		assert.ErrorIs(t, err, ErrNotFound, "items that don't fill the conditions are not found")
+
+		_, err = s.Get(ctx, id, Fields("z"))
+		assert.ErrorIs(t, err, ErrInvalidAttribute)
+		_, err = s.ListPage(ctx, ListOptions{}, Fields("z"))
+		assert.ErrorIs(t, err, ErrInvalidAttribute)
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		tearDown, s := prepareMockDB(t, WithSearch())
+		defer tearDown()
+
+		for id, c := range map[string]content{
+			"1": {I: 1, S: "payroll"},
+			"2": {I: 2, S: "payments and payroll"},
+			"3": {I: 3, S: "invoices"},
+			"4": {I: 4, S: "Payroll archive"},
+		} {
+			_, err := s.Add(ctx, admin, id, c)
+			require.NoError(t, err)
+		}
+		ids := func(items []Stored[content]) []string {
+			result := []string{}
+			for _, item := range items {
+				result = append(result, item.ID)
+			}
+			return result
+		}
+
+		found, err := s.Search(ctx, "pay", 0)
+		require.NoError(t, err)
+		// The item that matches twice ranks first, and ties are ordered by id
+		assert.Equal(t, []string{"2", "1", "4"}, ids(found))
+
+		found, err = s.Search(ctx, "pay", 2)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2", "1"}, ids(found), "only the best matches up to the limit are returned")
+
+		found, err = s.Search(ctx, "PAYROLL arch", 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"4"}, ids(found))
+
+		found, err = s.Search(ctx, "pay", 0, Condition{Attribute: "i", Op: GreaterThanOperator, Value: 1})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2", "4"}, ids(found))
+
+		found, err = s.Search(ctx, "' & |", 0)
+		require.NoError(t, err)
+		assert.Empty(t, found)
+
+		require.NoError(t, s.Delete(ctx, admin, "2"))
+		found, err = s.Search(ctx, "pay", 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1", "4"}, ids(found))
+	})
+
+	t.Run("Search disabled", func(t *testing.T) {
+		tearDown, s := prepareMockDB(t)
+		defer tearDown()
+
+		_, err := s.Search(ctx, "pay", 0)
+		assert.ErrorIs(t, err, ErrSearchDisabled)
+	})
+
+	t.Run("ListPage", func(t *testing.T) {
+		fixtures := map[string]content{
+			"1": {I: 30, B: true, S: "a"},
+			"2": {I: 10, B: false, S: "b"},
+			"3": {I: 20, B: true, S: "c"},
+			"4": {I: 10, B: false, S: "d"},
+			"5": {I: 0, B: true, S: "e"},
+		}
+		addFixtures := func(t *testing.T, s Store[content]) {
+			for _, id := range []string{"1", "2", "3", "4", "5"} {
+				_, err := s.Add(ctx, admin, id, fixtures[id])
+				require.NoError(t, err)
+			}
+		}
+		listAll := func(t *testing.T, s Store[content], opts ListOptions, conds ...Condition) []string {
+			ids := []string{}
+			for {
+				page, err := s.ListPage(ctx, opts, Where(conds...))
+				require.NoError(t, err)
+				require.LessOrEqual(t, len(page.Items), opts.Limit)
+				for _, item := range page.Items {
+					ids = append(ids, item.ID)
+				}
+				if page.NextCursor == "" {
+					return ids
+				}
+				opts.Cursor = page.NextCursor
+			}
+		}
+
+		tests := []struct {
+			name        string
+			sort        Sort
+			cond        []Condition
+			expectedIDs []string
+		}{
+			{"by id", Sort{}, nil, []string{"1", "2", "3", "4", "5"}},
+			{"by id descending", Sort{Column: IDColumn, Descending: true}, nil, []string{"5", "4", "3", "2", "1"}},
+			{"by created at", Sort{Column: CreatedAtColumn}, nil, []string{"1", "2", "3", "4", "5"}},
+			{"by attribute", Sort{Attribute: "i"}, nil, []string{"5", "2", "4", "3", "1"}},
+			{"by attribute descending", Sort{Attribute: "i", Descending: true}, nil, []string{"1", "3", "4", "2", "5"}},
+			{"by missing attribute", Sort{Attribute: "n.x"}, nil, []string{"1", "2", "3", "4", "5"}},
+			{"with conditions", Sort{Attribute: "s", Descending: true}, []Condition{{Attribute: "b", Op: EqualOperator, Value: true}}, []string{"5", "3", "1"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				tearDown, s := prepareMockDB(t)
+				defer tearDown()
+				addFixtures(t, s)
+
+				ids := listAll(t, s, ListOptions{Limit: 2, Sort: tt.sort}, tt.cond...)
+				assert.Equal(t, tt.expectedIDs, ids)
+			})
+		}
+
+		t.Run("Returns a single page when the limit is not reached", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+			addFixtures(t, s)
+
+			page, err := s.ListPage(ctx, ListOptions{})
+			require.NoError(t, err)
+			assert.Len(t, page.Items, len(fixtures))
+			assert.Empty(t, page.NextCursor)
+		})
+
+		t.Run("Fails when", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+			addFixtures(t, s)
+
+			page, err := s.ListPage(ctx, ListOptions{Limit: 2})
+			require.NoError(t, err)
+			require.NotEmpty(t, page.NextCursor)
+
+			_, err = s.ListPage(ctx, ListOptions{Cursor: "not a cursor"})
+			assert.ErrorIs(t, err, ErrInvalidCursor, "the cursor is invalid")
+			_, err = s.ListPage(ctx, ListOptions{Cursor: page.NextCursor, Sort: Sort{Attribute: "i"}})
+			assert.ErrorIs(t, err, ErrInvalidCursor, "the cursor belongs to a different sort")
+			_, err = s.ListPage(ctx, ListOptions{Sort: Sort{Column: "content"}})
+			assert.ErrorIs(t, err, ErrInvalidSort, "the sort column is unknown")
+			_, err = s.ListPage(ctx, ListOptions{Sort: Sort{Attribute: "z"}})
+			assert.ErrorIs(t, err, ErrInvalidAttribute, "the sort attribute is unknown")
+		})
+	})
+
+	t.Run("Count and Aggregate", func(t *testing.T) {
+		fixtures := map[string]content{
+			"1": {I: 30, B: true},
+			"2": {I: 10, B: false},
+			"3": {I: 20, B: true},
+			"4": {I: 5, B: false},
+		}
+		prepareFixtures := func(t *testing.T) (func(), Store[content]) {
+			tearDown, s := prepareMockDB(t, WithSoftDelete())
+			for _, id := range []string{"1", "2", "3"} {
+				_, err := s.Add(ctx, admin, id, fixtures[id])
+				require.NoError(t, err)
+			}
+			_, err := s.Add(ctx, "other@example.com", "4", fixtures["4"])
+			require.NoError(t, err)
+			require.NoError(t, s.Delete(ctx, admin, "3"))
+			return tearDown, s
+		}
+
+		t.Run("Counts the items that fill the conditions", func(t *testing.T) {
+			tearDown, s := prepareFixtures(t)
+			defer tearDown()
+
+			count, err := s.Count(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), count)
+
+			count, err = s.Count(ctx, Condition{Attribute: "b", Op: EqualOperator, Value: true})
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), count)
+
+			count, err = s.Count(ctx, IncludeDeleted(), Condition{Attribute: "b", Op: EqualOperator, Value: true})
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), count)
+		})
+
+		t.Run("Aggregates groups", func(t *testing.T) {
+			tearDown, s := prepareFixtures(t)
+			defer tearDown()
+
+			groups, err := s.Aggregate(ctx, Aggregation{GroupBy: []GroupBy{{Column: CreatedByColumn}, {Attribute: "b"}}})
+			require.NoError(t, err)
+			assert.Equal(t, []Group{
+				{Keys: []any{admin, false}, Value: int64(1)},
+				{Keys: []any{admin, true}, Value: int64(1)},
+				{Keys: []any{"other@example.com", false}, Value: int64(1)},
+			}, groups)
+
+			groups, err = s.Aggregate(ctx, Aggregation{Function: MaxFunction, Attribute: "i", GroupBy: []GroupBy{{Attribute: "b"}}})
+			require.NoError(t, err)
+			assert.Equal(t, []Group{{Keys: []any{false}, Value: float64(10)}, {Keys: []any{true}, Value: float64(30)}}, groups)
+
+			groups, err = s.Aggregate(ctx, Aggregation{Function: MinFunction, Column: CreatedAtColumn})
+			require.NoError(t, err)
+			require.Len(t, groups, 1)
+			assert.IsType(t, time.Time{}, groups[0].Value)
+		})
+
+		t.Run("Buckets time columns", func(t *testing.T) {
+			tearDown, s := prepareFixtures(t)
+			defer tearDown()
+
+			groups, err := s.Aggregate(ctx, Aggregation{GroupBy: []GroupBy{{Column: CreatedAtColumn, Bucket: WeekBucket}}})
+			require.NoError(t, err)
+			require.Len(t, groups, 1)
+			assert.Equal(t, int64(3), groups[0].Value)
+			week := groups[0].Keys[0].(time.Time)
+			assert.Equal(t, time.Monday, week.Weekday())
+		})
+
+		t.Run("Fails when", func(t *testing.T) {
+			tests := []struct {
+				name string
+				agg  Aggregation
+				err  error
+			}{
+				{"unknown function", Aggregation{Function: "sum"}, ErrInvalidAggregation},
+				{"min without column", Aggregation{Function: MinFunction}, ErrInvalidAggregation},
+				{"count with column", Aggregation{Column: CreatedAtColumn}, ErrInvalidAggregation},
+				{"unknown column", Aggregation{GroupBy: []GroupBy{{Column: "content"}}}, ErrInvalidAggregation},
+				{"unknown bucket", Aggregation{GroupBy: []GroupBy{{Column: CreatedAtColumn, Bucket: "decade"}}}, ErrInvalidAggregation},
+				{"bucketed non-time column", Aggregation{GroupBy: []GroupBy{{Column: CreatedByColumn, Bucket: DayBucket}}}, ErrInvalidAggregation},
+				{"bucketed attribute", Aggregation{GroupBy: []GroupBy{{Attribute: "i", Bucket: DayBucket}}}, ErrInvalidAggregation},
+				{"unknown attribute", Aggregation{GroupBy: []GroupBy{{Attribute: "z"}}}, ErrInvalidAttribute},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					tearDown, s := prepareMockDB(t)
+					defer tearDown()
+
+					groups, err := s.Aggregate(ctx, tt.agg)
+					assert.ErrorIs(t, err, tt.err)
+					assert.Nil(t, groups)
+				})
+			}
+		})
+	})
+	t.Run("Tenancy", func(t *testing.T) {
+		tenantA := ForTenant(ctx, "a")
+		tenantB := ForTenant(ctx, "b")
+
+		t.Run("Scopes all operations to the tenant of the context", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithTenancy(), WithSoftDelete(), WithHistory(), WithSearch())
+			defer tearDown()
+
+			_, err := s.Add(tenantA, admin, id, fixture)
+			require.NoError(t, err)
+			_, err = s.AddMany(tenantB, admin, []Stored[content]{{ID: "other", Content: fixture}}, AllOrNothing)
+			require.NoError(t, err)
+
+			fetched, err := s.Get(tenantA, id)
+			require.NoError(t, err)
+			assert.Equal(t, fixture, fetched.Content)
+			_, err = s.Get(tenantB, id)
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = s.Patch(tenantB, admin, id, map[string]any{"i": 6})
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, s.Delete(tenantB, admin, id), ErrNotFound)
+
+			listed, err := s.List(tenantA)
+			require.NoError(t, err)
+			require.Len(t, listed, 1)
+			assert.Equal(t, id, listed[0].ID)
+			count, err := s.Count(tenantB)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), count)
+			found, err := s.Search(tenantB, "some", 0)
+			require.NoError(t, err)
+			require.Len(t, found, 1)
+			assert.Equal(t, "other", found[0].ID)
+
+			revisions, err := s.History(tenantA, id)
+			require.NoError(t, err)
+			assert.Len(t, revisions, 1)
+			revisions, err = s.History(tenantB, id)
+			require.NoError(t, err)
+			assert.Empty(t, revisions)
+		})
+
+		t.Run("Fails when an id is used by another tenant", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithTenancy())
+			defer tearDown()
+
+			_, err := s.Add(tenantA, admin, id, fixture)
+			require.NoError(t, err)
+			_, err = s.Add(tenantB, admin, id, fixture)
+			assert.ErrorIs(t, err, ErrAlreadyExists)
+			_, err = s.Upsert(tenantB, admin, id, fixture)
+			assert.ErrorIs(t, err, ErrAlreadyExists)
+
+			fetched, err := s.Get(tenantA, id)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), fetched.Version)
+		})
+
+		t.Run("Fails without a tenant", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithTenancy())
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, id, fixture)
+			assert.ErrorIs(t, err, ErrTenantRequired)
+			_, err = s.Get(ctx, id)
+			assert.ErrorIs(t, err, ErrTenantRequired)
+			_, err = s.List(ctx)
+			assert.ErrorIs(t, err, ErrTenantRequired)
+		})
+
+		t.Run("Watches the changes of the tenant or of all tenants", func(t *testing.T) {
+			if newListener == nil {
+				t.Skip("the DB has no listener")
+			}
+			tearDown, s := prepareMockDB(t, WithTenancy(), WithListener(newListener(t)))
+			defer tearDown()
+
+			watchCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			changes, err := s.Watch(ForTenant(watchCtx, "a"))
+			require.NoError(t, err)
+			all, err := s.Watch(AllTenants(watchCtx))
+			require.NoError(t, err)
+			_, err = s.Watch(AllTenants(watchCtx), Condition{Attribute: "b", Op: EqualOperator, Value: true})
+			assert.ErrorIs(t, err, ErrInvalidCondition)
+
+			_, err = s.Add(tenantB, admin, "other", fixture)
+			require.NoError(t, err)
+			_, err = s.Add(tenantA, admin, id, fixture)
+			require.NoError(t, err)
+
+			c := receive(t, changes)
+			assert.Equal(t, id, c.ID)
+			assert.Equal(t, fixture, c.Item.Content)
+
+			c = receive(t, all)
+			assert.Equal(t, "other", c.ID)
+			assert.Nil(t, c.Item)
+			c = receive(t, all)
+			assert.Equal(t, id, c.ID)
+		})
+	})
+	t.Run("Expiry", func(t *testing.T) {
+		now := time.Now()
+		expired := ExpireAt(now.Add(-time.Hour))
+		expiring := ExpireAt(now.Add(time.Hour))
+
+		t.Run("Treats expired items as missing", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithExpiry())
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, "expired", fixture, expired)
+			require.NoError(t, err)
+			added, err := s.Add(ctx, admin, "expiring", fixture, expiring)
+			require.NoError(t, err)
+			require.NotNil(t, added.ExpiresAt)
+			_, err = s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+
+			_, err = s.Get(ctx, "expired")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = s.Patch(ctx, admin, "expired", map[string]any{"i": 6})
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, s.Delete(ctx, admin, "expired"), ErrNotFound)
+
+			fetched, err := s.Get(ctx, "expiring")
+			require.NoError(t, err)
+			require.NotNil(t, fetched.ExpiresAt)
+			assert.True(t, added.ExpiresAt.Equal(*fetched.ExpiresAt))
+			fetched, err = s.Get(ctx, id)
+			require.NoError(t, err)
+			assert.Nil(t, fetched.ExpiresAt)
+
+			listed, err := s.List(ctx)
+			require.NoError(t, err)
+			assert.Len(t, listed, 2)
+			count, err := s.Count(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), count)
+		})
+
+		t.Run("Sets and clears the expiry on writes", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithExpiry())
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, id, fixture, expiring)
+			require.NoError(t, err)
+			patched, err := s.Patch(ctx, admin, id, map[string]any{"i": 6})
+			require.NoError(t, err)
+			assert.NotNil(t, patched.ExpiresAt)
+			patched, err = s.Patch(ctx, admin, id, map[string]any{"i": 7}, ExpireAt(time.Time{}))
+			require.NoError(t, err)
+			assert.Nil(t, patched.ExpiresAt)
+			fetched, err := s.Get(ctx, id)
+			require.NoError(t, err)
+			assert.Nil(t, fetched.ExpiresAt)
+
+			_, err = s.Upsert(ctx, admin, id, fixture, expired)
+			require.NoError(t, err)
+			_, err = s.Get(ctx, id)
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+
+		t.Run("Adds items over expired ones", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithExpiry())
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, id, fixture, expired)
+			require.NoError(t, err)
+			_, err = s.AddMany(ctx, admin, []Stored[content]{{ID: "other", Content: fixture}}, AllOrNothing, expired)
+			require.NoError(t, err)
+
+			added, err := s.Add(ctx, admin, id, fixture)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), added.Version)
+			results, err := s.AddMany(ctx, admin, []Stored[content]{{ID: "other", Content: fixture}}, AllOrNothing)
+			require.NoError(t, err)
+			assert.Nil(t, results[0].Item.ExpiresAt)
+			listed, err := s.List(ctx)
+			require.NoError(t, err)
+			assert.Len(t, listed, 2)
+		})
+
+		t.Run("Reaps the expired items of all tenants in batches", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t, WithExpiry(), WithTenancy())
+			defer tearDown()
+
+			for i, tenant := range []string{"a", "b", "a"} {
+				_, err := s.Add(ForTenant(ctx, tenant), admin, fmt.Sprint("expired", i), fixture, expired)
+				require.NoError(t, err)
+			}
+			_, err := s.Add(ForTenant(ctx, "a"), admin, id, fixture, expiring)
+			require.NoError(t, err)
+
+			reaped, err := s.(Reapable).Reap(ctx, 2)
+			require.NoError(t, err)
+			assert.Equal(t, 2, reaped)
+			reaped, err = s.(Reapable).Reap(ctx, 2)
+			require.NoError(t, err)
+			assert.Equal(t, 1, reaped)
+			reaped, err = s.(Reapable).Reap(ctx, 2)
+			require.NoError(t, err)
+			assert.Equal(t, 0, reaped)
+
+			_, err = s.Get(ForTenant(ctx, "a"), id)
+			assert.NoError(t, err)
+		})
+
+		t.Run("Fails when expiry is disabled", func(t *testing.T) {
+			tearDown, s := prepareMockDB(t)
+			defer tearDown()
+
+			_, err := s.Add(ctx, admin, id, fixture, expiring)
+			assert.ErrorIs(t, err, ErrExpiryDisabled)
+			_, err = s.(Reapable).Reap(ctx, 1)
+			assert.ErrorIs(t, err, ErrExpiryDisabled)
+		})
 	})
 }
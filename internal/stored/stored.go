@@ -1,7 +1,12 @@
 // Package stored provides the ability to store arbitrary content as JSON in a JSON-capable SQL store (like Postgres)
 package stored
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
 
 // Stored struct represents a stored item that has a specific type of content.
 // All stored items use a string to identify them. These IDs may or may not
@@ -15,19 +20,73 @@ import "time"
 // created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 // modified_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 // created_by VARCHAR(50) NOT NULL CHECK(length(created_by) > 0),
-// modified_by VARCHAR(50) NOT NULL CHECK(length(modified_by) > 0)'
+// modified_by VARCHAR(50) NOT NULL CHECK(length(modified_by) > 0),
+// version BIGINT NOT NULL DEFAULT 1
 // );
 //
 // Additionally, you must add an index on the content to ensure that querying for
 // content is efficient:
 // CREATE INDEX <stored_named>_content_idx ON app USING GIN(content jsonb_path_ops);
 //
+// Stores in soft-delete mode (see WithSoftDelete) additionally require the following columns:
+//
+// deleted_at TIMESTAMP NULL,
+// deleted_by VARCHAR(50) NULL CHECK(length(deleted_by) > 0)
+//
+// Stores that keep history (see WithHistory) additionally require a companion table:
+//
+// CREATE TABLE <stored_name>_history (
+// revision BIGSERIAL PRIMARY KEY,
+// id VARCHAR(36) NOT NULL,
+// version BIGINT NOT NULL,
+// operation VARCHAR(10) NOT NULL,
+// content JSONB NOT NULL,
+// diff JSONB NOT NULL,
+// actor VARCHAR(50) NOT NULL CHECK(length(actor) > 0),
+// at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+// );
+// CREATE INDEX <stored_name>_history_id_idx ON <stored_name>_history(id, revision);
+//
+// Stores that can be watched (see WithListener) additionally require a trigger that calls the stored_notify function
+// created by the migrations:
+//
+// CREATE TRIGGER <stored_name>_notify AFTER INSERT OR UPDATE OR DELETE ON <stored_name>
+// FOR EACH ROW EXECUTE PROCEDURE stored_notify();
+//
+// Searchable stores (see WithSearch) additionally require a generated text search column over the searchable
+// attributes and an index on it:
+//
+// search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple',
+// coalesce(content->>'<attribute1>', ' ') || ' ' || coalesce(content->>'<attribute2>', ' '))) STORED
+// CREATE INDEX <stored_name>_search_idx ON <stored_name> USING GIN(search_vector);
+//
+// Multi-tenant stores (see WithTenancy) additionally require a tenant column in the table and its history table, and
+// row-level security policies that check the stored.tenant setting:
+//
+// tenant VARCHAR(50) NOT NULL CHECK(length(tenant) > 0)
+// ALTER TABLE <stored_name> ENABLE ROW LEVEL SECURITY;
+// ALTER TABLE <stored_name> FORCE ROW LEVEL SECURITY;
+// CREATE POLICY <stored_name>_tenant ON <stored_name> USING (tenant = current_setting('stored.tenant', true))
+// WITH CHECK (tenant = current_setting('stored.tenant', true));
+//
+// Stores that expire items (see WithExpiry) additionally require an expiry column, indexed for reaping. Multi-tenant
+// stores also require a policy that lets reaping see the expired items of all tenants:
+//
+// expires_at TIMESTAMP NULL
+// CREATE INDEX <stored_name>_expires_at_idx ON <stored_name>(expires_at) WHERE expires_at IS NOT NULL;
+// CREATE POLICY <stored_name>_reap ON <stored_name> USING (current_setting('stored.reap', true) = 'on'
+// AND expires_at <= CURRENT_TIMESTAMP);
+//
+// The migrations of a new table with this schema are generated by the 'stored scaffold' command, and the columns,
+// indexes, triggers and row-level security of the tables of registered stores are checked at startup (see Registry).
+//
 // You can potentially add constraints and unique indexes on the content if needed.
 // The Content Struct the fields of the type of the content must be exported and have
 // JSON tags associated with them.
 // The table that you use can be partitioned if you wish and you can use the content
 // JSON values attributes to control how your data is partitioned across.
-// It is best to avoid nested structures and keep your content struct flat.
+// Nested structures can be addressed in conditions, sorts and patches using dotted paths (a.b.c) or JSON pointers
+// (/a/b/c). Yet, values are best kept close to the top-level since only the whole content is indexed.
 type Stored[T any] struct {
 
 	// ID The unique ID of the storable object
@@ -45,10 +104,48 @@ type Stored[T any] struct {
 	// ModifiedBy the identification of the user who last modified this stored item
 	ModifiedBy string `json:"modifiedBy,omitempty" binding:"isdefault"`
 
+	// Version a number that starts at 1 and is incremented every time the stored item is modified
+	Version int64 `json:"version,omitempty" binding:"isdefault"`
+
+	// DeletedAt the time at which the stored item was soft-deleted. Only set for soft-deleted items.
+	DeletedAt *time.Time `json:"deletedAt,omitempty" binding:"isdefault"`
+
+	// DeletedBy the identification of the user who soft-deleted this stored item. Only set for soft-deleted items.
+	DeletedBy string `json:"deletedBy,omitempty" binding:"isdefault"`
+
+	// ExpiresAt the time from which the stored item is treated as missing. Only set for items of stores that expire
+	// items (see WithExpiry) that were written with an expiry.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" binding:"isdefault"`
+
 	// The content of the storable
 	Content T `json:"content"`
 }
 
+// Column identifies one of the columns that every stored table has
+type Column string
+
+// The columns that every stored table has
+const (
+	IDColumn         Column = "id"
+	CreatedAtColumn  Column = "created_at"
+	CreatedByColumn  Column = "created_by"
+	ModifiedAtColumn Column = "modified_at"
+	ModifiedByColumn Column = "modified_by"
+)
+
+func (c Column) valid() bool {
+	switch c {
+	case IDColumn, CreatedAtColumn, CreatedByColumn, ModifiedAtColumn, ModifiedByColumn:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c Column) isTime() bool {
+	return c == CreatedAtColumn || c == ModifiedAtColumn
+}
+
 // Operator Defines an operator that is used for creating conditions
 type Operator string
 
@@ -60,11 +157,168 @@ const (
 	LessThanOperator          Operator = "<"
 	GreaterThanOrEqualOpertor Operator = ">="
 	LessThanOrEqualOperator   Operator = "<="
+
+	// InOperator matches attributes equal to any of the values in a slice, as if they were compared using
+	// EqualOperator. Missing attributes match neither InOperator nor NotInOperator.
+	InOperator Operator = "IN"
+	// NotInOperator matches attributes not equal to any of the values in a slice, as if they were compared using
+	// NotEqualOperator
+	NotInOperator Operator = "NOT IN"
+	// ContainsOperator matches attributes that contain the value as per JSON containment. For example, an array
+	// attribute contains an array value if all elements of the value are in the attribute.
+	ContainsOperator Operator = "@>"
+	// ExistsOperator matches if the attribute exists, even if it is null. The value must be nil.
+	ExistsOperator Operator = "?"
+	// IsNullOperator matches if the attribute is missing or null. The value must be nil.
+	IsNullOperator Operator = "IS NULL"
+	// IsNotNullOperator matches if the attribute exists and is not null. The value must be nil.
+	IsNotNullOperator Operator = "IS NOT NULL"
+	// LikeOperator matches the text of the attribute against a SQL LIKE pattern string value
+	LikeOperator Operator = "LIKE"
+	// ILikeOperator matches the text of the attribute against a case-insensitive SQL LIKE pattern string value
+	ILikeOperator Operator = "ILIKE"
+	// BetweenOperator matches attributes between (inclusive) the two values of a slice
+	BetweenOperator Operator = "BETWEEN"
+
+	// AndOperator matches if all the conditions in its []Condition value match. Use And to create it.
+	AndOperator Operator = "AND"
+	// OrOperator matches if any of the conditions in its []Condition value match. Use Or to create it.
+	OrOperator Operator = "OR"
+	// NotOperator matches if the Condition in its value doesn't match. Use Not to create it.
+	NotOperator Operator = "NOT"
 )
 
 // Condition models a condition on an attribute. These conditions can then be passed to Store operations like List to control the result returns.
+// The Attribute can be a top-level attribute name, a dotted path (a.b.c) or a JSON pointer (/a/b/c) to a nested attribute.
+// Alternatively, a condition can be on one of the Columns that every stored table has instead of an Attribute.
+// Conditions can be combined using And, Or and Not.
 type Condition struct {
 	Attribute string
+	Column    Column
 	Op        Operator
 	Value     any
 }
+
+// applyRead makes conditions read options, which make reads only return the items that fill them
+func (c Condition) applyRead(o *readOptions) {
+	o.conds = append(o.conds, c)
+}
+
+// And creates a condition that matches if all the passed conditions match
+func And(conds ...Condition) Condition {
+	return Condition{Op: AndOperator, Value: conds}
+}
+
+// Or creates a condition that matches if any of the passed conditions match
+func Or(conds ...Condition) Condition {
+	return Condition{Op: OrOperator, Value: conds}
+}
+
+// Not creates a condition that matches if the passed condition doesn't match
+func Not(cond Condition) Condition {
+	return Condition{Op: NotOperator, Value: cond}
+}
+
+// conditionJSON the JSON representation of a Condition
+type conditionJSON struct {
+	Attribute string      `json:"attribute"`
+	Column    Column      `json:"column"`
+	Op        Operator    `json:"op"`
+	Value     any         `json:"value"`
+	And       []Condition `json:"and"`
+	Or        []Condition `json:"or"`
+	Not       *Condition  `json:"not"`
+}
+
+// UnmarshalJSON reads a condition from JSON. A condition on an attribute or a column is represented as
+// {"attribute": "a", "op": "=", "value": 1} or {"column": "created_by", "op": "=", "value": "x"} while combined
+// conditions are represented as {"and": [...]}, {"or": [...]} or {"not": {...}}.
+func (c *Condition) UnmarshalJSON(data []byte) error {
+	j := conditionJSON{}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	switch {
+	case j.And != nil:
+		*c = And(j.And...)
+	case j.Or != nil:
+		*c = Or(j.Or...)
+	case j.Not != nil:
+		*c = Not(*j.Not)
+	default:
+		*c = Condition{Attribute: j.Attribute, Column: j.Column, Op: j.Op, Value: j.Value}
+	}
+	return c.validate()
+}
+
+// validate checks that the value of the condition fits its operator
+func (c Condition) validate() error {
+	switch c.Op {
+	case AndOperator, OrOperator:
+		if conds, ok := c.Value.([]Condition); !ok || len(conds) == 0 {
+			return fmt.Errorf("%w: %v requires a non-empty []Condition value", ErrInvalidCondition, c.Op)
+		}
+		return nil
+	case NotOperator:
+		if _, ok := c.Value.(Condition); !ok {
+			return fmt.Errorf("%w: %v requires a Condition value", ErrInvalidCondition, c.Op)
+		}
+		return nil
+	}
+
+	if c.Column != "" {
+		if c.Attribute != "" {
+			return fmt.Errorf("%w: either a column or an attribute can be set", ErrInvalidCondition)
+		}
+		if !c.Column.valid() {
+			return fmt.Errorf("%w: unknown column '%v'", ErrInvalidCondition, c.Column)
+		}
+		switch c.Op {
+		case ContainsOperator, ExistsOperator, IsNullOperator, IsNotNullOperator:
+			return fmt.Errorf("%w: %v is not supported on columns", ErrInvalidCondition, c.Op)
+		}
+	}
+
+	switch c.Op {
+	case EqualOperator, NotEqualOperator, GreaterThanOperator, LessThanOperator, GreaterThanOrEqualOpertor, LessThanOrEqualOperator, ContainsOperator:
+		return nil
+	case InOperator, NotInOperator:
+		if n, ok := sliceLen(c.Value); !ok || n == 0 {
+			return fmt.Errorf("%w: %v requires a non-empty slice value", ErrInvalidCondition, c.Op)
+		}
+	case BetweenOperator:
+		if n, ok := sliceLen(c.Value); !ok || n != 2 {
+			return fmt.Errorf("%w: %v requires a slice value of 2 elements", ErrInvalidCondition, c.Op)
+		}
+	case ExistsOperator, IsNullOperator, IsNotNullOperator:
+		if c.Value != nil {
+			return fmt.Errorf("%w: %v doesn't accept a value", ErrInvalidCondition, c.Op)
+		}
+	case LikeOperator, ILikeOperator:
+		if _, ok := c.Value.(string); !ok {
+			return fmt.Errorf("%w: %v requires a string pattern value", ErrInvalidCondition, c.Op)
+		}
+	default:
+		return fmt.Errorf("%w: unknown operator '%v'", ErrInvalidCondition, c.Op)
+	}
+	return nil
+}
+
+// sliceValues returns the elements of a slice or an array value
+func sliceValues(value any) []any {
+	v := reflect.ValueOf(value)
+	result := make([]any, v.Len())
+	for i := range result {
+		result[i] = v.Index(i).Interface()
+	}
+	return result
+}
+
+func sliceLen(value any) (int, bool) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return 0, false
+	}
+	return v.Len(), true
+}
@@ -0,0 +1,88 @@
+package stored
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		cond  Condition
+		valid bool
+	}{
+		{"comparison", Condition{Attribute: "a", Op: GreaterThanOperator, Value: 1}, true},
+		{"in slice", Condition{Attribute: "a", Op: InOperator, Value: []int{1, 2}}, true},
+		{"in array", Condition{Attribute: "a", Op: InOperator, Value: [2]string{"a", "b"}}, true},
+		{"in empty slice", Condition{Attribute: "a", Op: InOperator, Value: []int{}}, false},
+		{"in non-slice", Condition{Attribute: "a", Op: InOperator, Value: 1}, false},
+		{"not in slice", Condition{Attribute: "a", Op: NotInOperator, Value: []any{1, "a"}}, true},
+		{"not in non-slice", Condition{Attribute: "a", Op: NotInOperator, Value: "a"}, false},
+		{"contains", Condition{Attribute: "a", Op: ContainsOperator, Value: []string{"x"}}, true},
+		{"exists", Condition{Attribute: "a", Op: ExistsOperator}, true},
+		{"exists with value", Condition{Attribute: "a", Op: ExistsOperator, Value: 1}, false},
+		{"is null", Condition{Attribute: "a", Op: IsNullOperator}, true},
+		{"is null with value", Condition{Attribute: "a", Op: IsNullOperator, Value: false}, false},
+		{"is not null", Condition{Attribute: "a", Op: IsNotNullOperator}, true},
+		{"like", Condition{Attribute: "a", Op: LikeOperator, Value: "a%"}, true},
+		{"like non-string", Condition{Attribute: "a", Op: LikeOperator, Value: 1}, false},
+		{"ilike", Condition{Attribute: "a", Op: ILikeOperator, Value: "A%"}, true},
+		{"between", Condition{Attribute: "a", Op: BetweenOperator, Value: []int{1, 2}}, true},
+		{"between single value", Condition{Attribute: "a", Op: BetweenOperator, Value: []int{1}}, false},
+		{"unknown operator", Condition{Attribute: "a", Op: "; DROP TABLE app", Value: 1}, false},
+		{"column", Condition{Column: CreatedByColumn, Op: EqualOperator, Value: "a"}, true},
+		{"column in", Condition{Column: IDColumn, Op: InOperator, Value: []string{"a"}}, true},
+		{"unknown column", Condition{Column: "content", Op: EqualOperator, Value: "a"}, false},
+		{"column and attribute", Condition{Column: IDColumn, Attribute: "a", Op: EqualOperator, Value: "a"}, false},
+		{"column contains", Condition{Column: IDColumn, Op: ContainsOperator, Value: "a"}, false},
+		{"and", And(Condition{Attribute: "a", Op: EqualOperator, Value: 1}), true},
+		{"empty and", And(), false},
+		{"or", Or(Condition{Attribute: "a", Op: EqualOperator, Value: 1}), true},
+		{"or with non-condition value", Condition{Op: OrOperator, Value: []int{1}}, false},
+		{"not", Not(Condition{Attribute: "a", Op: EqualOperator, Value: 1}), true},
+		{"not with non-condition value", Condition{Op: NotOperator, Value: 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cond.validate()
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidCondition)
+			}
+		})
+	}
+}
+
+func TestConditionUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		json     string
+		expected Condition
+	}{
+		{"attribute", `{"attribute": "a", "op": "=", "value": 1}`, Condition{Attribute: "a", Op: EqualOperator, Value: float64(1)}},
+		{"column", `{"column": "created_by", "op": "=", "value": "x"}`, Condition{Column: CreatedByColumn, Op: EqualOperator, Value: "x"}},
+		{"no value", `{"attribute": "a", "op": "IS NULL"}`, Condition{Attribute: "a", Op: IsNullOperator}},
+		{"and", `{"and": [{"attribute": "a", "op": "=", "value": 1}]}`, And(Condition{Attribute: "a", Op: EqualOperator, Value: float64(1)})},
+		{"or", `{"or": [{"attribute": "a", "op": "=", "value": 1}, {"not": {"attribute": "b", "op": "?"}}]}`, Or(
+			Condition{Attribute: "a", Op: EqualOperator, Value: float64(1)},
+			Not(Condition{Attribute: "b", Op: ExistsOperator}),
+		)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Condition{}
+			require.NoError(t, json.Unmarshal([]byte(tt.json), &c))
+			assert.Equal(t, tt.expected, c)
+		})
+	}
+
+	t.Run("Fails on invalid conditions", func(t *testing.T) {
+		c := Condition{}
+		err := json.Unmarshal([]byte(`{"or": [{"attribute": "a", "op": "IN", "value": 1}]}`), &c)
+		assert.ErrorIs(t, err, ErrInvalidCondition)
+	})
+}
@@ -0,0 +1,86 @@
+package stored
+
+import (
+	"context"
+	"fmt"
+
+	internalDB "alielgamal.com/myservice/internal/db"
+)
+
+const (
+	tenantColumn = "tenant"
+
+	// tenantSetting the Postgres setting that holds the tenant of a transaction, which row-level security policies
+	// check using current_setting('stored.tenant', true)
+	tenantSetting = "stored.tenant"
+)
+
+type tenantKey struct{}
+
+// ForTenant returns a context that scopes the operations of multi-tenant stores (see WithTenancy) to a tenant. Mark
+// the context of every request using the tenant of the authenticated user.
+func ForTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+func tenantOf(ctx context.Context) (string, bool) {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant, tenant != ""
+}
+
+type allTenantsKey struct{}
+
+// AllTenants returns a context that makes Watch deliver the changes of all the tenants of multi-tenant stores, for
+// background workers that don't act for a tenant. The changes have no Item, conditions can't be passed and the channel
+// is closed whenever changes may have been missed instead of catching them up. All other operations still require
+// a tenant.
+func AllTenants(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allTenantsKey{}, true)
+}
+
+func allTenants(ctx context.Context) bool {
+	all, _ := ctx.Value(allTenantsKey{}).(bool)
+	return all
+}
+
+// tenant returns the tenant that the operations of the context are scoped to, which is empty if the store is not
+// multi-tenant
+func (s sqlStore[T]) tenant(ctx context.Context) (string, error) {
+	if !s.tenancy {
+		return "", nil
+	}
+	tenant, ok := tenantOf(ctx)
+	if !ok {
+		return "", ErrTenantRequired
+	}
+	return tenant, nil
+}
+
+// read runs the reads of f. Reads of multi-tenant stores run in a transaction that is scoped to the tenant of the
+// context.
+func (s sqlStore[T]) read(ctx context.Context, f func(q internalDB.Querier) error) error {
+	if !s.tenancy {
+		return storeError(f(s.db))
+	}
+	return s.inTx(ctx, func(tx internalDB.Tx) error {
+		return f(tx)
+	})
+}
+
+// tenantScope returns the condition that scopes the statements of a multi-tenant store to the tenant of the
+// transaction, which is empty if the store is not multi-tenant
+func tenantScope(d dialect, tenancy bool) string {
+	if !tenancy {
+		return ""
+	}
+	return fmt.Sprintf(" AND %v = %v", tenantColumn, d.tenant())
+}
+
+// tenantInsert returns the column and the value that inserts into a multi-tenant store add, which are empty if the
+// store is not multi-tenant
+func tenantInsert(d dialect, tenancy bool) (string, string) {
+	if !tenancy {
+		return "", ""
+	}
+	return ", " + tenantColumn, ", " + d.tenant()
+}
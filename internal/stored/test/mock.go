@@ -3,6 +3,7 @@ package test
 
 import (
 	"context"
+	"iter"
 
 	"github.com/stretchr/testify/mock"
 
@@ -15,31 +16,187 @@ type Store[T any] struct {
 }
 
 // Add a new Stored item with a specific id and content
-func (m *Store[T]) Add(ctx context.Context, creator string, id string, content T) (*stored.Stored[T], error) {
-	args := m.Called(ctx, creator, id, content)
+func (m *Store[T]) Add(ctx context.Context, creator string, id string, content T, opts ...stored.WriteOption) (*stored.Stored[T], error) {
+	allArgs := []any{ctx, creator, id, content}
+	for _, o := range opts {
+		allArgs = append(allArgs, o)
+	}
+	args := m.Called(allArgs...)
+	return args.Get(0).(*stored.Stored[T]), args.Error(1)
+}
+
+// Patch Updates attributes in the content. Return the errors of the stored package (like stored.ErrNotFound) to mock
+// failures the same way the store reports them.
+func (m *Store[T]) Patch(ctx context.Context, updater string, id string, attributes map[string]any, opts ...stored.WriteOption) (*stored.Stored[T], error) {
+	allArgs := []any{ctx, updater, id, attributes}
+	for _, o := range opts {
+		allArgs = append(allArgs, o)
+	}
+	args := m.Called(allArgs...)
+	return args.Get(0).(*stored.Stored[T]), args.Error(1)
+}
+
+// PatchVersion behaves like Patch but only applies the patch if the stored item is still at the passed version.
+func (m *Store[T]) PatchVersion(ctx context.Context, updater string, id string, version int64, attributes map[string]any, opts ...stored.WriteOption) (*stored.Stored[T], error) {
+	allArgs := []any{ctx, updater, id, version, attributes}
+	for _, o := range opts {
+		allArgs = append(allArgs, o)
+	}
+	args := m.Called(allArgs...)
+	return args.Get(0).(*stored.Stored[T]), args.Error(1)
+}
+
+// AddMany adds multiple stored items in a single transaction
+func (m *Store[T]) AddMany(ctx context.Context, creator string, items []stored.Stored[T], mode stored.BatchMode, opts ...stored.WriteOption) ([]stored.BatchResult[T], error) {
+	allArgs := []any{ctx, creator, items, mode}
+	for _, o := range opts {
+		allArgs = append(allArgs, o)
+	}
+	args := m.Called(allArgs...)
+	return args.Get(0).([]stored.BatchResult[T]), args.Error(1)
+}
+
+// PatchMany applies multiple patches in a single transaction
+func (m *Store[T]) PatchMany(ctx context.Context, updater string, patches []stored.ItemPatch, mode stored.BatchMode, opts ...stored.WriteOption) ([]stored.BatchResult[T], error) {
+	allArgs := []any{ctx, updater, patches, mode}
+	for _, o := range opts {
+		allArgs = append(allArgs, o)
+	}
+	args := m.Called(allArgs...)
+	return args.Get(0).([]stored.BatchResult[T]), args.Error(1)
+}
+
+// Put replaces the whole content of a stored item
+func (m *Store[T]) Put(ctx context.Context, updater string, id string, content T, opts ...stored.WriteOption) (*stored.Stored[T], error) {
+	allArgs := []any{ctx, updater, id, content}
+	for _, o := range opts {
+		allArgs = append(allArgs, o)
+	}
+	args := m.Called(allArgs...)
 	return args.Get(0).(*stored.Stored[T]), args.Error(1)
 }
 
-// Patch Updates a single attribute in the content. This method doesn't check the attribute existence but guarantees
-// that content stored is still a valid. If it is not, the patch operation will fail without impacting storage.
-func (m *Store[T]) Patch(ctx context.Context, updater string, id string, attributes map[string]any) (*stored.Stored[T], error) {
-	args := m.Called(ctx, updater, id, attributes)
+// PutVersion replaces the whole content of a stored item if it is still at the passed version
+func (m *Store[T]) PutVersion(ctx context.Context, updater string, id string, version int64, content T, opts ...stored.WriteOption) (*stored.Stored[T], error) {
+	allArgs := []any{ctx, updater, id, version, content}
+	for _, o := range opts {
+		allArgs = append(allArgs, o)
+	}
+	args := m.Called(allArgs...)
+	return args.Get(0).(*stored.Stored[T]), args.Error(1)
+}
+
+// Search returns up to limit items that fill all conditions and match the query, the best matches first
+func (m *Store[T]) Search(ctx context.Context, query string, limit int, opts ...stored.ReadOption) ([]stored.Stored[T], error) {
+	allArgs := []any{ctx, query, limit}
+	for _, o := range opts {
+		allArgs = append(allArgs, o)
+	}
+	args := m.Called(allArgs...)
+	return args.Get(0).([]stored.Stored[T]), args.Error(1)
+}
+
+// Count returns the number of items that fill all conditions
+func (m *Store[T]) Count(ctx context.Context, opts ...stored.ReadOption) (int64, error) {
+	allArgs := []any{ctx}
+	for _, o := range opts {
+		allArgs = append(allArgs, o)
+	}
+	args := m.Called(allArgs...)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// Aggregate groups the items that fill all conditions and computes the function of the aggregation for every group
+func (m *Store[T]) Aggregate(ctx context.Context, agg stored.Aggregation, opts ...stored.ReadOption) ([]stored.Group, error) {
+	allArgs := []any{ctx, agg}
+	for _, o := range opts {
+		allArgs = append(allArgs, o)
+	}
+	args := m.Called(allArgs...)
+	return args.Get(0).([]stored.Group), args.Error(1)
+}
+
+// Upsert adds a stored item or replaces its whole content if it already exists
+func (m *Store[T]) Upsert(ctx context.Context, actor string, id string, content T, opts ...stored.WriteOption) (*stored.Stored[T], error) {
+	allArgs := []any{ctx, actor, id, content}
+	for _, o := range opts {
+		allArgs = append(allArgs, o)
+	}
+	args := m.Called(allArgs...)
 	return args.Get(0).(*stored.Stored[T]), args.Error(1)
 }
 
 // Get finds a storable by its id
-func (m *Store[T]) Get(ctx context.Context, id string) (*stored.Stored[T], error) {
-	args := m.Called(ctx, id)
+func (m *Store[T]) Get(ctx context.Context, id string, opts ...stored.ReadOption) (*stored.Stored[T], error) {
+	allArgs := []any{ctx, id}
+	for _, o := range opts {
+		allArgs = append(allArgs, o)
+	}
+	args := m.Called(allArgs...)
 	return args.Get(0).(*stored.Stored[T]), args.Error(1)
 }
 
 // List returns all items that fill certain all conditions (AND operator between the conditions).
 // if no conditions are passed, all stored items are returned.
-func (m *Store[T]) List(ctx context.Context, conds ...stored.Condition) ([]stored.Stored[T], error) {
+func (m *Store[T]) List(ctx context.Context, opts ...stored.ReadOption) ([]stored.Stored[T], error) {
+	allArgs := []any{ctx}
+	for _, o := range opts {
+		allArgs = append(allArgs, o)
+	}
+	args := m.Called(allArgs...)
+	return args.Get(0).([]stored.Stored[T]), args.Error(1)
+}
+
+// Iter streams the items that fill all conditions (AND operator between the conditions) one by one
+func (m *Store[T]) Iter(ctx context.Context, opts ...stored.ReadOption) iter.Seq2[stored.Stored[T], error] {
+	allArgs := []any{ctx}
+	for _, o := range opts {
+		allArgs = append(allArgs, o)
+	}
+	args := m.Called(allArgs...)
+	return args.Get(0).(iter.Seq2[stored.Stored[T], error])
+}
+
+// ListPage returns a single page of the items that fill all conditions (AND operator between the conditions)
+func (m *Store[T]) ListPage(ctx context.Context, page stored.ListOptions, opts ...stored.ReadOption) (*stored.Page[T], error) {
+	allArgs := []any{ctx, page}
+	for _, o := range opts {
+		allArgs = append(allArgs, o)
+	}
+	args := m.Called(allArgs...)
+	return args.Get(0).(*stored.Page[T]), args.Error(1)
+}
+
+// Delete removes a stored item or marks it as deleted if the store is in soft-delete mode
+func (m *Store[T]) Delete(ctx context.Context, deleter string, id string) error {
+	args := m.Called(ctx, deleter, id)
+	return args.Error(0)
+}
+
+// Restore brings back a stored item that was soft-deleted
+func (m *Store[T]) Restore(ctx context.Context, restorer string, id string) (*stored.Stored[T], error) {
+	args := m.Called(ctx, restorer, id)
+	return args.Get(0).(*stored.Stored[T]), args.Error(1)
+}
+
+// History returns all the revisions of a stored item, oldest first
+func (m *Store[T]) History(ctx context.Context, id string) ([]stored.Revision[T], error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).([]stored.Revision[T]), args.Error(1)
+}
+
+// GetAt returns the revision of a stored item at a specific version or time
+func (m *Store[T]) GetAt(ctx context.Context, id string, at stored.At) (*stored.Revision[T], error) {
+	args := m.Called(ctx, id, at)
+	return args.Get(0).(*stored.Revision[T]), args.Error(1)
+}
+
+// Watch delivers the changes of the items that fill all conditions (AND operator between the conditions)
+func (m *Store[T]) Watch(ctx context.Context, conds ...stored.Condition) (<-chan stored.Change[T], error) {
 	allArgs := []any{ctx}
 	for _, c := range conds {
 		allArgs = append(allArgs, c)
 	}
 	args := m.Called(allArgs...)
-	return args.Get(0).([]stored.Stored[T]), args.Error(1)
+	return args.Get(0).(<-chan stored.Change[T]), args.Error(1)
 }
@@ -0,0 +1,230 @@
+package stored
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	internalDB "alielgamal.com/myservice/internal/db"
+)
+
+const (
+	nowStmt                = "SELECT LOCALTIMESTAMP"
+	watchPingInterval      = time.Minute
+	notificationTimeLayout = "2006-01-02T15:04:05.999999"
+)
+
+// Change is a write to a stored item that is delivered by Watch
+type Change[T any] struct {
+	// Operation the kind of write
+	Operation Operation `json:"operation"`
+
+	// ID the id of the stored item
+	ID string `json:"id"`
+
+	// Version the version of the stored item after the write
+	Version int64 `json:"version"`
+
+	// At the time of the write
+	At time.Time `json:"at"`
+
+	// Item the stored item after the write. It is nil for items deleted from stores that are not in soft-delete mode.
+	Item *Stored[T] `json:"item,omitempty"`
+}
+
+// notification is the payload that the stored_notify trigger sends for every write
+type notification struct {
+	Operation Operation `json:"operation"`
+	ID        string    `json:"id"`
+	Version   int64     `json:"version"`
+	At        string    `json:"at"`
+	Tenant    string    `json:"tenant"`
+}
+
+func (s sqlStore[T]) Watch(ctx context.Context, conds ...Condition) (<-chan Change[T], error) {
+	spanCtx, span := tracer.Start(ctx, "store.watch")
+	defer span.End()
+
+	if s.newListener == nil {
+		return nil, ErrWatchDisabled
+	}
+	all := s.tenancy && allTenants(ctx)
+	if all {
+		if len(conds) > 0 {
+			return nil, fmt.Errorf("%w: the changes of all tenants can't be filtered", ErrInvalidCondition)
+		}
+	} else {
+		if _, err := s.tenant(ctx); err != nil {
+			return nil, err
+		}
+		if _, err := s.query(readOptions{conds: conds}); err != nil {
+			return nil, err
+		}
+	}
+
+	listener := s.newListener()
+	if err := listener.Listen(s.table); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	// Missed changes are caught up since this time whenever notifications may have been lost
+	since, resume := watchSince(ctx)
+	if !resume {
+		if err := s.db.QueryRowContext(spanCtx, nowStmt).Scan(&since); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	changes := make(chan Change[T])
+	go s.watch(ctx, listener, since, resume && !all, conds, changes)
+	return changes, nil
+}
+
+// watch delivers the changes notified to the listener until ctx is done or reading the changes fails. If catchUp is
+// set, the changes since the passed time are delivered first.
+func (s sqlStore[T]) watch(ctx context.Context, listener internalDB.Listener, since time.Time, catchUp bool, conds []Condition, changes chan<- Change[T]) {
+	defer close(changes)
+	defer listener.Close()
+
+	ping := time.NewTicker(watchPingInterval)
+	defer ping.Stop()
+
+	send := func(c Change[T]) bool {
+		select {
+		case changes <- c:
+			if c.At.After(since) {
+				since = c.At
+			}
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for {
+		if catchUp {
+			missed, err := s.changesSince(ctx, since, conds)
+			if err != nil {
+				return
+			}
+			for _, c := range missed {
+				if !send(c) {
+					return
+				}
+			}
+			catchUp = false
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ping.C:
+			// A failed ping makes the listener reconnect, so the error doesn't need handling here
+			listener.Ping()
+		case n, ok := <-listener.Notifications():
+			if !ok {
+				return
+			}
+			if n == nil {
+				// The listener has reconnected and notifications may have been lost meanwhile. The changes of all
+				// tenants can't be caught up, so the watcher is told by closing the channel.
+				if s.tenancy && allTenants(ctx) {
+					return
+				}
+				catchUp = true
+				continue
+			}
+			c, matches, err := s.change(ctx, n.Payload, conds)
+			if err != nil {
+				return
+			}
+			if matches && !send(c) {
+				return
+			}
+		}
+	}
+}
+
+// change creates the change of a notification payload. It doesn't match if the stored item doesn't fill the
+// conditions or if it has been written again since, in which case a later notification delivers it.
+func (s sqlStore[T]) change(ctx context.Context, payload string, conds []Condition) (Change[T], bool, error) {
+	n := notification{}
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		return Change[T]{}, false, err
+	}
+	at, err := time.Parse(notificationTimeLayout, n.At)
+	if err != nil {
+		return Change[T]{}, false, err
+	}
+
+	c := Change[T]{Operation: n.Operation, ID: n.ID, Version: n.Version, At: at}
+	if s.tenancy {
+		if allTenants(ctx) {
+			// The items of all tenants can't be read
+			return c, true, nil
+		}
+		if tenant, _ := tenantOf(ctx); n.Tenant != tenant {
+			return Change[T]{}, false, nil
+		}
+	}
+	if n.Operation == DeleteOperation && !s.softDelete {
+		// There is nothing left to match the conditions against
+		return c, true, nil
+	}
+
+	q, err := s.query(readOptions{conds: conds, includeDeleted: true})
+	if err != nil {
+		return Change[T]{}, false, err
+	}
+	q.where(fmt.Sprintf(conditionTemplate, IDColumn, EqualOperator, q.param(n.ID)))
+	items, err := s.list(ctx, q, s.columns)
+	if err != nil {
+		return Change[T]{}, false, err
+	}
+	if len(items) == 0 || items[0].Version > n.Version {
+		return Change[T]{}, false, nil
+	}
+
+	c.Item = &items[0]
+	return c, true, nil
+}
+
+// changesSince returns the latest change of every stored item that fills the conditions and was written since the
+// passed time, oldest first. Items deleted from stores that are not in soft-delete mode cannot be caught up.
+func (s sqlStore[T]) changesSince(ctx context.Context, since time.Time, conds []Condition) ([]Change[T], error) {
+	q, err := s.query(readOptions{conds: conds, includeDeleted: true})
+	if err != nil {
+		return nil, err
+	}
+	sinceParam := q.param(since)
+	if s.softDelete {
+		q.where(fmt.Sprintf("(modified_at >= %v OR deleted_at >= %v)", sinceParam, sinceParam))
+	} else {
+		q.where(fmt.Sprintf("modified_at >= %v", sinceParam))
+	}
+
+	items, err := s.list(ctx, q, s.columns)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Change[T], 0, len(items))
+	for i := range items {
+		c := Change[T]{Operation: PatchOperation, ID: items[i].ID, Version: items[i].Version, At: items[i].ModifiedAt, Item: &items[i]}
+		if items[i].DeletedAt != nil {
+			c.Operation = DeleteOperation
+			c.At = *items[i].DeletedAt
+		} else if items[i].Version == 1 {
+			c.Operation = AddOperation
+		}
+		result = append(result, c)
+	}
+	slices.SortFunc(result, func(a, b Change[T]) int {
+		return a.At.Compare(b.At)
+	})
+	return result, nil
+}
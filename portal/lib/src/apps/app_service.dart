@@ -28,7 +28,7 @@ class AppService {
     }
 
     List<Stored<App>> result = [];
-    for (final obj in json.decode(response.body)) {
+    for (final obj in json.decode(response.body)["items"]) {
       result.add(Stored.fromJSON(App.fromJSON, obj));
     }
 
@@ -33,7 +33,7 @@ void main() {
   group("listApps should", () {
     test('return a list of undeleted apps by default', () async {
       when(mockClient.get(any)).thenAnswer((_) async => http.Response(
-            '[$jsonResponse]',
+            '{"items": [$jsonResponse]}',
             200,
           ));
 
@@ -55,7 +55,7 @@ void main() {
 
     test('return a list of deleted apps if asked', () async {
       when(mockClient.get(any)).thenAnswer((_) async => http.Response(
-            '[$jsonResponse]',
+            '{"items": [$jsonResponse]}',
             200,
           ));
 